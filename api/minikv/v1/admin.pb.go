@@ -0,0 +1,290 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v3.21.12
+// source: api/minikv/v1/admin.proto
+
+package minikvv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Ranges are half-open [start, end); an empty bound is unbounded.
+type CompactRangeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Start         string                 `protobuf:"bytes,1,opt,name=start,proto3" json:"start,omitempty"`
+	End           string                 `protobuf:"bytes,2,opt,name=end,proto3" json:"end,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CompactRangeRequest) Reset() {
+	*x = CompactRangeRequest{}
+	mi := &file_api_minikv_v1_admin_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CompactRangeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CompactRangeRequest) ProtoMessage() {}
+
+func (x *CompactRangeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_minikv_v1_admin_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CompactRangeRequest.ProtoReflect.Descriptor instead.
+func (*CompactRangeRequest) Descriptor() ([]byte, []int) {
+	return file_api_minikv_v1_admin_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *CompactRangeRequest) GetStart() string {
+	if x != nil {
+		return x.Start
+	}
+	return ""
+}
+
+func (x *CompactRangeRequest) GetEnd() string {
+	if x != nil {
+		return x.End
+	}
+	return ""
+}
+
+type CompactRangeResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CompactRangeResponse) Reset() {
+	*x = CompactRangeResponse{}
+	mi := &file_api_minikv_v1_admin_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CompactRangeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CompactRangeResponse) ProtoMessage() {}
+
+func (x *CompactRangeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_api_minikv_v1_admin_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CompactRangeResponse.ProtoReflect.Descriptor instead.
+func (*CompactRangeResponse) Descriptor() ([]byte, []int) {
+	return file_api_minikv_v1_admin_proto_rawDescGZIP(), []int{1}
+}
+
+type ApproximateSizeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Start         string                 `protobuf:"bytes,1,opt,name=start,proto3" json:"start,omitempty"`
+	End           string                 `protobuf:"bytes,2,opt,name=end,proto3" json:"end,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ApproximateSizeRequest) Reset() {
+	*x = ApproximateSizeRequest{}
+	mi := &file_api_minikv_v1_admin_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ApproximateSizeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ApproximateSizeRequest) ProtoMessage() {}
+
+func (x *ApproximateSizeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_minikv_v1_admin_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ApproximateSizeRequest.ProtoReflect.Descriptor instead.
+func (*ApproximateSizeRequest) Descriptor() ([]byte, []int) {
+	return file_api_minikv_v1_admin_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ApproximateSizeRequest) GetStart() string {
+	if x != nil {
+		return x.Start
+	}
+	return ""
+}
+
+func (x *ApproximateSizeRequest) GetEnd() string {
+	if x != nil {
+		return x.End
+	}
+	return ""
+}
+
+type ApproximateSizeResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SizeBytes     int64                  `protobuf:"varint,1,opt,name=size_bytes,json=sizeBytes,proto3" json:"size_bytes,omitempty"`
+	Count         int64                  `protobuf:"varint,2,opt,name=count,proto3" json:"count,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ApproximateSizeResponse) Reset() {
+	*x = ApproximateSizeResponse{}
+	mi := &file_api_minikv_v1_admin_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ApproximateSizeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ApproximateSizeResponse) ProtoMessage() {}
+
+func (x *ApproximateSizeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_api_minikv_v1_admin_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ApproximateSizeResponse.ProtoReflect.Descriptor instead.
+func (*ApproximateSizeResponse) Descriptor() ([]byte, []int) {
+	return file_api_minikv_v1_admin_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ApproximateSizeResponse) GetSizeBytes() int64 {
+	if x != nil {
+		return x.SizeBytes
+	}
+	return 0
+}
+
+func (x *ApproximateSizeResponse) GetCount() int64 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+var File_api_minikv_v1_admin_proto protoreflect.FileDescriptor
+
+const file_api_minikv_v1_admin_proto_rawDesc = "" +
+	"\n" +
+	"\x19api/minikv/v1/admin.proto\x12\tminikv.v1\"=\n" +
+	"\x13CompactRangeRequest\x12\x14\n" +
+	"\x05start\x18\x01 \x01(\tR\x05start\x12\x10\n" +
+	"\x03end\x18\x02 \x01(\tR\x03end\"\x16\n" +
+	"\x14CompactRangeResponse\"@\n" +
+	"\x16ApproximateSizeRequest\x12\x14\n" +
+	"\x05start\x18\x01 \x01(\tR\x05start\x12\x10\n" +
+	"\x03end\x18\x02 \x01(\tR\x03end\"N\n" +
+	"\x17ApproximateSizeResponse\x12\x1d\n" +
+	"\n" +
+	"size_bytes\x18\x01 \x01(\x03R\tsizeBytes\x12\x14\n" +
+	"\x05count\x18\x02 \x01(\x03R\x05count2\xb2\x01\n" +
+	"\x05Admin\x12O\n" +
+	"\fCompactRange\x12\x1e.minikv.v1.CompactRangeRequest\x1a\x1f.minikv.v1.CompactRangeResponse\x12X\n" +
+	"\x0fApproximateSize\x12!.minikv.v1.ApproximateSizeRequest\x1a\".minikv.v1.ApproximateSizeResponseB Z\x1emini-kv/api/minikv/v1;minikvv1b\x06proto3"
+
+var (
+	file_api_minikv_v1_admin_proto_rawDescOnce sync.Once
+	file_api_minikv_v1_admin_proto_rawDescData []byte
+)
+
+func file_api_minikv_v1_admin_proto_rawDescGZIP() []byte {
+	file_api_minikv_v1_admin_proto_rawDescOnce.Do(func() {
+		file_api_minikv_v1_admin_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_api_minikv_v1_admin_proto_rawDesc), len(file_api_minikv_v1_admin_proto_rawDesc)))
+	})
+	return file_api_minikv_v1_admin_proto_rawDescData
+}
+
+var file_api_minikv_v1_admin_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_api_minikv_v1_admin_proto_goTypes = []any{
+	(*CompactRangeRequest)(nil),     // 0: minikv.v1.CompactRangeRequest
+	(*CompactRangeResponse)(nil),    // 1: minikv.v1.CompactRangeResponse
+	(*ApproximateSizeRequest)(nil),  // 2: minikv.v1.ApproximateSizeRequest
+	(*ApproximateSizeResponse)(nil), // 3: minikv.v1.ApproximateSizeResponse
+}
+var file_api_minikv_v1_admin_proto_depIdxs = []int32{
+	0, // 0: minikv.v1.Admin.CompactRange:input_type -> minikv.v1.CompactRangeRequest
+	2, // 1: minikv.v1.Admin.ApproximateSize:input_type -> minikv.v1.ApproximateSizeRequest
+	1, // 2: minikv.v1.Admin.CompactRange:output_type -> minikv.v1.CompactRangeResponse
+	3, // 3: minikv.v1.Admin.ApproximateSize:output_type -> minikv.v1.ApproximateSizeResponse
+	2, // [2:4] is the sub-list for method output_type
+	0, // [0:2] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_api_minikv_v1_admin_proto_init() }
+func file_api_minikv_v1_admin_proto_init() {
+	if File_api_minikv_v1_admin_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_api_minikv_v1_admin_proto_rawDesc), len(file_api_minikv_v1_admin_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   4,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_api_minikv_v1_admin_proto_goTypes,
+		DependencyIndexes: file_api_minikv_v1_admin_proto_depIdxs,
+		MessageInfos:      file_api_minikv_v1_admin_proto_msgTypes,
+	}.Build()
+	File_api_minikv_v1_admin_proto = out.File
+	file_api_minikv_v1_admin_proto_goTypes = nil
+	file_api_minikv_v1_admin_proto_depIdxs = nil
+}
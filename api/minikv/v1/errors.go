@@ -0,0 +1,18 @@
+package minikvv1
+
+// Servers attach a google.rpc.ErrorInfo with this domain to statuses that
+// clients are expected to act on.
+const ErrorDomain = "mini-kv"
+
+// ReasonNotLeader marks an Unavailable status returned by a follower. The
+// request was not executed, so it is safe to send again to the leader, whose
+// node ID is in the LeaderIDMetadataKey metadata entry when known.
+const (
+	ReasonNotLeader     = "NOT_LEADER"
+	LeaderIDMetadataKey = "leader_id"
+)
+
+// ReasonOutcomeUnknown marks an Unavailable status for a write that the node
+// appended to its log before losing leadership. The write may still be
+// applied, so sending it again could apply it twice.
+const ReasonOutcomeUnknown = "OUTCOME_UNKNOWN"
@@ -285,6 +285,86 @@ func (*DeleteResponse) Descriptor() ([]byte, []int) {
 	return file_api_minikv_v1_minikv_proto_rawDescGZIP(), []int{5}
 }
 
+type LeaderRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LeaderRequest) Reset() {
+	*x = LeaderRequest{}
+	mi := &file_api_minikv_v1_minikv_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LeaderRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LeaderRequest) ProtoMessage() {}
+
+func (x *LeaderRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_minikv_v1_minikv_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LeaderRequest.ProtoReflect.Descriptor instead.
+func (*LeaderRequest) Descriptor() ([]byte, []int) {
+	return file_api_minikv_v1_minikv_proto_rawDescGZIP(), []int{6}
+}
+
+type LeaderResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	LeaderId      string                 `protobuf:"bytes,1,opt,name=leader_id,json=leaderId,proto3" json:"leader_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LeaderResponse) Reset() {
+	*x = LeaderResponse{}
+	mi := &file_api_minikv_v1_minikv_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LeaderResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LeaderResponse) ProtoMessage() {}
+
+func (x *LeaderResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_api_minikv_v1_minikv_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LeaderResponse.ProtoReflect.Descriptor instead.
+func (*LeaderResponse) Descriptor() ([]byte, []int) {
+	return file_api_minikv_v1_minikv_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *LeaderResponse) GetLeaderId() string {
+	if x != nil {
+		return x.LeaderId
+	}
+	return ""
+}
+
 var File_api_minikv_v1_minikv_proto protoreflect.FileDescriptor
 
 const file_api_minikv_v1_minikv_proto_rawDesc = "" +
@@ -303,11 +383,15 @@ const file_api_minikv_v1_minikv_proto_rawDesc = "" +
 	"\vSetResponse\"!\n" +
 	"\rDeleteRequest\x12\x10\n" +
 	"\x03key\x18\x01 \x01(\tR\x03key\"\x10\n" +
-	"\x0eDeleteResponse2\xaf\x01\n" +
+	"\x0eDeleteResponse\"\x0f\n" +
+	"\rLeaderRequest\"-\n" +
+	"\x0eLeaderResponse\x12\x1b\n" +
+	"\tleader_id\x18\x01 \x01(\tR\bleaderId2\xee\x01\n" +
 	"\x02KV\x124\n" +
 	"\x03Get\x12\x15.minikv.v1.GetRequest\x1a\x16.minikv.v1.GetResponse\x124\n" +
 	"\x03Set\x12\x15.minikv.v1.SetRequest\x1a\x16.minikv.v1.SetResponse\x12=\n" +
-	"\x06Delete\x12\x18.minikv.v1.DeleteRequest\x1a\x19.minikv.v1.DeleteResponseB Z\x1emini-kv/api/minikv/v1;minikvv1b\x06proto3"
+	"\x06Delete\x12\x18.minikv.v1.DeleteRequest\x1a\x19.minikv.v1.DeleteResponse\x12=\n" +
+	"\x06Leader\x12\x18.minikv.v1.LeaderRequest\x1a\x19.minikv.v1.LeaderResponseB Z\x1emini-kv/api/minikv/v1;minikvv1b\x06proto3"
 
 var (
 	file_api_minikv_v1_minikv_proto_rawDescOnce sync.Once
@@ -321,7 +405,7 @@ func file_api_minikv_v1_minikv_proto_rawDescGZIP() []byte {
 	return file_api_minikv_v1_minikv_proto_rawDescData
 }
 
-var file_api_minikv_v1_minikv_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_api_minikv_v1_minikv_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
 var file_api_minikv_v1_minikv_proto_goTypes = []any{
 	(*GetRequest)(nil),     // 0: minikv.v1.GetRequest
 	(*GetResponse)(nil),    // 1: minikv.v1.GetResponse
@@ -329,16 +413,20 @@ var file_api_minikv_v1_minikv_proto_goTypes = []any{
 	(*SetResponse)(nil),    // 3: minikv.v1.SetResponse
 	(*DeleteRequest)(nil),  // 4: minikv.v1.DeleteRequest
 	(*DeleteResponse)(nil), // 5: minikv.v1.DeleteResponse
+	(*LeaderRequest)(nil),  // 6: minikv.v1.LeaderRequest
+	(*LeaderResponse)(nil), // 7: minikv.v1.LeaderResponse
 }
 var file_api_minikv_v1_minikv_proto_depIdxs = []int32{
 	0, // 0: minikv.v1.KV.Get:input_type -> minikv.v1.GetRequest
 	2, // 1: minikv.v1.KV.Set:input_type -> minikv.v1.SetRequest
 	4, // 2: minikv.v1.KV.Delete:input_type -> minikv.v1.DeleteRequest
-	1, // 3: minikv.v1.KV.Get:output_type -> minikv.v1.GetResponse
-	3, // 4: minikv.v1.KV.Set:output_type -> minikv.v1.SetResponse
-	5, // 5: minikv.v1.KV.Delete:output_type -> minikv.v1.DeleteResponse
-	3, // [3:6] is the sub-list for method output_type
-	0, // [0:3] is the sub-list for method input_type
+	6, // 3: minikv.v1.KV.Leader:input_type -> minikv.v1.LeaderRequest
+	1, // 4: minikv.v1.KV.Get:output_type -> minikv.v1.GetResponse
+	3, // 5: minikv.v1.KV.Set:output_type -> minikv.v1.SetResponse
+	5, // 6: minikv.v1.KV.Delete:output_type -> minikv.v1.DeleteResponse
+	7, // 7: minikv.v1.KV.Leader:output_type -> minikv.v1.LeaderResponse
+	4, // [4:8] is the sub-list for method output_type
+	0, // [0:4] is the sub-list for method input_type
 	0, // [0:0] is the sub-list for extension type_name
 	0, // [0:0] is the sub-list for extension extendee
 	0, // [0:0] is the sub-list for field type_name
@@ -355,7 +443,7 @@ func file_api_minikv_v1_minikv_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_api_minikv_v1_minikv_proto_rawDesc), len(file_api_minikv_v1_minikv_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   6,
+			NumMessages:   8,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -0,0 +1,432 @@
+// Package client is the Go client for mini-kv clusters. It tracks the raft
+// leader across a list of gRPC endpoints and retries calls that are safe to
+// send again.
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	minikvv1 "mini-kv/api/minikv/v1"
+)
+
+// KV is the key-value API shared by Client and Memory, so that code using the
+// client can be tested without a cluster.
+type KV interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte) error
+	Delete(ctx context.Context, key string) error
+	Close() error
+}
+
+var (
+	_ KV = (*Client)(nil)
+	_ KV = (*Memory)(nil)
+)
+
+// Routing decides which endpoint serves a call.
+type Routing string
+
+const (
+	// RoutingLeader sends every call to the tracked leader.
+	RoutingLeader Routing = "leader"
+	// RoutingRoundRobin spreads calls over all endpoints; followers reject
+	// them and the client retries on the next endpoint.
+	RoutingRoundRobin Routing = "round_robin"
+)
+
+type Config struct {
+	Endpoints []string
+	// LeaderEndpoint, when set, is assumed to be the leader until a call
+	// proves otherwise.
+	LeaderEndpoint string
+	Routing        Routing
+
+	// DialTimeout bounds connecting to the endpoints in New.
+	DialTimeout time.Duration
+	// RequestTimeout bounds every attempt of a call; the caller's context
+	// bounds the call as a whole.
+	RequestTimeout time.Duration
+	// MaxAttempts is the number of times a call is tried, including the
+	// first. 1 disables retries.
+	MaxAttempts int
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+	// KeepaliveTime is how long a connection may sit idle before it is
+	// pinged; an endpoint that stops answering is then reported unhealthy.
+	KeepaliveTime time.Duration
+
+	// Token is sent as a bearer token with every call.
+	Token string
+	// TLS enables transport security; nil connects in plaintext.
+	TLS         *tls.Config
+	DialOptions []grpc.DialOption
+}
+
+func (c Config) normalize() Config {
+	out := c
+	out.Endpoints = make([]string, 0, len(c.Endpoints))
+	seen := make(map[string]bool, len(c.Endpoints))
+	for _, endpoint := range c.Endpoints {
+		endpoint = strings.TrimSpace(endpoint)
+		if endpoint != "" && !seen[endpoint] {
+			seen[endpoint] = true
+			out.Endpoints = append(out.Endpoints, endpoint)
+		}
+	}
+	if out.Routing == "" {
+		out.Routing = RoutingLeader
+	}
+	if out.DialTimeout <= 0 {
+		out.DialTimeout = 3 * time.Second
+	}
+	if out.RequestTimeout <= 0 {
+		out.RequestTimeout = 2 * time.Second
+	}
+	if out.MaxAttempts <= 0 {
+		out.MaxAttempts = 4
+	}
+	if out.BackoffBase <= 0 {
+		out.BackoffBase = 20 * time.Millisecond
+	}
+	if out.BackoffMax < out.BackoffBase {
+		out.BackoffMax = max(time.Second, out.BackoffBase)
+	}
+	if out.KeepaliveTime <= 0 {
+		out.KeepaliveTime = 10 * time.Second
+	}
+	return out
+}
+
+// Client is safe for concurrent use.
+type Client struct {
+	cfg       Config
+	endpoints []*endpoint
+
+	leader       atomic.Int64
+	nextEndpoint atomic.Uint64
+	refreshes    atomic.Uint64
+	retries      atomic.Uint64
+
+	discoverMu sync.Mutex
+}
+
+type endpoint struct {
+	addr string
+	conn *grpc.ClientConn
+	kv   minikvv1.KVClient
+}
+
+// Stats counts the client's recovery work since it was created.
+type Stats struct {
+	LeaderRefreshes uint64
+	Retries         uint64
+}
+
+// EndpointHealth is the result of probing one endpoint.
+type EndpointHealth struct {
+	Endpoint string
+	State    connectivity.State
+	Leader   bool
+	Latency  time.Duration
+	Err      error
+}
+
+// New connects to the endpoints. It fails unless at least one of them can be
+// reached within DialTimeout, and with leader routing unless a leader is
+// found.
+func New(ctx context.Context, cfg Config) (*Client, error) {
+	cfg = cfg.normalize()
+	if len(cfg.Endpoints) == 0 {
+		return nil, ErrNoEndpoints
+	}
+	switch cfg.Routing {
+	case RoutingLeader, RoutingRoundRobin:
+	default:
+		return nil, fmt.Errorf("minikv client: unsupported routing %q", cfg.Routing)
+	}
+
+	c := &Client{cfg: cfg}
+	c.leader.Store(-1)
+	creds := insecure.NewCredentials()
+	if cfg.TLS != nil {
+		creds = credentials.NewTLS(cfg.TLS)
+	}
+	opts := append([]grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                cfg.KeepaliveTime,
+			Timeout:             cfg.DialTimeout,
+			PermitWithoutStream: true,
+		}),
+	}, cfg.DialOptions...)
+	if cfg.Token != "" {
+		opts = append(opts, grpc.WithChainUnaryInterceptor(bearerToken(cfg.Token)))
+	}
+	for i, addr := range cfg.Endpoints {
+		conn, err := grpc.NewClient(addr, opts...)
+		if err != nil {
+			_ = c.Close()
+			return nil, fmt.Errorf("minikv client: dial %s: %w", addr, err)
+		}
+		c.endpoints = append(c.endpoints, &endpoint{addr: addr, conn: conn, kv: minikvv1.NewKVClient(conn)})
+		if addr == cfg.LeaderEndpoint {
+			c.leader.Store(int64(i))
+		}
+	}
+	if cfg.LeaderEndpoint != "" && c.leader.Load() < 0 {
+		_ = c.Close()
+		return nil, fmt.Errorf("minikv client: leader endpoint %q is not present in endpoints", cfg.LeaderEndpoint)
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, cfg.DialTimeout)
+	defer cancel()
+	if err := c.waitReady(dialCtx); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	if cfg.Routing == RoutingLeader && c.leader.Load() < 0 {
+		if _, err := c.discoverLeader(dialCtx); err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// waitReady connects to every endpoint and returns once one of them is ready.
+func (c *Client) waitReady(ctx context.Context) error {
+	ready := make(chan struct{}, len(c.endpoints))
+	for _, ep := range c.endpoints {
+		ep.conn.Connect()
+		go func(conn *grpc.ClientConn) {
+			for state := conn.GetState(); state != connectivity.Ready; state = conn.GetState() {
+				if state == connectivity.Shutdown || !conn.WaitForStateChange(ctx, state) {
+					return
+				}
+			}
+			ready <- struct{}{}
+		}(ep.conn)
+	}
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("minikv client: no endpoint of %v became ready: %w", c.cfg.Endpoints, ctx.Err())
+	}
+}
+
+func (c *Client) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	var resp *minikvv1.GetResponse
+	err := c.do(ctx, false, func(ctx context.Context, kv minikvv1.KVClient) error {
+		var err error
+		resp, err = kv.Get(ctx, &minikvv1.GetRequest{Key: key})
+		return err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return resp.GetValue(), resp.GetFound(), nil
+}
+
+func (c *Client) Set(ctx context.Context, key string, value []byte) error {
+	return c.do(ctx, true, func(ctx context.Context, kv minikvv1.KVClient) error {
+		_, err := kv.Set(ctx, &minikvv1.SetRequest{Key: key, Value: value})
+		return err
+	})
+}
+
+func (c *Client) Delete(ctx context.Context, key string) error {
+	return c.do(ctx, true, func(ctx context.Context, kv minikvv1.KVClient) error {
+		_, err := kv.Delete(ctx, &minikvv1.DeleteRequest{Key: key})
+		return err
+	})
+}
+
+// Leader returns the endpoint currently believed to be the leader, or "" if
+// none is known.
+func (c *Client) Leader() string {
+	index := c.leader.Load()
+	if index < 0 {
+		return ""
+	}
+	return c.endpoints[index].addr
+}
+
+func (c *Client) Stats() Stats {
+	return Stats{
+		LeaderRefreshes: c.refreshes.Load(),
+		Retries:         c.retries.Load(),
+	}
+}
+
+// Health probes every endpoint with a Leader call and reports its connection state
+// and whether it answered as the leader.
+func (c *Client) Health(ctx context.Context) []EndpointHealth {
+	out := make([]EndpointHealth, len(c.endpoints))
+	var wg sync.WaitGroup
+	for i, ep := range c.endpoints {
+		wg.Add(1)
+		go func(i int, ep *endpoint) {
+			defer wg.Done()
+			startedAt := time.Now()
+			err := c.probe(ctx, ep)
+			out[i] = EndpointHealth{
+				Endpoint: ep.addr,
+				State:    ep.conn.GetState(),
+				Leader:   err == nil,
+				Latency:  time.Since(startedAt),
+				Err:      err,
+			}
+		}(i, ep)
+	}
+	wg.Wait()
+	return out
+}
+
+func (c *Client) Close() error {
+	var errs []error
+	for _, ep := range c.endpoints {
+		if err := ep.conn.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// do runs call until it succeeds, fails with an error that is not safe to
+// retry, runs out of attempts or ctx ends.
+func (c *Client) do(ctx context.Context, write bool, call func(context.Context, minikvv1.KVClient) error) error {
+	var err error
+	for attempt := 0; attempt < c.cfg.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			c.retries.Add(1)
+			if waitErr := sleep(ctx, c.backoff(attempt)); waitErr != nil {
+				return err
+			}
+		}
+		var index int
+		index, err = c.pick(ctx)
+		if err != nil {
+			if ctx.Err() != nil || !retryable(err, false) {
+				return err
+			}
+			continue
+		}
+
+		ep := c.endpoints[index]
+		attemptCtx, cancel := context.WithTimeout(ctx, c.cfg.RequestTimeout)
+		err = call(attemptCtx, ep.kv)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if unknown, ok := asOutcomeUnknown(ep.addr, err); ok {
+			err = unknown
+			c.leader.CompareAndSwap(int64(index), -1)
+		} else if notLeader, ok := asNotLeader(ep.addr, err); ok {
+			err = notLeader
+			c.leader.CompareAndSwap(int64(index), -1)
+		}
+		if ctx.Err() != nil || !retryable(err, write) {
+			return err
+		}
+	}
+	return err
+}
+
+func (c *Client) pick(ctx context.Context) (int, error) {
+	if c.cfg.Routing == RoutingRoundRobin {
+		return int(c.nextEndpoint.Add(1)-1) % len(c.endpoints), nil
+	}
+	if index := c.leader.Load(); index >= 0 {
+		return int(index), nil
+	}
+	return c.discoverLeader(ctx)
+}
+
+// discoverLeader probes the endpoints for the leader. Concurrent callers
+// share one discovery.
+func (c *Client) discoverLeader(ctx context.Context) (int, error) {
+	c.discoverMu.Lock()
+	defer c.discoverMu.Unlock()
+	if index := c.leader.Load(); index >= 0 {
+		return int(index), nil
+	}
+
+	var lastErr error
+	start := int(c.nextEndpoint.Add(1) - 1)
+	for i := range c.endpoints {
+		index := (start + i) % len(c.endpoints)
+		ep := c.endpoints[index]
+		err := c.probe(ctx, ep)
+		if err == nil {
+			c.leader.Store(int64(index))
+			c.refreshes.Add(1)
+			return index, nil
+		}
+		switch status.Code(err) {
+		case codes.Unauthenticated, codes.PermissionDenied:
+			return 0, err
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return 0, fmt.Errorf("minikv client: discover leader: %w", lastErr)
+}
+
+// probe asks the endpoint for the leader. Followers answer not-leader; the
+// call touches no keys, so it works for tokens scoped to any prefix.
+func (c *Client) probe(ctx context.Context, ep *endpoint) error {
+	probeCtx, cancel := context.WithTimeout(ctx, c.cfg.RequestTimeout)
+	defer cancel()
+	_, err := ep.kv.Leader(probeCtx, &minikvv1.LeaderRequest{})
+	if notLeader, ok := asNotLeader(ep.addr, err); ok {
+		return notLeader
+	}
+	return err
+}
+
+// backoff is the full-jitter exponential delay before the given retry.
+func (c *Client) backoff(attempt int) time.Duration {
+	limit := c.cfg.BackoffBase << min(attempt-1, 16)
+	if limit <= 0 || limit > c.cfg.BackoffMax {
+		limit = c.cfg.BackoffMax
+	}
+	return rand.N(limit) + 1
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func bearerToken(token string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token), method, req, reply, cc, opts...)
+	}
+}
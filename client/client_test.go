@@ -0,0 +1,367 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	minikvv1 "mini-kv/api/minikv/v1"
+	"mini-kv/internal/config"
+	"mini-kv/internal/logger"
+	"mini-kv/internal/observability"
+	"mini-kv/internal/raftstore"
+	"mini-kv/internal/server/grpcserver"
+)
+
+// fakeCluster serves one shared keyspace from several endpoints, of which
+// only the current leader accepts calls.
+type fakeCluster struct {
+	mu     sync.Mutex
+	values map[string][]byte
+	leader int
+	err    error
+	token  string
+
+	addrs []string
+	calls atomic.Int64
+}
+
+type fakeNode struct {
+	minikvv1.UnimplementedKVServer
+
+	cluster *fakeCluster
+	index   int
+}
+
+func (n *fakeNode) check(ctx context.Context) error {
+	n.cluster.calls.Add(1)
+	n.cluster.mu.Lock()
+	defer n.cluster.mu.Unlock()
+	if n.cluster.token != "" {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if values := md.Get("authorization"); len(values) == 0 || values[0] != "Bearer "+n.cluster.token {
+			return status.Error(codes.Unauthenticated, "bad token")
+		}
+	}
+	if n.index != n.cluster.leader {
+		st, _ := status.New(codes.Unavailable, "not leader").WithDetails(&errdetails.ErrorInfo{
+			Reason:   minikvv1.ReasonNotLeader,
+			Domain:   minikvv1.ErrorDomain,
+			Metadata: map[string]string{minikvv1.LeaderIDMetadataKey: "node"},
+		})
+		return st.Err()
+	}
+	return n.cluster.err
+}
+
+func (n *fakeNode) Get(ctx context.Context, req *minikvv1.GetRequest) (*minikvv1.GetResponse, error) {
+	if err := n.check(ctx); err != nil {
+		return nil, err
+	}
+	n.cluster.mu.Lock()
+	defer n.cluster.mu.Unlock()
+	value, ok := n.cluster.values[req.GetKey()]
+	return &minikvv1.GetResponse{Value: value, Found: ok}, nil
+}
+
+func (n *fakeNode) Set(ctx context.Context, req *minikvv1.SetRequest) (*minikvv1.SetResponse, error) {
+	if err := n.check(ctx); err != nil {
+		return nil, err
+	}
+	n.cluster.mu.Lock()
+	defer n.cluster.mu.Unlock()
+	n.cluster.values[req.GetKey()] = req.GetValue()
+	return &minikvv1.SetResponse{}, nil
+}
+
+func (n *fakeNode) Delete(ctx context.Context, req *minikvv1.DeleteRequest) (*minikvv1.DeleteResponse, error) {
+	if err := n.check(ctx); err != nil {
+		return nil, err
+	}
+	n.cluster.mu.Lock()
+	defer n.cluster.mu.Unlock()
+	delete(n.cluster.values, req.GetKey())
+	return &minikvv1.DeleteResponse{}, nil
+}
+
+func (n *fakeNode) Leader(ctx context.Context, _ *minikvv1.LeaderRequest) (*minikvv1.LeaderResponse, error) {
+	if err := n.check(ctx); err != nil {
+		return nil, err
+	}
+	return &minikvv1.LeaderResponse{LeaderId: "node"}, nil
+}
+
+// raftNode is a minikv service that answers like a raft replica: only the
+// leader serves requests.
+type raftNode struct {
+	mu       sync.Mutex
+	leader   bool
+	leaderID string
+	values   map[string][]byte
+}
+
+func (n *raftNode) Get(_ context.Context, key string) ([]byte, bool, error) {
+	if _, err := n.Leader(context.Background()); err != nil {
+		return nil, false, err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	value, ok := n.values[key]
+	return value, ok, nil
+}
+
+func (n *raftNode) Set(_ context.Context, key string, value []byte) error {
+	if _, err := n.Leader(context.Background()); err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.values[key] = value
+	return nil
+}
+
+func (n *raftNode) Delete(_ context.Context, key string) error {
+	if _, err := n.Leader(context.Background()); err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	delete(n.values, key)
+	return nil
+}
+
+func (n *raftNode) Leader(context.Context) (string, error) {
+	if !n.leader {
+		return "", raftstore.NotLeaderError{LeaderID: n.leaderID}
+	}
+	return n.leaderID, nil
+}
+
+func (c *fakeCluster) set(apply func(*fakeCluster)) {
+	c.mu.Lock()
+	apply(c)
+	c.mu.Unlock()
+}
+
+func newFakeCluster(t *testing.T, nodes, leader int) *fakeCluster {
+	t.Helper()
+
+	cluster := &fakeCluster{values: make(map[string][]byte), leader: leader}
+	for i := 0; i < nodes; i++ {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen: %v", err)
+		}
+		server := grpc.NewServer()
+		minikvv1.RegisterKVServer(server, &fakeNode{cluster: cluster, index: i})
+		go func() { _ = server.Serve(listener) }()
+		t.Cleanup(server.Stop)
+		cluster.addrs = append(cluster.addrs, listener.Addr().String())
+	}
+	return cluster
+}
+
+func newTestClient(t *testing.T, cfg Config) *Client {
+	t.Helper()
+
+	c, err := New(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func TestFollowsLeaderChanges(t *testing.T) {
+	t.Parallel()
+
+	cluster := newFakeCluster(t, 3, 1)
+	c := newTestClient(t, Config{Endpoints: cluster.addrs})
+	if c.Leader() != cluster.addrs[1] {
+		t.Fatalf("leader = %q, want %q", c.Leader(), cluster.addrs[1])
+	}
+
+	ctx := context.Background()
+	if err := c.Set(ctx, "a", []byte("1")); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	cluster.set(func(c *fakeCluster) { c.leader = 2 })
+	if err := c.Set(ctx, "b", []byte("2")); err != nil {
+		t.Fatalf("set after leader change: %v", err)
+	}
+	value, found, err := c.Get(ctx, "a")
+	if err != nil || !found || string(value) != "1" {
+		t.Fatalf("get = %q, %v, %v; want 1", value, found, err)
+	}
+	if c.Leader() != cluster.addrs[2] {
+		t.Fatalf("leader = %q, want %q", c.Leader(), cluster.addrs[2])
+	}
+	if stats := c.Stats(); stats.LeaderRefreshes != 2 || stats.Retries != 1 {
+		t.Fatalf("stats = %+v, want 2 refreshes and 1 retry", stats)
+	}
+
+	health := c.Health(ctx)
+	if len(health) != 3 || health[1].Leader || !health[2].Leader || !IsNotLeader(health[0].Err) {
+		t.Fatalf("health = %+v", health)
+	}
+}
+
+func TestRetriesOnlyWhatIsSafe(t *testing.T) {
+	t.Parallel()
+
+	cluster := newFakeCluster(t, 1, 0)
+	c := newTestClient(t, Config{Endpoints: cluster.addrs, MaxAttempts: 3, BackoffBase: time.Millisecond})
+	ctx := context.Background()
+
+	cluster.set(func(c *fakeCluster) { c.err = status.Error(codes.Unavailable, "connection reset") })
+	cluster.calls.Store(0)
+	if err := c.Set(ctx, "a", []byte("1")); status.Code(err) != codes.Unavailable {
+		t.Fatalf("set error = %v, want unavailable", err)
+	}
+	if calls := cluster.calls.Load(); calls != 1 {
+		t.Fatalf("set was sent %d times, want 1: writes must not be retried blindly", calls)
+	}
+
+	cluster.calls.Store(0)
+	if _, _, err := c.Get(ctx, "a"); status.Code(err) != codes.Unavailable {
+		t.Fatalf("get error = %v, want unavailable", err)
+	}
+	if calls := cluster.calls.Load(); calls != 3 {
+		t.Fatalf("get was sent %d times, want 3", calls)
+	}
+
+	unknown, _ := status.New(codes.Unavailable, "leadership lost").WithDetails(&errdetails.ErrorInfo{
+		Reason: minikvv1.ReasonOutcomeUnknown,
+		Domain: minikvv1.ErrorDomain,
+	})
+	cluster.set(func(c *fakeCluster) { c.err = unknown.Err() })
+	cluster.calls.Store(0)
+	if err := c.Set(ctx, "a", []byte("1")); !IsOutcomeUnknown(err) || IsNotLeader(err) {
+		t.Fatalf("set error = %v, want outcome unknown", err)
+	}
+	if calls := cluster.calls.Load(); calls != 1 {
+		t.Fatalf("set with unknown outcome was sent %d times, want 1", calls)
+	}
+
+	cluster.set(func(c *fakeCluster) { c.err = status.Error(codes.ResourceExhausted, "write stall") })
+	cluster.calls.Store(0)
+	if err := c.Set(ctx, "a", []byte("1")); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("stalled set error = %v, want resource exhausted", err)
+	}
+	if calls := cluster.calls.Load(); calls != 3 {
+		t.Fatalf("stalled set was sent %d times, want 3", calls)
+	}
+}
+
+func TestTokenAndRoundRobin(t *testing.T) {
+	t.Parallel()
+
+	cluster := newFakeCluster(t, 2, 1)
+	cluster.token = "secret"
+	c := newTestClient(t, Config{Endpoints: cluster.addrs, Routing: RoutingRoundRobin, Token: "secret"})
+	for i := 0; i < 4; i++ {
+		if err := c.Set(context.Background(), "a", []byte("1")); err != nil {
+			t.Fatalf("round robin set %d: %v", i, err)
+		}
+	}
+
+	if _, err := New(context.Background(), Config{Endpoints: cluster.addrs}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("new without token error = %v, want unauthenticated", err)
+	}
+}
+
+func TestPrefixScopedToken(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Default()
+	cfg.Port = 0
+	cfg.Auth = config.AuthConfig{
+		Enabled: true,
+		Tokens:  []config.AuthToken{{Token: "tenant-token", Principal: "tenant"}},
+		Principals: []config.AuthPrincipal{{Name: "tenant", Grants: []config.AuthGrant{
+			{Prefix: "tenant/", Permissions: []string{"read", "write"}},
+		}}},
+	}
+	var addrs []string
+	for _, node := range []*raftNode{{leaderID: "node2"}, {leader: true, leaderID: "node2", values: make(map[string][]byte)}} {
+		srv := grpcserver.New(cfg, logger.NewDiscard(), node, observability.NewRegistry(), nil)
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() { _ = srv.Run(ctx) }()
+		t.Cleanup(cancel)
+		deadline := time.Now().Add(time.Second)
+		for srv.Addr() == "" {
+			if time.Now().After(deadline) {
+				t.Fatal("grpc server did not start")
+			}
+			time.Sleep(time.Millisecond)
+		}
+		addrs = append(addrs, srv.Addr())
+	}
+
+	// Discovery must not need permission on any key.
+	c := newTestClient(t, Config{Endpoints: addrs, Token: "tenant-token"})
+	if c.Leader() != addrs[1] {
+		t.Fatalf("leader = %q, want %q", c.Leader(), addrs[1])
+	}
+	ctx := context.Background()
+	if err := c.Set(ctx, "tenant/a", []byte("1")); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if err := c.Set(ctx, "other/a", []byte("1")); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("foreign set error = %v, want permission denied", err)
+	}
+	if health := c.Health(ctx); health[0].Leader || !IsNotLeader(health[0].Err) || !health[1].Leader {
+		t.Fatalf("health = %+v", health)
+	}
+}
+
+func TestNewWithoutReachableEndpoint(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	_ = listener.Close()
+
+	if _, err := New(context.Background(), Config{Endpoints: []string{addr}, DialTimeout: 200 * time.Millisecond}); err == nil {
+		t.Fatal("new with an unreachable endpoint should fail")
+	}
+	if _, err := New(context.Background(), Config{}); !errors.Is(err, ErrNoEndpoints) {
+		t.Fatalf("new without endpoints error = %v, want %v", err, ErrNoEndpoints)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	t.Parallel()
+
+	var kv KV = NewMemory()
+	ctx := context.Background()
+	if err := kv.Set(ctx, "a", []byte("1")); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if value, found, err := kv.Get(ctx, "a"); err != nil || !found || string(value) != "1" {
+		t.Fatalf("get = %q, %v, %v", value, found, err)
+	}
+	boom := errors.New("boom")
+	kv.(*Memory).SetError(boom)
+	if err := kv.Delete(ctx, "a"); !errors.Is(err, boom) {
+		t.Fatalf("delete error = %v, want %v", err, boom)
+	}
+	kv.(*Memory).SetError(nil)
+	_ = kv.Close()
+	if _, _, err := kv.Get(ctx, "a"); !errors.Is(err, ErrClosed) {
+		t.Fatalf("get after close error = %v, want %v", err, ErrClosed)
+	}
+}
@@ -0,0 +1,129 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	minikvv1 "mini-kv/api/minikv/v1"
+)
+
+var (
+	// ErrNoEndpoints is returned by New without any endpoint to connect to.
+	ErrNoEndpoints = errors.New("minikv client: no endpoints")
+	// ErrClosed is returned by calls on a closed Memory.
+	ErrClosed = errors.New("minikv client: closed")
+)
+
+// NotLeaderError reports that an endpoint rejected a call because it is not
+// the raft leader. The server checks leadership before proposing, so the call
+// was not executed; a write that loses leadership after it was proposed is
+// reported as an OutcomeUnknownError instead.
+type NotLeaderError struct {
+	Endpoint string
+	LeaderID string
+	Err      error
+}
+
+func (e *NotLeaderError) Error() string {
+	if e.LeaderID == "" {
+		return fmt.Sprintf("minikv client: %s is not leader", e.Endpoint)
+	}
+	return fmt.Sprintf("minikv client: %s is not leader; leader=%s", e.Endpoint, e.LeaderID)
+}
+
+func (e *NotLeaderError) Unwrap() error {
+	return e.Err
+}
+
+// IsNotLeader reports whether err is a follower's rejection.
+func IsNotLeader(err error) bool {
+	var notLeader *NotLeaderError
+	return errors.As(err, &notLeader)
+}
+
+// OutcomeUnknownError reports that the leader lost leadership after it had
+// appended a write to its log. The next leader may still commit it, so the
+// write is not retried.
+type OutcomeUnknownError struct {
+	Endpoint string
+	Err      error
+}
+
+func (e *OutcomeUnknownError) Error() string {
+	return fmt.Sprintf("minikv client: %s lost leadership after accepting the write; outcome unknown", e.Endpoint)
+}
+
+func (e *OutcomeUnknownError) Unwrap() error {
+	return e.Err
+}
+
+// IsOutcomeUnknown reports whether err is a write that may or may not have
+// been applied.
+func IsOutcomeUnknown(err error) bool {
+	var unknown *OutcomeUnknownError
+	return errors.As(err, &unknown)
+}
+
+// asOutcomeUnknown recognises the status of a write that lost leadership
+// after it was appended.
+func asOutcomeUnknown(endpoint string, err error) (*OutcomeUnknownError, bool) {
+	st, ok := status.FromError(err)
+	if !ok {
+		return nil, false
+	}
+	for _, detail := range st.Details() {
+		info, ok := detail.(*errdetails.ErrorInfo)
+		if ok && info.GetDomain() == minikvv1.ErrorDomain && info.GetReason() == minikvv1.ReasonOutcomeUnknown {
+			return &OutcomeUnknownError{Endpoint: endpoint, Err: err}, true
+		}
+	}
+	return nil, false
+}
+
+// asNotLeader recognises the status a follower answers with. Servers that
+// predate the ErrorInfo detail are matched on the message.
+func asNotLeader(endpoint string, err error) (*NotLeaderError, bool) {
+	st, ok := status.FromError(err)
+	if !ok {
+		return nil, false
+	}
+	for _, detail := range st.Details() {
+		info, ok := detail.(*errdetails.ErrorInfo)
+		if ok && info.GetDomain() == minikvv1.ErrorDomain && info.GetReason() == minikvv1.ReasonNotLeader {
+			return &NotLeaderError{Endpoint: endpoint, LeaderID: info.GetMetadata()[minikvv1.LeaderIDMetadataKey], Err: err}, true
+		}
+	}
+	if strings.Contains(strings.ToLower(st.Message()), "not leader") {
+		return &NotLeaderError{Endpoint: endpoint, Err: err}, true
+	}
+	return nil, false
+}
+
+// retryable reports whether a failed attempt may be sent again. Rejections
+// that prove the request was not executed are retried for every call; other
+// transient failures only for reads, since a write may already have been
+// applied and retrying it could overwrite a later write.
+func retryable(err error, write bool) bool {
+	if IsOutcomeUnknown(err) {
+		return !write
+	}
+	if IsNotLeader(err) {
+		return true
+	}
+	switch status.Code(err) {
+	case codes.ResourceExhausted:
+		return true
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Aborted:
+		return !write
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return !write
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package client
+
+import (
+	"context"
+	"sync"
+)
+
+// Memory is an in-memory KV for unit tests of code built on the client.
+type Memory struct {
+	mu     sync.Mutex
+	values map[string][]byte
+	err    error
+	closed bool
+}
+
+func NewMemory() *Memory {
+	return &Memory{values: make(map[string][]byte)}
+}
+
+// SetError makes every following call fail with err; nil restores normal
+// operation.
+func (m *Memory) SetError(err error) {
+	m.mu.Lock()
+	m.err = err
+	m.mu.Unlock()
+}
+
+func (m *Memory) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.check(ctx); err != nil {
+		return nil, false, err
+	}
+	value, ok := m.values[key]
+	if !ok {
+		return nil, false, nil
+	}
+	return append([]byte(nil), value...), true, nil
+}
+
+func (m *Memory) Set(ctx context.Context, key string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.check(ctx); err != nil {
+		return err
+	}
+	m.values[key] = append([]byte(nil), value...)
+	return nil
+}
+
+func (m *Memory) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.check(ctx); err != nil {
+		return err
+	}
+	delete(m.values, key)
+	return nil
+}
+
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	m.closed = true
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *Memory) check(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if m.closed {
+		return ErrClosed
+	}
+	return m.err
+}
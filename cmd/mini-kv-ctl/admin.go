@@ -0,0 +1,505 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"mini-kv/client"
+	"mini-kv/internal/observability"
+)
+
+// sample is one node's /debug/vars.
+type sample struct {
+	endpoint string
+	snapshot observability.DebugSnapshot
+	err      error
+}
+
+type nodeStatus struct {
+	Endpoint  string `json:"endpoint"`
+	Node      string `json:"node,omitempty"`
+	State     string `json:"state,omitempty"`
+	Leader    string `json:"leader,omitempty"`
+	Term      uint64 `json:"term"`
+	Commit    uint64 `json:"commit_index"`
+	Applied   uint64 `json:"applied_index"`
+	LastIndex uint64 `json:"last_index"`
+	Error     string `json:"error,omitempty"`
+}
+
+type statusReport struct {
+	Leader   string       `json:"leader,omitempty"`
+	Nodes    []nodeStatus `json:"nodes"`
+	Problems []string     `json:"problems,omitempty"`
+}
+
+type metricDelta struct {
+	Metric string   `json:"metric"`
+	Before float64  `json:"before"`
+	After  float64  `json:"after"`
+	Delta  float64  `json:"delta"`
+	Rate   *float64 `json:"rate_per_sec,omitempty"`
+}
+
+type pingStats struct {
+	Endpoint  string  `json:"endpoint"`
+	Role      string  `json:"role,omitempty"`
+	State     string  `json:"state"`
+	Sent      int     `json:"sent"`
+	Answered  int     `json:"answered"`
+	MinMS     float64 `json:"min_ms"`
+	AvgMS     float64 `json:"avg_ms"`
+	MaxMS     float64 `json:"max_ms"`
+	LastError string  `json:"last_error,omitempty"`
+
+	total time.Duration
+}
+
+func runStatus(args []string) error {
+	fs, opts := newFlagSet("status")
+	opts.parse(fs, args)
+
+	report := statusReport{}
+	leaders := make(map[string]bool)
+	for _, sample := range opts.sampleAll() {
+		node := nodeStatus{Endpoint: sample.endpoint}
+		if sample.err != nil {
+			node.Error = sample.err.Error()
+			report.Problems = append(report.Problems, fmt.Sprintf("%s: %v", sample.endpoint, sample.err))
+			report.Nodes = append(report.Nodes, node)
+			continue
+		}
+		snapshot := sample.snapshot
+		if len(snapshot.RaftState) == 0 {
+			report.Problems = append(report.Problems, fmt.Sprintf("%s: raft is not running", sample.endpoint))
+		}
+		for _, id := range slices.Sorted(maps.Keys(snapshot.RaftState)) {
+			node.Node = id
+			node.State = snapshot.RaftState[id]
+			node.Leader = snapshot.RaftLeader[id]
+			node.Term = uint64(snapshot.Metrics["mini_kv_raft_term|"+id])
+			node.Commit = snapshot.CommitIndex[id]
+			node.Applied = snapshot.AppliedIndex[id]
+			node.LastIndex = uint64(snapshot.Metrics["mini_kv_raft_last_index|"+id])
+			if node.Leader != "" {
+				leaders[node.Leader] = true
+			}
+		}
+		report.Nodes = append(report.Nodes, node)
+	}
+	switch len(leaders) {
+	case 0:
+		report.Problems = append(report.Problems, "no node knows a leader")
+	case 1:
+		for leader := range leaders {
+			report.Leader = leader
+		}
+	default:
+		report.Problems = append(report.Problems, fmt.Sprintf("nodes disagree on the leader: %s", strings.Join(slices.Sorted(maps.Keys(leaders)), ", ")))
+	}
+
+	if opts.json() {
+		if err := printJSON(report); err != nil {
+			return err
+		}
+	} else {
+		table := newTable()
+		fmt.Fprintln(table, "ENDPOINT\tNODE\tSTATE\tLEADER\tTERM\tCOMMIT\tAPPLIED\tLAST INDEX")
+		for _, node := range report.Nodes {
+			if node.Error != "" {
+				fmt.Fprintf(table, "%s\t-\tunreachable\t-\t-\t-\t-\t-\n", node.Endpoint)
+				continue
+			}
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%d\t%d\t%d\t%d\n",
+				node.Endpoint, node.Node, node.State, node.Leader, node.Term, node.Commit, node.Applied, node.LastIndex)
+		}
+		_ = table.Flush()
+		if report.Leader != "" {
+			fmt.Printf("leader: %s\n", report.Leader)
+		}
+		for _, problem := range report.Problems {
+			fmt.Printf("problem: %s\n", problem)
+		}
+	}
+	if len(report.Problems) > 0 {
+		return errReported
+	}
+	return nil
+}
+
+func runMetrics(args []string) error {
+	fs, opts := newFlagSet("metrics")
+	filter := fs.String("filter", "", "only print metrics whose name contains this text")
+	opts.parse(fs, args)
+
+	dump := make(map[string]map[string]float64)
+	var failed bool
+	for _, sample := range opts.sampleAll() {
+		if sample.err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", sample.endpoint, sample.err)
+			failed = true
+			continue
+		}
+		metrics := flatten(sample.snapshot)
+		maps.DeleteFunc(metrics, func(key string, _ float64) bool { return !strings.Contains(key, *filter) })
+		dump[sample.endpoint] = metrics
+	}
+
+	if opts.json() {
+		if err := printJSON(dump); err != nil {
+			return err
+		}
+	} else {
+		for _, endpoint := range slices.Sorted(maps.Keys(dump)) {
+			fmt.Printf("# %s\n", endpoint)
+			metrics := dump[endpoint]
+			for _, key := range slices.Sorted(maps.Keys(metrics)) {
+				fmt.Printf("%s %s\n", formatMetric(key), formatNumber(metrics[key]))
+			}
+		}
+	}
+	if failed {
+		return errReported
+	}
+	return nil
+}
+
+func runDiff(args []string) error {
+	fs, opts := newFlagSet("diff")
+	interval := fs.Duration("interval", 10*time.Second, "time between the two live samples")
+	filter := fs.String("filter", "", "only diff metrics whose name contains this text")
+	all := fs.Bool("all", false, "also print metrics that did not change")
+	opts.parse(fs, args)
+
+	var before, after map[string]map[string]float64
+	var elapsed time.Duration
+	var failed bool
+	switch fs.NArg() {
+	case 2:
+		var err error
+		if before, err = loadMetrics(fs.Arg(0)); err != nil {
+			return err
+		}
+		if after, err = loadMetrics(fs.Arg(1)); err != nil {
+			return err
+		}
+		// Samples of a single node, such as raw /debug/vars files keyed by
+		// file name, are compared with each other whatever their names.
+		if len(before) == 1 && len(after) == 1 {
+			for _, metrics := range before {
+				for name := range after {
+					before = map[string]map[string]float64{name: metrics}
+				}
+			}
+		}
+	case 0:
+		live := func() map[string]map[string]float64 {
+			out := make(map[string]map[string]float64)
+			for _, sample := range opts.sampleAll() {
+				if sample.err != nil {
+					fmt.Fprintf(os.Stderr, "%s: %v\n", sample.endpoint, sample.err)
+					failed = true
+					continue
+				}
+				out[sample.endpoint] = flatten(sample.snapshot)
+			}
+			return out
+		}
+		startedAt := time.Now()
+		before = live()
+		time.Sleep(*interval)
+		after = live()
+		elapsed = time.Since(startedAt)
+	default:
+		return fmt.Errorf("want two saved samples or none for a live diff")
+	}
+
+	diffs := make(map[string][]metricDelta)
+	for endpoint, metrics := range after {
+		previous, ok := before[endpoint]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "%s: missing from the first sample\n", endpoint)
+			failed = true
+			continue
+		}
+		diffs[endpoint] = diffMetrics(previous, metrics, *filter, *all, elapsed)
+	}
+
+	if opts.json() {
+		report := struct {
+			ElapsedSeconds float64                  `json:"elapsed_seconds,omitempty"`
+			Endpoints      map[string][]metricDelta `json:"endpoints"`
+		}{elapsed.Seconds(), diffs}
+		if err := printJSON(report); err != nil {
+			return err
+		}
+	} else {
+		for _, endpoint := range slices.Sorted(maps.Keys(diffs)) {
+			if elapsed > 0 {
+				fmt.Printf("# %s over %s\n", endpoint, elapsed.Round(time.Millisecond))
+			} else {
+				fmt.Printf("# %s\n", endpoint)
+			}
+			if len(diffs[endpoint]) == 0 {
+				fmt.Println("no changes")
+				continue
+			}
+			table := newTable()
+			fmt.Fprintln(table, "METRIC\tBEFORE\tAFTER\tDELTA\tRATE/S")
+			for _, delta := range diffs[endpoint] {
+				rate := "-"
+				if delta.Rate != nil {
+					rate = fmt.Sprintf("%.2f", *delta.Rate)
+				}
+				fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n", formatMetric(delta.Metric),
+					formatNumber(delta.Before), formatNumber(delta.After), signed(formatNumber(delta.Delta)), rate)
+			}
+			_ = table.Flush()
+		}
+	}
+	if failed {
+		return errReported
+	}
+	return nil
+}
+
+func runLeader(args []string) error {
+	fs, opts := newFlagSet("leader")
+	opts.parse(fs, args)
+
+	kv, err := opts.client(client.RoutingLeader)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = kv.Close() }()
+
+	if opts.json() {
+		return printJSON(struct {
+			Leader string `json:"leader"`
+		}{kv.Leader()})
+	}
+	fmt.Println(kv.Leader())
+	return nil
+}
+
+func runPing(args []string) error {
+	fs, opts := newFlagSet("ping")
+	count := fs.Int("count", 4, "probes sent to every endpoint")
+	interval := fs.Duration("interval", time.Second, "time between probes")
+	opts.parse(fs, args)
+
+	// Round-robin routing connects without looking for a leader, so a
+	// cluster without one can still be pinged.
+	kv, err := opts.client(client.RoutingRoundRobin)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = kv.Close() }()
+
+	var stats []*pingStats
+	for seq := 1; seq <= *count; seq++ {
+		if seq > 1 {
+			time.Sleep(*interval)
+		}
+		for i, health := range kv.Health(context.Background()) {
+			if i == len(stats) {
+				stats = append(stats, &pingStats{Endpoint: health.Endpoint})
+			}
+			s := stats[i]
+			s.Sent++
+			s.State = health.State.String()
+			answered := health.Err == nil || client.IsNotLeader(health.Err)
+			switch {
+			case health.Leader:
+				s.Role = "leader"
+			case answered:
+				s.Role = "follower"
+			}
+			if !answered {
+				s.LastError = health.Err.Error()
+				if !opts.json() {
+					fmt.Printf("%s: seq=%d error: %v\n", health.Endpoint, seq, health.Err)
+				}
+				continue
+			}
+			latency := float64(health.Latency.Microseconds()) / 1000
+			if s.Answered == 0 || latency < s.MinMS {
+				s.MinMS = latency
+			}
+			s.MaxMS = max(s.MaxMS, latency)
+			s.Answered++
+			s.total += health.Latency
+			s.AvgMS = float64((s.total / time.Duration(s.Answered)).Microseconds()) / 1000
+			if !opts.json() {
+				fmt.Printf("%s: seq=%d time=%s %s\n", health.Endpoint, seq, formatMS(health.Latency), s.Role)
+			}
+		}
+	}
+
+	var failed bool
+	for _, s := range stats {
+		failed = failed || s.Answered == 0
+	}
+	if opts.json() {
+		if err := printJSON(stats); err != nil {
+			return err
+		}
+	} else {
+		fmt.Println()
+		table := newTable()
+		fmt.Fprintln(table, "ENDPOINT\tROLE\tSTATE\tANSWERED\tMIN\tAVG\tMAX")
+		for _, s := range stats {
+			if s.Answered == 0 {
+				fmt.Fprintf(table, "%s\t%s\t%s\t0/%d\t-\t-\t-\n", s.Endpoint, s.Role, s.State, s.Sent)
+				continue
+			}
+			fmt.Fprintf(table, "%s\t%s\t%s\t%d/%d\t%.3fms\t%.3fms\t%.3fms\n",
+				s.Endpoint, s.Role, s.State, s.Answered, s.Sent, s.MinMS, s.AvgMS, s.MaxMS)
+		}
+		_ = table.Flush()
+	}
+	if failed {
+		return errReported
+	}
+	return nil
+}
+
+// sampleAll fetches /debug/vars from every debug endpoint in parallel.
+func (o *options) sampleAll() []sample {
+	endpoints := splitCSV(o.debugEndpoints)
+	httpClient := &http.Client{Timeout: o.timeout}
+	if tlsConfig, err := o.tlsConfig(); err == nil && tlsConfig != nil {
+		httpClient.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+	}
+	return forEach(len(endpoints), len(endpoints), func(i int) sample {
+		out := sample{endpoint: endpoints[i]}
+		out.snapshot, out.err = fetchVars(httpClient, endpoints[i])
+		return out
+	})
+}
+
+func fetchVars(httpClient *http.Client, endpoint string) (observability.DebugSnapshot, error) {
+	url := strings.TrimSuffix(endpoint, "/")
+	if !strings.Contains(url, "://") {
+		url = "http://" + url
+	}
+	var snapshot observability.DebugSnapshot
+	resp, err := httpClient.Get(url + "/debug/vars")
+	if err != nil {
+		return snapshot, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return snapshot, fmt.Errorf("GET /debug/vars: %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&snapshot); err != nil {
+		return snapshot, fmt.Errorf("decode /debug/vars: %w", err)
+	}
+	return snapshot, nil
+}
+
+// flatten turns a snapshot into one number per series, keyed like the
+// snapshot's own metrics: the Prometheus name and the label values joined
+// with "|".
+func flatten(snapshot observability.DebugSnapshot) map[string]float64 {
+	out := make(map[string]float64, len(snapshot.Metrics))
+	maps.Copy(out, snapshot.Metrics)
+	for key, stats := range snapshot.GRPC {
+		out["mini_kv_grpc_requests_total|"+key] = float64(stats.Count)
+		out["mini_kv_grpc_request_duration_ms_sum|"+key] = stats.SumMS
+	}
+	for key, stats := range snapshot.RaftOperation {
+		out["mini_kv_raft_operations_total|"+key] = float64(stats.Count)
+		out["mini_kv_raft_operation_duration_ms_sum|"+key] = stats.SumMS
+	}
+	for key, count := range snapshot.LeaderChanges {
+		out["mini_kv_raft_leader_changes_total|"+key] = float64(count)
+	}
+	for key, index := range snapshot.CommitIndex {
+		out["mini_kv_raft_commit_index|"+key] = float64(index)
+	}
+	for key, index := range snapshot.AppliedIndex {
+		out["mini_kv_raft_applied_index|"+key] = float64(index)
+	}
+	for key, count := range snapshot.AuthDenied {
+		out["mini_kv_auth_denied_total|"+key] = float64(count)
+	}
+	for key, progress := range snapshot.Replication {
+		out["mini_kv_raft_replication_lag_entries|"+key] = float64(progress.Lag)
+		out["mini_kv_raft_replication_match_index|"+key] = float64(progress.Match)
+	}
+	for key, bytes := range snapshot.Transport {
+		out["mini_kv_raft_transport_frames_total|"+key] = float64(bytes.Frames)
+		out["mini_kv_raft_transport_raw_bytes_total|"+key] = float64(bytes.RawBytes)
+		out["mini_kv_raft_transport_wire_bytes_total|"+key] = float64(bytes.WireBytes)
+	}
+	return out
+}
+
+// loadMetrics reads a sample saved with "metrics -output json", or a raw
+// /debug/vars response, which is keyed by the file name.
+func loadMetrics(path string) (map[string]map[string]float64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if _, raw := fields["started_at"]; raw {
+		var snapshot observability.DebugSnapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return map[string]map[string]float64{path: flatten(snapshot)}, nil
+	}
+	var out map[string]map[string]float64
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return out, nil
+}
+
+func diffMetrics(before, after map[string]float64, filter string, all bool, elapsed time.Duration) []metricDelta {
+	keys := make(map[string]bool, len(after))
+	for key := range before {
+		keys[key] = true
+	}
+	for key := range after {
+		keys[key] = true
+	}
+	var out []metricDelta
+	for _, key := range slices.Sorted(maps.Keys(keys)) {
+		if !strings.Contains(key, filter) {
+			continue
+		}
+		delta := metricDelta{Metric: key, Before: before[key], After: after[key]}
+		delta.Delta = delta.After - delta.Before
+		if delta.Delta == 0 && !all {
+			continue
+		}
+		if elapsed > 0 {
+			rate := delta.Delta / elapsed.Seconds()
+			delta.Rate = &rate
+		}
+		out = append(out, delta)
+	}
+	return out
+}
+
+// formatMetric renders "name|a|b" as "name{a,b}".
+func formatMetric(key string) string {
+	name, labels, ok := strings.Cut(key, "|")
+	if !ok {
+		return key
+	}
+	return name + "{" + strings.ReplaceAll(labels, "|", ",") + "}"
+}
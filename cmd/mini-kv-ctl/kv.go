@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"mini-kv/client"
+)
+
+// kvResult is the outcome of one key of a data command.
+type kvResult struct {
+	Key   string `json:"key"`
+	Found bool   `json:"found,omitempty"`
+	Value []byte `json:"value,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+func runGet(args []string) error {
+	fs, opts := newFlagSet("get")
+	file := fs.String("file", "", "read keys from this file, one per line; - reads stdin")
+	concurrency := fs.Int("concurrency", 8, "requests in flight for bulk gets")
+	opts.parse(fs, args)
+	keys, err := keysFrom(*file, fs.Args())
+	if err != nil {
+		return err
+	}
+
+	kv, err := opts.client(client.RoutingLeader)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = kv.Close() }()
+
+	results := forEach(len(keys), *concurrency, func(i int) kvResult {
+		value, found, err := kv.Get(context.Background(), keys[i])
+		return kvResult{Key: keys[i], Found: found, Value: value, Error: errorString(err)}
+	})
+
+	// A single key given on the command line prints just its value, so that
+	// it can be piped.
+	if *file == "" && len(results) == 1 {
+		result := results[0]
+		if opts.json() {
+			return printJSON(result)
+		}
+		if result.Error != "" {
+			return fmt.Errorf("%s", result.Error)
+		}
+		if !result.Found {
+			return fmt.Errorf("key %q not found", result.Key)
+		}
+		_, err := os.Stdout.Write(append(result.Value, '\n'))
+		return err
+	}
+
+	if opts.json() {
+		if err := printJSON(results); err != nil {
+			return err
+		}
+	} else {
+		for _, result := range results {
+			switch {
+			case result.Error != "":
+				fmt.Printf("%s\terror: %s\n", formatBytes([]byte(result.Key)), result.Error)
+			case !result.Found:
+				fmt.Printf("%s\t(not found)\n", formatBytes([]byte(result.Key)))
+			default:
+				fmt.Printf("%s\t%s\n", formatBytes([]byte(result.Key)), formatBytes(result.Value))
+			}
+		}
+	}
+	return failed(results)
+}
+
+func runPut(args []string) error {
+	fs, opts := newFlagSet("put")
+	file := fs.String("file", "", "read key<TAB>value lines from this file; - reads stdin")
+	concurrency := fs.Int("concurrency", 8, "requests in flight for bulk puts")
+	opts.parse(fs, args)
+
+	var pairs [][2]string
+	switch {
+	case *file != "":
+		lines, err := readLines(*file)
+		if err != nil {
+			return err
+		}
+		for n, line := range lines {
+			key, value, ok := strings.Cut(line, "\t")
+			if !ok {
+				return fmt.Errorf("%s: entry %d has no tab between key and value", *file, n+1)
+			}
+			pairs = append(pairs, [2]string{key, value})
+		}
+	case fs.NArg() == 2:
+		pairs = append(pairs, [2]string{fs.Arg(0), fs.Arg(1)})
+	default:
+		return fmt.Errorf("want <key> <value> or -file")
+	}
+
+	kv, err := opts.client(client.RoutingLeader)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = kv.Close() }()
+
+	results := forEach(len(pairs), *concurrency, func(i int) kvResult {
+		err := kv.Set(context.Background(), pairs[i][0], []byte(pairs[i][1]))
+		return kvResult{Key: pairs[i][0], Error: errorString(err)}
+	})
+	return printWrites(opts, "put", results)
+}
+
+func runDel(args []string) error {
+	fs, opts := newFlagSet("del")
+	file := fs.String("file", "", "read keys from this file, one per line; - reads stdin")
+	concurrency := fs.Int("concurrency", 8, "requests in flight for bulk deletes")
+	opts.parse(fs, args)
+	keys, err := keysFrom(*file, fs.Args())
+	if err != nil {
+		return err
+	}
+
+	kv, err := opts.client(client.RoutingLeader)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = kv.Close() }()
+
+	results := forEach(len(keys), *concurrency, func(i int) kvResult {
+		err := kv.Delete(context.Background(), keys[i])
+		return kvResult{Key: keys[i], Error: errorString(err)}
+	})
+	return printWrites(opts, "deleted", results)
+}
+
+// printWrites reports the outcome of puts or deletes: a count, and one line
+// per failed key.
+func printWrites(opts *options, verb string, results []kvResult) error {
+	if opts.json() {
+		if err := printJSON(results); err != nil {
+			return err
+		}
+		return failed(results)
+	}
+	errs := 0
+	for _, result := range results {
+		if result.Error != "" {
+			errs++
+			fmt.Fprintf(os.Stderr, "%s: %s\n", formatBytes([]byte(result.Key)), result.Error)
+		}
+	}
+	fmt.Printf("%s %d of %d keys\n", verb, len(results)-errs, len(results))
+	if errs > 0 {
+		return errReported
+	}
+	return nil
+}
+
+func failed(results []kvResult) error {
+	for _, result := range results {
+		if result.Error != "" {
+			return errReported
+		}
+	}
+	return nil
+}
+
+func keysFrom(file string, args []string) ([]string, error) {
+	if file == "" {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("want at least one key or -file")
+		}
+		return args, nil
+	}
+	if len(args) > 0 {
+		return nil, fmt.Errorf("keys are read from -file; unexpected arguments %q", args)
+	}
+	return readLines(file)
+}
+
+// readLines reads the entries of a bulk file, skipping blank lines and lines
+// starting with #.
+func readLines(path string) ([]string, error) {
+	var reader io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 64<<20)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// forEach runs fn for 0..n-1 with at most concurrency calls in flight and
+// returns the results in order.
+func forEach[T any](n, concurrency int, fn func(int) T) []T {
+	results := make([]T, n)
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < max(1, min(concurrency, n)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"mini-kv/client"
+)
+
+const usage = `usage: mini-kv-ctl <command> [flags] [args]
+
+data commands (gRPC endpoints):
+  get     get <key>... or get -file <keys>; prints the values
+  put     put <key> <value> or put -file <key<TAB>value lines>
+  del     del <key>... or del -file <keys>
+
+operator commands:
+  status  leader, term and commit/applied index of every node (debug endpoints)
+  metrics dump /debug/vars metrics of every node (debug endpoints)
+  diff    diff two metric samples: two saved "metrics -output json" files, or
+          two live samples taken -interval apart (debug endpoints)
+  leader  find the leader among the gRPC endpoints
+  ping    measure round-trip latency to every gRPC endpoint
+
+Every command accepts -endpoints, -debug-endpoints, -token, -tls-* flags,
+-timeout and -output text|json. Their defaults are read from MINIKV_ENDPOINTS,
+MINIKV_DEBUG_ENDPOINTS, MINIKV_TOKEN, MINIKV_TLS_CA, MINIKV_TLS_CERT,
+MINIKV_TLS_KEY, MINIKV_TLS_SERVER_NAME, MINIKV_TIMEOUT and MINIKV_OUTPUT.
+
+Run "mini-kv-ctl <command> -h" for command flags.
+`
+
+// errReported is returned by commands that already printed why they failed.
+var errReported = errors.New("reported")
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	commands := map[string]func([]string) error{
+		"get":     runGet,
+		"put":     runPut,
+		"del":     runDel,
+		"status":  runStatus,
+		"metrics": runMetrics,
+		"diff":    runDiff,
+		"leader":  runLeader,
+		"ping":    runPing,
+	}
+	run, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+	if err := run(os.Args[2:]); err != nil {
+		if !errors.Is(err, errReported) {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[1], err)
+		}
+		os.Exit(1)
+	}
+}
+
+// options are the flags shared by every command.
+type options struct {
+	endpoints      string
+	debugEndpoints string
+	token          string
+	caFile         string
+	certFile       string
+	keyFile        string
+	serverName     string
+	skipVerify     bool
+	timeout        time.Duration
+	output         string
+}
+
+// newFlagSet registers the shared flags, with defaults taken from the
+// environment, on a command's flag set.
+func newFlagSet(name string) (*flag.FlagSet, *options) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	opts := &options{}
+	fs.StringVar(&opts.endpoints, "endpoints", env("MINIKV_ENDPOINTS", "127.0.0.1:6380"), "comma-separated gRPC endpoints")
+	fs.StringVar(&opts.debugEndpoints, "debug-endpoints", env("MINIKV_DEBUG_ENDPOINTS", "127.0.0.1:6060"), "comma-separated debug HTTP endpoints")
+	fs.StringVar(&opts.token, "token", env("MINIKV_TOKEN", ""), "bearer token sent with gRPC calls")
+	fs.StringVar(&opts.caFile, "tls-ca", env("MINIKV_TLS_CA", ""), "CA bundle used to verify the servers; enables TLS")
+	fs.StringVar(&opts.certFile, "tls-cert", env("MINIKV_TLS_CERT", ""), "client certificate; enables TLS")
+	fs.StringVar(&opts.keyFile, "tls-key", env("MINIKV_TLS_KEY", ""), "client certificate key")
+	fs.StringVar(&opts.serverName, "tls-server-name", env("MINIKV_TLS_SERVER_NAME", ""), "server name to verify instead of the endpoint host")
+	fs.BoolVar(&opts.skipVerify, "tls-insecure-skip-verify", false, "enable TLS without verifying the server certificate")
+	fs.DurationVar(&opts.timeout, "timeout", envDuration("MINIKV_TIMEOUT", 5*time.Second), "timeout of each request")
+	fs.StringVar(&opts.output, "output", env("MINIKV_OUTPUT", "text"), "output format: text or json")
+	return fs, opts
+}
+
+// parse parses args and checks the shared flags.
+func (o *options) parse(fs *flag.FlagSet, args []string) {
+	_ = fs.Parse(args)
+	if o.output != "text" && o.output != "json" {
+		fmt.Fprintf(os.Stderr, "%s: -output must be text or json, got %q\n", fs.Name(), o.output)
+		os.Exit(2)
+	}
+}
+
+func (o *options) json() bool {
+	return o.output == "json"
+}
+
+func (o *options) client(routing client.Routing) (*client.Client, error) {
+	tlsConfig, err := o.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	return client.New(context.Background(), client.Config{
+		Endpoints:      splitCSV(o.endpoints),
+		Routing:        routing,
+		DialTimeout:    o.timeout,
+		RequestTimeout: o.timeout,
+		Token:          o.token,
+		TLS:            tlsConfig,
+	})
+}
+
+// tlsConfig returns nil, which means plaintext, unless a TLS flag is set.
+func (o *options) tlsConfig() (*tls.Config, error) {
+	if o.caFile == "" && o.certFile == "" && o.serverName == "" && !o.skipVerify {
+		return nil, nil
+	}
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         o.serverName,
+		InsecureSkipVerify: o.skipVerify,
+	}
+	if o.caFile != "" {
+		caPEM, err := os.ReadFile(o.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("read tls ca: %w", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates in %s", o.caFile)
+		}
+	}
+	if o.certFile != "" || o.keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.certFile, o.keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load tls key pair: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+func env(name, fallback string) string {
+	if value, ok := os.LookupEnv(name); ok {
+		return value
+	}
+	return fallback
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	raw, ok := os.LookupEnv(name)
+	if !ok {
+		return fallback
+	}
+	if value, err := time.ParseDuration(raw); err == nil {
+		return value
+	}
+	if seconds, err := strconv.ParseFloat(raw, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	fmt.Fprintf(os.Stderr, "ignoring invalid %s=%q\n", name, raw)
+	return fallback
+}
+
+func splitCSV(raw string) []string {
+	if strings.TrimSpace(raw) == "" {
+		return nil
+	}
+	parts := strings.Split(raw, ",")
+	out := make([]string, 0, len(parts))
+	for _, part := range parts {
+		trimmed := strings.TrimSpace(part)
+		if trimmed != "" {
+			out = append(out, trimmed)
+		}
+	}
+	return out
+}
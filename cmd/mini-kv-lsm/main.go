@@ -0,0 +1,502 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"mini-kv/internal/storage/lsm"
+	"mini-kv/internal/storage/lsm/manifest"
+	"mini-kv/internal/storage/lsm/record"
+	version "mini-kv/internal/storage/lsm/sstable"
+	"mini-kv/internal/storage/lsm/vlog"
+	"mini-kv/internal/storage/lsm/wal"
+)
+
+const usage = `usage: mini-kv-lsm <command> [flags]
+
+commands:
+  levels  list column families, levels and tables from the manifest
+  sst     dump an SSTable's footer, index, bloom filter and entries
+  wal     dump WAL segments batch by batch
+  verify  verify checksums of the manifest, tables, blob files and WAL
+  stats   print per-level key-range statistics
+  repair  rebuild the manifest from files on disk and salvage the WAL
+
+Run "mini-kv-lsm <command> -h" for command flags.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	commands := map[string]func([]string) error{
+		"levels": runLevels,
+		"sst":    runSST,
+		"wal":    runWAL,
+		"verify": runVerify,
+		"stats":  runStats,
+		"repair": runRepair,
+	}
+	run, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+	if err := run(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+// parseDir parses the flags of a command that only needs the data directory.
+func parseDir(name string, args []string) string {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	dir := fs.String("dir", "", "LSM data directory")
+	_ = fs.Parse(args)
+	if *dir == "" {
+		fmt.Fprintf(os.Stderr, "%s: -dir is required\n", name)
+		os.Exit(2)
+	}
+	return *dir
+}
+
+func runLevels(args []string) error {
+	dir := parseDir("levels", args)
+	state, err := loadState(dir)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("next_file=%d last_seq=%d\n", state.NextFileNum, state.LastSeq)
+	for _, id := range state.FamilyIDs() {
+		fmt.Printf("family %d %q flushed_seq=%d\n", id, familyName(state, id), state.FlushedSeq(id))
+		for level, files := range state.Family(id).Levels {
+			if len(files) == 0 {
+				continue
+			}
+			fmt.Printf("  L%d: %d tables, %d bytes\n", level, len(files), totalSize(files))
+			for _, meta := range files {
+				fmt.Printf("    #%d [%q, %q] seq=%d-%d size=%d\n",
+					meta.FileNum, meta.Smallest, meta.Largest, meta.MinSeq, meta.MaxSeq, meta.Size)
+			}
+		}
+	}
+	for _, meta := range state.Blobs {
+		fmt.Printf("blob #%d size=%d records=%d garbage=%.1f%%\n",
+			meta.FileNum, meta.Size, meta.Count, meta.GarbageRatio()*100)
+	}
+	return nil
+}
+
+func runSST(args []string) error {
+	fs := flag.NewFlagSet("sst", flag.ExitOnError)
+	file := fs.String("file", "", "SSTable file to dump")
+	limit := fs.Int("limit", 100, "maximum number of entries to print, 0 prints all")
+	valueLen := fs.Int("value-len", 32, "maximum number of value bytes to print per entry")
+	_ = fs.Parse(args)
+	if *file == "" {
+		fmt.Fprintln(os.Stderr, "sst: -file is required")
+		os.Exit(2)
+	}
+	fileNum, _ := strconv.ParseUint(strings.TrimSuffix(filepath.Base(*file), ".sst"), 10, 64)
+	reader, err := version.Open(*file, version.TableMeta{FileNum: fileNum})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = reader.Close() }()
+
+	props := reader.Properties()
+	family := "unknown"
+	if props.FamilyKnown {
+		family = strconv.FormatUint(uint64(props.ColumnFamily), 10)
+	}
+	fmt.Printf("%s format=%d entries=%d family=%s\n", filepath.Base(*file), props.FormatVersion, props.Count, family)
+	index := reader.IndexEntries()
+	fmt.Printf("index @%d len=%d blocks=%d\n", props.Index.Offset, props.Index.Length, len(index))
+	for i, entry := range index {
+		fmt.Printf("  block %d @%d len=%d [%q, %q]\n",
+			i, entry.Handle.Offset, entry.Handle.Length, entry.FirstKey, entry.LastKey)
+	}
+	if props.Bloom.Length == 0 {
+		fmt.Println("bloom: none")
+	} else {
+		fmt.Printf("bloom @%d len=%d bits=%d hashes=%d", props.Bloom.Offset, props.Bloom.Length, props.BloomBits, props.BloomHashes)
+		if props.Count > 0 {
+			fmt.Printf(" bits/key=%.1f", float64(props.BloomBits)/float64(props.Count))
+		}
+		fmt.Println()
+	}
+
+	entries, err := reader.Entries()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("entries: %d\n", len(entries))
+	for i, entry := range entries {
+		if *limit > 0 && i >= *limit {
+			fmt.Printf("  ... %d more\n", len(entries)-i)
+			break
+		}
+		fmt.Printf("  %s\n", formatEntry(entry, *valueLen))
+	}
+	return nil
+}
+
+func runWAL(args []string) error {
+	fs := flag.NewFlagSet("wal", flag.ExitOnError)
+	dir := fs.String("dir", "", "LSM data directory; dumps every WAL segment")
+	file := fs.String("file", "", "single WAL segment to dump instead of -dir")
+	entries := fs.Bool("entries", false, "print every entry of each batch")
+	valueLen := fs.Int("value-len", 32, "maximum number of value bytes to print per entry")
+	_ = fs.Parse(args)
+
+	var paths []string
+	switch {
+	case *file != "":
+		paths = []string{*file}
+	case *dir != "":
+		var err error
+		if paths, err = wal.Segments(*dir); err != nil {
+			return err
+		}
+	default:
+		fmt.Fprintln(os.Stderr, "wal: one of -dir or -file is required")
+		os.Exit(2)
+	}
+	for _, path := range paths {
+		fmt.Println(filepath.Base(path))
+		err := walkFrames(path, func(offset int, payload []byte) error {
+			batch, err := record.DecodeBatchPayload(payload)
+			if err != nil {
+				return err
+			}
+			first, last := batchSeqs(batch)
+			fmt.Printf("  @%d batch seq=%d-%d entries=%d\n", offset, first, last, len(batch.Entries))
+			if *entries {
+				for _, entry := range batch.Entries {
+					fmt.Printf("    family=%d %s\n", entry.Family, formatEntry(entry, *valueLen))
+				}
+			}
+			return nil
+		}, func(count int, size int64) {
+			fmt.Printf("  decoded %d batches, %d bytes\n", count, size)
+		})
+		if err != nil {
+			fmt.Printf("  %v\n", err)
+		}
+	}
+	return nil
+}
+
+func runVerify(args []string) error {
+	dir := parseDir("verify", args)
+	var problems []error
+	state, err := loadState(dir)
+	if err != nil {
+		problems = append(problems, err)
+	}
+	fmt.Printf("manifest: %s\n", status(err))
+
+	for _, id := range state.FamilyIDs() {
+		for _, meta := range state.Family(id).AllFiles() {
+			err := verifyTable(dir, meta)
+			fmt.Printf("table #%d (family %d, L%d): %s\n", meta.FileNum, id, meta.Level, status(err))
+			if err != nil {
+				problems = append(problems, fmt.Errorf("table %d: %w", meta.FileNum, err))
+			}
+		}
+	}
+	for _, meta := range state.Blobs {
+		err := verifyBlob(dir, meta.FileNum)
+		fmt.Printf("blob #%d: %s\n", meta.FileNum, status(err))
+		if err != nil {
+			problems = append(problems, fmt.Errorf("blob %d: %w", meta.FileNum, err))
+		}
+	}
+
+	segments, err := wal.Segments(dir)
+	if err != nil {
+		return err
+	}
+	for i, path := range segments {
+		err := walkFrames(path, func(_ int, payload []byte) error {
+			_, err := record.DecodeBatchPayload(payload)
+			return err
+		}, nil)
+		// A torn tail on the last segment is expected after a crash and is truncated on open.
+		if err != nil && i == len(segments)-1 && errors.Is(err, record.ErrPartial) {
+			fmt.Printf("wal %s: torn tail (%v)\n", filepath.Base(path), err)
+			continue
+		}
+		fmt.Printf("wal %s: %s\n", filepath.Base(path), status(err))
+		if err != nil {
+			problems = append(problems, fmt.Errorf("wal %s: %w", filepath.Base(path), err))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problems found: %w", len(problems), errors.Join(problems...))
+	}
+	fmt.Println("all checks passed")
+	return nil
+}
+
+func runStats(args []string) error {
+	dir := parseDir("stats", args)
+	state, err := loadState(dir)
+	if err != nil {
+		return err
+	}
+	var totalTables int
+	var totalBytes, totalEntries int64
+	for _, id := range state.FamilyIDs() {
+		fmt.Printf("family %d %q\n", id, familyName(state, id))
+		for level, files := range state.Family(id).Levels {
+			if len(files) == 0 {
+				continue
+			}
+			var entries int64
+			var smallest, largest []byte
+			var minSeq, maxSeq uint64
+			for i, meta := range files {
+				reader, err := version.Open(filepath.Join(dir, version.FileName(meta.FileNum)), meta)
+				if err != nil {
+					return fmt.Errorf("open table %d: %w", meta.FileNum, err)
+				}
+				entries += reader.Properties().Count
+				_ = reader.Close()
+				if i == 0 || bytes.Compare(meta.Smallest, smallest) < 0 {
+					smallest = meta.Smallest
+				}
+				if i == 0 || bytes.Compare(meta.Largest, largest) > 0 {
+					largest = meta.Largest
+				}
+				if i == 0 || meta.MinSeq < minSeq {
+					minSeq = meta.MinSeq
+				}
+				maxSeq = max(maxSeq, meta.MaxSeq)
+			}
+			size := totalSize(files)
+			fmt.Printf("  L%d: tables=%d bytes=%d entries=%d avg_table=%d keys=[%q, %q] seq=%d-%d",
+				level, len(files), size, entries, size/int64(len(files)), smallest, largest, minSeq, maxSeq)
+			if level == 0 {
+				fmt.Printf(" overlaps=%d", overlaps(files))
+			}
+			fmt.Println()
+			totalTables += len(files)
+			totalBytes += size
+			totalEntries += entries
+		}
+	}
+	var blobBytes, garbageBytes int64
+	for _, meta := range state.Blobs {
+		blobBytes += meta.Size
+		garbageBytes += meta.GarbageBytes
+	}
+	segments, err := wal.Segments(dir)
+	if err != nil {
+		return err
+	}
+	var walBytes int64
+	for _, path := range segments {
+		if info, err := os.Stat(path); err == nil {
+			walBytes += info.Size()
+		}
+	}
+	fmt.Printf("total: tables=%d bytes=%d entries=%d\n", totalTables, totalBytes, totalEntries)
+	fmt.Printf("blobs: files=%d bytes=%d garbage=%d\n", len(state.Blobs), blobBytes, garbageBytes)
+	fmt.Printf("wal: segments=%d bytes=%d\n", len(segments), walBytes)
+	return nil
+}
+
+func runRepair(args []string) error {
+	dir := parseDir("repair", args)
+	report, err := lsm.Repair(dir)
+	if report.ManifestError != nil {
+		fmt.Printf("old manifest: %v\n", report.ManifestError)
+	}
+	for _, result := range report.WAL {
+		if result.Dropped > 0 {
+			fmt.Printf("wal %s: kept %d batches (%d bytes), dropped %d bytes: %v\n",
+				filepath.Base(result.Path), result.Batches, result.Kept, result.Dropped, result.Err)
+		}
+	}
+	printNums("missing files", report.Missing)
+	printNums("recovered tables into their column family's L0", report.Recovered)
+	printNums("registered column families found in WAL or recovered tables", uint32sToUint64s(report.Families))
+	if len(report.Lost) > 0 {
+		fmt.Printf("moved to lost/: %s\n", strings.Join(report.Lost, " "))
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s with %d tables and %d blob files\n",
+		filepath.Base(report.Manifest), len(report.Tables), len(report.Blobs))
+	return nil
+}
+
+// loadState replays the current manifest. On a decode error it returns the
+// state built from the readable prefix together with the error.
+func loadState(dir string) (*version.State, error) {
+	state := (&version.State{NextFileNum: 1}).Clone()
+	path, err := manifest.CurrentPath(dir)
+	if err != nil {
+		return state, err
+	}
+	err = manifest.ReadFile(path, func(rec manifest.Record) error {
+		if rec.Snapshot != nil {
+			state = rec.Snapshot
+		} else {
+			state = state.Apply(*rec.Edit)
+		}
+		return nil
+	})
+	return state, err
+}
+
+// walkFrames decodes every frame of a file with record.DecodeFrame. done, if
+// set, receives the number of frames and bytes decoded before any error.
+func walkFrames(path string, fn func(offset int, payload []byte) error, done func(int, int64)) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	offset, count := 0, 0
+	for offset < len(data) {
+		payload, consumed, err := record.DecodeFrame(data[offset:])
+		if err == nil {
+			err = fn(offset, payload)
+		}
+		if err != nil {
+			if done != nil {
+				done(count, int64(offset))
+			}
+			return fmt.Errorf("frame at %d of %d bytes: %w", offset, len(data), err)
+		}
+		offset += consumed
+		count++
+	}
+	if done != nil {
+		done(count, int64(offset))
+	}
+	return nil
+}
+
+func verifyTable(dir string, meta version.TableMeta) error {
+	reader, err := version.Open(filepath.Join(dir, version.FileName(meta.FileNum)), meta)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = reader.Close() }()
+	return reader.VerifyChecksums()
+}
+
+func verifyBlob(dir string, fileNum uint64) error {
+	reader, err := vlog.Open(dir, fileNum)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = reader.Close() }()
+	return reader.Iterate(func(vlog.Pointer, []byte, []byte) error { return nil })
+}
+
+func familyName(state *version.State, id uint32) string {
+	if id == 0 {
+		return lsm.DefaultColumnFamilyName
+	}
+	for _, family := range state.Families {
+		if family.ID == id {
+			return family.Name
+		}
+	}
+	return ""
+}
+
+func totalSize(files []version.TableMeta) int64 {
+	var size int64
+	for _, meta := range files {
+		size += meta.Size
+	}
+	return size
+}
+
+// overlaps counts pairs of L0 tables whose key ranges intersect.
+func overlaps(files []version.TableMeta) int {
+	count := 0
+	for i := range files {
+		for j := i + 1; j < len(files); j++ {
+			if bytes.Compare(files[i].Smallest, files[j].Largest) <= 0 &&
+				bytes.Compare(files[j].Smallest, files[i].Largest) <= 0 {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+func batchSeqs(batch record.Batch) (uint64, uint64) {
+	if len(batch.Entries) == 0 {
+		return batch.SeqStart, batch.SeqStart
+	}
+	first, last := batch.Entries[0].Seq, batch.Entries[0].Seq
+	for _, entry := range batch.Entries {
+		first, last = min(first, entry.Seq), max(last, entry.Seq)
+	}
+	return first, last
+}
+
+func formatEntry(entry record.Entry, valueLen int) string {
+	kind := map[record.Kind]string{
+		record.KindPut:          "put",
+		record.KindDelete:       "del",
+		record.KindValuePointer: "blob",
+	}[entry.Kind]
+	if kind == "" {
+		kind = fmt.Sprintf("kind(%d)", entry.Kind)
+	}
+	switch entry.Kind {
+	case record.KindDelete:
+		return fmt.Sprintf("seq=%d %s %q", entry.Seq, kind, entry.Key)
+	case record.KindValuePointer:
+		if ptr, err := vlog.DecodePointer(entry.Value); err == nil {
+			return fmt.Sprintf("seq=%d %s %q -> #%d@%d+%d", entry.Seq, kind, entry.Key, ptr.FileNum, ptr.Offset, ptr.Size)
+		}
+	}
+	value := entry.Value
+	suffix := ""
+	if valueLen >= 0 && len(value) > valueLen {
+		value, suffix = value[:valueLen], fmt.Sprintf("... (%d bytes)", len(entry.Value))
+	}
+	return fmt.Sprintf("seq=%d %s %q = %q%s", entry.Seq, kind, entry.Key, value, suffix)
+}
+
+func status(err error) string {
+	if err != nil {
+		return "FAILED: " + err.Error()
+	}
+	return "ok"
+}
+
+func printNums(label string, nums []uint64) {
+	if len(nums) == 0 {
+		return
+	}
+	parts := make([]string, len(nums))
+	for i, num := range nums {
+		parts[i] = strconv.FormatUint(num, 10)
+	}
+	fmt.Printf("%s: %s\n", label, strings.Join(parts, " "))
+}
+
+func uint32sToUint64s(in []uint32) []uint64 {
+	out := make([]uint64, len(in))
+	for i, v := range in {
+		out[i] = uint64(v)
+	}
+	return out
+}
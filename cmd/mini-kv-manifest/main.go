@@ -0,0 +1,137 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"mini-kv/internal/storage/lsm/manifest"
+	version "mini-kv/internal/storage/lsm/sstable"
+)
+
+func main() {
+	var dir string
+	var file string
+	var summaryOnly bool
+
+	flag.StringVar(&dir, "dir", "", "LSM data directory; dumps the manifest named by CURRENT")
+	flag.StringVar(&file, "file", "", "explicit MANIFEST file to dump instead of -dir")
+	flag.BoolVar(&summaryOnly, "summary", false, "print only the final version state")
+	flag.Parse()
+
+	path, err := manifestPath(dir, file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "locate manifest: %v\n", err)
+		os.Exit(2)
+	}
+	if err := dump(os.Stdout, path, summaryOnly); err != nil {
+		fmt.Fprintf(os.Stderr, "dump manifest: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func manifestPath(dir, file string) (string, error) {
+	switch {
+	case file != "":
+		return file, nil
+	case dir != "":
+		return manifest.CurrentPath(dir)
+	default:
+		return "", fmt.Errorf("one of -dir or -file is required")
+	}
+}
+
+func dump(w io.Writer, path string, summaryOnly bool) error {
+	fmt.Fprintf(w, "%s\n", filepath.Base(path))
+	state := (&version.State{NextFileNum: 1}).Clone()
+	records := 0
+	err := manifest.ReadFile(path, func(rec manifest.Record) error {
+		records++
+		if rec.Snapshot != nil {
+			state = rec.Snapshot
+			if !summaryOnly {
+				fmt.Fprintf(w, "@%d snapshot\n", rec.Offset)
+				printState(w, rec.Snapshot)
+			}
+			return nil
+		}
+		state = state.Apply(*rec.Edit)
+		if !summaryOnly {
+			printEdit(w, rec)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "final state after %d records\n", records)
+	printState(w, state)
+	return nil
+}
+
+func printEdit(w io.Writer, rec manifest.Record) {
+	edit := rec.Edit
+	format := "binary"
+	if rec.Legacy {
+		format = "json"
+	}
+	fmt.Fprintf(w, "@%d edit (%s) next_file=%d last_seq=%d family=%d flushed_seq=%d\n",
+		rec.Offset, format, edit.NextFileNum, edit.LastSeq, edit.Family, edit.FlushedSeq)
+	for _, meta := range edit.AddedFamilies {
+		fmt.Fprintf(w, "  + family %d %q\n", meta.ID, meta.Name)
+	}
+	for _, meta := range edit.Added {
+		fmt.Fprintf(w, "  + table %s\n", formatTable(meta))
+	}
+	for _, fileNum := range edit.Deleted {
+		fmt.Fprintf(w, "  - table #%d\n", fileNum)
+	}
+	for _, meta := range edit.AddedBlobs {
+		fmt.Fprintf(w, "  + blob %s\n", formatBlob(meta))
+	}
+	for _, fileNum := range edit.DeletedBlobs {
+		fmt.Fprintf(w, "  - blob #%d\n", fileNum)
+	}
+	for _, garbage := range edit.BlobGarbage {
+		fmt.Fprintf(w, "  ~ blob #%d garbage +%d bytes +%d records\n", garbage.FileNum, garbage.Bytes, garbage.Count)
+	}
+}
+
+func printState(w io.Writer, state *version.State) {
+	fmt.Fprintf(w, "  next_file=%d last_seq=%d\n", state.NextFileNum, state.LastSeq)
+	names := map[uint32]string{0: "default"}
+	for _, family := range state.Families {
+		names[family.ID] = family.Name
+	}
+	for _, id := range state.FamilyIDs() {
+		fmt.Fprintf(w, "  family %d %q flushed_seq=%d\n", id, names[id], state.FlushedSeq(id))
+		for level, files := range state.Family(id).Levels {
+			if len(files) == 0 {
+				continue
+			}
+			var size int64
+			for _, meta := range files {
+				size += meta.Size
+			}
+			fmt.Fprintf(w, "    L%d: %d tables, %d bytes\n", level, len(files), size)
+			for _, meta := range files {
+				fmt.Fprintf(w, "      %s\n", formatTable(meta))
+			}
+		}
+	}
+	for _, meta := range state.Blobs {
+		fmt.Fprintf(w, "  blob %s\n", formatBlob(meta))
+	}
+}
+
+func formatTable(meta version.TableMeta) string {
+	return fmt.Sprintf("L%d #%d [%q, %q] seq=%d-%d size=%d",
+		meta.Level, meta.FileNum, meta.Smallest, meta.Largest, meta.MinSeq, meta.MaxSeq, meta.Size)
+}
+
+func formatBlob(meta version.BlobMeta) string {
+	return fmt.Sprintf("#%d size=%d records=%d garbage=%d bytes/%d records",
+		meta.FileNum, meta.Size, meta.Count, meta.GarbageBytes, meta.GarbageCount)
+}
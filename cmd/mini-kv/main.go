@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
@@ -12,6 +14,11 @@ import (
 
 func main() {
 	cfgPath := os.Getenv("MINIKV_CONFIG")
+	if len(os.Args) > 1 && os.Args[1] == "init" {
+		runInit(cfgPath, os.Args[2:])
+		return
+	}
+
 	application, err := app.Start(cfgPath)
 	if err != nil {
 		log.Fatal(err)
@@ -24,3 +31,20 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// runInit stamps the identity of a new node into its data directories. The
+// first node of a cluster generates the cluster id unless one is given.
+func runInit(cfgPath string, args []string) {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	clusterID := fs.String("cluster-id", "", "cluster to join; empty uses raft.cluster_id or generates a new one")
+	_ = fs.Parse(args)
+
+	id, err := app.Init(cfgPath, *clusterID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("initialized %s\n", id)
+	if *clusterID == "" {
+		fmt.Printf("initialize the other nodes with: mini-kv init -cluster-id %s\n", id.ClusterID)
+	}
+}
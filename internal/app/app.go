@@ -15,7 +15,11 @@ import (
 	"mini-kv/internal/raftstore"
 	raftstoretransport "mini-kv/internal/raftstore/transport"
 	grpcserver "mini-kv/internal/server/grpcserver"
+	"mini-kv/internal/server/httpserver"
+	"mini-kv/internal/server/respserver"
 	"mini-kv/internal/service/minikv"
+	lsmstore "mini-kv/internal/storage/lsm"
+	"mini-kv/internal/tracing"
 )
 
 type App struct {
@@ -24,12 +28,15 @@ type App struct {
 	KVStore       *kvlsm.Store
 	KVService     minikv.Service
 	Server        *grpcserver.Server
+	RESPServer    *respserver.Server
+	HTTPServer    *httpserver.Server
 	DebugServer   *observability.Server
 	Registry      *observability.Registry
 	RaftNode      raft.Node
 	RaftStorage   *logstore.FileStorage
 	RaftRuntime   *raftstore.Runtime
-	RaftTransport *raftstoretransport.Transport
+	RaftTransport raftstoretransport.Endpoint
+	Tracing       *tracing.Provider
 }
 
 func Start(cfgPath string) (*App, error) {
@@ -43,22 +50,49 @@ func Start(cfgPath string) (*App, error) {
 		return nil, err
 	}
 	registry := observability.NewRegistry()
+	traceProvider, err := tracing.Setup(context.Background(), cfg.Tracing, cfg.Raft.ID)
+	if err != nil {
+		return nil, err
+	}
 
-	engine, err := kvlsm.Open(cfg.Storage.LSMPath)
+	engine, err := kvlsm.Open(cfg.Storage.LSMPath, lsmstore.WithEventListener(observability.LSMEventListener(registry, cfg.Raft.ID)))
 	if err != nil {
+		_ = traceProvider.Shutdown(context.Background())
 		return nil, err
 	}
 
-	raftTransport, err := raftstoretransport.New(cfg.Raft.ID, cfg.Raft.ListenAddr, cfg.Raft.PeerAddrs)
+	raftStorage, err := logstore.OpenFileStorage(cfg.Raft.WALPath)
+	if err != nil {
+		_ = traceProvider.Shutdown(context.Background())
+		_ = engine.Close()
+		return nil, err
+	}
+	// The transport checks peers against the resolved cluster id, so the
+	// identity is settled before it is built.
+	id, err := checkIdentity(cfg, l, engine, raftStorage)
 	if err != nil {
+		_ = traceProvider.Shutdown(context.Background())
 		_ = engine.Close()
+		_ = raftStorage.Close()
 		return nil, err
 	}
 
-	raftStorage, err := logstore.OpenFileStorage(cfg.Raft.WALPath)
+	raftTransport, err := newRaftTransport(cfg.Raft,
+		raftstoretransport.WithTLS(raftstoretransport.TLSConfig{
+			CertFile: cfg.Raft.TLS.CertFile,
+			KeyFile:  cfg.Raft.TLS.KeyFile,
+			CAFile:   cfg.Raft.TLS.CAFile,
+		}),
+		raftstoretransport.WithClusterID(id.ClusterID),
+		raftstoretransport.WithMinProtocolVersion(byte(cfg.Raft.MinProtocolVersion)),
+		compressionOption(cfg.Raft.Compression),
+		raftstoretransport.WithFrameObserver(func(peer, message string, rawBytes, wireBytes int) {
+			registry.AddRaftTransportBytes(cfg.Raft.ID, peer, message, rawBytes, wireBytes)
+		}))
 	if err != nil {
+		_ = traceProvider.Shutdown(context.Background())
 		_ = engine.Close()
-		_ = raftTransport.Close()
+		_ = raftStorage.Close()
 		return nil, err
 	}
 
@@ -70,8 +104,11 @@ func Start(cfgPath string) (*App, error) {
 		ElectionTimeout:  time.Duration(cfg.Raft.ElectionTimeoutMS) * time.Millisecond,
 		HeartbeatTimeout: time.Duration(cfg.Raft.HeartbeatTimeoutMS) * time.Millisecond,
 		ApplyBufferSize:  cfg.Raft.ApplyBufferSize,
+		MaxInflightMsgs:  cfg.Raft.MaxInflightMsgs,
+		MaxSizePerMsg:    cfg.Raft.MaxSizePerMsg,
 	})
 	if err != nil {
+		_ = traceProvider.Shutdown(context.Background())
 		_ = engine.Close()
 		_ = raftTransport.Close()
 		_ = raftStorage.Close()
@@ -80,12 +117,14 @@ func Start(cfgPath string) (*App, error) {
 
 	handler, ok := raftNode.(raft.RPCHandler)
 	if !ok {
+		_ = traceProvider.Shutdown(context.Background())
 		_ = engine.Close()
 		_ = raftTransport.Close()
 		_ = raftStorage.Close()
 		return nil, errors.New("raft node does not implement RPCHandler")
 	}
 	if err := raftTransport.Start(handler); err != nil {
+		_ = traceProvider.Shutdown(context.Background())
 		_ = engine.Close()
 		_ = raftTransport.Close()
 		_ = raftStorage.Close()
@@ -93,20 +132,25 @@ func Start(cfgPath string) (*App, error) {
 	}
 
 	if err := raftNode.Start(); err != nil {
+		_ = traceProvider.Shutdown(context.Background())
 		_ = engine.Close()
 		_ = raftTransport.Close()
 		_ = raftStorage.Close()
 		return nil, err
 	}
 
+	slowLog := observability.NewSlowLog(cfg.SlowLog, l)
 	runtime := raftstore.NewWithOptions(engine, raftNode, raftstore.Options{
 		SnapshotThreshold: cfg.Raft.SnapshotThreshold,
 		NodeID:            cfg.Raft.ID,
 		Registry:          registry,
+		SlowLog:           slowLog,
 	})
 	service := minikv.NewRaft(runtime)
-	srv := grpcserver.New(cfg, l, service, registry)
-	debugServer := observability.NewServer(cfg.Debug, l, registry)
+	srv := grpcserver.New(cfg, l, service, registry, slowLog)
+	respServer := respserver.New(cfg, l, service, registry, slowLog)
+	httpServer := httpserver.New(cfg, l, service, runtime, registry, slowLog)
+	debugServer := observability.NewServer(cfg.Debug, l, registry, runtime, slowLog)
 
 	return &App{
 		Config:        cfg,
@@ -114,12 +158,15 @@ func Start(cfgPath string) (*App, error) {
 		KVStore:       engine,
 		KVService:     service,
 		Server:        srv,
+		RESPServer:    respServer,
+		HTTPServer:    httpServer,
 		DebugServer:   debugServer,
 		Registry:      registry,
 		RaftNode:      raftNode,
 		RaftStorage:   raftStorage,
 		RaftRuntime:   runtime,
 		RaftTransport: raftTransport,
+		Tracing:       traceProvider,
 	}, nil
 }
 
@@ -127,7 +174,8 @@ func (a *App) Run(ctx context.Context) error {
 	if a.RaftRuntime != nil {
 		a.RaftRuntime.Start(ctx)
 	}
-	observability.StartRaftSampler(ctx, a.Registry, a.Config.Raft.ID, a.RaftNode, a.RaftStorage, 0)
+	observability.StartRaftSampler(ctx, a.Registry, a.Config.Raft.ID, a.RaftRuntime, 0)
+	observability.StartLSMSampler(ctx, a.Registry, a.Config.Raft.ID, a.KVStore, 0)
 	if a.DebugServer != nil {
 		go func() {
 			if err := a.DebugServer.Run(ctx); err != nil {
@@ -135,6 +183,20 @@ func (a *App) Run(ctx context.Context) error {
 			}
 		}()
 	}
+	if a.RESPServer != nil {
+		go func() {
+			if err := a.RESPServer.Run(ctx); err != nil {
+				a.Logger.Errorf("resp server stopped: %v", err)
+			}
+		}()
+	}
+	if a.HTTPServer != nil {
+		go func() {
+			if err := a.HTTPServer.Run(ctx); err != nil {
+				a.Logger.Errorf("http server stopped: %v", err)
+			}
+		}()
+	}
 	defer func() {
 		if a.RaftNode != nil {
 			_ = a.RaftNode.Stop()
@@ -148,10 +210,32 @@ func (a *App) Run(ctx context.Context) error {
 		if a.KVStore != nil {
 			_ = a.KVStore.Close()
 		}
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := a.Tracing.Shutdown(shutdownCtx); err != nil {
+			a.Logger.Errorf("flush traces: %v", err)
+		}
 	}()
 	return a.Server.Run(ctx)
 }
 
+func newRaftTransport(cfg config.RaftConfig, opts ...raftstoretransport.Option) (raftstoretransport.Endpoint, error) {
+	switch cfg.Transport {
+	case "tcp":
+		return raftstoretransport.New(cfg.ID, cfg.ListenAddr, cfg.PeerAddrs, opts...)
+	case "grpc":
+		return raftstoretransport.NewGRPC(cfg.ID, cfg.ListenAddr, cfg.PeerAddrs, opts...)
+	}
+	return nil, fmt.Errorf("unknown raft transport %q", cfg.Transport)
+}
+
+func compressionOption(cfg config.RaftCompression) raftstoretransport.Option {
+	if !cfg.Enabled {
+		return nil
+	}
+	return raftstoretransport.WithCompression(cfg.Threshold)
+}
+
 func validate(cfg config.RaftConfig) error {
 	for _, peer := range cfg.Peers {
 		if cfg.PeerAddrs[peer] == "" {
@@ -193,6 +193,7 @@ storage:
 
 raft:
   id: %s
+  cluster_id: integration
   peers: [node1, node2, node3]
   listen_addr: %s
   peer_addrs:
@@ -0,0 +1,142 @@
+package app
+
+import (
+	"fmt"
+
+	"mini-kv/internal/config"
+	"mini-kv/internal/identity"
+	kvlsm "mini-kv/internal/kv/lsm"
+	"mini-kv/internal/logger"
+	"mini-kv/internal/raft"
+	"mini-kv/internal/raft/logstore"
+)
+
+// Init creates the identity of a new node, before its first start. An empty
+// clusterID takes raft.cluster_id from the config, or generates a new cluster.
+func Init(cfgPath, clusterID string) (identity.Identity, error) {
+	cfg, err := config.Load(cfgPath)
+	if err != nil {
+		return identity.Identity{}, err
+	}
+	if clusterID == "" {
+		clusterID = cfg.Raft.ClusterID
+	}
+	if cfg.Raft.ClusterID != "" && clusterID != cfg.Raft.ClusterID {
+		return identity.Identity{}, fmt.Errorf("cluster id %q does not match raft.cluster_id %q", clusterID, cfg.Raft.ClusterID)
+	}
+
+	engine, err := kvlsm.Open(cfg.Storage.LSMPath)
+	if err != nil {
+		return identity.Identity{}, err
+	}
+	defer func() { _ = engine.Close() }()
+	raftStorage, err := logstore.OpenFileStorage(cfg.Raft.WALPath)
+	if err != nil {
+		return identity.Identity{}, err
+	}
+	defer func() { _ = raftStorage.Close() }()
+
+	locations, err := identityLocations(cfg, engine, raftStorage)
+	if err != nil {
+		return identity.Identity{}, err
+	}
+	for _, loc := range locations {
+		if loc.Stamped {
+			return identity.Identity{}, fmt.Errorf("%s is already initialized as %s", loc.Name, loc.Identity)
+		}
+		if !loc.Empty {
+			return identity.Identity{}, fmt.Errorf("%s already holds data; init only creates the identity of new nodes", loc.Name)
+		}
+	}
+	id, err := identity.New(clusterID, cfg.Raft.ID)
+	if err != nil {
+		return identity.Identity{}, err
+	}
+	if err := raftStorage.SetIdentity(id); err != nil {
+		return identity.Identity{}, err
+	}
+	if err := engine.SetIdentity(id); err != nil {
+		return identity.Identity{}, err
+	}
+	return id, nil
+}
+
+// checkIdentity refuses to pair an LSM directory and a raft log that belong to
+// different nodes or clusters, or to another node than raft.id, and an LSM
+// directory that has applied entries past the end of its raft log. Places not
+// stamped yet are stamped, which happens on the first start of a node. It
+// returns the node's identity.
+func checkIdentity(cfg config.Config, l *logger.Logger, engine *kvlsm.Store, raftStorage *logstore.FileStorage) (identity.Identity, error) {
+	locations, err := identityLocations(cfg, engine, raftStorage)
+	if err != nil {
+		return identity.Identity{}, err
+	}
+	id, err := identity.Resolve(cfg.Raft.ID, cfg.Raft.ClusterID, locations...)
+	if err != nil {
+		return identity.Identity{}, err
+	}
+	applied, err := engine.AppliedIndex()
+	if err != nil {
+		return identity.Identity{}, err
+	}
+	lastIndex, err := raftStorage.LastIndex()
+	if err != nil {
+		return identity.Identity{}, err
+	}
+	if applied > lastIndex {
+		return identity.Identity{}, fmt.Errorf("%w: %s has applied raft index %d, but %s ends at index %d",
+			identity.ErrMismatch, locations[1].Name, applied, locations[0].Name, lastIndex)
+	}
+
+	if !locations[0].Stamped {
+		if err := raftStorage.SetIdentity(id); err != nil {
+			return identity.Identity{}, err
+		}
+		l.Infof("stamped %s into %s", id, locations[0].Name)
+	}
+	if !locations[1].Stamped {
+		if err := engine.SetIdentity(id); err != nil {
+			return identity.Identity{}, err
+		}
+		l.Infof("stamped %s into %s", id, locations[1].Name)
+	}
+	return id, nil
+}
+
+// identityLocations describes the raft log and the LSM directory, in that
+// order.
+func identityLocations(cfg config.Config, engine *kvlsm.Store, raftStorage *logstore.FileStorage) ([]identity.Location, error) {
+	walID, walStamped := raftStorage.Identity()
+	walEmpty, err := raftLogEmpty(raftStorage)
+	if err != nil {
+		return nil, err
+	}
+	lsmID, lsmStamped, err := engine.Identity()
+	if err != nil {
+		return nil, err
+	}
+	lsmEmpty, err := engine.Empty()
+	if err != nil {
+		return nil, err
+	}
+	return []identity.Location{
+		{Name: "raft log " + cfg.Raft.WALPath, Identity: walID, Stamped: walStamped, Empty: walEmpty},
+		{Name: "LSM directory " + cfg.Storage.LSMPath, Identity: lsmID, Stamped: lsmStamped, Empty: lsmEmpty},
+	}, nil
+}
+
+func raftLogEmpty(storage *logstore.FileStorage) (bool, error) {
+	lastIndex, err := storage.LastIndex()
+	if err != nil {
+		return false, err
+	}
+	hardState, err := storage.LoadHardState()
+	if err != nil {
+		return false, err
+	}
+	snapshot, err := storage.LoadSnapshot()
+	if err != nil {
+		return false, err
+	}
+	return lastIndex == 0 && hardState == (raft.HardState{}) && snapshot.Index == 0, nil
+}
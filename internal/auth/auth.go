@@ -0,0 +1,222 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+
+	"mini-kv/internal/config"
+)
+
+var (
+	ErrNoCredentials    = errors.New("auth: no credentials")
+	ErrUnauthenticated  = errors.New("auth: unauthenticated")
+	ErrPermissionDenied = errors.New("auth: permission denied")
+)
+
+type Permission uint8
+
+const (
+	PermissionRead Permission = 1 << iota
+	PermissionWrite
+)
+
+func (p Permission) String() string {
+	switch p {
+	case PermissionRead:
+		return "read"
+	case PermissionWrite:
+		return "write"
+	case PermissionRead | PermissionWrite:
+		return "read,write"
+	}
+	return fmt.Sprintf("permission(%d)", uint8(p))
+}
+
+func ParsePermission(name string) (Permission, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "read":
+		return PermissionRead, nil
+	case "write":
+		return PermissionWrite, nil
+	}
+	return 0, fmt.Errorf("auth: unknown permission %q", name)
+}
+
+type Principal struct {
+	Name string
+}
+
+// Credentials are what a protocol layer extracted from a request. Certificates
+// must already be verified by the TLS handshake.
+type Credentials struct {
+	Token        string
+	Certificates []*x509.Certificate
+}
+
+type Authenticator interface {
+	Authenticate(ctx context.Context, creds Credentials) (Principal, error)
+}
+
+type AuthenticatorFunc func(ctx context.Context, creds Credentials) (Principal, error)
+
+func (f AuthenticatorFunc) Authenticate(ctx context.Context, creds Credentials) (Principal, error) {
+	return f(ctx, creds)
+}
+
+// StaticTokens maps bearer tokens to principal names.
+func StaticTokens(tokens map[string]string) Authenticator {
+	copied := make(map[string]string, len(tokens))
+	for token, principal := range tokens {
+		copied[token] = principal
+	}
+	return AuthenticatorFunc(func(_ context.Context, creds Credentials) (Principal, error) {
+		if creds.Token == "" {
+			return Principal{}, ErrNoCredentials
+		}
+		name, ok := copied[creds.Token]
+		if !ok {
+			return Principal{}, fmt.Errorf("%w: unknown token", ErrUnauthenticated)
+		}
+		return Principal{Name: name}, nil
+	})
+}
+
+// ClientCertSubjects uses the common name of a verified client certificate as
+// the principal name.
+func ClientCertSubjects() Authenticator {
+	return AuthenticatorFunc(func(_ context.Context, creds Credentials) (Principal, error) {
+		if len(creds.Certificates) == 0 {
+			return Principal{}, ErrNoCredentials
+		}
+		name := creds.Certificates[0].Subject.CommonName
+		if name == "" {
+			return Principal{}, fmt.Errorf("%w: client certificate has no common name", ErrUnauthenticated)
+		}
+		return Principal{Name: name}, nil
+	})
+}
+
+// Chain tries each authenticator in order and returns the first principal.
+// Authenticators that find no credentials of their kind are skipped.
+func Chain(authenticators ...Authenticator) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context, creds Credentials) (Principal, error) {
+		for _, authenticator := range authenticators {
+			principal, err := authenticator.Authenticate(ctx, creds)
+			if errors.Is(err, ErrNoCredentials) {
+				continue
+			}
+			return principal, err
+		}
+		return Principal{}, fmt.Errorf("%w: no credentials", ErrUnauthenticated)
+	})
+}
+
+type Grant struct {
+	Prefix      string
+	Permissions Permission
+}
+
+// Policy restricts each principal to the key prefixes it was granted.
+// Principals without grants can do nothing.
+type Policy struct {
+	grants map[string][]Grant
+}
+
+func NewPolicy(grants map[string][]Grant) *Policy {
+	copied := make(map[string][]Grant, len(grants))
+	for principal, list := range grants {
+		copied[principal] = append([]Grant(nil), list...)
+	}
+	return &Policy{grants: copied}
+}
+
+func (p *Policy) AuthorizeKey(principal Principal, perm Permission, key string) error {
+	for _, grant := range p.grants[principal.Name] {
+		if grant.Permissions&perm == perm && strings.HasPrefix(key, grant.Prefix) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s may not %s key %q", ErrPermissionDenied, principal.Name, perm, key)
+}
+
+// AuthorizeRange checks [start, end); an empty end means the range is
+// unbounded, which only a grant with an empty prefix covers.
+func (p *Policy) AuthorizeRange(principal Principal, perm Permission, start, end string) error {
+	for _, grant := range p.grants[principal.Name] {
+		if grant.Permissions&perm == perm && rangeWithinPrefix(start, end, grant.Prefix) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s may not %s range [%q, %q)", ErrPermissionDenied, principal.Name, perm, start, end)
+}
+
+func rangeWithinPrefix(start, end, prefix string) bool {
+	if prefix == "" {
+		return true
+	}
+	if !strings.HasPrefix(start, prefix) || end == "" {
+		return false
+	}
+	if strings.HasPrefix(end, prefix) {
+		return true
+	}
+	limit, ok := prefixEnd(prefix)
+	return ok && end <= limit
+}
+
+// prefixEnd returns the smallest key greater than every key with the prefix.
+func prefixEnd(prefix string) (string, bool) {
+	raw := []byte(prefix)
+	for i := len(raw) - 1; i >= 0; i-- {
+		if raw[i] < 0xff {
+			raw[i]++
+			return string(raw[:i+1]), true
+		}
+	}
+	return "", false
+}
+
+// Guard bundles authentication and authorization. A nil Guard allows
+// everything, which is how auth stays disabled.
+type Guard struct {
+	Authenticator Authenticator
+	Policy        *Policy
+}
+
+// FromConfig builds the guard described by cfg, or nil when auth is disabled.
+func FromConfig(cfg config.AuthConfig) (*Guard, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	tokens := make(map[string]string, len(cfg.Tokens))
+	for _, token := range cfg.Tokens {
+		if token.Token == "" || token.Principal == "" {
+			return nil, errors.New("auth: token entries need a token and a principal")
+		}
+		tokens[token.Token] = token.Principal
+	}
+	grants := make(map[string][]Grant, len(cfg.Principals))
+	for _, principal := range cfg.Principals {
+		if principal.Name == "" {
+			return nil, errors.New("auth: principal without a name")
+		}
+		for _, grant := range principal.Grants {
+			var perms Permission
+			for _, name := range grant.Permissions {
+				perm, err := ParsePermission(name)
+				if err != nil {
+					return nil, err
+				}
+				perms |= perm
+			}
+			grants[principal.Name] = append(grants[principal.Name], Grant{Prefix: grant.Prefix, Permissions: perms})
+		}
+	}
+	return &Guard{
+		Authenticator: Chain(StaticTokens(tokens), ClientCertSubjects()),
+		Policy:        NewPolicy(grants),
+	}, nil
+}
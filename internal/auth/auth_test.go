@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"testing"
+
+	"mini-kv/internal/config"
+)
+
+func TestFromConfigAuthenticatesAndAuthorizes(t *testing.T) {
+	guard, err := FromConfig(config.AuthConfig{
+		Enabled: true,
+		Tokens:  []config.AuthToken{{Token: "secret-a", Principal: "tenant-a"}},
+		Principals: []config.AuthPrincipal{
+			{Name: "tenant-a", Grants: []config.AuthGrant{
+				{Prefix: "a/", Permissions: []string{"read", "write"}},
+				{Prefix: "shared/", Permissions: []string{"read"}},
+			}},
+			{Name: "ops", Grants: []config.AuthGrant{{Prefix: "", Permissions: []string{"read"}}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("from config: %v", err)
+	}
+	ctx := context.Background()
+
+	tenant, err := guard.Authenticator.Authenticate(ctx, Credentials{Token: "secret-a"})
+	if err != nil || tenant.Name != "tenant-a" {
+		t.Fatalf("token principal = %+v, %v; want tenant-a", tenant, err)
+	}
+	if _, err := guard.Authenticator.Authenticate(ctx, Credentials{Token: "wrong"}); !errors.Is(err, ErrUnauthenticated) {
+		t.Fatalf("unknown token error = %v, want %v", err, ErrUnauthenticated)
+	}
+	if _, err := guard.Authenticator.Authenticate(ctx, Credentials{}); !errors.Is(err, ErrUnauthenticated) {
+		t.Fatalf("missing credentials error = %v, want %v", err, ErrUnauthenticated)
+	}
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "ops"}}
+	ops, err := guard.Authenticator.Authenticate(ctx, Credentials{Certificates: []*x509.Certificate{cert}})
+	if err != nil || ops.Name != "ops" {
+		t.Fatalf("certificate principal = %+v, %v; want ops", ops, err)
+	}
+
+	policy := guard.Policy
+	for _, tc := range []struct {
+		principal Principal
+		perm      Permission
+		key       string
+		allowed   bool
+	}{
+		{tenant, PermissionRead, "a/1", true},
+		{tenant, PermissionWrite, "a/1", true},
+		{tenant, PermissionRead, "shared/x", true},
+		{tenant, PermissionWrite, "shared/x", false},
+		{tenant, PermissionRead, "b/1", false},
+		{ops, PermissionRead, "b/1", true},
+		{ops, PermissionWrite, "b/1", false},
+		{Principal{Name: "nobody"}, PermissionRead, "a/1", false},
+	} {
+		err := policy.AuthorizeKey(tc.principal, tc.perm, tc.key)
+		if tc.allowed != (err == nil) {
+			t.Fatalf("%s %s %q: err = %v, allowed = %v", tc.principal.Name, tc.perm, tc.key, err, tc.allowed)
+		}
+		if err != nil && !errors.Is(err, ErrPermissionDenied) {
+			t.Fatalf("denial error = %v, want %v", err, ErrPermissionDenied)
+		}
+	}
+
+	for _, tc := range []struct {
+		start, end string
+		allowed    bool
+	}{
+		{"a/", "a/z", true},
+		{"a/", "a0", true},
+		{"a/", "b", false},
+		{"a/", "", false},
+		{"", "a/z", false},
+	} {
+		err := policy.AuthorizeRange(tenant, PermissionWrite, tc.start, tc.end)
+		if tc.allowed != (err == nil) {
+			t.Fatalf("range [%q, %q): err = %v, allowed = %v", tc.start, tc.end, err, tc.allowed)
+		}
+	}
+	if err := policy.AuthorizeRange(ops, PermissionRead, "", ""); err != nil {
+		t.Fatalf("unbounded read for ops: %v", err)
+	}
+}
+
+func TestFromConfigRejectsUnknownPermission(t *testing.T) {
+	_, err := FromConfig(config.AuthConfig{
+		Enabled:    true,
+		Principals: []config.AuthPrincipal{{Name: "a", Grants: []config.AuthGrant{{Prefix: "a/", Permissions: []string{"admin"}}}}},
+	})
+	if err == nil {
+		t.Fatal("expected unknown permission error")
+	}
+	if guard, err := FromConfig(config.AuthConfig{}); guard != nil || err != nil {
+		t.Fatalf("disabled auth = %v, %v; want nil guard", guard, err)
+	}
+}
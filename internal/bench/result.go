@@ -23,6 +23,7 @@ type Result struct {
 	PreloadKeys    int                         `json:"preload_keys"`
 	Seed           int64                       `json:"seed"`
 	LeaderRefresh  uint64                      `json:"leader_refresh_count"`
+	Retries        uint64                      `json:"retries"`
 	Totals         OperationSummary            `json:"totals"`
 	Operations     map[string]OperationSummary `json:"operations"`
 	Latency        LatencySummary              `json:"latency"`
@@ -58,6 +59,9 @@ func (r Result) Summary() string {
 	if r.LeaderEndpoint != "" {
 		fmt.Fprintf(&builder, "leader=%s refreshes=%d\n", r.LeaderEndpoint, r.LeaderRefresh)
 	}
+	if r.Retries > 0 {
+		fmt.Fprintf(&builder, "retries=%d\n", r.Retries)
+	}
 	fmt.Fprintf(&builder, "totals: success=%d errors=%d total=%d success_qps=%.2f attempted_qps=%.2f\n",
 		r.Totals.Success, r.Totals.Errors, r.Totals.Total, r.Totals.SuccessQPS, r.Totals.AttemptedQPS)
 	fmt.Fprintf(&builder, "latency_ms: avg=%.3f p50=%.3f p95=%.3f p99=%.3f max=%.3f\n",
@@ -8,20 +8,16 @@ import (
 	"math/rand"
 	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
-	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/status"
-	minikvv1 "mini-kv/api/minikv/v1"
+	"mini-kv/client"
 )
 
 type Runner struct {
 	cfg     Config
-	conns   []*grpc.ClientConn
-	router  *router
+	client  *client.Client
 	keys    []string
 	value   []byte
 	weights operationWeights
@@ -47,19 +43,6 @@ type operationWeights struct {
 	deleteLimit int
 }
 
-type router struct {
-	endpoints      []string
-	clients        []minikvv1.KVClient
-	routing        Routing
-	requestTimeout time.Duration
-	leaderIndex    atomic.Uint64
-	rrIndex        atomic.Uint64
-	refreshCount   atomic.Uint64
-
-	mu            sync.Mutex
-	lastRefreshAt time.Time
-}
-
 func Run(ctx context.Context, cfg Config) (Result, error) {
 	runner, err := NewRunner(cfg)
 	if err != nil {
@@ -76,25 +59,17 @@ func NewRunner(cfg Config) (*Runner, error) {
 		return nil, err
 	}
 
-	conns := make([]*grpc.ClientConn, 0, len(cfg.Endpoints))
-	clients := make([]minikvv1.KVClient, 0, len(cfg.Endpoints))
-	for _, endpoint := range cfg.Endpoints {
-		dialCtx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
-		conn, err := grpc.DialContext(
-			dialCtx,
-			endpoint,
-			grpc.WithBlock(),
-			grpc.WithTransportCredentials(insecure.NewCredentials()),
-		)
-		cancel()
-		if err != nil {
-			for _, opened := range conns {
-				_ = opened.Close()
-			}
-			return nil, fmt.Errorf("dial %s: %w", endpoint, err)
-		}
-		conns = append(conns, conn)
-		clients = append(clients, minikvv1.NewKVClient(conn))
+	connectCtx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
+	defer cancel()
+	kv, err := client.New(connectCtx, client.Config{
+		Endpoints:      cfg.Endpoints,
+		LeaderEndpoint: cfg.LeaderEndpoint,
+		Routing:        client.Routing(cfg.Routing),
+		DialTimeout:    cfg.ConnectTimeout,
+		RequestTimeout: cfg.RequestTimeout,
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	keys := make([]string, cfg.Keyspace)
@@ -102,26 +77,9 @@ func NewRunner(cfg Config) (*Runner, error) {
 		keys[i] = fmt.Sprintf("bench:%08d", i)
 	}
 
-	rt := &router{
-		endpoints:      append([]string(nil), cfg.Endpoints...),
-		clients:        clients,
-		routing:        cfg.Routing,
-		requestTimeout: cfg.RequestTimeout,
-	}
-
-	if cfg.Routing == RoutingLeader {
-		if err := rt.initLeader(cfg.LeaderEndpoint); err != nil {
-			for _, opened := range conns {
-				_ = opened.Close()
-			}
-			return nil, err
-		}
-	}
-
 	return &Runner{
 		cfg:     cfg,
-		conns:   conns,
-		router:  rt,
+		client:  kv,
 		keys:    keys,
 		value:   bytes.Repeat([]byte("x"), cfg.ValueSize),
 		weights: newOperationWeights(cfg),
@@ -129,9 +87,7 @@ func NewRunner(cfg Config) (*Runner, error) {
 }
 
 func (r *Runner) Close() {
-	for _, conn := range r.conns {
-		_ = conn.Close()
-	}
+	_ = r.client.Close()
 }
 
 func (r *Runner) Run(ctx context.Context) (Result, error) {
@@ -155,6 +111,7 @@ func (r *Runner) Run(ctx context.Context) (Result, error) {
 	endedAt := time.Now()
 
 	seconds := endedAt.Sub(startedAt).Seconds()
+	stats := r.client.Stats()
 	result := Result{
 		Label:          r.cfg.Label,
 		StartedAt:      startedAt,
@@ -164,13 +121,14 @@ func (r *Runner) Run(ctx context.Context) (Result, error) {
 		Mode:           string(r.cfg.Mode),
 		Routing:        string(r.cfg.Routing),
 		Endpoints:      append([]string(nil), r.cfg.Endpoints...),
-		LeaderEndpoint: r.router.leaderEndpoint(),
+		LeaderEndpoint: r.leaderEndpoint(),
 		Concurrency:    r.cfg.Concurrency,
 		Keyspace:       r.cfg.Keyspace,
 		ValueSize:      r.cfg.ValueSize,
 		PreloadKeys:    r.cfg.PreloadKeys,
 		Seed:           r.cfg.Seed,
-		LeaderRefresh:  r.router.refreshCount.Load(),
+		LeaderRefresh:  stats.LeaderRefreshes,
+		Retries:        stats.Retries,
 		Operations:     make(map[string]OperationSummary, 4),
 		Latency:        summarizeLatencies(measurement.latencies),
 		ErrorSamples:   measurement.errors,
@@ -191,20 +149,9 @@ func (r *Runner) Run(ctx context.Context) (Result, error) {
 }
 
 func (r *Runner) preload(ctx context.Context) error {
-	client, _, err := r.router.leaderClient(ctx)
-	if err != nil {
-		return err
-	}
-
 	for i := 0; i < r.cfg.PreloadKeys; i++ {
-		reqCtx, cancel := context.WithTimeout(ctx, r.cfg.RequestTimeout)
-		_, callErr := client.Set(reqCtx, &minikvv1.SetRequest{
-			Key:   r.keys[i],
-			Value: r.value,
-		})
-		cancel()
-		if callErr != nil {
-			return fmt.Errorf("preload key %d: %w", i, callErr)
+		if err := r.client.Set(ctx, r.keys[i], r.value); err != nil {
+			return fmt.Errorf("preload key %d: %w", i, err)
 		}
 	}
 	return nil
@@ -284,9 +231,6 @@ func (r *Runner) runWorker(ctx context.Context, workerIndex int) workerResult {
 			label := classifyError(err)
 			local.errors[label]++
 			local.ops[mode] = summary
-			if isNotLeaderError(err) {
-				_, _ = r.router.refreshLeader(context.Background())
-			}
 			continue
 		}
 
@@ -303,31 +247,26 @@ func (r *Runner) runWorker(ctx context.Context, workerIndex int) workerResult {
 }
 
 func (r *Runner) call(ctx context.Context, mode Mode, key string) (bool, error) {
-	client := r.router.client()
-	reqCtx, cancel := context.WithTimeout(ctx, r.cfg.RequestTimeout)
-	defer cancel()
-
 	switch mode {
 	case ModeSet:
-		_, err := client.Set(reqCtx, &minikvv1.SetRequest{
-			Key:   key,
-			Value: r.value,
-		})
-		return false, err
+		return false, r.client.Set(ctx, key, r.value)
 	case ModeGet:
-		resp, err := client.Get(reqCtx, &minikvv1.GetRequest{Key: key})
-		if err != nil {
-			return false, err
-		}
-		return resp.GetFound(), nil
+		_, found, err := r.client.Get(ctx, key)
+		return found, err
 	case ModeDelete:
-		_, err := client.Delete(reqCtx, &minikvv1.DeleteRequest{Key: key})
-		return false, err
+		return false, r.client.Delete(ctx, key)
 	default:
 		return false, fmt.Errorf("unsupported mode %q", mode)
 	}
 }
 
+func (r *Runner) leaderEndpoint() string {
+	if r.cfg.Routing != RoutingLeader {
+		return ""
+	}
+	return r.client.Leader()
+}
+
 func (r *Runner) pickMode(random *rand.Rand) Mode {
 	switch r.cfg.Mode {
 	case ModeSet, ModeGet, ModeDelete:
@@ -380,7 +319,7 @@ func classifyError(err error) string {
 		return ""
 	}
 	message := strings.TrimSpace(err.Error())
-	if isNotLeaderError(err) {
+	if client.IsNotLeader(err) {
 		return "not_leader"
 	}
 	if errors.Is(err, context.DeadlineExceeded) {
@@ -391,98 +330,3 @@ func classifyError(err error) string {
 	}
 	return message
 }
-
-func isNotLeaderError(err error) bool {
-	return err != nil && strings.Contains(strings.ToLower(err.Error()), "not leader")
-}
-
-func (r *router) initLeader(explicit string) error {
-	if explicit != "" {
-		for index, endpoint := range r.endpoints {
-			if endpoint == explicit {
-				r.leaderIndex.Store(uint64(index))
-				return nil
-			}
-		}
-		return fmt.Errorf("leader endpoint %q is not present in endpoints", explicit)
-	}
-
-	_, err := r.refreshLeader(context.Background())
-	return err
-}
-
-func (r *router) client() minikvv1.KVClient {
-	if r.routing == RoutingRoundRobin {
-		index := int(r.rrIndex.Add(1)-1) % len(r.clients)
-		return r.clients[index]
-	}
-	index := int(r.leaderIndex.Load())
-	return r.clients[index]
-}
-
-func (r *router) leaderClient(ctx context.Context) (minikvv1.KVClient, string, error) {
-	if r.routing != RoutingLeader {
-		return r.client(), "", nil
-	}
-	if len(r.clients) == 0 {
-		return nil, "", fmt.Errorf("no clients configured")
-	}
-	if len(r.clients) == 1 {
-		return r.clients[0], r.endpoints[0], nil
-	}
-	endpoint, err := r.refreshLeader(ctx)
-	if err != nil {
-		return nil, "", err
-	}
-	index := int(r.leaderIndex.Load())
-	return r.clients[index], endpoint, nil
-}
-
-func (r *router) leaderEndpoint() string {
-	if r.routing != RoutingLeader || len(r.endpoints) == 0 {
-		return ""
-	}
-	return r.endpoints[int(r.leaderIndex.Load())]
-}
-
-func (r *router) refreshLeader(ctx context.Context) (string, error) {
-	if r.routing != RoutingLeader {
-		return "", nil
-	}
-
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	if !r.lastRefreshAt.IsZero() && time.Since(r.lastRefreshAt) < 200*time.Millisecond {
-		return r.endpoints[int(r.leaderIndex.Load())], nil
-	}
-
-	probeKey := fmt.Sprintf("__mini_kv_bench_probe__:%d", time.Now().UnixNano())
-	var lastErr error
-	for index, client := range r.clients {
-		reqCtx, cancel := context.WithTimeout(ctx, r.requestTimeout)
-		_, err := client.Set(reqCtx, &minikvv1.SetRequest{
-			Key:   probeKey,
-			Value: []byte("1"),
-		})
-		cancel()
-		if err != nil {
-			lastErr = err
-			continue
-		}
-
-		reqCtx, cancel = context.WithTimeout(ctx, r.requestTimeout)
-		_, _ = client.Delete(reqCtx, &minikvv1.DeleteRequest{Key: probeKey})
-		cancel()
-
-		r.leaderIndex.Store(uint64(index))
-		r.lastRefreshAt = time.Now()
-		r.refreshCount.Add(1)
-		return r.endpoints[index], nil
-	}
-
-	if lastErr == nil {
-		lastErr = fmt.Errorf("no endpoint accepted leader probe")
-	}
-	return "", fmt.Errorf("discover leader: %w", lastErr)
-}
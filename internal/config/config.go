@@ -14,6 +14,73 @@ type Config struct {
 	Debug    DebugConfig   `yaml:"debug"`
 	Storage  StorageConfig `yaml:"storage"`
 	Raft     RaftConfig    `yaml:"raft"`
+	TLS      TLSConfig     `yaml:"tls"`
+	Auth     AuthConfig    `yaml:"auth"`
+	Tracing  TracingConfig `yaml:"tracing"`
+	SlowLog  SlowLogConfig `yaml:"slowlog"`
+	RESP     RESPConfig    `yaml:"resp"`
+	HTTP     HTTPConfig    `yaml:"http"`
+}
+
+type HTTPConfig struct {
+	Enabled    bool              `yaml:"enabled"`
+	Host       string            `yaml:"host"`
+	Port       int               `yaml:"port"`
+	TimeoutMS  int               `yaml:"timeout_ms"`
+	LeaderMode string            `yaml:"leader_mode"`
+	PeerAddrs  map[string]string `yaml:"peer_addrs"`
+	TLS        TLSConfig         `yaml:"tls"`
+	PeerCAFile string            `yaml:"peer_ca_file"`
+}
+
+type RESPConfig struct {
+	Enabled   bool              `yaml:"enabled"`
+	Host      string            `yaml:"host"`
+	Port      int               `yaml:"port"`
+	TimeoutMS int               `yaml:"timeout_ms"`
+	PeerAddrs map[string]string `yaml:"peer_addrs"`
+	TLS       TLSConfig         `yaml:"tls"`
+}
+
+type SlowLogConfig struct {
+	ThresholdMS int  `yaml:"threshold_ms"`
+	MaxLen      int  `yaml:"max_len"`
+	RedactKeys  bool `yaml:"redact_keys"`
+}
+
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter"`
+	Endpoint    string  `yaml:"endpoint"`
+	Insecure    bool    `yaml:"insecure"`
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+type TLSConfig struct {
+	CertFile          string `yaml:"cert_file"`
+	KeyFile           string `yaml:"key_file"`
+	ClientCAFile      string `yaml:"client_ca_file"`
+	RequireClientCert bool   `yaml:"require_client_cert"`
+}
+
+type AuthConfig struct {
+	Enabled    bool            `yaml:"enabled"`
+	Tokens     []AuthToken     `yaml:"tokens"`
+	Principals []AuthPrincipal `yaml:"principals"`
+}
+
+type AuthToken struct {
+	Token     string `yaml:"token"`
+	Principal string `yaml:"principal"`
+}
+
+type AuthPrincipal struct {
+	Name   string      `yaml:"name"`
+	Grants []AuthGrant `yaml:"grants"`
+}
+
+type AuthGrant struct {
+	Prefix      string   `yaml:"prefix"`
+	Permissions []string `yaml:"permissions"`
 }
 
 type StorageConfig struct {
@@ -30,12 +97,30 @@ type RaftConfig struct {
 	ID                 string            `yaml:"id"`
 	Peers              []string          `yaml:"peers"`
 	ListenAddr         string            `yaml:"listen_addr"`
+	Transport          string            `yaml:"transport"`
 	PeerAddrs          map[string]string `yaml:"peer_addrs"`
 	WALPath            string            `yaml:"wal_path"`
 	ElectionTimeoutMS  int               `yaml:"election_timeout_ms"`
 	HeartbeatTimeoutMS int               `yaml:"heartbeat_timeout_ms"`
 	ApplyBufferSize    int               `yaml:"apply_buffer_size"`
 	SnapshotThreshold  uint64            `yaml:"snapshot_threshold"`
+	TLS                RaftTLSConfig     `yaml:"tls"`
+	ClusterID          string            `yaml:"cluster_id"`
+	MinProtocolVersion int               `yaml:"min_protocol_version"`
+	MaxInflightMsgs    int               `yaml:"max_inflight_msgs"`
+	MaxSizePerMsg      uint64            `yaml:"max_size_per_msg"`
+	Compression        RaftCompression   `yaml:"compression"`
+}
+
+type RaftCompression struct {
+	Enabled   bool `yaml:"enabled"`
+	Threshold int  `yaml:"threshold"`
+}
+
+type RaftTLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	CAFile   string `yaml:"ca_file"`
 }
 
 func Default() Config {
@@ -55,6 +140,7 @@ func Default() Config {
 			ID:                 "node1",
 			Peers:              []string{"node1"},
 			ListenAddr:         "127.0.0.1:16380",
+			Transport:          "tcp",
 			PeerAddrs:          map[string]string{"node1": "127.0.0.1:16380"},
 			WALPath:            "data/raft-node1.wal",
 			ElectionTimeoutMS:  150,
@@ -62,6 +148,26 @@ func Default() Config {
 			ApplyBufferSize:    128,
 			SnapshotThreshold:  1024,
 		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			SampleRatio: 1,
+		},
+		SlowLog: SlowLogConfig{
+			ThresholdMS: 100,
+			MaxLen:      128,
+		},
+		RESP: RESPConfig{
+			Enabled:   false,
+			Host:      "127.0.0.1",
+			Port:      6379,
+			TimeoutMS: 5000,
+		},
+		HTTP: HTTPConfig{
+			Enabled:   false,
+			Host:      "127.0.0.1",
+			Port:      8080,
+			TimeoutMS: 5000,
+		},
 	}
 }
 
@@ -126,6 +232,9 @@ func Load(path string) (Config, error) {
 	if cfg.Raft.PeerAddrs[cfg.Raft.ID] == "" {
 		cfg.Raft.PeerAddrs[cfg.Raft.ID] = cfg.Raft.ListenAddr
 	}
+	if cfg.Raft.Transport == "" {
+		cfg.Raft.Transport = defaults.Raft.Transport
+	}
 	if cfg.Raft.WALPath == "" {
 		cfg.Raft.WALPath = fmt.Sprintf("data/raft-%s.wal", cfg.Raft.ID)
 	}
@@ -144,6 +253,36 @@ func Load(path string) (Config, error) {
 	if cfg.Raft.SnapshotThreshold == 0 {
 		cfg.Raft.SnapshotThreshold = defaults.Raft.SnapshotThreshold
 	}
+	if cfg.Tracing.Exporter == "" {
+		cfg.Tracing.Exporter = defaults.Tracing.Exporter
+	}
+	if cfg.Tracing.SampleRatio <= 0 {
+		cfg.Tracing.SampleRatio = defaults.Tracing.SampleRatio
+	}
+	if cfg.SlowLog.ThresholdMS <= 0 {
+		cfg.SlowLog.ThresholdMS = defaults.SlowLog.ThresholdMS
+	}
+	if cfg.SlowLog.MaxLen <= 0 {
+		cfg.SlowLog.MaxLen = defaults.SlowLog.MaxLen
+	}
+	if cfg.RESP.Host == "" {
+		cfg.RESP.Host = defaults.RESP.Host
+	}
+	if cfg.RESP.Port <= 0 {
+		cfg.RESP.Port = defaults.RESP.Port
+	}
+	if cfg.RESP.TimeoutMS <= 0 {
+		cfg.RESP.TimeoutMS = defaults.RESP.TimeoutMS
+	}
+	if cfg.HTTP.Host == "" {
+		cfg.HTTP.Host = defaults.HTTP.Host
+	}
+	if cfg.HTTP.Port <= 0 {
+		cfg.HTTP.Port = defaults.HTTP.Port
+	}
+	if cfg.HTTP.TimeoutMS <= 0 {
+		cfg.HTTP.TimeoutMS = defaults.HTTP.TimeoutMS
+	}
 
 	return cfg, nil
 }
@@ -155,3 +294,11 @@ func (c Config) Address() string {
 func (c DebugConfig) Address() string {
 	return fmt.Sprintf("%s:%d", c.Host, c.Port)
 }
+
+func (c RESPConfig) Address() string {
+	return fmt.Sprintf("%s:%d", c.Host, c.Port)
+}
+
+func (c HTTPConfig) Address() string {
+	return fmt.Sprintf("%s:%d", c.Host, c.Port)
+}
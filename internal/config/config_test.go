@@ -8,7 +8,7 @@ import (
 
 func TestLoad(t *testing.T) {
 	path := filepath.Join(t.TempDir(), "mini-kv.yaml")
-	data := []byte("port: 0\nraft:\n  id: node2\n")
+	data := []byte("port: 0\nraft:\n  id: node2\n  cluster_id: alpha\n  min_protocol_version: 2\n  max_inflight_msgs: 8\n  max_size_per_msg: 65536\n  compression:\n    enabled: true\n    threshold: 512\n  tls:\n    cert_file: node2.pem\n    key_file: node2-key.pem\n    ca_file: ca.pem\ntracing:\n  exporter: otlp\n  endpoint: 127.0.0.1:4317\nslowlog:\n  threshold_ms: 20\n  redact_keys: true\nresp:\n  enabled: true\n  peer_addrs:\n    node1: 127.0.0.1:6379\nhttp:\n  enabled: true\n  leader_mode: proxy\n")
 	if err := os.WriteFile(path, data, 0o644); err != nil {
 		t.Fatalf("write config: %v", err)
 	}
@@ -45,6 +45,33 @@ func TestLoad(t *testing.T) {
 	if cfg.Raft.HeartbeatTimeoutMS != Default().Raft.HeartbeatTimeoutMS {
 		t.Fatalf("heartbeat timeout = %d, want %d", cfg.Raft.HeartbeatTimeoutMS, Default().Raft.HeartbeatTimeoutMS)
 	}
+	if cfg.Raft.TLS != (RaftTLSConfig{CertFile: "node2.pem", KeyFile: "node2-key.pem", CAFile: "ca.pem"}) {
+		t.Fatalf("raft tls = %+v", cfg.Raft.TLS)
+	}
+	if cfg.Raft.ClusterID != "alpha" || cfg.Raft.MinProtocolVersion != 2 {
+		t.Fatalf("raft cluster id = %q min protocol version = %d, want alpha 2", cfg.Raft.ClusterID, cfg.Raft.MinProtocolVersion)
+	}
+	if cfg.Raft.MaxInflightMsgs != 8 || cfg.Raft.MaxSizePerMsg != 65536 {
+		t.Fatalf("raft max inflight = %d max size = %d, want 8 65536", cfg.Raft.MaxInflightMsgs, cfg.Raft.MaxSizePerMsg)
+	}
+	if !cfg.Raft.Compression.Enabled || cfg.Raft.Compression.Threshold != 512 {
+		t.Fatalf("raft compression = %+v, want enabled with threshold 512", cfg.Raft.Compression)
+	}
+	if cfg.Raft.Transport != "tcp" {
+		t.Fatalf("raft transport = %q, want tcp", cfg.Raft.Transport)
+	}
+	if cfg.Tracing != (TracingConfig{Exporter: "otlp", Endpoint: "127.0.0.1:4317", SampleRatio: 1}) {
+		t.Fatalf("tracing = %+v, want otlp exporter sampling everything", cfg.Tracing)
+	}
+	if cfg.SlowLog != (SlowLogConfig{ThresholdMS: 20, MaxLen: Default().SlowLog.MaxLen, RedactKeys: true}) {
+		t.Fatalf("slowlog = %+v, want 20ms threshold with redacted keys", cfg.SlowLog)
+	}
+	if !cfg.RESP.Enabled || cfg.RESP.Address() != "127.0.0.1:6379" || cfg.RESP.PeerAddrs["node1"] != "127.0.0.1:6379" {
+		t.Fatalf("resp = %+v, want enabled on the default address", cfg.RESP)
+	}
+	if !cfg.HTTP.Enabled || cfg.HTTP.LeaderMode != "proxy" || cfg.HTTP.Address() != "127.0.0.1:8080" || cfg.HTTP.TimeoutMS != Default().HTTP.TimeoutMS {
+		t.Fatalf("http = %+v, want proxy mode on the default address", cfg.HTTP)
+	}
 	if cfg.Raft.ApplyBufferSize != Default().Raft.ApplyBufferSize {
 		t.Fatalf("apply buffer size = %d, want %d", cfg.Raft.ApplyBufferSize, Default().Raft.ApplyBufferSize)
 	}
@@ -0,0 +1,187 @@
+package identity
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// FormatVersion is the version of the identity written by this build. Newer
+// versions are refused rather than guessed at.
+const FormatVersion = 1
+
+// FileName is the identity file inside a data directory.
+const FileName = "IDENTITY"
+
+var ErrMismatch = errors.New("data directory identity mismatch")
+
+// ErrUninitialized reports a first start without a cluster to join: the node
+// needs `mini-kv init` or raft.cluster_id, so that every node of a cluster
+// shares one cluster id.
+var ErrUninitialized = errors.New("data directory has no identity")
+
+// Identity names the cluster and node a data directory belongs to. It is
+// stamped into the LSM directory and the raft log when a node first starts,
+// and checked on every start after that.
+type Identity struct {
+	FormatVersion int    `json:"format_version"`
+	ClusterID     string `json:"cluster_id"`
+	NodeID        string `json:"node_id"`
+}
+
+// New returns the identity of node nodeID in cluster clusterID; an empty
+// clusterID generates a new one.
+func New(clusterID, nodeID string) (Identity, error) {
+	if nodeID == "" {
+		return Identity{}, errors.New("identity: empty node id")
+	}
+	if clusterID == "" {
+		var raw [16]byte
+		if _, err := rand.Read(raw[:]); err != nil {
+			return Identity{}, fmt.Errorf("identity: generate cluster id: %w", err)
+		}
+		clusterID = hex.EncodeToString(raw[:])
+	}
+	return Identity{FormatVersion: FormatVersion, ClusterID: clusterID, NodeID: nodeID}, nil
+}
+
+func (id Identity) String() string {
+	return fmt.Sprintf("node %q of cluster %q", id.NodeID, id.ClusterID)
+}
+
+func (id Identity) Validate() error {
+	switch {
+	case id.FormatVersion <= 0:
+		return fmt.Errorf("identity: invalid format version %d", id.FormatVersion)
+	case id.FormatVersion > FormatVersion:
+		return fmt.Errorf("identity: format version %d is newer than supported version %d", id.FormatVersion, FormatVersion)
+	case id.ClusterID == "" || id.NodeID == "":
+		return errors.New("identity: empty cluster or node id")
+	}
+	return nil
+}
+
+// Marshal and Unmarshal are the encoding shared by every place an identity is
+// stamped into.
+func (id Identity) Marshal() ([]byte, error) {
+	return json.Marshal(id)
+}
+
+func Unmarshal(data []byte) (Identity, error) {
+	var id Identity
+	if err := json.Unmarshal(data, &id); err != nil {
+		return Identity{}, fmt.Errorf("identity: %w", err)
+	}
+	return id, id.Validate()
+}
+
+// ReadFile reads the identity file in dir. A missing file reports false.
+func ReadFile(dir string) (Identity, bool, error) {
+	data, err := os.ReadFile(filepath.Join(dir, FileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return Identity{}, false, nil
+	}
+	if err != nil {
+		return Identity{}, false, err
+	}
+	id, err := Unmarshal(data)
+	if err != nil {
+		return Identity{}, false, fmt.Errorf("%s: %w", filepath.Join(dir, FileName), err)
+	}
+	return id, true, nil
+}
+
+// WriteFile atomically writes the identity file in dir.
+func WriteFile(dir string, id Identity) error {
+	data, err := id.Marshal()
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, FileName)
+	tmp, err := os.CreateTemp(dir, FileName+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	parent, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer parent.Close()
+	return parent.Sync()
+}
+
+// Location is one place an identity is stamped into.
+type Location struct {
+	// Name describes the location in diagnostics, e.g. "raft log data/raft.wal".
+	Name     string
+	Identity Identity
+	Stamped  bool
+	// Empty reports that the location holds no data yet, so it can still be
+	// stamped with any identity.
+	Empty bool
+}
+
+// Resolve checks the identities stamped into locations against each other and
+// against the configured node and cluster, and returns the identity that the
+// unstamped locations should be stamped with. An empty clusterID accepts any
+// cluster. When nothing is stamped yet the configured cluster is used, and
+// data written before identities existed is adopted into it; without one
+// Resolve fails with ErrUninitialized instead of making up a cluster id that
+// the other nodes would not share.
+func Resolve(nodeID, clusterID string, locations ...Location) (Identity, error) {
+	var stamped *Location
+	for i := range locations {
+		loc := &locations[i]
+		if !loc.Stamped {
+			continue
+		}
+		if err := loc.Identity.Validate(); err != nil {
+			return Identity{}, fmt.Errorf("%w: %s: %v", ErrMismatch, loc.Name, err)
+		}
+		if loc.Identity.NodeID != nodeID {
+			return Identity{}, fmt.Errorf("%w: %s belongs to node %q, but raft.id is %q", ErrMismatch, loc.Name, loc.Identity.NodeID, nodeID)
+		}
+		if clusterID != "" && loc.Identity.ClusterID != clusterID {
+			return Identity{}, fmt.Errorf("%w: %s belongs to cluster %q, but raft.cluster_id is %q", ErrMismatch, loc.Name, loc.Identity.ClusterID, clusterID)
+		}
+		if stamped != nil && loc.Identity.ClusterID != stamped.Identity.ClusterID {
+			return Identity{}, fmt.Errorf("%w: %s belongs to cluster %q, but %s belongs to cluster %q",
+				ErrMismatch, stamped.Name, stamped.Identity.ClusterID, loc.Name, loc.Identity.ClusterID)
+		}
+		if stamped == nil {
+			stamped = loc
+		}
+	}
+	if stamped == nil {
+		if clusterID == "" {
+			return Identity{}, fmt.Errorf("%w: run `mini-kv init` on a new node, or set raft.cluster_id to the cluster's id", ErrUninitialized)
+		}
+		return New(clusterID, nodeID)
+	}
+	for _, loc := range locations {
+		if !loc.Stamped && !loc.Empty {
+			return Identity{}, fmt.Errorf("%w: %s holds data but no identity, while %s belongs to %s",
+				ErrMismatch, loc.Name, stamped.Name, stamped.Identity)
+		}
+	}
+	return stamped.Identity, nil
+}
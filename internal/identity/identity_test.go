@@ -0,0 +1,121 @@
+package identity
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFileRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	if _, ok, err := ReadFile(dir); ok || err != nil {
+		t.Fatalf("ReadFile on empty dir = %v, %v", ok, err)
+	}
+	id, err := New("", "node1")
+	if err != nil {
+		t.Fatalf("New error = %v", err)
+	}
+	if len(id.ClusterID) != 32 || id.FormatVersion != FormatVersion {
+		t.Fatalf("New = %+v", id)
+	}
+	if err := WriteFile(dir, id); err != nil {
+		t.Fatalf("WriteFile error = %v", err)
+	}
+	if got, ok, err := ReadFile(dir); err != nil || !ok || got != id {
+		t.Fatalf("ReadFile = %+v, %v, %v; want %+v", got, ok, err, id)
+	}
+
+	newer := id
+	newer.FormatVersion = FormatVersion + 1
+	if err := WriteFile(dir, newer); err != nil {
+		t.Fatalf("WriteFile error = %v", err)
+	}
+	if _, _, err := ReadFile(dir); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Fatalf("ReadFile of a newer format error = %v", err)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	node1 := Identity{FormatVersion: FormatVersion, ClusterID: "c1", NodeID: "node1"}
+	node2 := Identity{FormatVersion: FormatVersion, ClusterID: "c1", NodeID: "node2"}
+	other := Identity{FormatVersion: FormatVersion, ClusterID: "c2", NodeID: "node1"}
+	stamped := func(name string, id Identity) Location {
+		return Location{Name: name, Identity: id, Stamped: true}
+	}
+
+	tests := []struct {
+		name      string
+		clusterID string
+		locations []Location
+		want      Identity
+		wantErr   string
+	}{
+		{
+			name:      "both stamped",
+			locations: []Location{stamped("raft log", node1), stamped("lsm", node1)},
+			want:      node1,
+		},
+		{
+			name:      "one half of a first start",
+			locations: []Location{stamped("raft log", node1), {Name: "lsm", Empty: true}},
+			want:      node1,
+		},
+		{
+			name:      "another node's directory",
+			locations: []Location{stamped("raft log", node1), stamped("lsm", node2)},
+			wantErr:   `lsm belongs to node "node2", but raft.id is "node1"`,
+		},
+		{
+			name:      "log from another cluster",
+			locations: []Location{stamped("raft log", other), stamped("lsm", node1)},
+			wantErr:   `raft log belongs to cluster "c2", but lsm belongs to cluster "c1"`,
+		},
+		{
+			name:      "configured cluster",
+			clusterID: "c2",
+			locations: []Location{stamped("raft log", node1)},
+			wantErr:   `raft log belongs to cluster "c1", but raft.cluster_id is "c2"`,
+		},
+		{
+			name:      "unstamped data next to a stamped log",
+			locations: []Location{stamped("raft log", node1), {Name: "lsm"}},
+			wantErr:   `lsm holds data but no identity, while raft log belongs to node "node1" of cluster "c1"`,
+		},
+		{
+			name:      "first start without a cluster",
+			locations: []Location{{Name: "raft log", Empty: true}, {Name: "lsm", Empty: true}},
+			wantErr:   "run `mini-kv init`",
+		},
+		{
+			name:      "data from before identities without a cluster",
+			locations: []Location{{Name: "raft log"}, {Name: "lsm"}},
+			wantErr:   "set raft.cluster_id",
+		},
+		{
+			name:      "first start with a configured cluster",
+			clusterID: "c1",
+			locations: []Location{{Name: "raft log", Empty: true}, {Name: "lsm", Empty: true}},
+			want:      node1,
+		},
+		{
+			name:      "data from before identities with a configured cluster",
+			clusterID: "c1",
+			locations: []Location{{Name: "raft log"}, {Name: "lsm"}},
+			want:      node1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Resolve("node1", tt.clusterID, tt.locations...)
+			if tt.wantErr != "" {
+				if !errors.Is(err, ErrMismatch) && !errors.Is(err, ErrUninitialized) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Resolve error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("Resolve = %+v, %v; want %+v", got, err, tt.want)
+			}
+		})
+	}
+}
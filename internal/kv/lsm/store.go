@@ -1,15 +1,34 @@
 package lsm
 
 import (
+	"context"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"os"
 	"sync"
+	"sync/atomic"
 
+	"mini-kv/internal/identity"
 	"mini-kv/internal/kv"
 	lsmstore "mini-kv/internal/storage/lsm"
 )
 
+// Each keyspace lives in its own column family so flushes, compactions and
+// range estimates of one do not touch the other. Keys keep their one-byte
+// namespace prefix, which keeps the empty user key representable and lets
+// stores written before column families migrate keys unchanged. Future
+// metadata such as the TTL index or watch history gets a family of its own.
+const (
+	dataFamily    = "data"
+	sessionFamily = "sessions"
+	metaFamily    = "meta"
+)
+
+// appliedIndexKey holds the raft index of the last entry applied through
+// ApplyAt, written in the entry's own batch.
+var appliedIndexKey = []byte("applied_index")
+
 const (
 	dataNamespace    = byte(1)
 	sessionNamespace = byte(2)
@@ -17,34 +36,141 @@ const (
 )
 
 type Store struct {
-	mu       sync.RWMutex
-	dir      string
-	engine   *lsmstore.Engine
-	sessions map[string]kv.Session
-	closed   bool
+	mu        sync.RWMutex
+	dir       string
+	opts      []lsmstore.Option
+	engine    *lsmstore.Engine
+	dataCF    *lsmstore.ColumnFamily
+	sessionCF *lsmstore.ColumnFamily
+	metaCF    *lsmstore.ColumnFamily
+	sessions  map[string]kv.Session
+	closed    bool
+
+	// liveEngine mirrors engine so WriteStall and admin calls can reach it
+	// without s.mu, which Apply may hold while blocked inside a stalled write
+	// and which a long manual compaction must not hold.
+	liveEngine atomic.Pointer[lsmstore.Engine]
 }
 
 var _ kv.Store = (*Store)(nil)
+var _ kv.WriteThrottler = (*Store)(nil)
+var _ kv.RangeCompactor = (*Store)(nil)
+var _ kv.IndexedApplier = (*Store)(nil)
 var _ kv.FSM = (*Store)(nil)
 var _ kv.Reader = (*Store)(nil)
 
 func Open(dir string, opts ...lsmstore.Option) (*Store, error) {
-	engine, err := lsmstore.Open(dir, opts...)
-	if err != nil {
-		return nil, err
-	}
 	store := &Store{
 		dir:      dir,
-		engine:   engine,
+		opts:     opts,
 		sessions: make(map[string]kv.Session),
 	}
+	if err := store.openEngine(); err != nil {
+		return nil, err
+	}
 	if err := store.loadSessions(); err != nil {
-		_ = engine.Close()
+		_ = store.engine.Close()
 		return nil, err
 	}
+	store.liveEngine.Store(store.engine)
 	return store, nil
 }
 
+// openEngine opens the engine and its column families, moving keys left in
+// the default family by older versions into their own families.
+func (s *Store) openEngine() error {
+	engine, err := lsmstore.Open(s.dir, s.opts...)
+	if err != nil {
+		return err
+	}
+	dataCF, err := engine.OpenColumnFamily(dataFamily)
+	if err != nil {
+		_ = engine.Close()
+		return err
+	}
+	sessionCF, err := engine.OpenColumnFamily(sessionFamily)
+	if err != nil {
+		_ = engine.Close()
+		return err
+	}
+	metaCF, err := engine.OpenColumnFamily(metaFamily)
+	if err != nil {
+		_ = engine.Close()
+		return err
+	}
+	if err := migrateDefaultFamily(engine, dataCF, sessionCF); err != nil {
+		_ = engine.Close()
+		return err
+	}
+	s.engine, s.dataCF, s.sessionCF, s.metaCF = engine, dataCF, sessionCF, metaCF
+	return nil
+}
+
+// Migration batch limits. Each chunk is one synced batch that both copies its
+// keys into their families and deletes them from the default family, so a
+// crash leaves every key in exactly one place and the next Open picks up the
+// rest.
+var (
+	migrateBatchKeys  = 1024
+	migrateBatchBytes = 4 << 20
+)
+
+// migrateDefaultFamily moves namespaced keys from the default family into the
+// data and session families in bounded atomic chunks.
+func migrateDefaultFamily(engine *lsmstore.Engine, dataCF, sessionCF *lsmstore.ColumnFamily) error {
+	lower := namespaceLower(dataNamespace)
+	for lower != nil {
+		next, err := migrateDefaultChunk(engine, dataCF, sessionCF, lower)
+		if err != nil {
+			return err
+		}
+		lower = next
+	}
+	return nil
+}
+
+// migrateDefaultChunk moves up to one chunk of keys at or after lower and
+// returns the bound to continue from, or nil once the default family is
+// drained. The iterator is closed before the write so it never reads its own
+// deletions.
+func migrateDefaultChunk(engine *lsmstore.Engine, dataCF, sessionCF *lsmstore.ColumnFamily, lower []byte) ([]byte, error) {
+	iter := engine.NewIterator(lsmstore.IterOptions{
+		LowerBound: lower,
+		UpperBound: namespaceLower(upperNamespace),
+	})
+	var (
+		batch lsmstore.WriteBatch
+		size  int
+		next  []byte
+	)
+	for ok := iter.First(); ok; ok = iter.Next() {
+		if batch.Len() >= 2*migrateBatchKeys || size >= migrateBatchBytes {
+			next = append([]byte(nil), iter.Key()...)
+			break
+		}
+		key := iter.Key()
+		family := dataCF
+		if key[0] == sessionNamespace {
+			family = sessionCF
+		}
+		batch.PutCF(family, key, iter.Value())
+		batch.Delete(key)
+		size += 2*len(key) + len(iter.Value())
+	}
+	err := iter.Error()
+	_ = iter.Close()
+	if err != nil {
+		return nil, err
+	}
+	if batch.Len() == 0 {
+		return nil, nil
+	}
+	if err := engine.Write(&batch, lsmstore.WriteOptions{Sync: true}); err != nil {
+		return nil, err
+	}
+	return next, nil
+}
+
 func (s *Store) Close() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -53,17 +179,145 @@ func (s *Store) Close() error {
 		return nil
 	}
 	s.closed = true
+	s.liveEngine.Store(nil)
 	if s.engine == nil {
 		return nil
 	}
 	return s.engine.Close()
 }
 
+// WriteStall reports whether the engine has stopped accepting writes because
+// flushes or compactions fell behind.
+func (s *Store) WriteStall() error {
+	engine := s.liveEngine.Load()
+	if engine == nil {
+		return nil
+	}
+	state := engine.WriteStall()
+	if state.Condition != lsmstore.StallStopped {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", lsmstore.ErrWriteStall, state.Reason)
+}
+
+// Metrics returns the engine metrics, or false while the engine is closed or
+// being restored.
+func (s *Store) Metrics() (lsmstore.Metrics, bool) {
+	engine := s.liveEngine.Load()
+	if engine == nil {
+		return lsmstore.Metrics{}, false
+	}
+	return engine.Metrics(), true
+}
+
+// CompactRange compacts the user keys in [start, end) down to the bottom
+// level, dropping deleted entries. Empty bounds cover the whole keyspace.
+func (s *Store) CompactRange(ctx context.Context, start, end string) error {
+	engine := s.liveEngine.Load()
+	if engine == nil {
+		return lsmstore.ErrClosed
+	}
+	dataCF, ok := engine.ColumnFamily(dataFamily)
+	if !ok {
+		return lsmstore.ErrClosed
+	}
+	lower, upper := dataRange(start, end)
+	return engine.CompactRangeCF(ctx, dataCF, lower, upper)
+}
+
+func (s *Store) ApproximateSize(start, end string) (int64, error) {
+	engine := s.liveEngine.Load()
+	if engine == nil {
+		return 0, lsmstore.ErrClosed
+	}
+	dataCF, ok := engine.ColumnFamily(dataFamily)
+	if !ok {
+		return 0, lsmstore.ErrClosed
+	}
+	lower, upper := dataRange(start, end)
+	return engine.ApproximateSizeCF(dataCF, lower, upper)
+}
+
+func (s *Store) ApproximateCount(start, end string) (int64, error) {
+	engine := s.liveEngine.Load()
+	if engine == nil {
+		return 0, lsmstore.ErrClosed
+	}
+	dataCF, ok := engine.ColumnFamily(dataFamily)
+	if !ok {
+		return 0, lsmstore.ErrClosed
+	}
+	lower, upper := dataRange(start, end)
+	return engine.ApproximateCountCF(dataCF, lower, upper)
+}
+
 func (s *Store) Reader() kv.Reader {
 	return s
 }
 
 func (s *Store) Apply(command kv.Command) kv.ApplyResult {
+	return s.ApplyWithContext(context.TODO(), command)
+}
+
+func (s *Store) ApplyWithContext(ctx context.Context, command kv.Command) kv.ApplyResult {
+	return s.apply(ctx, 0, command)
+}
+
+// ApplyAt applies command and records index as the applied index in the same
+// atomic batch.
+func (s *Store) ApplyAt(ctx context.Context, index uint64, command kv.Command) kv.ApplyResult {
+	return s.apply(ctx, index, command)
+}
+
+// AppliedIndex returns the index last recorded by ApplyAt, or 0. A restored
+// snapshot starts again from 0.
+func (s *Store) AppliedIndex() (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed || s.engine == nil {
+		return 0, lsmstore.ErrClosed
+	}
+	value, found, err := s.engine.GetCF(s.metaCF, appliedIndexKey)
+	if err != nil || !found {
+		return 0, err
+	}
+	if len(value) != 8 {
+		return 0, fmt.Errorf("corrupt applied index: %d bytes", len(value))
+	}
+	return binary.BigEndian.Uint64(value), nil
+}
+
+// Empty reports whether the store holds no keys and no client sessions.
+func (s *Store) Empty() (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed || s.engine == nil {
+		return false, lsmstore.ErrClosed
+	}
+	for _, family := range []*lsmstore.ColumnFamily{s.dataCF, s.sessionCF} {
+		iter := s.engine.NewIterator(lsmstore.IterOptions{ColumnFamily: family})
+		found := iter.First()
+		err := iter.Error()
+		_ = iter.Close()
+		if err != nil || found {
+			return false, err
+		}
+	}
+	return len(s.sessions) == 0, nil
+}
+
+// Identity returns the identity stamped into the store's directory.
+func (s *Store) Identity() (identity.Identity, bool, error) {
+	return identity.ReadFile(s.dir)
+}
+
+func (s *Store) SetIdentity(id identity.Identity) error {
+	return identity.WriteFile(s.dir, id)
+}
+
+func (s *Store) apply(ctx context.Context, index uint64, command kv.Command) kv.ApplyResult {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -84,11 +338,15 @@ func (s *Store) Apply(command kv.Command) kv.ApplyResult {
 		if err != nil {
 			return kv.ApplyResult{Error: fmt.Sprintf("marshal client session: %v", err)}
 		}
-		batch.Put(sessionKey(command.ClientID), payload)
+		// The session lands in its own family within the same atomic batch.
+		batch.PutCF(s.sessionCF, sessionKey(command.ClientID), payload)
+	}
+	if index > 0 {
+		batch.PutCF(s.metaCF, appliedIndexKey, binary.BigEndian.AppendUint64(nil, index))
 	}
 
 	if batch.Len() > 0 {
-		if err := s.engine.Write(&batch, lsmstore.WriteOptions{}); err != nil {
+		if err := s.engine.WriteWithContext(ctx, &batch, lsmstore.WriteOptions{}); err != nil {
 			return kv.ApplyResult{Error: err.Error()}
 		}
 	}
@@ -105,7 +363,7 @@ func (s *Store) Get(key string) ([]byte, bool, error) {
 	if s.closed || s.engine == nil {
 		return nil, false, lsmstore.ErrClosed
 	}
-	return s.engine.Get(dataKey(key))
+	return s.engine.GetCF(s.dataCF, dataKey(key))
 }
 
 func (s *Store) Snapshot() ([]byte, error) {
@@ -121,10 +379,7 @@ func (s *Store) Snapshot() ([]byte, error) {
 	}
 	defer func() { _ = snapshot.Close() }()
 
-	iter := snapshot.NewIterator(lsmstore.IterOptions{
-		LowerBound: namespaceLower(dataNamespace),
-		UpperBound: namespaceLower(sessionNamespace),
-	})
+	iter := snapshot.NewIterator(lsmstore.IterOptions{ColumnFamily: s.dataCF})
 	defer func() { _ = iter.Close() }()
 
 	var entries []kv.SnapshotEntry
@@ -149,24 +404,39 @@ func (s *Store) Restore(data []byte) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	// The directory is recreated from scratch, but keeps belonging to the
+	// same node.
+	id, stamped, err := identity.ReadFile(s.dir)
+	if err != nil {
+		return err
+	}
 	if s.engine != nil {
 		if err := s.engine.Close(); err != nil {
 			return err
 		}
 		s.engine = nil
+		s.liveEngine.Store(nil)
 	}
 	if err := os.RemoveAll(s.dir); err != nil {
 		return fmt.Errorf("remove lsm dir before restore: %w", err)
 	}
-	engine, err := lsmstore.Open(s.dir)
-	if err != nil {
+	if err := s.openEngine(); err != nil {
 		return err
 	}
+	if stamped {
+		if err := identity.WriteFile(s.dir, id); err != nil {
+			_ = s.engine.Close()
+			s.engine = nil
+			return err
+		}
+	}
+	engine := s.engine
+	s.engine = nil
 
 	sessions := in.SessionsMap()
 	var batch lsmstore.WriteBatch
 	for _, entry := range in.Entries {
-		batch.Put(dataKey(entry.Key), entry.Value)
+		batch.PutCF(s.dataCF, dataKey(entry.Key), entry.Value)
 	}
 	for clientID, session := range sessions {
 		payload, err := json.Marshal(session)
@@ -174,7 +444,7 @@ func (s *Store) Restore(data []byte) error {
 			_ = engine.Close()
 			return fmt.Errorf("marshal client session: %w", err)
 		}
-		batch.Put(sessionKey(clientID), payload)
+		batch.PutCF(s.sessionCF, sessionKey(clientID), payload)
 	}
 	if batch.Len() > 0 {
 		if err := engine.Write(&batch, lsmstore.WriteOptions{Sync: true}); err != nil {
@@ -184,16 +454,14 @@ func (s *Store) Restore(data []byte) error {
 	}
 
 	s.engine = engine
+	s.liveEngine.Store(engine)
 	s.sessions = sessions
 	s.closed = false
 	return nil
 }
 
 func (s *Store) loadSessions() error {
-	iter := s.engine.NewIterator(lsmstore.IterOptions{
-		LowerBound: namespaceLower(sessionNamespace),
-		UpperBound: namespaceLower(upperNamespace),
-	})
+	iter := s.engine.NewIterator(lsmstore.IterOptions{ColumnFamily: s.sessionCF})
 	defer func() { _ = iter.Close() }()
 
 	for ok := iter.First(); ok; ok = iter.Next() {
@@ -212,15 +480,15 @@ func (s *Store) loadSessions() error {
 func (s *Store) applyToBatch(command kv.Command, batch *lsmstore.WriteBatch) kv.ApplyResult {
 	switch command.Type {
 	case kv.CommandPut:
-		batch.Put(dataKey(command.Key), command.Value)
+		batch.PutCF(s.dataCF, dataKey(command.Key), command.Value)
 		return kv.ApplyResult{Found: true}
 	case kv.CommandDelete:
-		_, found, err := s.engine.Get(dataKey(command.Key))
+		_, found, err := s.engine.GetCF(s.dataCF, dataKey(command.Key))
 		if err != nil {
 			return kv.ApplyResult{Error: err.Error()}
 		}
 		if found {
-			batch.Delete(dataKey(command.Key))
+			batch.DeleteCF(s.dataCF, dataKey(command.Key))
 		}
 		return kv.ApplyResult{Found: found}
 	default:
@@ -267,6 +535,19 @@ func dataKey(key string) []byte {
 	return prefixedKey(dataNamespace, key)
 }
 
+// dataRange maps a user key range onto the data family, keeping empty bounds
+// within the data namespace.
+func dataRange(start, end string) ([]byte, []byte) {
+	lower, upper := namespaceLower(dataNamespace), namespaceLower(sessionNamespace)
+	if start != "" {
+		lower = dataKey(start)
+	}
+	if end != "" {
+		upper = dataKey(end)
+	}
+	return lower, upper
+}
+
 func sessionKey(clientID string) []byte {
 	return prefixedKey(sessionNamespace, clientID)
 }
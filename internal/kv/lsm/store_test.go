@@ -2,10 +2,12 @@ package lsm
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"testing"
 
+	"mini-kv/internal/identity"
 	"mini-kv/internal/kv"
 	lsmstore "mini-kv/internal/storage/lsm"
 )
@@ -110,6 +112,94 @@ func TestStoreRestoreLegacySnapshot(t *testing.T) {
 	}
 }
 
+func TestStoreMigratesDefaultFamilyKeys(t *testing.T) {
+	dir := t.TempDir()
+	engine, err := lsmstore.Open(dir)
+	if err != nil {
+		t.Fatalf("lsm Open error = %v", err)
+	}
+	session, err := json.Marshal(kv.Session{
+		LastRequestID: 1,
+		Results:       map[uint64]kv.ApplyResult{1: {Found: true}},
+	})
+	if err != nil {
+		t.Fatalf("marshal session: %v", err)
+	}
+	var batch lsmstore.WriteBatch
+	batch.Put(dataKey("a"), []byte("1"))
+	batch.Put(sessionKey("client-1"), session)
+	if err := engine.Write(&batch, lsmstore.WriteOptions{Sync: true}); err != nil {
+		t.Fatalf("legacy Write error = %v", err)
+	}
+	if err := engine.Close(); err != nil {
+		t.Fatalf("lsm Close error = %v", err)
+	}
+
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open error = %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	assertStoreValue(t, store, "a", []byte("1"))
+	duplicate := kv.Command{Type: kv.CommandPut, Key: "a", Value: []byte("2"), ClientID: "client-1", RequestID: 1}
+	if result := store.Apply(duplicate); result.Error != "" || !result.Found {
+		t.Fatalf("duplicate apply result = %+v, want cached result", result)
+	}
+	assertStoreValue(t, store, "a", []byte("1"))
+
+	iter := store.engine.NewIterator(lsmstore.IterOptions{})
+	defer func() { _ = iter.Close() }()
+	if iter.First() {
+		t.Fatalf("default family still holds %q after migration", iter.Key())
+	}
+}
+
+func TestStoreMigratesDefaultFamilyInChunks(t *testing.T) {
+	defer func(keys, bytes int) { migrateBatchKeys, migrateBatchBytes = keys, bytes }(migrateBatchKeys, migrateBatchBytes)
+	migrateBatchKeys = 2
+
+	dir := t.TempDir()
+	engine, err := lsmstore.Open(dir)
+	if err != nil {
+		t.Fatalf("lsm Open error = %v", err)
+	}
+	dataCF, err := engine.OpenColumnFamily(dataFamily)
+	if err != nil {
+		t.Fatalf("OpenColumnFamily error = %v", err)
+	}
+	var batch lsmstore.WriteBatch
+	for i := 0; i < 7; i++ {
+		batch.Put(dataKey(fmt.Sprintf("k%d", i)), []byte(fmt.Sprint(i)))
+	}
+	if err := engine.Write(&batch, lsmstore.WriteOptions{Sync: true}); err != nil {
+		t.Fatalf("legacy Write error = %v", err)
+	}
+	// An earlier migration stopped after moving k0.
+	batch.Reset()
+	batch.PutCF(dataCF, dataKey("k0"), []byte("0"))
+	batch.Delete(dataKey("k0"))
+	if err := engine.Write(&batch, lsmstore.WriteOptions{Sync: true}); err != nil {
+		t.Fatalf("partial migration Write error = %v", err)
+	}
+	if err := engine.Close(); err != nil {
+		t.Fatalf("lsm Close error = %v", err)
+	}
+
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open error = %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	for i := 0; i < 7; i++ {
+		assertStoreValue(t, store, fmt.Sprintf("k%d", i), []byte(fmt.Sprint(i)))
+	}
+	iter := store.engine.NewIterator(lsmstore.IterOptions{})
+	defer func() { _ = iter.Close() }()
+	if iter.First() {
+		t.Fatalf("default family still holds %q after migration", iter.Key())
+	}
+}
+
 func TestStoreMatrixWorkloadCorrectness(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -270,6 +360,94 @@ func TestStoreStabilityAcrossFlushSnapshotAndReopen(t *testing.T) {
 	assertSnapshotRestore(t, store, keyspace, model)
 }
 
+func TestStoreCompactRangeAndApproximateCount(t *testing.T) {
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open error = %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	for i := 0; i < 20; i++ {
+		result := store.Apply(kv.Command{Type: kv.CommandPut, Key: matrixKey(i), Value: []byte("v"), ClientID: "c1", RequestID: uint64(i + 1)})
+		if result.Error != "" {
+			t.Fatalf("put %d error: %s", i, result.Error)
+		}
+	}
+	for i := 0; i < 15; i++ {
+		if result := store.Apply(kv.Command{Type: kv.CommandDelete, Key: matrixKey(i)}); result.Error != "" {
+			t.Fatalf("delete %d error: %s", i, result.Error)
+		}
+	}
+	if err := store.CompactRange(context.Background(), "", ""); err != nil {
+		t.Fatalf("CompactRange error = %v", err)
+	}
+
+	// Estimates are block-granular, so a block shared with the session record
+	// is counted too; the deleted keys must be gone after compaction.
+	count, err := store.ApproximateCount("", "")
+	if err != nil {
+		t.Fatalf("ApproximateCount error = %v", err)
+	}
+	if count < 5 || count > 6 {
+		t.Fatalf("ApproximateCount = %d, want live keys plus at most the session record", count)
+	}
+	size, err := store.ApproximateSize(matrixKey(15), "")
+	if err != nil || size <= 0 {
+		t.Fatalf("ApproximateSize = (%d, %v), want > 0", size, err)
+	}
+	assertStoreValue(t, store, matrixKey(0), nil)
+	assertStoreValue(t, store, matrixKey(19), []byte("v"))
+}
+
+func TestStoreAppliedIndexAndIdentity(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open error = %v", err)
+	}
+	id := identity.Identity{FormatVersion: identity.FormatVersion, ClusterID: "c1", NodeID: "node1"}
+	if err := store.SetIdentity(id); err != nil {
+		t.Fatalf("SetIdentity error = %v", err)
+	}
+	for index := uint64(1); index <= 3; index++ {
+		command := kv.Command{Type: kv.CommandPut, Key: fmt.Sprintf("k%d", index), Value: []byte("v")}
+		if result := store.ApplyAt(context.Background(), index, command); result.Error != "" {
+			t.Fatalf("ApplyAt(%d) error: %s", index, result.Error)
+		}
+	}
+	// Deleting a missing key writes nothing but the index.
+	if result := store.ApplyAt(context.Background(), 4, kv.Command{Type: kv.CommandDelete, Key: "missing"}); result.Error != "" {
+		t.Fatalf("ApplyAt(4) error: %s", result.Error)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close error = %v", err)
+	}
+
+	store, err = Open(dir)
+	if err != nil {
+		t.Fatalf("reopen error = %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	if index, err := store.AppliedIndex(); err != nil || index != 4 {
+		t.Fatalf("AppliedIndex = %d, %v; want 4", index, err)
+	}
+
+	snapshot, err := store.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot error = %v", err)
+	}
+	if err := store.Restore(snapshot); err != nil {
+		t.Fatalf("Restore error = %v", err)
+	}
+	if index, err := store.AppliedIndex(); err != nil || index != 0 {
+		t.Fatalf("AppliedIndex after restore = %d, %v; want 0", index, err)
+	}
+	if got, ok, err := store.Identity(); err != nil || !ok || got != id {
+		t.Fatalf("Identity after restore = %+v, %v, %v; want %+v", got, ok, err, id)
+	}
+	assertStoreValue(t, store, "k3", []byte("v"))
+}
+
 func TestStoreImplementsKVStore(t *testing.T) {
 	store, err := Open(t.TempDir())
 	if err != nil {
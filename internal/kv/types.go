@@ -1,5 +1,7 @@
 package kv
 
+import "context"
+
 type CommandType uint8
 
 const (
@@ -40,6 +42,35 @@ type Reader interface {
 	Get(key string) ([]byte, bool, error)
 }
 
+// ContextApplier is implemented by stores that accept the context of the
+// proposal being applied, so that storage work joins the proposal's trace.
+type ContextApplier interface {
+	ApplyWithContext(ctx context.Context, command Command) ApplyResult
+}
+
+// IndexedApplier is implemented by stores that persist the raft index of the
+// applied entry in the same write as the entry, so that a restart can tell
+// whether the store is ahead of the raft log it is paired with.
+type IndexedApplier interface {
+	ApplyAt(ctx context.Context, index uint64, command Command) ApplyResult
+	AppliedIndex() (uint64, error)
+}
+
+// WriteThrottler is implemented by stores that can ask proposers to back off
+// before new writes are replicated, e.g. when the storage engine stalls.
+type WriteThrottler interface {
+	WriteStall() error
+}
+
+// RangeCompactor is implemented by stores that can compact a key range on
+// demand and estimate its on-disk footprint. Empty bounds are unbounded and
+// ranges are half-open: [start, end).
+type RangeCompactor interface {
+	CompactRange(ctx context.Context, start, end string) error
+	ApproximateSize(start, end string) (int64, error)
+	ApproximateCount(start, end string) (int64, error)
+}
+
 type SnapshotHandle interface {
 	Marshal() ([]byte, error)
 	Close() error
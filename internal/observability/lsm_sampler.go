@@ -0,0 +1,108 @@
+package observability
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"mini-kv/internal/storage/lsm"
+)
+
+const DefaultLSMSampleInterval = time.Second
+
+type LSMMetricsSource interface {
+	Metrics() (lsm.Metrics, bool)
+}
+
+// LSMEventListener feeds flush, compaction and WAL sync durations into
+// histograms; the sampler cannot see individual events.
+func LSMEventListener(registry *Registry, nodeID string) lsm.EventListener {
+	if registry == nil {
+		return lsm.EventListener{}
+	}
+	buckets := LatencyBucketsMS()
+	flushDuration := registry.Histogram("mini_kv_lsm_flush_duration_ms", "LSM memtable flush duration in milliseconds.", buckets, "node")
+	compactionDuration := registry.Histogram("mini_kv_lsm_compaction_duration_ms", "LSM compaction duration in milliseconds, by output level.", buckets, "node", "level")
+	walSyncDuration := registry.Histogram("mini_kv_lsm_wal_sync_duration_ms", "LSM WAL fsync latency in milliseconds.", buckets, "node")
+	return lsm.EventListener{
+		FlushCompleted: func(info lsm.FlushInfo) {
+			flushDuration.Observe(durationMS(info.Duration), nodeID)
+		},
+		CompactionCompleted: func(info lsm.CompactionInfo) {
+			compactionDuration.Observe(durationMS(info.Duration), nodeID, strconv.Itoa(info.OutputLevel))
+		},
+		WALSynced: func(elapsed time.Duration) {
+			walSyncDuration.Observe(durationMS(elapsed), nodeID)
+		},
+	}
+}
+
+func StartLSMSampler(ctx context.Context, registry *Registry, nodeID string, source LSMMetricsSource, interval time.Duration) {
+	if registry == nil || source == nil {
+		return
+	}
+	if interval <= 0 {
+		interval = DefaultLSMSampleInterval
+	}
+
+	memTableBytes := registry.Gauge("mini_kv_lsm_memtable_bytes", "Approximate bytes held by active and immutable memtables.", "node")
+	memTables := registry.Gauge("mini_kv_lsm_memtables", "Active and immutable memtables.", "node")
+	immutableMemTables := registry.Gauge("mini_kv_lsm_immutable_memtables", "Immutable memtables waiting to be flushed.", "node")
+	levelFiles := registry.Gauge("mini_kv_lsm_level_files", "SSTable files by level.", "node", "level")
+	levelBytes := registry.Gauge("mini_kv_lsm_level_bytes", "SSTable bytes by level.", "node", "level")
+	writeAmplification := registry.Gauge("mini_kv_lsm_write_amplification", "Bytes written by flushes and compactions divided by bytes flushed.", "node")
+	backgroundError := registry.Gauge("mini_kv_lsm_background_error", "1 when the engine stopped after a background error.", "node")
+	flushBytes := registry.Counter("mini_kv_lsm_flush_bytes_total", "Bytes written by memtable flushes.", "node")
+	compactionBytesRead := registry.Counter("mini_kv_lsm_compaction_read_bytes_total", "SSTable bytes read by compactions.", "node")
+	compactionBytesWritten := registry.Counter("mini_kv_lsm_compaction_written_bytes_total", "Bytes written by compactions and blob garbage collection.", "node")
+	bloomUseful := registry.Counter("mini_kv_lsm_bloom_useful_total", "Point lookups that skipped an SSTable because of its bloom filter.", "node")
+	bloomFalsePositives := registry.Counter("mini_kv_lsm_bloom_false_positives_total", "Point lookups that passed the bloom filter but found no visible entry.", "node")
+	stallTime := registry.Counter("mini_kv_lsm_stall_time_ms_total", "Time writes spent throttled by write stalls, in milliseconds.", "node")
+	stalledWrites := registry.Counter("mini_kv_lsm_stalled_writes_total", "Writes throttled by write stalls, by condition.", "node", "condition")
+
+	go func() {
+		sample := func() {
+			metrics, ok := source.Metrics()
+			if !ok {
+				return
+			}
+			memTableBytes.Set(float64(metrics.MemTableBytes), nodeID)
+			memTables.Set(float64(metrics.MemTables), nodeID)
+			immutableMemTables.Set(float64(metrics.ImmutableMemTables), nodeID)
+			for _, level := range metrics.Levels {
+				levelFiles.Set(float64(level.Files), nodeID, strconv.Itoa(level.Level))
+				levelBytes.Set(float64(level.Bytes), nodeID, strconv.Itoa(level.Level))
+			}
+			writeAmplification.Set(metrics.WriteAmplification(), nodeID)
+			errorState := 0.0
+			if metrics.BackgroundError {
+				errorState = 1
+			}
+			backgroundError.Set(errorState, nodeID)
+			flushBytes.Set(float64(metrics.FlushBytes), nodeID)
+			compactionBytesRead.Set(float64(metrics.CompactionBytesRead), nodeID)
+			compactionBytesWritten.Set(float64(metrics.CompactionBytes), nodeID)
+			bloomUseful.Set(float64(metrics.BloomUseful), nodeID)
+			bloomFalsePositives.Set(float64(metrics.BloomFalsePositives), nodeID)
+			stallTime.Set(durationMS(metrics.StallTime), nodeID)
+			stalledWrites.Set(float64(metrics.StallDelayedWrites), nodeID, "delayed")
+			stalledWrites.Set(float64(metrics.StallStoppedWrites), nodeID, "stopped")
+		}
+
+		sample()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				sample()
+			}
+		}
+	}()
+}
+
+func durationMS(duration time.Duration) float64 {
+	return float64(duration) / float64(time.Millisecond)
+}
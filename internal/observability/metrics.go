@@ -0,0 +1,230 @@
+package observability
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	counterKind   = "counter"
+	gaugeKind     = "gauge"
+	histogramKind = "histogram"
+)
+
+type metricFamily struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	series  map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labels []string
+	value  float64
+	counts []uint64
+	sum    float64
+}
+
+type Counter struct {
+	registry *Registry
+	family   *metricFamily
+}
+
+type Gauge struct {
+	registry *Registry
+	family   *metricFamily
+}
+
+type Histogram struct {
+	registry *Registry
+	family   *metricFamily
+}
+
+// LatencyBucketsMS are the millisecond bounds used by the built-in duration
+// histograms.
+func LatencyBucketsMS() []float64 {
+	out := make([]float64, len(latencyBuckets))
+	for i, bound := range latencyBuckets {
+		out[i] = float64(bound) / float64(time.Millisecond)
+	}
+	return out
+}
+
+// Counter registers a counter family, or returns the existing one with the
+// same name. Registering a name again with another type or label set panics.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	if r == nil {
+		return nil
+	}
+	return &Counter{registry: r, family: r.register(name, help, counterKind, labels, nil)}
+}
+
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	if r == nil {
+		return nil
+	}
+	return &Gauge{registry: r, family: r.register(name, help, gaugeKind, labels, nil)}
+}
+
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if r == nil {
+		return nil
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Histogram{registry: r, family: r.register(name, help, histogramKind, labels, buckets)}
+}
+
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if c == nil || delta < 0 {
+		return
+	}
+	c.registry.mu.Lock()
+	c.family.ensureSeries(labelValues).value += delta
+	c.registry.mu.Unlock()
+}
+
+// Set replaces the counter value. It is meant for mirroring totals that are
+// already accumulated elsewhere, such as engine statistics.
+func (c *Counter) Set(value float64, labelValues ...string) {
+	if c == nil {
+		return
+	}
+	c.registry.mu.Lock()
+	c.family.ensureSeries(labelValues).value = value
+	c.registry.mu.Unlock()
+}
+
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	if g == nil {
+		return
+	}
+	g.registry.mu.Lock()
+	g.family.ensureSeries(labelValues).value = value
+	g.registry.mu.Unlock()
+}
+
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	if h == nil {
+		return
+	}
+	h.registry.mu.Lock()
+	defer h.registry.mu.Unlock()
+	series := h.family.ensureSeries(labelValues)
+	series.value++
+	series.sum += value
+	for i, bound := range h.family.buckets {
+		if value <= bound {
+			series.counts[i]++
+		}
+	}
+}
+
+func (r *Registry) register(name, help, kind string, labels []string, buckets []float64) *metricFamily {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if family, ok := r.families[name]; ok {
+		if family.kind != kind || strings.Join(family.labels, ",") != strings.Join(labels, ",") {
+			panic(fmt.Sprintf("observability: metric %s registered as %s%v, requested as %s%v", name, family.kind, family.labels, kind, labels))
+		}
+		return family
+	}
+	family := &metricFamily{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  append([]string(nil), labels...),
+		buckets: buckets,
+		series:  make(map[string]*metricSeries),
+	}
+	r.families[name] = family
+	return family
+}
+
+func (f *metricFamily) ensureSeries(labelValues []string) *metricSeries {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("observability: metric %s expects %d label values, got %d", f.name, len(f.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	series, ok := f.series[key]
+	if !ok {
+		series = &metricSeries{labels: append([]string(nil), labelValues...)}
+		if f.kind == histogramKind {
+			series.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = series
+	}
+	return series
+}
+
+func (f *metricFamily) sortedSeries() []*metricSeries {
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	out := make([]*metricSeries, len(keys))
+	for i, key := range keys {
+		out[i] = f.series[key]
+	}
+	return out
+}
+
+func (f *metricFamily) labelMap(series *metricSeries) map[string]string {
+	labels := make(map[string]string, len(f.labels)+1)
+	for i, name := range f.labels {
+		labels[name] = series.labels[i]
+	}
+	return labels
+}
+
+func (f *metricFamily) render(builder *strings.Builder) {
+	builder.WriteString("# HELP " + f.name + " " + f.help + "\n")
+	builder.WriteString("# TYPE " + f.name + " " + f.kind + "\n")
+	for _, series := range f.sortedSeries() {
+		labels := f.labelMap(series)
+		if f.kind != histogramKind {
+			writeMetric(builder, f.name, labels, series.value)
+			continue
+		}
+		for i, count := range series.counts {
+			labelCopy := copyLabels(labels)
+			labelCopy["le"] = fmt.Sprintf("%g", f.buckets[i])
+			writeMetric(builder, f.name+"_bucket", labelCopy, float64(count))
+		}
+		labelCopy := copyLabels(labels)
+		labelCopy["le"] = "+Inf"
+		writeMetric(builder, f.name+"_bucket", labelCopy, series.value)
+		writeMetric(builder, f.name+"_sum", labels, series.sum)
+		writeMetric(builder, f.name+"_count", labels, series.value)
+	}
+}
+
+func (f *metricFamily) snapshot(out map[string]float64) {
+	key := func(name string, series *metricSeries) string {
+		return strings.Join(append([]string{name}, series.labels...), "|")
+	}
+	for _, series := range f.series {
+		if f.kind != histogramKind {
+			out[key(f.name, series)] = series.value
+			continue
+		}
+		out[key(f.name+"_count", series)] = series.value
+		out[key(f.name+"_sum", series)] = series.sum
+	}
+}
+
+func (r *Registry) renderFamilies(builder *strings.Builder) {
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		r.families[name].render(builder)
+	}
+}
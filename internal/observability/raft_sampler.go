@@ -9,31 +9,51 @@ import (
 
 const DefaultRaftSampleInterval = 200 * time.Millisecond
 
-func StartRaftSampler(ctx context.Context, registry *Registry, nodeID string, node raft.Node, storage raft.Storage, interval time.Duration) {
-	if registry == nil || nodeID == "" || node == nil || storage == nil {
+type RaftStatusSource interface {
+	Status() raft.Status
+}
+
+func StartRaftSampler(ctx context.Context, registry *Registry, nodeID string, source RaftStatusSource, interval time.Duration) {
+	if registry == nil || nodeID == "" || source == nil {
 		return
 	}
 	if interval <= 0 {
 		interval = DefaultRaftSampleInterval
 	}
 
+	term := registry.Gauge("mini_kv_raft_term", "Current raft term by node.", "node")
+	lastIndex := registry.Gauge("mini_kv_raft_last_index", "Index of the last raft log entry by node.", "node")
+	snapshotIndex := registry.Gauge("mini_kv_raft_snapshot_index", "Index covered by the latest raft snapshot by node.", "node")
+
 	go func() {
-		lastState := ""
+		lastState := raft.StateType(0)
 		sample := func() {
-			state := "follower"
-			if node.IsLeader() {
-				state = "leader"
-			}
-			if state == "leader" && lastState != "leader" {
+			status := source.Status()
+			if status.State == raft.Leader && lastState != raft.Leader {
 				registry.IncLeaderChange(nodeID)
 			}
-			lastState = state
+			lastState = status.State
+
+			registry.SetRaftState(nodeID, status.State.String())
+			registry.SetRaftLeader(nodeID, status.Leader)
+			registry.SetCommitIndex(nodeID, status.Commit)
+			registry.SetAppliedIndex(nodeID, status.Applied)
+			term.Set(float64(status.Term), nodeID)
+			lastIndex.Set(float64(status.LastIndex), nodeID)
+			snapshotIndex.Set(float64(status.SnapshotIndex), nodeID)
 
-			registry.SetRaftState(nodeID, state)
-			registry.SetRaftLeader(nodeID, node.LeaderID())
-			if hardState, err := storage.LoadHardState(); err == nil {
-				registry.SetCommitIndex(nodeID, hardState.Commit)
+			progress := make(map[string]ReplicationProgress, len(status.Progress))
+			for peer, item := range status.Progress {
+				progress[peer] = ReplicationProgress{
+					State:       item.State.String(),
+					Inflight:    item.Inflight,
+					Lag:         item.Lag,
+					Match:       item.Match,
+					Next:        item.Next,
+					LastContact: item.LastContact,
+				}
 			}
+			registry.SetReplicationProgress(nodeID, progress)
 		}
 
 		sample()
@@ -37,6 +37,10 @@ type Registry struct {
 	raftLeaders   map[string]string
 	commitIndex   map[string]uint64
 	appliedIndex  map[string]uint64
+	authDenied    map[labelKey]uint64
+	replication   map[labelKey]ReplicationProgress
+	transport     map[labelKey]TransportBytes
+	families      map[string]*metricFamily
 }
 
 type labelKey struct {
@@ -61,6 +65,25 @@ type DebugSnapshot struct {
 	RaftLeader    map[string]string                `json:"raft_leader"`
 	CommitIndex   map[string]uint64                `json:"commit_index"`
 	AppliedIndex  map[string]uint64                `json:"applied_index"`
+	AuthDenied    map[string]uint64                `json:"auth_denied"`
+	Replication   map[string]ReplicationProgress   `json:"replication"`
+	Transport     map[string]TransportBytes        `json:"transport"`
+	Metrics       map[string]float64               `json:"metrics"`
+}
+
+type ReplicationProgress struct {
+	State       string    `json:"state"`
+	Inflight    int       `json:"inflight"`
+	Lag         uint64    `json:"lag"`
+	Match       uint64    `json:"match"`
+	Next        uint64    `json:"next"`
+	LastContact time.Time `json:"last_contact"`
+}
+
+type TransportBytes struct {
+	Frames    uint64 `json:"frames"`
+	RawBytes  uint64 `json:"raw_bytes"`
+	WireBytes uint64 `json:"wire_bytes"`
 }
 
 type DurationStatsSnapshot struct {
@@ -80,6 +103,10 @@ func NewRegistry() *Registry {
 		raftLeaders:   make(map[string]string),
 		commitIndex:   make(map[string]uint64),
 		appliedIndex:  make(map[string]uint64),
+		authDenied:    make(map[labelKey]uint64),
+		replication:   make(map[labelKey]ReplicationProgress),
+		transport:     make(map[labelKey]TransportBytes),
+		families:      make(map[string]*metricFamily),
 	}
 }
 
@@ -150,6 +177,45 @@ func (r *Registry) SetAppliedIndex(nodeID string, index uint64) {
 	r.mu.Unlock()
 }
 
+func (r *Registry) IncAuthDenied(method, reason string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.authDenied[labelKey{A: method, B: reason}]++
+	r.mu.Unlock()
+}
+
+func (r *Registry) SetReplicationProgress(nodeID string, progress map[string]ReplicationProgress) {
+	if r == nil || nodeID == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key := range r.replication {
+		if key.A == nodeID {
+			delete(r.replication, key)
+		}
+	}
+	for peer, item := range progress {
+		r.replication[labelKey{A: nodeID, B: peer}] = item
+	}
+}
+
+func (r *Registry) AddRaftTransportBytes(nodeID, peer, message string, rawBytes, wireBytes int) {
+	if r == nil || nodeID == "" {
+		return
+	}
+	key := labelKey{A: nodeID, B: peer, C: message}
+	r.mu.Lock()
+	item := r.transport[key]
+	item.Frames++
+	item.RawBytes += uint64(rawBytes)
+	item.WireBytes += uint64(wireBytes)
+	r.transport[key] = item
+	r.mu.Unlock()
+}
+
 func (r *Registry) Snapshot() DebugSnapshot {
 	if r == nil {
 		return DebugSnapshot{}
@@ -167,6 +233,10 @@ func (r *Registry) Snapshot() DebugSnapshot {
 		RaftLeader:    cloneStringMap(r.raftLeaders),
 		CommitIndex:   cloneUintMap(r.commitIndex),
 		AppliedIndex:  cloneUintMap(r.appliedIndex),
+		AuthDenied:    make(map[string]uint64, len(r.authDenied)),
+		Replication:   make(map[string]ReplicationProgress, len(r.replication)),
+		Transport:     make(map[string]TransportBytes, len(r.transport)),
+		Metrics:       make(map[string]float64),
 	}
 
 	for key, stats := range r.grpcStats {
@@ -175,6 +245,18 @@ func (r *Registry) Snapshot() DebugSnapshot {
 	for key, stats := range r.raftOpStats {
 		snapshot.RaftOperation[fmt.Sprintf("%s|%s|%s", key.A, key.B, key.C)] = stats.snapshot()
 	}
+	for key, item := range r.replication {
+		snapshot.Replication[fmt.Sprintf("%s|%s", key.A, key.B)] = item
+	}
+	for key, item := range r.transport {
+		snapshot.Transport[fmt.Sprintf("%s|%s|%s", key.A, key.B, key.C)] = item
+	}
+	for key, count := range r.authDenied {
+		snapshot.AuthDenied[fmt.Sprintf("%s|%s", key.A, key.B)] = count
+	}
+	for _, family := range r.families {
+		family.snapshot(snapshot.Metrics)
+	}
 	return snapshot
 }
 
@@ -205,6 +287,14 @@ func (r *Registry) RenderPrometheus() string {
 			return map[string]string{"method": key.A, "status": key.B}
 		})
 
+	builder.WriteString("# HELP mini_kv_auth_denied_total Total gRPC requests rejected by authentication or authorization, by method and reason.\n")
+	builder.WriteString("# TYPE mini_kv_auth_denied_total counter\n")
+	for _, key := range sortedKeys(r.authDenied) {
+		writeMetric(&builder, "mini_kv_auth_denied_total",
+			map[string]string{"method": key.A, "reason": key.B},
+			float64(r.authDenied[key]))
+	}
+
 	builder.WriteString("# HELP mini_kv_raft_operations_total Total raft/runtime operations by node, operation and status.\n")
 	builder.WriteString("# TYPE mini_kv_raft_operations_total counter\n")
 	raftKeys := sortedLabelKeys(r.raftOpStats)
@@ -249,6 +339,58 @@ func (r *Registry) RenderPrometheus() string {
 		writeMetric(&builder, "mini_kv_raft_leader_info", map[string]string{"node": nodeID, "leader": r.raftLeaders[nodeID]}, 1)
 	}
 
+	replicationKeys := sortedKeys(r.replication)
+	builder.WriteString("# HELP mini_kv_raft_replication_inflight AppendEntries messages in flight from leader to follower.\n")
+	builder.WriteString("# TYPE mini_kv_raft_replication_inflight gauge\n")
+	for _, key := range replicationKeys {
+		writeMetric(&builder, "mini_kv_raft_replication_inflight", map[string]string{"node": key.A, "peer": key.B}, float64(r.replication[key].Inflight))
+	}
+	builder.WriteString("# HELP mini_kv_raft_replication_lag_entries Log entries the follower is behind the leader.\n")
+	builder.WriteString("# TYPE mini_kv_raft_replication_lag_entries gauge\n")
+	for _, key := range replicationKeys {
+		writeMetric(&builder, "mini_kv_raft_replication_lag_entries", map[string]string{"node": key.A, "peer": key.B}, float64(r.replication[key].Lag))
+	}
+	builder.WriteString("# HELP mini_kv_raft_replication_match_index Highest log index known to be replicated on the follower.\n")
+	builder.WriteString("# TYPE mini_kv_raft_replication_match_index gauge\n")
+	for _, key := range replicationKeys {
+		writeMetric(&builder, "mini_kv_raft_replication_match_index", map[string]string{"node": key.A, "peer": key.B}, float64(r.replication[key].Match))
+	}
+	builder.WriteString("# HELP mini_kv_raft_replication_next_index Next log index the leader will send to the follower.\n")
+	builder.WriteString("# TYPE mini_kv_raft_replication_next_index gauge\n")
+	for _, key := range replicationKeys {
+		writeMetric(&builder, "mini_kv_raft_replication_next_index", map[string]string{"node": key.A, "peer": key.B}, float64(r.replication[key].Next))
+	}
+	builder.WriteString("# HELP mini_kv_raft_replication_last_contact_timestamp_seconds Unix time of the last response from the follower.\n")
+	builder.WriteString("# TYPE mini_kv_raft_replication_last_contact_timestamp_seconds gauge\n")
+	for _, key := range replicationKeys {
+		if contact := r.replication[key].LastContact; !contact.IsZero() {
+			writeMetric(&builder, "mini_kv_raft_replication_last_contact_timestamp_seconds", map[string]string{"node": key.A, "peer": key.B}, float64(contact.UnixNano())/float64(time.Second))
+		}
+	}
+	builder.WriteString("# HELP mini_kv_raft_replication_state_info Replication state of each follower as seen by the leader.\n")
+	builder.WriteString("# TYPE mini_kv_raft_replication_state_info gauge\n")
+	for _, key := range replicationKeys {
+		writeMetric(&builder, "mini_kv_raft_replication_state_info", map[string]string{"node": key.A, "peer": key.B, "state": r.replication[key].State}, 1)
+	}
+
+	transportKeys := sortedKeys(r.transport)
+	builder.WriteString("# HELP mini_kv_raft_transport_frames_total Raft frames sent by peer and message type.\n")
+	builder.WriteString("# TYPE mini_kv_raft_transport_frames_total counter\n")
+	for _, key := range transportKeys {
+		writeMetric(&builder, "mini_kv_raft_transport_frames_total", map[string]string{"node": key.A, "peer": key.B, "message": key.C}, float64(r.transport[key].Frames))
+	}
+	builder.WriteString("# HELP mini_kv_raft_transport_raw_bytes_total Raft frame payload bytes before compression, by peer and message type.\n")
+	builder.WriteString("# TYPE mini_kv_raft_transport_raw_bytes_total counter\n")
+	for _, key := range transportKeys {
+		writeMetric(&builder, "mini_kv_raft_transport_raw_bytes_total", map[string]string{"node": key.A, "peer": key.B, "message": key.C}, float64(r.transport[key].RawBytes))
+	}
+	builder.WriteString("# HELP mini_kv_raft_transport_wire_bytes_total Raft frame payload bytes as sent on the wire, by peer and message type.\n")
+	builder.WriteString("# TYPE mini_kv_raft_transport_wire_bytes_total counter\n")
+	for _, key := range transportKeys {
+		writeMetric(&builder, "mini_kv_raft_transport_wire_bytes_total", map[string]string{"node": key.A, "peer": key.B, "message": key.C}, float64(r.transport[key].WireBytes))
+	}
+
+	r.renderFamilies(&builder)
 	return builder.String()
 }
 
@@ -363,6 +505,23 @@ func sortedLabelKeys(source map[labelKey]*durationStats) []labelKey {
 	return keys
 }
 
+func sortedKeys[V any](source map[labelKey]V) []labelKey {
+	keys := make([]labelKey, 0, len(source))
+	for key := range source {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].A != keys[j].A {
+			return keys[i].A < keys[j].A
+		}
+		if keys[i].B != keys[j].B {
+			return keys[i].B < keys[j].B
+		}
+		return keys[i].C < keys[j].C
+	})
+	return keys
+}
+
 func sortedStringKeys(source map[string]uint64) []string {
 	keys := make([]string, 0, len(source))
 	for key := range source {
@@ -2,8 +2,10 @@ package observability
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/pprof"
+	"strconv"
 	"time"
 
 	"mini-kv/internal/config"
@@ -11,17 +13,21 @@ import (
 )
 
 type Server struct {
-	cfg      config.DebugConfig
-	logger   *logger.Logger
-	registry *Registry
-	server   *http.Server
+	cfg        config.DebugConfig
+	logger     *logger.Logger
+	registry   *Registry
+	raftStatus RaftStatusSource
+	slowLog    *SlowLog
+	server     *http.Server
 }
 
-func NewServer(cfg config.DebugConfig, logger *logger.Logger, registry *Registry) *Server {
+func NewServer(cfg config.DebugConfig, logger *logger.Logger, registry *Registry, raftStatus RaftStatusSource, slowLog *SlowLog) *Server {
 	return &Server{
-		cfg:      cfg,
-		logger:   logger,
-		registry: registry,
+		cfg:        cfg,
+		logger:     logger,
+		registry:   registry,
+		raftStatus: raftStatus,
+		slowLog:    slowLog,
 	}
 }
 
@@ -30,18 +36,9 @@ func (s *Server) Run(ctx context.Context) error {
 		return nil
 	}
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("/metrics", s.handleMetrics)
-	mux.HandleFunc("/debug/vars", s.handleVars)
-	mux.HandleFunc("/debug/pprof/", pprof.Index)
-	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
-	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
-	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
-	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
-
 	server := &http.Server{
 		Addr:              s.cfg.Address(),
-		Handler:           mux,
+		Handler:           s.Handler(),
 		ReadHeaderTimeout: 5 * time.Second,
 	}
 	s.server = server
@@ -62,6 +59,20 @@ func (s *Server) Run(ctx context.Context) error {
 	return err
 }
 
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	mux.HandleFunc("/debug/vars", s.handleVars)
+	mux.HandleFunc("/debug/raft", s.handleRaft)
+	mux.HandleFunc("/debug/slowlog", s.handleSlowLog)
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
 func (s *Server) handleMetrics(writer http.ResponseWriter, _ *http.Request) {
 	writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
 	_, _ = writer.Write([]byte(s.registry.RenderPrometheus()))
@@ -76,3 +87,56 @@ func (s *Server) handleVars(writer http.ResponseWriter, _ *http.Request) {
 	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
 	_, _ = writer.Write(data)
 }
+
+func (s *Server) handleRaft(writer http.ResponseWriter, _ *http.Request) {
+	if s.raftStatus == nil {
+		http.Error(writer, "raft is not running", http.StatusServiceUnavailable)
+		return
+	}
+	data, err := json.MarshalIndent(s.raftStatus.Status(), "", "  ")
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_, _ = writer.Write(data)
+}
+
+// handleSlowLog lists recorded slow requests, newest first; ?limit=N caps the
+// list. DELETE clears the log.
+func (s *Server) handleSlowLog(writer http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
+	case http.MethodDelete:
+		s.slowLog.Reset()
+		writer.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		writer.Header().Set("Allow", "GET, DELETE")
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	limit := 0
+	if raw := request.URL.Query().Get("limit"); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 0 {
+			http.Error(writer, "limit must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		limit = value
+	}
+	entries := s.slowLog.Entries(limit)
+	if entries == nil {
+		entries = []SlowLogEntry{}
+	}
+	data, err := json.MarshalIndent(struct {
+		Len     int            `json:"len"`
+		Entries []SlowLogEntry `json:"entries"`
+	}{s.slowLog.Len(), entries}, "", "  ")
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_, _ = writer.Write(data)
+}
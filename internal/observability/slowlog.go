@@ -0,0 +1,240 @@
+package observability
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"mini-kv/internal/config"
+	"mini-kv/internal/logger"
+)
+
+// Phase is one step of a request's latency breakdown.
+type Phase int
+
+const (
+	PhaseQueueWait Phase = iota
+	PhaseProposal
+	PhaseCommit
+	PhaseApply
+	PhaseReadIndex
+	PhaseStorageRead
+	phaseCount
+)
+
+var phaseNames = [phaseCount]string{"queue_wait", "proposal", "commit", "apply", "read_index", "storage_read"}
+
+func (p Phase) String() string {
+	if p < 0 || p >= phaseCount {
+		return fmt.Sprintf("phase_%d", int(p))
+	}
+	return phaseNames[p]
+}
+
+// Breakdown is the time a request spent in each phase. Phases the request did
+// not go through stay zero.
+type Breakdown [phaseCount]time.Duration
+
+func (b Breakdown) MarshalJSON() ([]byte, error) {
+	out := make(map[string]float64, phaseCount)
+	for phase, elapsed := range b {
+		if elapsed > 0 {
+			out[Phase(phase).String()] = durationMS(elapsed)
+		}
+	}
+	return json.Marshal(out)
+}
+
+func (b Breakdown) String() string {
+	var builder strings.Builder
+	for phase, elapsed := range b {
+		if elapsed <= 0 {
+			continue
+		}
+		if builder.Len() > 0 {
+			builder.WriteByte(' ')
+		}
+		fmt.Fprintf(&builder, "%s=%s", Phase(phase), elapsed)
+	}
+	return builder.String()
+}
+
+type SlowLogEntry struct {
+	ID        uint64        `json:"id"`
+	Time      time.Time     `json:"time"`
+	Operation string        `json:"operation"`
+	Key       string        `json:"key"`
+	Size      int           `json:"size"`
+	Duration  time.Duration `json:"-"`
+	Breakdown Breakdown     `json:"breakdown_ms"`
+	Error     string        `json:"error,omitempty"`
+}
+
+func (e SlowLogEntry) MarshalJSON() ([]byte, error) {
+	type entry SlowLogEntry
+	return json.Marshal(struct {
+		entry
+		DurationMS float64 `json:"duration_ms"`
+	}{entry(e), durationMS(e.Duration)})
+}
+
+// SlowLog keeps the most recent requests that took longer than a threshold,
+// like Redis SLOWLOG, and logs each one as it is recorded.
+type SlowLog struct {
+	threshold time.Duration
+	redact    bool
+	logger    *logger.Logger
+
+	mu      sync.Mutex
+	entries []SlowLogEntry
+	next    int
+	lastID  uint64
+}
+
+func NewSlowLog(cfg config.SlowLogConfig, logger *logger.Logger) *SlowLog {
+	return &SlowLog{
+		threshold: time.Duration(cfg.ThresholdMS) * time.Millisecond,
+		redact:    cfg.RedactKeys,
+		logger:    logger,
+		entries:   make([]SlowLogEntry, 0, max(cfg.MaxLen, 1)),
+	}
+}
+
+type slowOpKey struct{}
+
+// SlowOp measures one request from Start to Finish and collects its phase
+// timings from the layers below through the context.
+type SlowOp struct {
+	log       *SlowLog
+	startedAt time.Time
+	operation string
+	key       string
+	size      int
+	mu        sync.Mutex
+	breakdown Breakdown
+}
+
+// Start begins measuring a request. When ctx already carries a request started
+// by an outer layer, that layer records it and Start returns a nil op, whose
+// Finish does nothing.
+func (l *SlowLog) Start(ctx context.Context, operation, key string, size int) (context.Context, *SlowOp) {
+	if l == nil || slowOpFrom(ctx) != nil {
+		return ctx, nil
+	}
+	op := &SlowOp{log: l, startedAt: time.Now(), operation: operation, key: key, size: size}
+	return context.WithValue(ctx, slowOpKey{}, op), op
+}
+
+// ObservePhase adds elapsed to phase of the request measured in ctx, if any.
+func ObservePhase(ctx context.Context, phase Phase, elapsed time.Duration) {
+	op := slowOpFrom(ctx)
+	if op == nil || phase < 0 || phase >= phaseCount {
+		return
+	}
+	op.mu.Lock()
+	op.breakdown[phase] += elapsed
+	op.mu.Unlock()
+}
+
+func slowOpFrom(ctx context.Context) *SlowOp {
+	if ctx == nil {
+		return nil
+	}
+	op, _ := ctx.Value(slowOpKey{}).(*SlowOp)
+	return op
+}
+
+// Finish records the request if it ran longer than the threshold.
+func (op *SlowOp) Finish(err error) {
+	if op == nil {
+		return
+	}
+	elapsed := time.Since(op.startedAt)
+	if elapsed < op.log.threshold {
+		return
+	}
+	op.mu.Lock()
+	breakdown := op.breakdown
+	op.mu.Unlock()
+	entry := SlowLogEntry{
+		Time:      op.startedAt,
+		Operation: op.operation,
+		Key:       op.log.displayKey(op.key),
+		Size:      op.size,
+		Duration:  elapsed,
+		Breakdown: breakdown,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	op.log.add(entry)
+}
+
+func (l *SlowLog) add(entry SlowLogEntry) {
+	l.mu.Lock()
+	l.lastID++
+	entry.ID = l.lastID
+	if len(l.entries) < cap(l.entries) {
+		l.entries = append(l.entries, entry)
+	} else {
+		l.entries[l.next] = entry
+	}
+	l.next = (l.next + 1) % cap(l.entries)
+	l.mu.Unlock()
+
+	if l.logger != nil {
+		l.logger.Infof("slow %s key=%q size=%d duration=%s %s", entry.Operation, entry.Key, entry.Size, entry.Duration, entry.Breakdown)
+	}
+}
+
+// displayKey replaces the key with a short digest when keys are redacted, so
+// that repeated slow requests on one key can still be told apart.
+func (l *SlowLog) displayKey(key string) string {
+	if !l.redact {
+		return key
+	}
+	sum := sha256.Sum256([]byte(key))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// Entries returns up to limit recorded requests, newest first. A limit of zero
+// or less returns all of them.
+func (l *SlowLog) Entries(limit int) []SlowLogEntry {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if limit <= 0 || limit > len(l.entries) {
+		limit = len(l.entries)
+	}
+	out := make([]SlowLogEntry, 0, limit)
+	for i := 1; i <= limit; i++ {
+		out = append(out, l.entries[(l.next-i+cap(l.entries))%cap(l.entries)])
+	}
+	return out
+}
+
+func (l *SlowLog) Len() int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.entries)
+}
+
+func (l *SlowLog) Reset() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	l.entries = l.entries[:0]
+	l.next = 0
+	l.mu.Unlock()
+}
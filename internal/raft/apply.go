@@ -39,6 +39,7 @@ func (r *raftNode) applyCommitEntries() {
 				if r.lastApplied+1 == entry.Index {
 					r.lastApplied = entry.Index
 				}
+				delete(r.proposalSpans, entry.Index)
 				r.mu.Unlock()
 			case <-r.applyNotifyCh:
 				restart = true
@@ -96,6 +97,7 @@ func (r *raftNode) makeApplyMsg(entry LogEntry) (ApplyMsg, bool) {
 		Term:  entry.Term,
 		Type:  entry.Type,
 		Data:  append([]byte(nil), entry.Data...),
+		Trace: r.proposalSpans[entry.Index],
 	}, true
 }
 
@@ -10,6 +10,10 @@ type Config struct {
 	ElectionTimeout  time.Duration
 	HeartbeatTimeout time.Duration
 	ApplyBufferSize  int
+	// 每个 follower 最多同时在途的 AppendEntries 数量，0 表示使用默认值
+	MaxInflightMsgs int
+	// 单条 AppendEntries 携带日志的最大字节数，至少携带一条日志，0 表示使用默认值
+	MaxSizePerMsg uint64
 }
 
 func (c Config) validate() error {
@@ -51,6 +55,9 @@ func (c Config) validate() error {
 	if c.ApplyBufferSize <= 0 {
 		return ErrInvalidConfig
 	}
+	if c.MaxInflightMsgs < 0 {
+		return ErrInvalidConfig
+	}
 	return nil
 }
 
@@ -174,6 +174,11 @@ func (r *raftNode) beLeader(term uint64) {
 		r.nextIndex[peer] = noop.Index + 1
 		r.matchIndex[peer] = 0
 	}
+	// 上一任期的在途消息不再计数，所有 follower 从探测阶段开始
+	for _, p := range r.progress {
+		*p = progress{}
+	}
+	clear(r.proposalSpans)
 	r.matchIndex[r.id] = noop.Index
 	r.nextIndex[r.id] = noop.Index + 1
 
@@ -199,6 +204,8 @@ func (r *raftNode) stepDownLocked(term uint64, leaderID string) error {
 	r.leaderID = leaderID
 	r.currentTerm = term
 	r.votedFor = ""
+	// 未应用的提案可能被新 leader 截断，同一索引上的新日志不能挂到旧提案的 trace 下
+	clear(r.proposalSpans)
 	// 如果持久化失败，记录错误
 	if err := r.persistState(); err != nil {
 		return r.failNodeLocked(err)
@@ -12,6 +12,7 @@ import (
 	"path/filepath"
 	"sync"
 
+	"mini-kv/internal/identity"
 	"mini-kv/internal/raft"
 )
 
@@ -22,6 +23,7 @@ const (
 	fileStorageRecordTruncatePrefix = "truncate_prefix"
 	fileStorageRecordSaveSnapshot   = "save_snapshot"
 	fileStorageRecordApplySnapshot  = "apply_snapshot"
+	fileStorageRecordIdentity       = "identity"
 	fileStorageRecordHeaderSize     = 16
 	fileStorageRewriteTempSuffix    = ".rewrite"
 )
@@ -39,14 +41,16 @@ type FileStorage struct {
 	entries   []raft.LogEntry
 	offset    uint64
 	snapshot  raft.Snapshot
+	identity  *identity.Identity
 }
 
 type fileStorageRecord struct {
-	Type      string          `json:"type"`
-	HardState *raft.HardState `json:"hard_state,omitempty"`
-	Entries   []raft.LogEntry `json:"entries,omitempty"`
-	Index     uint64          `json:"index,omitempty"`
-	Snapshot  *raft.Snapshot  `json:"snapshot,omitempty"`
+	Type      string             `json:"type"`
+	HardState *raft.HardState    `json:"hard_state,omitempty"`
+	Entries   []raft.LogEntry    `json:"entries,omitempty"`
+	Index     uint64             `json:"index,omitempty"`
+	Snapshot  *raft.Snapshot     `json:"snapshot,omitempty"`
+	Identity  *identity.Identity `json:"identity,omitempty"`
 }
 
 var _ raft.Storage = (*FileStorage)(nil)
@@ -305,6 +309,40 @@ func (s *FileStorage) ApplySnapshot(snapshot raft.Snapshot) error {
 	return nil
 }
 
+// 返回日志中记录的集群与节点身份，未写入时 ok 为 false
+func (s *FileStorage) Identity() (identity.Identity, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.identity == nil {
+		return identity.Identity{}, false
+	}
+	return *s.identity, true
+}
+
+// 把身份写入日志；身份只能写入一次，重写日志时会保留
+func (s *FileStorage) SetIdentity(id identity.Identity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.identity != nil {
+		if *s.identity == id {
+			return nil
+		}
+		return fmt.Errorf("%w: raft log %s already belongs to %s", identity.ErrMismatch, s.path, *s.identity)
+	}
+
+	next := id
+	if err := s.writeRecordLocked(fileStorageRecord{
+		Type:     fileStorageRecordIdentity,
+		Identity: &next,
+	}); err != nil {
+		return err
+	}
+	s.identity = &next
+	return nil
+}
+
 func (s *FileStorage) Close() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -454,6 +492,14 @@ func (s *FileStorage) applyRecordLocked(record fileStorageRecord) error {
 		}
 		return nil
 
+	case fileStorageRecordIdentity:
+		if record.Identity == nil {
+			return raft.ErrInvalidConfig
+		}
+		id := *record.Identity
+		s.identity = &id
+		return nil
+
 	default:
 		return raft.ErrInvalidConfig
 	}
@@ -486,6 +532,16 @@ func (s *FileStorage) rewriteStateLocked(hardState raft.HardState, offset uint64
 		}
 	}()
 
+	if s.identity != nil {
+		id := *s.identity
+		if err := writeRecord(tmpFile, fileStorageRecord{
+			Type:     fileStorageRecordIdentity,
+			Identity: &id,
+		}); err != nil {
+			return err
+		}
+	}
+
 	if snapshot.Index > 0 {
 		nextSnapshot := cloneSnapshot(snapshot)
 		if err := writeRecord(tmpFile, fileStorageRecord{
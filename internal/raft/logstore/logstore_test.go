@@ -3,11 +3,13 @@ package logstore
 import (
 	"context"
 	"encoding/binary"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
 
+	"mini-kv/internal/identity"
 	"mini-kv/internal/raft"
 )
 
@@ -714,3 +716,39 @@ func assertRecoveredSnapshot(t *testing.T, path string, want raft.Snapshot, want
 		t.Fatalf("last index = %d, want %d", lastIndex, wantLast)
 	}
 }
+
+func TestIdentitySurvivesRewrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "raft.wal")
+	storage, err := OpenFileStorage(path)
+	if err != nil {
+		t.Fatalf("open storage: %v", err)
+	}
+	if _, ok := storage.Identity(); ok {
+		t.Fatal("new log should have no identity")
+	}
+	id := identity.Identity{FormatVersion: identity.FormatVersion, ClusterID: "c1", NodeID: "node1"}
+	if err := storage.SetIdentity(id); err != nil {
+		t.Fatalf("set identity: %v", err)
+	}
+	appendFileEntries(t, storage, 16)
+	if err := storage.SaveSnapshot(raft.Snapshot{Index: 8, Term: 1, Data: []byte("snapshot")}); err != nil {
+		t.Fatalf("save snapshot: %v", err)
+	}
+	other := id
+	other.ClusterID = "c2"
+	if err := storage.SetIdentity(other); !errors.Is(err, identity.ErrMismatch) {
+		t.Fatalf("restamp error = %v, want %v", err, identity.ErrMismatch)
+	}
+	if err := storage.Close(); err != nil {
+		t.Fatalf("close storage: %v", err)
+	}
+
+	recovered, err := OpenFileStorage(path)
+	if err != nil {
+		t.Fatalf("reopen storage: %v", err)
+	}
+	defer recovered.Close()
+	if got, ok := recovered.Identity(); !ok || got != id {
+		t.Fatalf("identity after rewrite = %+v, %v; want %+v", got, ok, id)
+	}
+}
@@ -0,0 +1,115 @@
+package raft
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	defaultMaxInflightMsgs = 16
+	defaultMaxSizePerMsg   = 1 << 20
+)
+
+// ProgressState 描述 Leader 向某个 follower 复制日志所处的阶段
+type ProgressState uint8
+
+const (
+	// 探测阶段：同一时间只有一条消息在途，用于找到与 follower 日志的匹配位置
+	ProgressProbe ProgressState = iota
+	// 复制阶段：发送后立即推进 nextIndex，允许多条消息同时在途
+	ProgressReplicate
+	// 快照阶段：follower 需要的日志已被压缩，暂停日志复制直到快照安装结束
+	ProgressSnapshot
+)
+
+func (s ProgressState) String() string {
+	switch s {
+	case ProgressProbe:
+		return "probe"
+	case ProgressReplicate:
+		return "replicate"
+	case ProgressSnapshot:
+		return "snapshot"
+	}
+	return fmt.Sprintf("ProgressState(%d)", uint8(s))
+}
+
+func (s ProgressState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// PeerProgress 是 Leader 视角下某个 follower 复制进度的只读视图
+type PeerProgress struct {
+	State    ProgressState `json:"state"`
+	Match    uint64        `json:"match"`
+	Next     uint64        `json:"next"`
+	Inflight int           `json:"inflight"`
+	// Leader 最后一条日志与 Match 之间的差距
+	Lag uint64 `json:"lag"`
+	// 最后一次收到该 follower 响应的时间，当选后尚未收到响应时为零值
+	LastContact time.Time `json:"last_contact"`
+}
+
+// ProgressReporter 由能够报告复制进度的节点实现，非 Leader 返回空
+type ProgressReporter interface {
+	Progress() map[string]PeerProgress
+}
+
+type progress struct {
+	state    ProgressState
+	inflight int
+}
+
+// 当前是否不能再发送新的 AppendEntries
+func (p *progress) paused(maxInflight int) bool {
+	switch p.state {
+	case ProgressProbe:
+		return p.inflight > 0
+	case ProgressReplicate:
+		return p.inflight >= maxInflight
+	default:
+		return true
+	}
+}
+
+func (p *progress) becomeProbe() {
+	p.state = ProgressProbe
+}
+
+func (p *progress) becomeReplicate() {
+	p.state = ProgressReplicate
+}
+
+// 返回各 follower 的复制进度，只有 Leader 有数据
+func (r *raftNode) Progress() map[string]PeerProgress {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.stopped || r.state != Leader {
+		return nil
+	}
+	lastIndex, err := r.storage.LastIndex()
+	if err != nil {
+		return nil
+	}
+
+	return r.progressLocked(lastIndex)
+}
+
+func (r *raftNode) progressLocked(lastIndex uint64) map[string]PeerProgress {
+	out := make(map[string]PeerProgress, len(r.progress))
+	for peer, p := range r.progress {
+		match := r.matchIndex[peer]
+		view := PeerProgress{
+			State:       p.state,
+			Match:       match,
+			Next:        r.nextIndex[peer],
+			Inflight:    p.inflight,
+			LastContact: r.lastContact[peer],
+		}
+		if lastIndex > match {
+			view.Lag = lastIndex - match
+		}
+		out[peer] = view
+	}
+	return out
+}
@@ -5,6 +5,9 @@ import (
 	"errors"
 	"sync"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const proposalBatchSize = 64
@@ -20,6 +23,7 @@ type Node interface {
 	IsLeader() bool
 	LeaderID() string
 	ApplyCh() <-chan ApplyMsg
+	Status() Status
 }
 
 type raftNode struct {
@@ -38,13 +42,19 @@ type raftNode struct {
 	currentTerm uint64
 	votedFor    string
 
-	commitIndex uint64
-	commitTerm  uint64
-	lastApplied uint64
+	commitIndex   uint64
+	commitTerm    uint64
+	lastApplied   uint64
+	snapshotIndex uint64
 
 	nextIndex    map[string]uint64
 	matchIndex   map[string]uint64
 	matchScratch []uint64
+	progress     map[string]*progress
+	lastContact  map[string]time.Time
+
+	maxInflightMsgs int
+	maxSizePerMsg   uint64
 
 	storage   Storage
 	transport Transport
@@ -66,14 +76,33 @@ type raftNode struct {
 	proposalMu     sync.Mutex
 	proposalQueue  []*proposalRequest
 	proposalActive bool
+	proposalSpans  map[uint64]trace.SpanContext
 }
 
 type proposalRequest struct {
 	term  uint64
 	data  []byte
+	span  trace.SpanContext
 	done  chan struct{}
 	index uint64
 	err   error
+
+	enqueuedAt time.Time
+	batchedAt  time.Time
+	appendedAt time.Time
+}
+
+// ProposalTimings 记录一次提案在 leader 本地各阶段的耗时
+type ProposalTimings struct {
+	QueueWait time.Duration // 在提案队列中等待组批的时间
+	Append    time.Duration // 批次写入本地日志（含 fsync）的时间
+}
+
+type proposalTimingsKey struct{}
+
+// WithProposalTimings 让 Propose 在返回前把本次提案的阶段耗时写入 timings
+func WithProposalTimings(ctx context.Context, timings *ProposalTimings) context.Context {
+	return context.WithValue(ctx, proposalTimingsKey{}, timings)
 }
 
 func NewNode(config Config) (Node, error) {
@@ -121,9 +150,15 @@ func NewNode(config Config) (Node, error) {
 		commitIndex:      commitIndex,
 		commitTerm:       commitTerm,
 		lastApplied:      snapshot.Index,
+		snapshotIndex:    snapshot.Index,
 		nextIndex:        make(map[string]uint64),
 		matchIndex:       make(map[string]uint64),
 		matchScratch:     make([]uint64, 0, len(config.Peers)),
+		progress:         make(map[string]*progress),
+		lastContact:      make(map[string]time.Time),
+		proposalSpans:    make(map[uint64]trace.SpanContext),
+		maxInflightMsgs:  config.MaxInflightMsgs,
+		maxSizePerMsg:    config.MaxSizePerMsg,
 		storage:          config.Storage,
 		transport:        config.Transport,
 		applyCh:          make(chan ApplyMsg, config.ApplyBufferSize),
@@ -135,12 +170,19 @@ func NewNode(config Config) (Node, error) {
 		stopCh:           make(chan struct{}),
 		restoreSnapshot:  snapshot,
 	}
+	if node.maxInflightMsgs == 0 {
+		node.maxInflightMsgs = defaultMaxInflightMsgs
+	}
+	if node.maxSizePerMsg == 0 {
+		node.maxSizePerMsg = defaultMaxSizePerMsg
+	}
 
 	for _, peer := range node.peers {
 		node.nextIndex[peer] = lastIndex + 1
 		node.matchIndex[peer] = 0
 		if peer != node.id {
 			node.replicateNotify[peer] = make(chan struct{}, 1)
+			node.progress[peer] = &progress{}
 		}
 	}
 	node.matchIndex[node.id] = lastIndex
@@ -194,12 +236,17 @@ func (r *raftNode) Stop() error {
 }
 
 // Leader 接收上层提案，通过 Raft 集群达成共识并最终应用到状态机
-func (r *raftNode) Propose(ctx context.Context, data []byte) (uint64, error) {
+func (r *raftNode) Propose(ctx context.Context, data []byte) (index uint64, err error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
+	ctx, span := tracer.Start(ctx, "raft.Propose", trace.WithAttributes(attribute.Int("raft.bytes", len(data))))
+	defer func() {
+		span.SetAttributes(attribute.Int64("raft.index", int64(index)))
+		endSpan(span, err)
+	}()
 
-	request, run, err := r.enqueueProposal(data)
+	request, run, err := r.enqueueProposal(span.SpanContext(), data)
 	if err != nil {
 		return 0, err
 	}
@@ -212,13 +259,19 @@ func (r *raftNode) Propose(ctx context.Context, data []byte) (uint64, error) {
 
 	select {
 	case <-request.done:
+		if timings, ok := ctx.Value(proposalTimingsKey{}).(*ProposalTimings); ok && timings != nil && !request.batchedAt.IsZero() {
+			timings.QueueWait = request.batchedAt.Sub(request.enqueuedAt)
+			if !request.appendedAt.IsZero() {
+				timings.Append = request.appendedAt.Sub(request.batchedAt)
+			}
+		}
 		return request.index, request.err
 	case <-ctx.Done():
 		return 0, ctx.Err()
 	}
 }
 
-func (r *raftNode) enqueueProposal(data []byte) (*proposalRequest, bool, error) {
+func (r *raftNode) enqueueProposal(span trace.SpanContext, data []byte) (*proposalRequest, bool, error) {
 	r.mu.RLock()
 	if r.stopped {
 		err := r.nodeErrorLocked()
@@ -234,7 +287,10 @@ func (r *raftNode) enqueueProposal(data []byte) (*proposalRequest, bool, error)
 	request := &proposalRequest{
 		term: term,
 		data: append([]byte(nil), data...),
+		span: span,
 		done: make(chan struct{}),
+
+		enqueuedAt: time.Now(),
 	}
 
 	r.proposalMu.Lock()
@@ -304,6 +360,23 @@ func (r *raftNode) popProposalBatchLocked(limit int) []*proposalRequest {
 }
 
 func (r *raftNode) appendProposalBatch(requests []*proposalRequest) {
+	batchedAt := time.Now()
+	for _, request := range requests {
+		request.batchedAt = batchedAt
+	}
+	// 批次在后台协程中处理，通过 link 关联到每个提案的 span
+	links := make([]trace.Link, 0, len(requests))
+	for _, request := range requests {
+		if request.span.IsValid() {
+			links = append(links, trace.Link{SpanContext: request.span})
+		}
+	}
+	ctx, span := tracer.Start(context.Background(), "raft.appendProposalBatch",
+		trace.WithLinks(links...),
+		trace.WithAttributes(attribute.Int("raft.proposals", len(requests))),
+	)
+	defer span.End()
+
 	r.mu.Lock()
 	if r.stopped {
 		err := r.nodeErrorLocked()
@@ -351,12 +424,19 @@ func (r *raftNode) appendProposalBatch(requests []*proposalRequest) {
 	}
 	r.mu.Unlock()
 
-	if err := r.storage.Append(entries); err != nil {
+	_, appendSpan := tracer.Start(ctx, "raft.storage.Append", trace.WithAttributes(entryAttributes(entries)...))
+	err = r.storage.Append(entries)
+	endSpan(appendSpan, err)
+	if err != nil {
 		r.logMu.Unlock()
 		completeProposalBatch(active, 0, err)
 		return
 	}
 	r.logMu.Unlock()
+	appendedAt := time.Now()
+	for _, request := range active {
+		request.appendedAt = appendedAt
+	}
 
 	lastEntry := entries[len(entries)-1]
 	r.mu.Lock()
@@ -368,7 +448,7 @@ func (r *raftNode) appendProposalBatch(requests []*proposalRequest) {
 	}
 	if r.state != Leader || r.currentTerm != term {
 		r.mu.Unlock()
-		completeProposalBatch(active, 0, ErrNotLeader)
+		completeProposalBatch(active, 0, ErrLeadershipLost)
 		return
 	}
 	r.matchIndex[r.id] = lastEntry.Index
@@ -376,6 +456,7 @@ func (r *raftNode) appendProposalBatch(requests []*proposalRequest) {
 	for i, request := range active {
 		request.index = entries[i].Index
 	}
+	r.recordProposalSpansLocked(entries, active)
 	r.advanceCommitIndex()
 	r.mu.Unlock()
 
@@ -444,11 +525,15 @@ func (r *raftNode) Snapshot(index uint64, data []byte) error {
 		return err
 	}
 
-	return r.storage.SaveSnapshot(Snapshot{
+	if err := r.storage.SaveSnapshot(Snapshot{
 		Index: index,
 		Term:  term,
 		Data:  append([]byte(nil), data...),
-	})
+	}); err != nil {
+		return err
+	}
+	r.snapshotIndex = index
+	return nil
 }
 
 // 返回当前节点是否是 Leader
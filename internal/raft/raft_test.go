@@ -4,9 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"sync"
 	"testing"
 	"time"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestNoSelf(t *testing.T) {
@@ -460,6 +463,46 @@ func TestReadIndexDoesNotWaitForProposalAppendFsync(t *testing.T) {
 	}
 }
 
+func TestProposeReportsLeadershipLostAfterAppend(t *testing.T) {
+	storage := newBlockingAppendStorage()
+	appendTerms(t, storage.memStorage, 1)
+	node := newLeaderNode(t, storage, 1)
+
+	// 写盘前失去 leader 身份，提案未写入日志，可以安全重试
+	node.mu.Lock()
+	if err := node.stepDownLocked(2, "node2"); err != nil {
+		node.mu.Unlock()
+		t.Fatalf("step down: %v", err)
+	}
+	node.mu.Unlock()
+	if _, err := node.Propose(context.Background(), []byte("before")); !errors.Is(err, ErrNotLeader) {
+		t.Fatalf("propose on follower error = %v, want %v", err, ErrNotLeader)
+	}
+
+	// 写盘期间失去 leader 身份，条目已在日志中，结果未知
+	becomeLeader(node, 3)
+	storage.blockNextAppend()
+	proposeDone := make(chan error, 1)
+	go func() {
+		_, err := node.Propose(context.Background(), []byte("appended"))
+		proposeDone <- err
+	}()
+	storage.waitBlocked(t, time.Second)
+	node.mu.Lock()
+	err := node.stepDownLocked(4, "node2")
+	node.mu.Unlock()
+	close(storage.release)
+	if err != nil {
+		t.Fatalf("step down: %v", err)
+	}
+	if err := <-proposeDone; !errors.Is(err, ErrLeadershipLost) {
+		t.Fatalf("propose error = %v, want %v", err, ErrLeadershipLost)
+	}
+	if lastIndex, _ := storage.LastIndex(); lastIndex != 2 {
+		t.Fatalf("last index = %d, want the appended entry at 2", lastIndex)
+	}
+}
+
 func TestReadIndexHeartbeatDoesNotWaitForFollowerAppendFsync(t *testing.T) {
 	storage := newBlockingAppendStorage()
 	appendTerms(t, storage.memStorage, 1)
@@ -943,6 +986,60 @@ func TestStepDownRollback(t *testing.T) {
 	}
 }
 
+func TestProposalSpansDroppedWhenEntriesAreReplaced(t *testing.T) {
+	storage := newMemStorage()
+	appendTerms(t, storage, 1, 1, 1)
+	node := newLeaderNode(t, storage, 1)
+	span := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+	})
+	spanIndexes := func() []uint64 {
+		node.mu.RLock()
+		defer node.mu.RUnlock()
+		var indexes []uint64
+		for index := range node.proposalSpans {
+			indexes = append(indexes, index)
+		}
+		slices.Sort(indexes)
+		return indexes
+	}
+
+	// 降级时丢弃全部未应用提案的 span
+	node.proposalSpans[2], node.proposalSpans[3] = span, span
+	if _, err := node.HandleAppendEntries(context.Background(), AppendEntriesRequest{
+		Term: 2, LeaderID: "node2", PrevLogIndex: 3, PrevLogTerm: 1,
+	}); err != nil {
+		t.Fatalf("HandleAppendEntries error = %v", err)
+	}
+	if got := spanIndexes(); len(got) != 0 {
+		t.Fatalf("span indexes after step down = %v, want none", got)
+	}
+
+	// 日志被截断时只丢弃截断点之后的 span
+	node.proposalSpans[1], node.proposalSpans[3] = span, span
+	if _, err := node.HandleAppendEntries(context.Background(), AppendEntriesRequest{
+		Term: 2, LeaderID: "node2", PrevLogIndex: 2, PrevLogTerm: 1,
+		Entries: []LogEntry{{Index: 3, Term: 2, Type: EntryNormal, Data: []byte("y")}},
+	}); err != nil {
+		t.Fatalf("HandleAppendEntries error = %v", err)
+	}
+	if got := spanIndexes(); !slices.Equal(got, []uint64{1}) {
+		t.Fatalf("span indexes after truncation = %v, want [1]", got)
+	}
+
+	// 安装快照后旧提案的 span 全部失效
+	if _, err := node.HandleInstallSnapshot(context.Background(), InstallSnapshotRequest{
+		Term: 2, LeaderID: "node2", LastIncludedIndex: 5, LastIncludedTerm: 2, Data: []byte("snap"),
+	}); err != nil {
+		t.Fatalf("HandleInstallSnapshot error = %v", err)
+	}
+	if got := spanIndexes(); len(got) != 0 {
+		t.Fatalf("span indexes after snapshot install = %v, want none", got)
+	}
+}
+
 func TestReadIndexRejectedAfterFatalStepDown(t *testing.T) {
 	node := newFailNode(t)
 	node.state = Leader
@@ -1295,6 +1392,69 @@ func waitOtherLead(t *testing.T, nodes map[string]Node, excluded string, timeout
 	return ""
 }
 
+func TestStatusReportsRoleIndexesAndPeerProgress(t *testing.T) {
+	net := newNet()
+	ids := []string{"node1", "node2", "node3"}
+	nodes := newNodes(t, net, ids)
+	startNodes(t, nodes)
+	defer stopNodes(nodes)
+
+	leaderID := waitLeadMap(t, nodes, time.Second)
+	if leaderID == "" {
+		t.Fatal("leader should be elected")
+	}
+	leader := nodes[leaderID]
+	index, err := leader.Propose(context.Background(), []byte("cmd"))
+	if err != nil {
+		t.Fatalf("propose error: %v", err)
+	}
+	for {
+		if msg := waitMsg(t, leader.ApplyCh(), time.Second); msg.Index == index {
+			break
+		}
+	}
+
+	waitForCondition(t, time.Second, func() bool {
+		status := leader.Status()
+		for _, peer := range status.Progress {
+			if peer.Match != index || peer.LastContact.IsZero() {
+				return false
+			}
+		}
+		return len(status.Progress) == 2
+	})
+	status := leader.Status()
+	if status.ID != leaderID || status.State != Leader || status.Leader != leaderID || status.Term == 0 {
+		t.Fatalf("leader status = %+v, want leader %s", status, leaderID)
+	}
+	if status.Commit != index || status.Applied != index || status.LastIndex != index {
+		t.Fatalf("leader indexes = commit %d applied %d last %d, want %d", status.Commit, status.Applied, status.LastIndex, index)
+	}
+	for peer, progress := range status.Progress {
+		if progress.Next != index+1 || progress.Lag != 0 || progress.State != ProgressReplicate {
+			t.Fatalf("progress[%s] = %+v, want replicate at next %d", peer, progress, index+1)
+		}
+	}
+
+	var followerID string
+	for _, id := range ids {
+		if id != leaderID {
+			followerID = id
+			break
+		}
+	}
+	follower := nodes[followerID]
+	if status := follower.Status(); status.State != Follower || status.Leader != leaderID || status.Progress != nil {
+		t.Fatalf("follower status = %+v, want follower of %s without progress", status, leaderID)
+	}
+
+	// 被隔离的 follower 不断发起选举，应报告为 candidate 而不是 follower
+	net.cut(followerID)
+	waitForCondition(t, 2*time.Second, func() bool {
+		return follower.Status().State == Candidate
+	})
+}
+
 func TestAppendEntriesRejectReportsConflictHint(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -1468,6 +1628,91 @@ func TestReplicationWorkerBatchesBacklog(t *testing.T) {
 	}
 }
 
+func TestReplicationPipelinesWithinInflightLimit(t *testing.T) {
+	leaderStorage := newMemStorage()
+	entryCount := replicationBatchSize*8 + 3
+	appendRepeatedTerm(t, leaderStorage, entryCount, 1)
+
+	followerStorage := newMemStorage()
+	baseTransport := NewFakeTransport()
+	follower := newTestNode(t, "node2", followerStorage, baseTransport)
+	defer follower.Stop()
+	baseTransport.Register("node2", follower.(RPCHandler))
+
+	transport := &slowAppendTransport{delegate: baseTransport, delay: 5 * time.Millisecond}
+	leader := newTestNode(t, "node1", leaderStorage, transport)
+	defer leader.Stop()
+
+	leaderNode := becomeLeader(leader, 1)
+	leaderNode.maxInflightMsgs = 3
+	leaderNode.maxSizePerMsg = 40
+	leaderNode.nextIndex["node2"] = 1
+	leaderNode.matchIndex["node1"] = uint64(entryCount)
+	startReplicationWorker(leaderNode, "node2")
+
+	leaderNode.notifyReplication("node2")
+
+	waitForCondition(t, 2*time.Second, func() bool {
+		progress := leaderNode.Progress()["node2"]
+		return progress.Match == uint64(entryCount) && progress.Inflight == 0
+	})
+	lastIndex, err := followerStorage.LastIndex()
+	if err != nil || lastIndex != uint64(entryCount) {
+		t.Fatalf("follower last index = %d, %v; want %d", lastIndex, err, entryCount)
+	}
+
+	maxConcurrent, maxBatch := transport.stats()
+	if maxConcurrent < 2 || maxConcurrent > 3 {
+		t.Fatalf("max concurrent appends = %d, want 2..3", maxConcurrent)
+	}
+	if maxBatch > 40 {
+		t.Fatalf("max batch = %d entries, want <= 40 one-byte entries", maxBatch)
+	}
+	progress := leaderNode.Progress()["node2"]
+	if progress.State != ProgressReplicate || progress.Lag != 0 || progress.Next != uint64(entryCount)+1 {
+		t.Fatalf("progress = %+v, want replicate with no lag", progress)
+	}
+}
+
+func TestReplicationProbesBackToDivergencePoint(t *testing.T) {
+	leaderStorage := newMemStorage()
+	appendTerms(t, leaderStorage, 1, 1, 2, 2, 3, 3, 3)
+
+	followerStorage := newMemStorage()
+	appendTerms(t, followerStorage, 1, 1, 1, 1, 1)
+	baseTransport := NewFakeTransport()
+	follower := newTestNode(t, "node2", followerStorage, baseTransport)
+	defer follower.Stop()
+	baseTransport.Register("node2", follower.(RPCHandler))
+
+	leader := newTestNode(t, "node1", leaderStorage, baseTransport)
+	defer leader.Stop()
+
+	leaderNode := becomeLeader(leader, 3)
+	leaderNode.nextIndex["node2"] = 8
+	leaderNode.matchIndex["node1"] = 7
+	startReplicationWorker(leaderNode, "node2")
+
+	if state := leaderNode.Progress()["node2"].State; state != ProgressProbe {
+		t.Fatalf("initial progress state = %v, want %v", state, ProgressProbe)
+	}
+	leaderNode.notifyReplication("node2")
+
+	waitForCondition(t, time.Second, func() bool {
+		return leaderNode.Progress()["node2"].Match == 7
+	})
+	for index := uint64(1); index <= 7; index++ {
+		want, _ := leaderStorage.Term(index)
+		got, err := followerStorage.Term(index)
+		if err != nil || got != want {
+			t.Fatalf("follower term at %d = %d, %v; want %d", index, got, err, want)
+		}
+	}
+	if state := leaderNode.Progress()["node2"].State; state != ProgressReplicate {
+		t.Fatalf("progress state = %v, want %v", state, ProgressReplicate)
+	}
+}
+
 func waitForCondition(t *testing.T, timeout time.Duration, condition func() bool) {
 	t.Helper()
 
@@ -1655,6 +1900,45 @@ func (t *recordingTransport) entryBatchSizes() []int {
 	return append([]int(nil), t.batches...)
 }
 
+type slowAppendTransport struct {
+	mu            sync.Mutex
+	delegate      Transport
+	delay         time.Duration
+	concurrent    int
+	maxConcurrent int
+	maxBatch      int
+}
+
+func (t *slowAppendTransport) RequestVote(ctx context.Context, target string, req RequestVoteRequest) (RequestVoteResponse, error) {
+	return t.delegate.RequestVote(ctx, target, req)
+}
+
+func (t *slowAppendTransport) AppendEntries(ctx context.Context, target string, req AppendEntriesRequest) (AppendEntriesResponse, error) {
+	t.mu.Lock()
+	t.concurrent++
+	t.maxConcurrent = max(t.maxConcurrent, t.concurrent)
+	t.maxBatch = max(t.maxBatch, len(req.Entries))
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		t.concurrent--
+		t.mu.Unlock()
+	}()
+
+	time.Sleep(t.delay)
+	return t.delegate.AppendEntries(ctx, target, req)
+}
+
+func (t *slowAppendTransport) InstallSnapshot(ctx context.Context, target string, req InstallSnapshotRequest) (InstallSnapshotResponse, error) {
+	return t.delegate.InstallSnapshot(ctx, target, req)
+}
+
+func (t *slowAppendTransport) stats() (int, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.maxConcurrent, t.maxBatch
+}
+
 type blockingReadTransport struct {
 	mu        sync.Mutex
 	started   chan struct{}
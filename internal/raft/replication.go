@@ -4,6 +4,10 @@ import (
 	"context"
 	"errors"
 	"sort"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const replicationBatchSize = 64
@@ -47,12 +51,13 @@ func (r *raftNode) replicationWorker(peer string, notifyCh <-chan struct{}) {
 	}
 }
 
-// 单个 follower 的复制 worker,每次被唤醒后串行发送，直到追平 backlog 或遇到错误
+// 单个 follower 的复制 worker,每次被唤醒后持续发送，直到追平 backlog、在途窗口已满或遇到错误
 func (r *raftNode) replicatePeer(peer string) {
 	for r.replicateStep(peer) {
 	}
 }
 
+// 发出一条 AppendEntries 后立即返回，响应由独立协程处理；返回 true 表示可以继续发送
 func (r *raftNode) replicateStep(peer string) bool {
 	req, term, ok, needsSnapshot := r.buildAppendEntriesRequest(peer)
 	if !ok {
@@ -61,22 +66,122 @@ func (r *raftNode) replicateStep(peer string) bool {
 		}
 		return false
 	}
+	reserved, retry := r.reserveInflight(peer, req)
+	if !reserved {
+		return retry
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), r.heartbeatTimeout)
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.sendAppendEntries(peer, term, req)
+	}()
+	return len(req.Entries) > 0
+}
+
+// 登记一条在途消息；复制阶段乐观推进 nextIndex，使下一条消息无需等待响应
+func (r *raftNode) reserveInflight(peer string, req AppendEntriesRequest) (bool, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p := r.progress[peer]
+	if r.stopped || r.state != Leader || r.currentTerm != req.Term || p == nil {
+		return false, false
+	}
+	if r.nextIndex[peer] != req.PrevLogIndex+1 {
+		// 构造期间收到了响应，按新的进度重新构造
+		return false, true
+	}
+	if p.paused(r.maxInflightMsgs) {
+		return false, false
+	}
+	// 已有消息在途时不需要额外的心跳
+	if len(req.Entries) == 0 && p.inflight > 0 {
+		return false, false
+	}
+
+	p.inflight++
+	if p.state == ProgressReplicate && len(req.Entries) > 0 {
+		r.nextIndex[peer] = req.Entries[len(req.Entries)-1].Index + 1
+	}
+	return true, false
+}
+
+func (r *raftNode) sendAppendEntries(peer string, term uint64, req AppendEntriesRequest) {
+	ctx, links := r.replicationSpanContext(req.Entries)
+	// 只追踪携带了被追踪提案的消息，心跳不产生 span
+	var span trace.Span
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		ctx, span = tracer.Start(ctx, "raft.AppendEntries",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithLinks(links...),
+			trace.WithAttributes(append(entryAttributes(req.Entries), attribute.String("raft.peer", peer))...),
+		)
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.heartbeatTimeout)
 	resp, err := r.transport.AppendEntries(ctx, peer, req)
 	cancel()
-	if err != nil {
-		return false
+	if span != nil {
+		if err == nil && !resp.Success {
+			span.SetAttributes(attribute.Bool("raft.rejected", true))
+		}
+		endSpan(span, err)
 	}
-	if resp.Term > term {
+	if err == nil && resp.Term > term {
 		_ = r.stepDown(resp.Term, "")
+		return
+	}
+	if r.handleAppendEntriesResponse(peer, req, resp, err) {
+		r.notifyReplication(peer)
+	}
+}
+
+// 处理 AppendEntries 响应，返回 true 表示需要唤醒 worker 继续发送
+func (r *raftNode) handleAppendEntriesResponse(peer string, req AppendEntriesRequest, resp AppendEntriesResponse, err error) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p := r.progress[peer]
+	if r.stopped || r.state != Leader || r.currentTerm != req.Term || p == nil {
 		return false
 	}
-	if resp.Success {
-		r.handleAppendEntries(peer, req)
-		return len(req.Entries) > 0 && r.peerNeedsReplication(peer)
+	if p.inflight > 0 {
+		p.inflight--
 	}
-	return r.decreaseNextIndex(peer, term, resp)
+	if err == nil {
+		r.lastContact[peer] = time.Now()
+	}
+
+	switch {
+	case err != nil:
+		// 消息可能丢失，回到探测阶段从 matchIndex 之后重新发送，等下一次心跳重试
+		if p.state == ProgressReplicate {
+			p.becomeProbe()
+			r.nextIndex[peer] = r.matchIndex[peer] + 1
+		}
+		return false
+	case resp.Success:
+		r.handleAppendEntriesLocked(peer, req)
+		if p.state == ProgressProbe {
+			p.becomeReplicate()
+		}
+		return r.peerHasBacklogLocked(peer)
+	}
+
+	// 乱序到达或重复的拒绝不再回退
+	rejectedNext := req.PrevLogIndex + 1
+	if p.state == ProgressReplicate && req.PrevLogIndex <= r.matchIndex[peer] {
+		return false
+	}
+	if p.state == ProgressProbe && r.nextIndex[peer] != rejectedNext {
+		return false
+	}
+	if p.state == ProgressSnapshot {
+		return false
+	}
+	p.becomeProbe()
+	r.nextIndex[peer] = rejectedNext
+	return r.decreaseNextIndexLocked(peer, resp)
 }
 
 func (r *raftNode) replicateSnapshot(peer string) bool {
@@ -89,6 +194,7 @@ func (r *raftNode) replicateSnapshot(peer string) bool {
 	resp, err := r.transport.InstallSnapshot(ctx, peer, snapshotReq)
 	cancel()
 	if err != nil {
+		r.finishSnapshot(peer, term)
 		return false
 	}
 	if resp.Term > term {
@@ -100,19 +206,23 @@ func (r *raftNode) replicateSnapshot(peer string) bool {
 }
 
 func (r *raftNode) buildInstallSnapshotRequest(peer string) (InstallSnapshotRequest, uint64, bool) {
-	r.mu.RLock()
+	r.mu.Lock()
 	if r.stopped || r.state != Leader {
-		r.mu.RUnlock()
+		r.mu.Unlock()
 		return InstallSnapshotRequest{}, 0, false
 	}
 
 	term := r.currentTerm
 	nextIndex := r.nextIndex[peer]
 	snapshot, err := r.storage.LoadSnapshot()
-	r.mu.RUnlock()
 	if err != nil || snapshot.Index == 0 || nextIndex > snapshot.Index {
+		r.mu.Unlock()
 		return InstallSnapshotRequest{}, 0, false
 	}
+	if p := r.progress[peer]; p != nil {
+		p.state = ProgressSnapshot
+	}
+	r.mu.Unlock()
 
 	return InstallSnapshotRequest{
 		Term:              term,
@@ -123,12 +233,24 @@ func (r *raftNode) buildInstallSnapshotRequest(peer string) (InstallSnapshotRequ
 	}, term, true
 }
 
+func (r *raftNode) finishSnapshot(peer string, term uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if p := r.progress[peer]; p != nil && r.currentTerm == term && p.state == ProgressSnapshot {
+		p.becomeProbe()
+	}
+}
+
 func (r *raftNode) buildAppendEntriesRequest(peer string) (AppendEntriesRequest, uint64, bool, bool) {
 	r.mu.RLock()
 	if r.stopped || r.state != Leader {
 		r.mu.RUnlock()
 		return AppendEntriesRequest{}, 0, false, false
 	}
+	if p := r.progress[peer]; p != nil && p.paused(r.maxInflightMsgs) {
+		r.mu.RUnlock()
+		return AppendEntriesRequest{}, 0, false, false
+	}
 
 	term := r.currentTerm
 	leaderID := r.id
@@ -157,6 +279,7 @@ func (r *raftNode) buildAppendEntriesRequest(peer string) (AppendEntriesRequest,
 		if err != nil {
 			return AppendEntriesRequest{}, term, false, errors.Is(err, ErrCompacted)
 		}
+		entries = limitEntriesSize(entries, r.maxSizePerMsg)
 	}
 	return AppendEntriesRequest{
 		Term:         term,
@@ -168,17 +291,27 @@ func (r *raftNode) buildAppendEntriesRequest(peer string) (AppendEntriesRequest,
 	}, term, true, false
 }
 
-func (r *raftNode) handleAppendEntries(peer string, req AppendEntriesRequest) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	if r.stopped || r.state != Leader || req.Term != r.currentTerm {
-		return
+// 按字节数截断一批日志，至少保留一条
+func limitEntriesSize(entries []LogEntry, maxSize uint64) []LogEntry {
+	var size uint64
+	for i, entry := range entries {
+		size += uint64(len(entry.Data))
+		if size > maxSize && i > 0 {
+			return entries[:i]
+		}
 	}
+	return entries
+}
 
+// 响应可能乱序到达，matchIndex 与 nextIndex 只前进不后退
+func (r *raftNode) handleAppendEntriesLocked(peer string, req AppendEntriesRequest) {
 	matchIndex := req.PrevLogIndex + uint64(len(req.Entries))
-	r.matchIndex[peer] = matchIndex
-	r.nextIndex[peer] = matchIndex + 1
+	if matchIndex > r.matchIndex[peer] {
+		r.matchIndex[peer] = matchIndex
+	}
+	if r.nextIndex[peer] <= r.matchIndex[peer] {
+		r.nextIndex[peer] = r.matchIndex[peer] + 1
+	}
 
 	r.advanceCommitIndex()
 }
@@ -191,11 +324,16 @@ func (r *raftNode) decreaseNextIndex(peer string, term uint64, resp AppendEntrie
 	if r.stopped || r.state != Leader || r.currentTerm != term {
 		return false
 	}
+	return r.decreaseNextIndexLocked(peer, resp)
+}
 
+func (r *raftNode) decreaseNextIndexLocked(peer string, resp AppendEntriesResponse) bool {
 	minNextIndex := uint64(1)
 	if snapshot, err := r.storage.LoadSnapshot(); err == nil && snapshot.Index > 0 {
 		minNextIndex = snapshot.Index
 	}
+	// 已确认匹配的日志不需要重发
+	minNextIndex = max(minNextIndex, r.matchIndex[peer]+1)
 	currentNextIndex := r.nextIndex[peer]
 	if currentNextIndex <= minNextIndex {
 		return false
@@ -237,9 +375,15 @@ func (r *raftNode) handleInstallSnapshot(peer string, req InstallSnapshotRequest
 	if r.stopped || r.state != Leader || req.Term != r.currentTerm {
 		return
 	}
+	r.lastContact[peer] = time.Now()
 
-	r.matchIndex[peer] = req.LastIncludedIndex
-	r.nextIndex[peer] = req.LastIncludedIndex + 1
+	if req.LastIncludedIndex > r.matchIndex[peer] {
+		r.matchIndex[peer] = req.LastIncludedIndex
+	}
+	r.nextIndex[peer] = r.matchIndex[peer] + 1
+	if p := r.progress[peer]; p != nil {
+		p.becomeProbe()
+	}
 }
 
 func (r *raftNode) findLastIndexOfTermLocked(term uint64) (uint64, bool) {
@@ -281,6 +425,14 @@ func (r *raftNode) peerNeedsReplication(peer string) bool {
 	return nextIndex <= lastIndex
 }
 
+func (r *raftNode) peerHasBacklogLocked(peer string) bool {
+	lastIndex, err := r.storage.LastIndex()
+	if err != nil {
+		return false
+	}
+	return r.nextIndex[peer] <= lastIndex
+}
+
 // 检查是否有新日志可以在当前 Term 提交，更新 commitIndex 并将已提交日志应用到状态机
 func (r *raftNode) advanceCommitIndex() {
 	indexes := r.matchScratch[:0]
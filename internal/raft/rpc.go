@@ -3,6 +3,9 @@ package raft
 import (
 	"context"
 	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func (r *raftNode) HandleRequestVote(ctx context.Context, req RequestVoteRequest) (RequestVoteResponse, error) {
@@ -48,7 +51,20 @@ func (r *raftNode) HandleRequestVote(ctx context.Context, req RequestVoteRequest
 	}, nil
 }
 
-func (r *raftNode) HandleAppendEntries(ctx context.Context, req AppendEntriesRequest) (AppendEntriesResponse, error) {
+func (r *raftNode) HandleAppendEntries(ctx context.Context, req AppendEntriesRequest) (resp AppendEntriesResponse, err error) {
+	// leader 通过传输层带来了提案的 trace 时才记录
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		var span trace.Span
+		ctx, span = tracer.Start(ctx, "raft.HandleAppendEntries",
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(entryAttributes(req.Entries)...),
+		)
+		defer func() {
+			span.SetAttributes(attribute.Bool("raft.success", resp.Success))
+			endSpan(span, err)
+		}()
+	}
+
 	r.mu.Lock()
 	if r.stopped {
 		r.mu.Unlock()
@@ -124,7 +140,11 @@ func (r *raftNode) HandleAppendEntries(ctx context.Context, req AppendEntriesReq
 	var lastIndex uint64
 	if len(req.Entries) > 0 {
 		r.mu.Unlock()
-		if err := r.appendEntries(req.Entries); err != nil {
+		_, appendSpan := tracer.Start(ctx, "raft.storage.Append", trace.WithAttributes(entryAttributes(req.Entries)...))
+		var truncated uint64
+		truncated, err = r.appendEntries(req.Entries)
+		endSpan(appendSpan, err)
+		if err != nil {
 			r.logMu.Unlock()
 			return AppendEntriesResponse{}, err
 		}
@@ -135,6 +155,9 @@ func (r *raftNode) HandleAppendEntries(ctx context.Context, req AppendEntriesReq
 		}
 
 		r.mu.Lock()
+		if truncated > 0 {
+			r.dropProposalSpansLocked(truncated)
+		}
 		if r.stopped {
 			r.mu.Unlock()
 			return AppendEntriesResponse{}, r.nodeErrorLocked()
@@ -210,7 +233,10 @@ func (r *raftNode) HandleInstallSnapshot(ctx context.Context, req InstallSnapsho
 		}
 		r.logMu.Unlock()
 		r.updateCommitIndexLocked(nextCommit, snapshot.Term)
+		// 快照之后的日志由新 leader 重新发送，旧提案的 span 都已失效
+		clear(r.proposalSpans)
 		r.lastApplied = req.LastIncludedIndex
+		r.snapshotIndex = req.LastIncludedIndex
 		r.restoreSnapshot = snapshot
 	}
 	term := r.currentTerm
@@ -222,27 +248,28 @@ func (r *raftNode) HandleInstallSnapshot(ctx context.Context, req InstallSnapsho
 	return InstallSnapshotResponse{Term: term}, nil
 }
 
-func (r *raftNode) appendEntries(entries []LogEntry) error {
+// 返回被截断的第一条日志索引，没有截断时为 0
+func (r *raftNode) appendEntries(entries []LogEntry) (uint64, error) {
 	for _, entry := range entries {
 		localTerm, err := r.storage.Term(entry.Index)
 		if err == nil {
 			if localTerm != entry.Term {
 				if err := r.storage.TruncateSuffix(entry.Index - 1); err != nil {
-					return err
+					return 0, err
 				}
-				return r.storage.Append(entriesFrom(entries, entry.Index))
+				return entry.Index, r.storage.Append(entriesFrom(entries, entry.Index))
 			}
 			continue
 		}
 
 		if err == ErrEntryNotFound {
-			return r.storage.Append(entriesFrom(entries, entry.Index))
+			return 0, r.storage.Append(entriesFrom(entries, entry.Index))
 		}
 
-		return err
+		return 0, err
 	}
 
-	return nil
+	return 0, nil
 }
 
 func entriesFrom(entries []LogEntry, index uint64) []LogEntry {
@@ -0,0 +1,40 @@
+package raft
+
+// Status 是节点状态的只读快照
+type Status struct {
+	ID     string    `json:"id"`
+	Term   uint64    `json:"term"`
+	State  StateType `json:"state"`
+	Leader string    `json:"leader"`
+	Commit uint64    `json:"commit"`
+	// 已交给上层应用的最大日志索引
+	Applied       uint64 `json:"applied"`
+	LastIndex     uint64 `json:"last_index"`
+	SnapshotIndex uint64 `json:"snapshot_index"`
+	// 只有 Leader 有各 follower 的复制进度
+	Progress map[string]PeerProgress `json:"progress,omitempty"`
+}
+
+// 返回节点当前的任期、角色、各索引与复制进度
+func (r *raftNode) Status() Status {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	status := Status{
+		ID:            r.id,
+		Term:          r.currentTerm,
+		State:         r.state,
+		Leader:        r.leaderID,
+		Commit:        r.commitIndex,
+		Applied:       r.lastApplied,
+		SnapshotIndex: r.snapshotIndex,
+	}
+	lastIndex, err := r.storage.LastIndex()
+	if err != nil {
+		return status
+	}
+	status.LastIndex = lastIndex
+	if !r.stopped && r.state == Leader {
+		status.Progress = r.progressLocked(lastIndex)
+	}
+	return status
+}
@@ -0,0 +1,77 @@
+package raft
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("mini-kv/internal/raft")
+
+// 记录每条被追踪的提案所在的日志索引，复制 RPC 与 apply 据此挂到提案的 trace 下，日志应用后删除
+func (r *raftNode) recordProposalSpansLocked(entries []LogEntry, requests []*proposalRequest) {
+	for i, request := range requests {
+		if request.span.IsValid() {
+			r.proposalSpans[entries[i].Index] = request.span
+		}
+	}
+}
+
+// 日志从 index 起被截断时丢弃对应的提案 span
+func (r *raftNode) dropProposalSpansLocked(index uint64) {
+	for i := range r.proposalSpans {
+		if i >= index {
+			delete(r.proposalSpans, i)
+		}
+	}
+}
+
+// 返回一批日志对应的提案 span；第一个作为父 span，其余作为 link
+func (r *raftNode) replicationSpanContext(entries []LogEntry) (context.Context, []trace.Link) {
+	ctx := context.Background()
+	if len(entries) == 0 {
+		return ctx, nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.proposalSpans) == 0 {
+		return ctx, nil
+	}
+	var links []trace.Link
+	parent := false
+	for _, entry := range entries {
+		span, ok := r.proposalSpans[entry.Index]
+		if !ok {
+			continue
+		}
+		if !parent {
+			ctx = trace.ContextWithSpanContext(ctx, span)
+			parent = true
+			continue
+		}
+		links = append(links, trace.Link{SpanContext: span})
+	}
+	return ctx, links
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func entryAttributes(entries []LogEntry) []attribute.KeyValue {
+	if len(entries) == 0 {
+		return []attribute.KeyValue{attribute.Int("raft.entries", 0)}
+	}
+	return []attribute.KeyValue{
+		attribute.Int("raft.entries", len(entries)),
+		attribute.Int64("raft.first_index", int64(entries[0].Index)),
+		attribute.Int64("raft.last_index", int64(entries[len(entries)-1].Index)),
+	}
+}
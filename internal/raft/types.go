@@ -1,6 +1,10 @@
 package raft
 
-import "errors"
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel/trace"
+)
 
 type StateType uint8
 
@@ -19,6 +23,9 @@ var (
 	ErrCompacted         = errors.New("raft: log entry compacted")
 	ErrStorageConflict   = errors.New("raft: storage conflict")
 	ErrReadIndexNotReady = errors.New("raft: read index not ready")
+	// ErrLeadershipLost 表示提案已写入本地日志后节点失去了 leader 身份，
+	// 条目仍可能被新 leader 提交，调用方不能把它当作未执行的请求重试
+	ErrLeadershipLost = errors.New("raft: leadership lost after the proposal was appended")
 )
 
 func (s StateType) String() string {
@@ -34,6 +41,10 @@ func (s StateType) String() string {
 	}
 }
 
+func (s StateType) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
 type EntryType uint8
 
 const (
@@ -55,6 +66,8 @@ type ApplyMsg struct {
 	Data         []byte
 	Snapshot     bool
 	SnapshotData []byte
+	// 本节点作为 leader 提出该日志时的提案 span，用于把 apply 挂到同一条 trace 下
+	Trace trace.SpanContext
 }
 
 type Snapshot struct {
@@ -10,9 +10,15 @@ import (
 	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
 	"mini-kv/internal/kv"
 	"mini-kv/internal/observability"
 	"mini-kv/internal/raft"
+	"mini-kv/internal/tracing"
 )
 
 const (
@@ -20,10 +26,25 @@ const (
 	commandBinaryVersion = 1
 )
 
+var tracer = otel.Tracer("mini-kv/internal/raftstore")
+
 var commandBinaryMagic = [...]byte{'M', 'K', 'V', 'C'}
 
 var ErrProposalMismatch = errors.New("raftkv: proposed log entry was overwritten")
 
+// ErrResourceExhausted is returned when the local store asks writers to back
+// off. Callers may retry after a short delay.
+var ErrResourceExhausted = errors.New("raftkv: resource exhausted")
+
+// ErrOutcomeUnknown is returned when the node lost leadership after it had
+// appended a write to its log. The write may still be committed by the next
+// leader, so callers must not resend it as if it had been rejected.
+var ErrOutcomeUnknown = errors.New("raftkv: leadership lost after the write was appended; outcome unknown")
+
+// ErrUnsupported is returned by admin operations the local store does not
+// implement.
+var ErrUnsupported = errors.New("raftkv: operation not supported by store")
+
 type NotLeaderError struct {
 	LeaderID string
 }
@@ -172,6 +193,9 @@ type applyResult struct {
 	Data   []byte
 	Result kv.ApplyResult
 	Err    error
+
+	AppliedAt     time.Time
+	ApplyDuration time.Duration
 }
 
 type waiter struct {
@@ -265,6 +289,7 @@ type Options struct {
 	SnapshotThreshold uint64
 	NodeID            string
 	Registry          *observability.Registry
+	SlowLog           *observability.SlowLog
 }
 
 type Runtime struct {
@@ -273,6 +298,7 @@ type Runtime struct {
 	waiter            *waiter
 	nodeID            string
 	registry          *observability.Registry
+	slowLog           *observability.SlowLog
 	snapshotThreshold uint64
 	snapshotMu        sync.Mutex
 	lastSnapshotIndex uint64
@@ -294,6 +320,7 @@ func NewWithOptions(store kv.Store, node raft.Node, options Options) *Runtime {
 		waiter:            newWaiter(),
 		nodeID:            options.NodeID,
 		registry:          options.Registry,
+		slowLog:           options.SlowLog,
 		snapshotThreshold: options.SnapshotThreshold,
 		snapshotCh:        make(chan snapshotJob, 1),
 		appliedWaiters:    make(map[uint64][]chan struct{}),
@@ -315,33 +342,67 @@ func (s *Runtime) LeaderID() string {
 	return s.node.LeaderID()
 }
 
-func (s *Runtime) Propose(ctx context.Context, command kv.Command) (kv.ApplyResult, error) {
+// Status reports the raft node status with Applied replaced by the index the
+// state machine has actually applied, which trails what raft has handed over.
+func (s *Runtime) Status() raft.Status {
+	status := s.node.Status()
+	s.applyMu.Lock()
+	status.Applied = s.appliedIndex
+	s.applyMu.Unlock()
+	return status
+}
+
+func (s *Runtime) Propose(ctx context.Context, command kv.Command) (result kv.ApplyResult, err error) {
 	startedAt := time.Now()
+	ctx, span := tracer.Start(ctx, "raftstore.Propose", trace.WithAttributes(attribute.Int("kv.command", int(command.Type))))
+	defer func() { tracing.EndSpan(span, err) }()
+	ctx, slowOp := s.slowLog.Start(ctx, commandName(command.Type), command.Key, len(command.Value))
+	defer func() { slowOp.Finish(err) }()
 	if err := s.ensureLeader(); err != nil {
 		s.observe("propose", startedAt, err)
 		return kv.ApplyResult{}, err
 	}
 
+	if err := s.checkWriteStall(); err != nil {
+		s.observe("propose", startedAt, err)
+		return kv.ApplyResult{}, err
+	}
+
 	data, err := EncodeCommand(command)
 	if err != nil {
 		s.observe("propose", startedAt, err)
 		return kv.ApplyResult{}, err
 	}
 
-	index, err := s.node.Propose(ctx, data)
+	var timings raft.ProposalTimings
+	proposeStartedAt := time.Now()
+	index, err := s.node.Propose(raft.WithProposalTimings(ctx, &timings), data)
+	proposedAt := time.Now()
+	observability.ObservePhase(ctx, observability.PhaseQueueWait, timings.QueueWait)
+	observability.ObservePhase(ctx, observability.PhaseProposal, proposedAt.Sub(proposeStartedAt)-timings.QueueWait)
 	if err != nil {
-		if errors.Is(err, raft.ErrNotLeader) {
+		switch {
+		case errors.Is(err, raft.ErrNotLeader):
 			err = NotLeaderError{LeaderID: s.node.LeaderID()}
+		case errors.Is(err, raft.ErrLeadershipLost):
+			err = ErrOutcomeUnknown
 		}
 		s.observe("propose", startedAt, err)
 		return kv.ApplyResult{}, err
 	}
+	span.SetAttributes(attribute.Int64("raft.index", int64(index)))
 
-	applied, err := s.waiter.wait(ctx, index)
+	waitCtx, waitSpan := tracer.Start(ctx, "raftstore.waitApply")
+	applied, err := s.waiter.wait(waitCtx, index)
+	tracing.EndSpan(waitSpan, err)
 	if err != nil {
 		s.observe("propose", startedAt, err)
 		return kv.ApplyResult{}, err
 	}
+	if !applied.AppliedAt.IsZero() {
+		observability.ObservePhase(ctx, observability.PhaseCommit, max(applied.AppliedAt.Sub(proposedAt)-applied.ApplyDuration, 0))
+		observability.ObservePhase(ctx, observability.PhaseApply, applied.ApplyDuration)
+	}
 	if applied.Err != nil {
 		s.observe("propose", startedAt, applied.Err)
 		return applied.Result, applied.Err
@@ -386,13 +447,63 @@ func (s *Runtime) Delete(ctx context.Context, keys ...string) (int64, error) {
 	return deleted, nil
 }
 
-func (s *Runtime) Get(ctx context.Context, key string) ([]byte, bool, error) {
+func (s *Runtime) Get(ctx context.Context, key string) (value []byte, found bool, err error) {
+	ctx, slowOp := s.slowLog.Start(ctx, "get", key, 0)
+	defer func() { slowOp.Finish(err) }()
+
+	readStartedAt := time.Now()
 	if err := s.linearizableRead(ctx); err != nil {
 		return nil, false, err
 	}
+	getStartedAt := time.Now()
+	observability.ObservePhase(ctx, observability.PhaseReadIndex, getStartedAt.Sub(readStartedAt))
 
 	db := s.store.Reader()
-	return db.Get(key)
+	value, found, err = db.Get(key)
+	observability.ObservePhase(ctx, observability.PhaseStorageRead, time.Since(getStartedAt))
+	return value, found, err
+}
+
+func commandName(typ kv.CommandType) string {
+	switch typ {
+	case kv.CommandPut:
+		return "set"
+	case kv.CommandDelete:
+		return "delete"
+	}
+	return fmt.Sprintf("command_%d", typ)
+}
+
+// CompactRange compacts [start, end) in the local store. Compaction is not
+// replicated; it reclaims space on this node only.
+func (s *Runtime) CompactRange(ctx context.Context, start, end string) error {
+	startedAt := time.Now()
+	compactor, ok := s.store.(kv.RangeCompactor)
+	if !ok {
+		s.observe("compact_range", startedAt, ErrUnsupported)
+		return ErrUnsupported
+	}
+	err := compactor.CompactRange(ctx, start, end)
+	s.observe("compact_range", startedAt, err)
+	return err
+}
+
+// ApproximateSize estimates the on-disk bytes and entry count of [start, end)
+// in the local store.
+func (s *Runtime) ApproximateSize(start, end string) (int64, int64, error) {
+	compactor, ok := s.store.(kv.RangeCompactor)
+	if !ok {
+		return 0, 0, ErrUnsupported
+	}
+	size, err := compactor.ApproximateSize(start, end)
+	if err != nil {
+		return 0, 0, err
+	}
+	count, err := compactor.ApproximateCount(start, end)
+	if err != nil {
+		return 0, 0, err
+	}
+	return size, count, nil
 }
 
 func (s *Runtime) applyLoop(ctx context.Context) {
@@ -433,7 +544,7 @@ func (s *Runtime) applyMessage(msg raft.ApplyMsg) {
 
 	var result kv.ApplyResult
 	if err == nil {
-		result = s.store.Apply(command)
+		result = s.applyCommand(msg, command)
 		if result.Error != "" {
 			err = errors.New(result.Error)
 		}
@@ -446,6 +557,9 @@ func (s *Runtime) applyMessage(msg raft.ApplyMsg) {
 		Data:   msg.Data,
 		Result: result,
 		Err:    err,
+
+		AppliedAt:     time.Now(),
+		ApplyDuration: time.Since(startedAt),
 	})
 	s.observe("apply_entry", startedAt, err)
 	if err == nil {
@@ -453,6 +567,35 @@ func (s *Runtime) applyMessage(msg raft.ApplyMsg) {
 	}
 }
 
+// applyCommand applies command to the store. Entries proposed by this node
+// carry the proposal's span, so the apply and the storage write it triggers
+// join the proposal's trace.
+func (s *Runtime) applyCommand(msg raft.ApplyMsg, command kv.Command) kv.ApplyResult {
+	if !msg.Trace.IsValid() {
+		return s.applyToStore(context.Background(), msg.Index, command)
+	}
+	ctx, span := tracer.Start(trace.ContextWithSpanContext(context.Background(), msg.Trace), "raftstore.apply",
+		trace.WithAttributes(attribute.Int64("raft.index", int64(msg.Index))))
+	result := s.applyToStore(ctx, msg.Index, command)
+	if result.Error != "" {
+		span.SetStatus(codes.Error, result.Error)
+	}
+	span.End()
+	return result
+}
+
+// applyToStore hands command to the store, together with its raft index when
+// the store records the applied index.
+func (s *Runtime) applyToStore(ctx context.Context, index uint64, command kv.Command) kv.ApplyResult {
+	switch store := s.store.(type) {
+	case kv.IndexedApplier:
+		return store.ApplyAt(ctx, index, command)
+	case kv.ContextApplier:
+		return store.ApplyWithContext(ctx, command)
+	}
+	return s.store.Apply(command)
+}
+
 func (s *Runtime) ensureLeader() error {
 	if s.node.IsLeader() {
 		return nil
@@ -460,6 +603,19 @@ func (s *Runtime) ensureLeader() error {
 	return NotLeaderError{LeaderID: s.node.LeaderID()}
 }
 
+// checkWriteStall rejects new proposals while the store is stalled, so that
+// committed entries do not pile up behind a blocked apply loop.
+func (s *Runtime) checkWriteStall() error {
+	throttler, ok := s.store.(kv.WriteThrottler)
+	if !ok {
+		return nil
+	}
+	if err := throttler.WriteStall(); err != nil {
+		return fmt.Errorf("%w: %v", ErrResourceExhausted, err)
+	}
+	return nil
+}
+
 func (s *Runtime) maybeSnapshot(index uint64) {
 	if s.snapshotThreshold == 0 {
 		return
@@ -575,7 +731,10 @@ func (s *Runtime) linearizableRead(ctx context.Context) error {
 	return err
 }
 
-func (s *Runtime) waitApplied(ctx context.Context, index uint64) error {
+func (s *Runtime) waitApplied(ctx context.Context, index uint64) (err error) {
+	ctx, span := tracer.Start(ctx, "raftstore.waitApplied", trace.WithAttributes(attribute.Int64("raft.index", int64(index))))
+	defer func() { tracing.EndSpan(span, err) }()
+
 	s.applyMu.Lock()
 	if s.appliedIndex >= index {
 		s.applyMu.Unlock()
@@ -615,9 +774,6 @@ func (s *Runtime) setAppliedIndex(index uint64) {
 	for _, ch := range ready {
 		close(ch)
 	}
-	if s.registry != nil && s.nodeID != "" {
-		s.registry.SetAppliedIndex(s.nodeID, index)
-	}
 }
 
 func (s *Runtime) unregisterAppliedWaiter(index uint64, target chan struct{}) {
@@ -11,10 +11,15 @@ import (
 	"testing"
 	"time"
 
+	"go.opentelemetry.io/otel"
+
+	"mini-kv/internal/config"
 	"mini-kv/internal/kv"
 	"mini-kv/internal/kv/mem"
+	"mini-kv/internal/observability"
 	"mini-kv/internal/raft"
 	"mini-kv/internal/raft/logstore"
+	"mini-kv/internal/tracing"
 )
 
 func TestCommandCodecRoundTrip(t *testing.T) {
@@ -108,6 +113,8 @@ func (n *stubNode) LeaderID() string { return n.leaderID }
 
 func (n *stubNode) ApplyCh() <-chan raft.ApplyMsg { return nil }
 
+func (n *stubNode) Status() raft.Status { return raft.Status{Leader: n.leaderID} }
+
 func TestSingleNode(t *testing.T) {
 	nodes := newCluster(t, []string{"node1"})
 	node := waitLead(t, nodes, time.Second)
@@ -158,6 +165,113 @@ func TestReplicate(t *testing.T) {
 	waitStores(t, nodes, "shared", []byte("value"), time.Second)
 }
 
+func TestProposeTraceCoversReplicationAndApply(t *testing.T) {
+	// Tracers bind to the first global provider, so every run shares one.
+	provider, err := memoryTracing()
+	if err != nil {
+		t.Fatalf("setup tracing: %v", err)
+	}
+
+	nodes := newCluster(t, []string{"node1", "node2", "node3"})
+	leader := waitLead(t, nodes, time.Second)
+	provider.Reset()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	ctx, root := otel.Tracer("test").Start(ctx, "client.Set")
+	if err := leader.kv.Set(ctx, "traced", []byte("value")); err != nil {
+		t.Fatalf("set error: %v", err)
+	}
+	root.End()
+	waitStores(t, nodes, "traced", []byte("value"), time.Second)
+
+	want := []string{"raftstore.Propose", "raft.Propose", "raft.AppendEntries", "raft.HandleAppendEntries", "raftstore.waitApply", "raftstore.apply"}
+	deadline := time.Now().Add(time.Second)
+	for {
+		names := make(map[string]bool)
+		batchLinked := false
+		for _, span := range provider.Spans() {
+			if span.SpanContext.TraceID() == root.SpanContext().TraceID() {
+				names[span.Name] = true
+			}
+			if span.Name == "raft.appendProposalBatch" {
+				for _, link := range span.Links {
+					batchLinked = batchLinked || link.SpanContext.TraceID() == root.SpanContext().TraceID()
+				}
+			}
+		}
+		missing := []string{}
+		for _, name := range want {
+			if !names[name] {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) == 0 && batchLinked {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("trace is missing spans %v (batch linked: %v), got %v", missing, batchLinked, names)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+var memoryTracing = sync.OnceValues(func() (*tracing.Provider, error) {
+	return tracing.Setup(context.Background(), config.TracingConfig{Exporter: "memory", SampleRatio: 1}, "node1")
+})
+
+func TestSlowLogRecordsBreakdown(t *testing.T) {
+	store := mem.NewMemoryStore()
+	defer store.Close()
+	node, err := raft.NewNode(raft.Config{
+		ID:               "node1",
+		Peers:            []string{"node1"},
+		Storage:          logstore.NewMemoryStorage(),
+		Transport:        raft.NewFakeTransport(),
+		ElectionTimeout:  80 * time.Millisecond,
+		HeartbeatTimeout: 20 * time.Millisecond,
+		ApplyBufferSize:  16,
+	})
+	if err != nil {
+		t.Fatalf("new raft node error: %v", err)
+	}
+	slowLog := observability.NewSlowLog(config.SlowLogConfig{MaxLen: 4, RedactKeys: true}, nil)
+	rt := NewWithOptions(store, node, Options{SlowLog: slowLog})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := node.Start(); err != nil {
+		t.Fatalf("start raft node error: %v", err)
+	}
+	defer node.Stop()
+	rt.Start(ctx)
+	waitLead(t, []*testNode{{id: "node1", store: store, raft: node, kv: rt}}, time.Second)
+
+	if err := rt.Set(ctx, "slow", []byte("value")); err != nil {
+		t.Fatalf("set error: %v", err)
+	}
+	if _, _, err := rt.Get(ctx, "slow"); err != nil {
+		t.Fatalf("get error: %v", err)
+	}
+
+	entries := slowLog.Entries(0)
+	if len(entries) != 2 {
+		t.Fatalf("slow log entries = %d, want 2", len(entries))
+	}
+	get, set := entries[0], entries[1]
+	if get.Operation != "get" || set.Operation != "set" || set.Size != len("value") {
+		t.Fatalf("slow log entries = %+v", entries)
+	}
+	if set.Key == "slow" || set.Key != get.Key {
+		t.Fatalf("redacted keys = %q, %q", set.Key, get.Key)
+	}
+	if set.Breakdown[observability.PhaseCommit] <= 0 && set.Breakdown[observability.PhaseApply] <= 0 {
+		t.Fatalf("set breakdown = %v, want commit or apply time", set.Breakdown)
+	}
+	if get.Breakdown[observability.PhaseStorageRead] <= 0 {
+		t.Fatalf("get breakdown = %v, want storage read time", get.Breakdown)
+	}
+}
+
 func TestRejectCmd(t *testing.T) {
 	nodes := newCluster(t, []string{"node1", "node2", "node3"})
 	leader := waitLead(t, nodes, time.Second)
@@ -428,6 +542,42 @@ func TestFastPropose(t *testing.T) {
 	}
 }
 
+func TestProposeRejectsStalledStore(t *testing.T) {
+	store := &stalledStore{MemoryStore: mem.NewMemoryStore(), err: errors.New("l0_files")}
+	node := &stubNode{leader: true, leaderID: "node1"}
+	node.propose = func(context.Context, []byte) (uint64, error) {
+		t.Fatal("stalled store should not reach raft proposal")
+		return 0, nil
+	}
+	rt := New(store, node)
+
+	err := rt.Set(context.Background(), "key", []byte("value"))
+	if !errors.Is(err, ErrResourceExhausted) {
+		t.Fatalf("set error = %v, want %v", err, ErrResourceExhausted)
+	}
+}
+
+func TestCompactRangeUsesLocalStore(t *testing.T) {
+	node := &stubNode{leader: false, leaderID: "node2"}
+	rt := New(mem.NewMemoryStore(), node)
+	if err := rt.CompactRange(context.Background(), "", ""); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("compact error = %v, want %v", err, ErrUnsupported)
+	}
+
+	store := &compactingStore{MemoryStore: mem.NewMemoryStore()}
+	rt = New(store, node)
+	if err := rt.CompactRange(context.Background(), "a", "b"); err != nil {
+		t.Fatalf("compact error = %v", err)
+	}
+	if store.compacted != "a-b" {
+		t.Fatalf("compacted range = %q, want a-b", store.compacted)
+	}
+	size, count, err := rt.ApproximateSize("a", "b")
+	if err != nil || size != 128 || count != 2 {
+		t.Fatalf("approximate size = (%d, %d, %v), want (128, 2, nil)", size, count, err)
+	}
+}
+
 func TestSnapshotRunsAsynchronously(t *testing.T) {
 	store := &blockingSnapshotStore{
 		MemoryStore: mem.NewMemoryStore(),
@@ -788,6 +938,27 @@ func assertLeaderErr(t *testing.T, err error) {
 	}
 }
 
+type stalledStore struct {
+	*mem.MemoryStore
+	err error
+}
+
+func (s *stalledStore) WriteStall() error { return s.err }
+
+type compactingStore struct {
+	*mem.MemoryStore
+	compacted string
+}
+
+func (s *compactingStore) CompactRange(_ context.Context, start, end string) error {
+	s.compacted = start + "-" + end
+	return nil
+}
+
+func (s *compactingStore) ApproximateSize(string, string) (int64, error) { return 128, nil }
+
+func (s *compactingStore) ApproximateCount(string, string) (int64, error) { return 2, nil }
+
 type blockingSnapshotStore struct {
 	*mem.MemoryStore
 	started chan struct{}
@@ -0,0 +1,136 @@
+package transport
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+const (
+	// The high bit of the header type byte marks a deflate-compressed payload.
+	frameFlagCompressed         byte = 0x80
+	defaultCompressionThreshold      = 1024
+)
+
+var flateWriters = sync.Pool{
+	New: func() any {
+		w, _ := flate.NewWriter(nil, flate.BestSpeed)
+		return w
+	},
+}
+
+// FrameObserver is told the payload size of every frame the transport sends,
+// before and after compression. Frames sent raw report the same size twice.
+type FrameObserver func(peer, message string, rawBytes, wireBytes int)
+
+// WithCompression offers per-frame compression to peers. It is used on a
+// connection only when both ends offer it, and only for payloads of at least
+// threshold bytes; zero picks the default threshold.
+func WithCompression(threshold int) Option {
+	return func(o *options) error {
+		if threshold < 0 {
+			return fmt.Errorf("raftnet: compression threshold %d is negative", threshold)
+		}
+		if threshold == 0 {
+			threshold = defaultCompressionThreshold
+		}
+		o.features |= featureCompression
+		o.writer.threshold = threshold
+		return nil
+	}
+}
+
+// WithFrameObserver reports the raw and on-the-wire size of sent frames.
+func WithFrameObserver(observe FrameObserver) Option {
+	return func(o *options) error {
+		o.writer.observe = observe
+		return nil
+	}
+}
+
+type frameWriter struct {
+	threshold int
+	observe   FrameObserver
+}
+
+// write sends payload in one frame. A non-empty traceContext is sent ahead of
+// the payload when the connection negotiated trace propagation.
+func (w frameWriter) write(conn net.Conn, peer string, features featureSet, version byte, typ messageType, id uint64, traceContext, payload []byte) error {
+	wire, flags := payload, byte(0)
+	if len(traceContext) > 0 && features&featureTraceContext != 0 {
+		wire = append(append(make([]byte, 0, len(traceContext)+len(payload)), traceContext...), payload...)
+		flags |= frameFlagTraced
+	}
+	if features&featureCompression != 0 && w.threshold > 0 && len(wire) >= w.threshold {
+		if compressed, ok := compressPayload(wire); ok {
+			wire, flags = compressed, flags|frameFlagCompressed
+		}
+	}
+	if err := writeFrameFlags(conn, version, typ, flags, id, wire); err != nil {
+		return err
+	}
+	if w.observe != nil {
+		w.observe(peer, typ.String(), len(payload), len(wire))
+	}
+	return nil
+}
+
+// compressPayload returns false when deflate does not make the payload smaller.
+func compressPayload(payload []byte) ([]byte, bool) {
+	var buf bytes.Buffer
+	buf.Grow(len(payload) / 2)
+	w := flateWriters.Get().(*flate.Writer)
+	defer flateWriters.Put(w)
+	w.Reset(&buf)
+	if _, err := w.Write(payload); err != nil {
+		return nil, false
+	}
+	if err := w.Close(); err != nil {
+		return nil, false
+	}
+	if buf.Len() >= len(payload) {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+func decompressPayload(payload []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(payload))
+	defer r.Close()
+	data, err := io.ReadAll(io.LimitReader(r, maxFramePayloadSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("raftnet: decompress frame: %w", err)
+	}
+	if len(data) > maxFramePayloadSize {
+		return nil, errors.New("raftnet: decompressed frame payload exceeds limit")
+	}
+	return data, nil
+}
+
+func (t messageType) String() string {
+	switch t {
+	case messageRequestVote:
+		return "request_vote"
+	case messageRequestVoteResponse:
+		return "request_vote_response"
+	case messageAppendEntries:
+		return "append_entries"
+	case messageAppendEntriesResponse:
+		return "append_entries_response"
+	case messageInstallSnapshot:
+		return "install_snapshot"
+	case messageInstallSnapshotResponse:
+		return "install_snapshot_response"
+	case messageErrorResponse:
+		return "error_response"
+	case messageHello:
+		return "hello"
+	case messageHelloResponse:
+		return "hello_response"
+	}
+	return fmt.Sprintf("message_%d", byte(t))
+}
@@ -0,0 +1,172 @@
+package transport
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+const helloTimeout = 10 * time.Second
+
+var ErrHandshake = errors.New("raftnet: handshake failed")
+
+type featureSet uint64
+
+const (
+	featureCompression featureSet = 1 << iota
+	featureTraceContext
+)
+
+// Features offered by default; the rest are enabled through options.
+const supportedFeatures = featureTraceContext
+
+// WithClusterID makes the transport refuse peers that belong to another
+// cluster. Nodes of one cluster must all use the same ID.
+func WithClusterID(id string) Option {
+	return func(o *options) error {
+		o.clusterID = id
+		return nil
+	}
+}
+
+// WithMinProtocolVersion rejects peers that cannot speak at least version v.
+// Raising it above 1 refuses peers that predate the hello handshake, which is
+// the last step of a rolling upgrade.
+func WithMinProtocolVersion(v byte) Option {
+	return func(o *options) error {
+		if v == 0 {
+			return nil
+		}
+		if v < minProtocolVersion || v > maxProtocolVersion {
+			return fmt.Errorf("raftnet: protocol version %d is outside %d-%d", v, minProtocolVersion, maxProtocolVersion)
+		}
+		o.minVersion = v
+		return nil
+	}
+}
+
+type session struct {
+	peerID   string
+	cert     *x509.Certificate
+	version  byte
+	features featureSet
+}
+
+func (s session) checkPeer(id string) error {
+	if s.peerID != "" && s.peerID != id {
+		return fmt.Errorf("%w: connection from %q cannot act as %q", ErrPeerIdentity, s.peerID, id)
+	}
+	return checkPeerIdentity(s.cert, id)
+}
+
+func (t *Transport) hello(target string) helloMessage {
+	return helloMessage{
+		ClusterID:  t.clusterID,
+		NodeID:     t.id,
+		TargetID:   target,
+		MinVersion: max(t.minVersion, legacyProtocolVersion+1),
+		MaxVersion: t.maxVersion,
+		Features:   t.features,
+	}
+}
+
+func (t *Transport) acceptHello(cert *x509.Certificate, payload []byte) (session, helloResponse, error) {
+	hello, err := decodeHello(payload)
+	if err != nil {
+		return session{}, helloResponse{}, fmt.Errorf("%w: %v", ErrHandshake, err)
+	}
+	if err := checkHello(t.clusterID, t.id, cert, hello); err != nil {
+		return session{}, helloResponse{}, err
+	}
+	local := t.hello(hello.NodeID)
+	version, ok := negotiateVersion(local, hello)
+	if !ok {
+		return session{}, helloResponse{}, fmt.Errorf("%w: no common protocol version: node %q speaks %d-%d, this node %d-%d",
+			ErrHandshake, hello.NodeID, hello.MinVersion, hello.MaxVersion, local.MinVersion, local.MaxVersion)
+	}
+	sess := session{peerID: hello.NodeID, cert: cert, version: version, features: local.Features & hello.Features}
+	return sess, helloResponse{ClusterID: t.clusterID, NodeID: t.id, Version: version, Features: sess.features}, nil
+}
+
+// checkHello verifies that the peer introduced in hello belongs to this
+// cluster, meant to reach this node and holds a certificate for its node ID.
+func checkHello(clusterID, localID string, cert *x509.Certificate, hello helloMessage) error {
+	if hello.ClusterID != clusterID {
+		return fmt.Errorf("%w: node %q belongs to cluster %q, this node %q to cluster %q",
+			ErrHandshake, hello.NodeID, hello.ClusterID, localID, clusterID)
+	}
+	if hello.TargetID != localID {
+		return fmt.Errorf("%w: node %q dialed %q but reached %q", ErrHandshake, hello.NodeID, hello.TargetID, localID)
+	}
+	if hello.NodeID == "" {
+		return fmt.Errorf("%w: peer sent an empty node id", ErrHandshake)
+	}
+	return checkPeerIdentity(cert, hello.NodeID)
+}
+
+// negotiateVersion picks the highest version both sides support.
+func negotiateVersion(local, peer helloMessage) (byte, bool) {
+	low := max(local.MinVersion, peer.MinVersion)
+	high := min(local.MaxVersion, peer.MaxVersion)
+	return high, low <= high
+}
+
+// handshake opens a client connection with a hello exchange. A peer that
+// predates the handshake answers with an unknown message type error and is
+// spoken to in version 1, unless the minimum version rules that out.
+func (c *peerClient) handshake(ctx context.Context, conn net.Conn) (byte, featureSet, error) {
+	deadline := time.Now().Add(helloTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	_ = conn.SetDeadline(deadline)
+	defer func() { _ = conn.SetDeadline(time.Time{}) }()
+
+	payload, err := encodeHello(c.hello)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := writeFrame(conn, legacyProtocolVersion, messageHello, 0, payload); err != nil {
+		return 0, 0, fmt.Errorf("%w: send hello to %s: %v", ErrHandshake, c.id, err)
+	}
+	frame, err := readFrame(conn)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: read hello response from %s: %v", ErrHandshake, c.id, err)
+	}
+
+	switch frame.typ {
+	case messageHelloResponse:
+		resp, err := decodeHelloResponse(frame.payload)
+		if err != nil {
+			return 0, 0, fmt.Errorf("%w: %v", ErrHandshake, err)
+		}
+		if resp.ClusterID != c.hello.ClusterID {
+			return 0, 0, fmt.Errorf("%w: %s belongs to cluster %q, expected %q", ErrHandshake, c.addr, resp.ClusterID, c.hello.ClusterID)
+		}
+		if resp.NodeID != c.id {
+			return 0, 0, fmt.Errorf("%w: dialed %q at %s but reached %q", ErrHandshake, c.id, c.addr, resp.NodeID)
+		}
+		if resp.Version < c.hello.MinVersion || resp.Version > c.hello.MaxVersion {
+			return 0, 0, fmt.Errorf("%w: %s chose unsupported protocol version %d", ErrHandshake, c.id, resp.Version)
+		}
+		return resp.Version, resp.Features & c.hello.Features, nil
+	case messageErrorResponse:
+		message, err := decodeErrorResponse(frame.payload)
+		if err != nil {
+			return 0, 0, fmt.Errorf("%w: %v", ErrHandshake, err)
+		}
+		if strings.Contains(message, "unknown message type") {
+			if !c.legacyOK {
+				return 0, 0, fmt.Errorf("%w: %s does not support the handshake", ErrHandshake, c.id)
+			}
+			return legacyProtocolVersion, 0, nil
+		}
+		return 0, 0, fmt.Errorf("%w: rejected by %s: %s", ErrHandshake, c.id, strings.TrimPrefix(message, ErrHandshake.Error()+": "))
+	default:
+		return 0, 0, fmt.Errorf("%w: unexpected message type %d from %s", ErrHandshake, frame.typ, c.id)
+	}
+}
@@ -8,12 +8,19 @@ import (
 	"math"
 	"net"
 
+	"go.opentelemetry.io/otel/propagation"
+
 	"mini-kv/internal/raft"
 )
 
 const (
-	protocolMagic       uint32 = 0x52564b4d // MKVR, little-endian.
-	protocolVersion     byte   = 1
+	protocolMagic uint32 = 0x52564b4d // MKVR, little-endian.
+	// Version 1 connections start sending raft messages right away. Version 2
+	// connections open with a hello exchange; hello frames themselves always
+	// carry version 1 so that peers without the handshake can reject them.
+	legacyProtocolVersion byte = 1
+	minProtocolVersion    byte = 1
+	maxProtocolVersion    byte = 2
 	frameHeaderLen             = 18
 	maxFramePayloadSize        = 256 << 20
 )
@@ -28,23 +35,33 @@ const (
 	messageInstallSnapshot
 	messageInstallSnapshotResponse
 	messageErrorResponse
+	messageHello
+	messageHelloResponse
 )
 
 type protocolFrame struct {
-	typ     messageType
-	id      uint64
-	payload []byte
+	version    byte
+	typ        messageType
+	compressed bool
+	traced     bool
+	trace      propagation.MapCarrier
+	id         uint64
+	payload    []byte
+}
+
+func writeFrame(conn net.Conn, version byte, typ messageType, id uint64, payload []byte) error {
+	return writeFrameFlags(conn, version, typ, 0, id, payload)
 }
 
-func writeFrame(conn net.Conn, typ messageType, id uint64, payload []byte) error {
+func writeFrameFlags(conn net.Conn, version byte, typ messageType, flags byte, id uint64, payload []byte) error {
 	if len(payload) > math.MaxUint32 {
 		return errors.New("raftnet: frame payload too large")
 	}
 
 	header := make([]byte, frameHeaderLen)
 	binary.LittleEndian.PutUint32(header[0:4], protocolMagic)
-	header[4] = protocolVersion
-	header[5] = byte(typ)
+	header[4] = version
+	header[5] = byte(typ) | flags
 	binary.LittleEndian.PutUint64(header[6:14], id)
 	binary.LittleEndian.PutUint32(header[14:18], uint32(len(payload)))
 
@@ -62,7 +79,7 @@ func readFrame(reader io.Reader) (protocolFrame, error) {
 	if binary.LittleEndian.Uint32(header[0:4]) != protocolMagic {
 		return protocolFrame{}, errors.New("raftnet: invalid frame magic")
 	}
-	if header[4] != protocolVersion {
+	if header[4] < minProtocolVersion || header[4] > maxProtocolVersion {
 		return protocolFrame{}, fmt.Errorf("raftnet: unsupported protocol version %d", header[4])
 	}
 
@@ -74,10 +91,29 @@ func readFrame(reader io.Reader) (protocolFrame, error) {
 	if _, err := io.ReadFull(reader, payload); err != nil {
 		return protocolFrame{}, err
 	}
+	compressed := header[5]&frameFlagCompressed != 0
+	if compressed {
+		var err error
+		if payload, err = decompressPayload(payload); err != nil {
+			return protocolFrame{}, err
+		}
+	}
+	traced := header[5]&frameFlagTraced != 0
+	var trace propagation.MapCarrier
+	if traced {
+		var err error
+		if trace, payload, err = splitTraceContext(payload); err != nil {
+			return protocolFrame{}, err
+		}
+	}
 	return protocolFrame{
-		typ:     messageType(header[5]),
-		id:      binary.LittleEndian.Uint64(header[6:14]),
-		payload: payload,
+		version:    header[4],
+		typ:        messageType(header[5] &^ (frameFlagCompressed | frameFlagTraced)),
+		compressed: compressed,
+		traced:     traced,
+		trace:      trace,
+		id:         binary.LittleEndian.Uint64(header[6:14]),
+		payload:    payload,
 	}, nil
 }
 
@@ -351,6 +387,66 @@ func decodeInstallSnapshotResponse(payload []byte) (raft.InstallSnapshotResponse
 	return resp, dec.done()
 }
 
+type helloMessage struct {
+	ClusterID  string
+	NodeID     string
+	TargetID   string
+	MinVersion byte
+	MaxVersion byte
+	Features   featureSet
+}
+
+type helloResponse struct {
+	ClusterID string
+	NodeID    string
+	Version   byte
+	Features  featureSet
+}
+
+func encodeHello(hello helloMessage) ([]byte, error) {
+	enc := newFrameEncoder(22 + len(hello.ClusterID) + len(hello.NodeID) + len(hello.TargetID))
+	enc.string(hello.ClusterID)
+	enc.string(hello.NodeID)
+	enc.string(hello.TargetID)
+	enc.u8(hello.MinVersion)
+	enc.u8(hello.MaxVersion)
+	enc.u64(uint64(hello.Features))
+	return enc.buf, enc.err
+}
+
+func decodeHello(payload []byte) (helloMessage, error) {
+	dec := newFrameDecoder(payload)
+	hello := helloMessage{
+		ClusterID:  dec.string(),
+		NodeID:     dec.string(),
+		TargetID:   dec.string(),
+		MinVersion: dec.u8(),
+		MaxVersion: dec.u8(),
+		Features:   featureSet(dec.u64()),
+	}
+	return hello, dec.done()
+}
+
+func encodeHelloResponse(resp helloResponse) ([]byte, error) {
+	enc := newFrameEncoder(17 + len(resp.ClusterID) + len(resp.NodeID))
+	enc.string(resp.ClusterID)
+	enc.string(resp.NodeID)
+	enc.u8(resp.Version)
+	enc.u64(uint64(resp.Features))
+	return enc.buf, enc.err
+}
+
+func decodeHelloResponse(payload []byte) (helloResponse, error) {
+	dec := newFrameDecoder(payload)
+	resp := helloResponse{
+		ClusterID: dec.string(),
+		NodeID:    dec.string(),
+		Version:   dec.u8(),
+		Features:  featureSet(dec.u64()),
+	}
+	return resp, dec.done()
+}
+
 func encodeErrorResponse(err error) ([]byte, error) {
 	enc := newFrameEncoder(32)
 	enc.string(err.Error())
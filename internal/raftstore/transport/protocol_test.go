@@ -61,7 +61,7 @@ func TestProtocolRoundTrip(t *testing.T) {
 func TestProtocolRejectsBadFrame(t *testing.T) {
 	var header [frameHeaderLen]byte
 	binary.LittleEndian.PutUint32(header[0:4], 0xdeadbeef)
-	header[4] = protocolVersion
+	header[4] = maxProtocolVersion
 
 	if _, err := readFrame(bytes.NewReader(header[:])); err == nil {
 		t.Fatal("expected bad magic error")
@@ -79,3 +79,33 @@ func TestProtocolRejectsBadFrame(t *testing.T) {
 		t.Fatalf("truncated append error = %v, want %v", err, io.ErrUnexpectedEOF)
 	}
 }
+
+func TestNegotiateVersionPicksHighestCommon(t *testing.T) {
+	for _, tc := range []struct {
+		local, peer [2]byte
+		want        byte
+		ok          bool
+	}{
+		{[2]byte{2, 2}, [2]byte{2, 2}, 2, true},
+		{[2]byte{2, 4}, [2]byte{2, 3}, 3, true},
+		{[2]byte{2, 3}, [2]byte{3, 5}, 3, true},
+		{[2]byte{2, 2}, [2]byte{3, 4}, 0, false},
+	} {
+		local := helloMessage{MinVersion: tc.local[0], MaxVersion: tc.local[1]}
+		peer := helloMessage{MinVersion: tc.peer[0], MaxVersion: tc.peer[1]}
+		got, ok := negotiateVersion(local, peer)
+		if ok != tc.ok || (ok && got != tc.want) {
+			t.Fatalf("negotiate %v with %v = %d, %v; want %d, %v", tc.local, tc.peer, got, ok, tc.want, tc.ok)
+		}
+	}
+
+	hello := helloMessage{ClusterID: "alpha", NodeID: "node2", TargetID: "node1", MinVersion: 2, MaxVersion: 3, Features: 5}
+	payload, err := encodeHello(hello)
+	if err != nil {
+		t.Fatalf("encode hello: %v", err)
+	}
+	got, err := decodeHello(payload)
+	if err != nil || got != hello {
+		t.Fatalf("hello round trip = %+v, %v; want %+v", got, err, hello)
+	}
+}
@@ -0,0 +1,603 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+	raftv1 "mini-kv/api/raft/v1"
+	"mini-kv/internal/raft"
+	"mini-kv/internal/tracing"
+)
+
+const (
+	grpcCallTimeout       = 5 * time.Second
+	grpcSnapshotTimeout   = time.Minute
+	grpcSnapshotChunkSize = 1 << 20
+	grpcKeepaliveTime     = 10 * time.Second
+	grpcKeepaliveTimeout  = 5 * time.Second
+
+	grpcClusterHeader = "mini-kv-raft-cluster"
+	grpcNodeHeader    = "mini-kv-raft-node"
+	grpcTargetHeader  = "mini-kv-raft-target"
+)
+
+// grpcMessageTypes maps each method to the frame types it stands for, so
+// metrics use the same message labels as the TCP transport.
+var grpcMessageTypes = map[string][2]messageType{
+	raftv1.Raft_RequestVote_FullMethodName:     {messageRequestVote, messageRequestVoteResponse},
+	raftv1.Raft_AppendEntries_FullMethodName:   {messageAppendEntries, messageAppendEntriesResponse},
+	raftv1.Raft_InstallSnapshot_FullMethodName: {messageInstallSnapshot, messageInstallSnapshotResponse},
+}
+
+// GRPCTransport carries raft traffic over the raft.v1.Raft gRPC service for
+// networks that only pass gRPC. It takes the same options as Transport:
+// cluster and node identity travel as request metadata instead of a hello
+// frame, protocol versions do not apply and compression uses gzip.
+type GRPCTransport struct {
+	id         string
+	listenAddr string
+	options
+	mu        sync.RWMutex
+	peerAddrs map[string]string
+	peers     map[string]*grpcPeer
+	handler   raft.RPCHandler
+	server    *grpc.Server
+	closed    bool
+	accepted  atomic.Uint64
+}
+
+type grpcPeer struct {
+	conn   *grpc.ClientConn
+	client raftv1.RaftClient
+}
+
+func NewGRPC(id string, listenAddr string, peerAddrs map[string]string, opts ...Option) (*GRPCTransport, error) {
+	if id == "" {
+		return nil, errors.New("raftnet: node id is empty")
+	}
+	if listenAddr == "" {
+		listenAddr = "127.0.0.1:0"
+	}
+	copied := make(map[string]string, len(peerAddrs)+1)
+	for peer, addr := range peerAddrs {
+		if peer != "" && addr != "" {
+			copied[peer] = addr
+		}
+	}
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &GRPCTransport{
+		id:         id,
+		listenAddr: listenAddr,
+		options:    o,
+		peerAddrs:  copied,
+		peers:      make(map[string]*grpcPeer),
+	}, nil
+}
+
+func (t *GRPCTransport) Start(handler raft.RPCHandler) error {
+	if handler == nil {
+		return errors.New("raftnet: rpc handler is nil")
+	}
+	listener, err := net.Listen("tcp", t.listenAddr)
+	if err != nil {
+		return err
+	}
+
+	serverOpts := []grpc.ServerOption{
+		grpc.KeepaliveParams(keepalive.ServerParameters{Time: grpcKeepaliveTime, Timeout: grpcKeepaliveTimeout}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{MinTime: grpcKeepaliveTime / 2, PermitWithoutStream: true}),
+		grpc.MaxRecvMsgSize(maxFramePayloadSize),
+		grpc.MaxSendMsgSize(maxFramePayloadSize),
+	}
+	if t.tls != nil {
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(grpcServerTLSConfig(t.tls))))
+	}
+	if t.writer.observe != nil {
+		serverOpts = append(serverOpts, grpc.StatsHandler(grpcFrameStats{observe: t.writer.observe}))
+	}
+	server := grpc.NewServer(serverOpts...)
+	raftv1.RegisterRaftServer(server, grpcRaftServer{transport: t})
+
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		_ = listener.Close()
+		return ErrTransportClosed
+	}
+	if t.server != nil {
+		t.mu.Unlock()
+		_ = listener.Close()
+		return nil
+	}
+	t.handler = handler
+	t.server = server
+	t.listenAddr = listener.Addr().String()
+	t.peerAddrs[t.id] = t.listenAddr
+	t.mu.Unlock()
+
+	go func() {
+		_ = server.Serve(countingListener{Listener: listener, accepted: &t.accepted})
+	}()
+	return nil
+}
+
+func (t *GRPCTransport) Addr() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.listenAddr
+}
+
+func (t *GRPCTransport) ReloadTLS() error {
+	if t.tls == nil {
+		return errors.New("raftnet: tls is not enabled")
+	}
+	return t.tls.reload()
+}
+
+func (t *GRPCTransport) SetPeer(id string, addr string) {
+	if id == "" || addr == "" {
+		return
+	}
+
+	var old *grpcPeer
+	t.mu.Lock()
+	if t.peerAddrs[id] != addr {
+		old = t.peers[id]
+		delete(t.peers, id)
+	}
+	t.peerAddrs[id] = addr
+	t.mu.Unlock()
+
+	if old != nil {
+		_ = old.conn.Close()
+	}
+}
+
+func (t *GRPCTransport) Close() error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	server := t.server
+	peers := t.peers
+	t.peers = make(map[string]*grpcPeer)
+	t.mu.Unlock()
+
+	for _, peer := range peers {
+		_ = peer.conn.Close()
+	}
+	if server != nil {
+		server.Stop()
+	}
+	return nil
+}
+
+func (t *GRPCTransport) RequestVote(ctx context.Context, target string, req raft.RequestVoteRequest) (raft.RequestVoteResponse, error) {
+	peer, err := t.peer(target)
+	if err != nil {
+		return raft.RequestVoteResponse{}, err
+	}
+	ctx, cancel := t.callContext(ctx, target, grpcCallTimeout)
+	defer cancel()
+	in := &raftv1.RequestVoteRequest{
+		Term:         req.Term,
+		CandidateId:  req.CandidateID,
+		LastLogIndex: req.LastLogIndex,
+		LastLogTerm:  req.LastLogTerm,
+	}
+	out, err := peer.client.RequestVote(ctx, in, t.callOptions(0)...)
+	if err != nil {
+		return raft.RequestVoteResponse{}, t.callError(ctx, target, peer, err)
+	}
+	return raft.RequestVoteResponse{Term: out.GetTerm(), VoteGranted: out.GetVoteGranted()}, nil
+}
+
+func (t *GRPCTransport) AppendEntries(ctx context.Context, target string, req raft.AppendEntriesRequest) (raft.AppendEntriesResponse, error) {
+	peer, err := t.peer(target)
+	if err != nil {
+		return raft.AppendEntriesResponse{}, err
+	}
+	ctx, cancel := t.callContext(ctx, target, grpcCallTimeout)
+	defer cancel()
+	in := &raftv1.AppendEntriesRequest{
+		Term:         req.Term,
+		LeaderId:     req.LeaderID,
+		PrevLogIndex: req.PrevLogIndex,
+		PrevLogTerm:  req.PrevLogTerm,
+		Entries:      make([]*raftv1.LogEntry, len(req.Entries)),
+		LeaderCommit: req.LeaderCommit,
+		ReadContext:  req.ReadContext,
+	}
+	size := 0
+	for i, entry := range req.Entries {
+		in.Entries[i] = &raftv1.LogEntry{Index: entry.Index, Term: entry.Term, Type: uint32(entry.Type), Data: entry.Data}
+		size += len(entry.Data)
+	}
+	out, err := peer.client.AppendEntries(ctx, in, t.callOptions(size)...)
+	if err != nil {
+		return raft.AppendEntriesResponse{}, t.callError(ctx, target, peer, err)
+	}
+	return raft.AppendEntriesResponse{
+		Term:          out.GetTerm(),
+		Success:       out.GetSuccess(),
+		ReadContext:   out.GetReadContext(),
+		ConflictIndex: out.GetConflictIndex(),
+		ConflictTerm:  out.GetConflictTerm(),
+	}, nil
+}
+
+func (t *GRPCTransport) InstallSnapshot(ctx context.Context, target string, req raft.InstallSnapshotRequest) (raft.InstallSnapshotResponse, error) {
+	peer, err := t.peer(target)
+	if err != nil {
+		return raft.InstallSnapshotResponse{}, err
+	}
+	ctx, cancel := t.callContext(ctx, target, grpcSnapshotTimeout)
+	defer cancel()
+	stream, err := peer.client.InstallSnapshot(ctx, t.callOptions(len(req.Data))...)
+	if err != nil {
+		return raft.InstallSnapshotResponse{}, t.callError(ctx, target, peer, err)
+	}
+
+	chunk := &raftv1.InstallSnapshotChunk{
+		Term:              req.Term,
+		LeaderId:          req.LeaderID,
+		LastIncludedIndex: req.LastIncludedIndex,
+		LastIncludedTerm:  req.LastIncludedTerm,
+	}
+	data := req.Data
+	for {
+		n := min(len(data), grpcSnapshotChunkSize)
+		chunk.Data = data[:n]
+		// io.EOF means the server ended the stream; CloseAndRecv reports why.
+		if err := stream.Send(chunk); err != nil {
+			if err != io.EOF {
+				return raft.InstallSnapshotResponse{}, t.callError(ctx, target, peer, err)
+			}
+			break
+		}
+		data = data[n:]
+		if len(data) == 0 {
+			break
+		}
+		chunk = &raftv1.InstallSnapshotChunk{}
+	}
+	out, err := stream.CloseAndRecv()
+	if err != nil {
+		return raft.InstallSnapshotResponse{}, t.callError(ctx, target, peer, err)
+	}
+	return raft.InstallSnapshotResponse{Term: out.GetTerm()}, nil
+}
+
+// peer returns the cached connection to target. gRPC multiplexes every call
+// over it and reconnects on its own after transient failures.
+func (t *GRPCTransport) peer(target string) (*grpcPeer, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil, ErrTransportClosed
+	}
+	addr := t.peerAddrs[target]
+	if addr == "" {
+		return nil, fmt.Errorf("%w: %s", ErrPeerNotFound, target)
+	}
+	if peer := t.peers[target]; peer != nil {
+		return peer, nil
+	}
+
+	creds := insecure.NewCredentials()
+	if t.tls != nil {
+		creds = credentials.NewTLS(t.tls.clientConfig(target))
+	}
+	dialOpts := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{Time: grpcKeepaliveTime, Timeout: grpcKeepaliveTimeout, PermitWithoutStream: true}),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(maxFramePayloadSize), grpc.MaxCallSendMsgSize(maxFramePayloadSize)),
+	}
+	if t.writer.observe != nil {
+		dialOpts = append(dialOpts, grpc.WithStatsHandler(grpcFrameStats{observe: t.writer.observe}))
+	}
+	conn, err := grpc.NewClient(addr, dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+	peer := &grpcPeer{conn: conn, client: raftv1.NewRaftClient(conn)}
+	t.peers[target] = peer
+	return peer, nil
+}
+
+// dropPeer discards a connection that failed, like the TCP transport does, so
+// the next call dials again instead of waiting out gRPC's reconnect backoff.
+func (t *GRPCTransport) dropPeer(target string, peer *grpcPeer) {
+	t.mu.Lock()
+	if t.peers[target] == peer {
+		delete(t.peers, target)
+	}
+	t.mu.Unlock()
+	_ = peer.conn.Close()
+}
+
+func (t *GRPCTransport) callContext(ctx context.Context, target string, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx,
+		grpcClusterHeader, t.clusterID,
+		grpcNodeHeader, t.id,
+		grpcTargetHeader, target)
+	ctx = tracing.InjectOutgoing(context.WithValue(ctx, grpcPeerKey{}, target))
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+func (t *GRPCTransport) callOptions(size int) []grpc.CallOption {
+	if t.features&featureCompression != 0 && size >= t.writer.threshold {
+		return []grpc.CallOption{grpc.UseCompressor(gzip.Name)}
+	}
+	return nil
+}
+
+// callError turns a gRPC status back into the errors the TCP transport
+// returns, so callers can match ErrHandshake and ErrPeerIdentity on both.
+func (t *GRPCTransport) callError(ctx context.Context, target string, peer *grpcPeer, err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	if st.Code() == codes.Unavailable {
+		t.dropPeer(target, peer)
+	}
+	message := st.Message()
+	for _, sentinel := range []error{ErrHandshake, ErrPeerIdentity} {
+		if i := strings.Index(message, sentinel.Error()); i >= 0 {
+			return fmt.Errorf("%w%s", sentinel, message[i+len(sentinel.Error()):])
+		}
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if st.Code() == codes.Unknown {
+		return errors.New(message)
+	}
+	return err
+}
+
+func (t *GRPCTransport) acceptedConnCount() uint64 {
+	return t.accepted.Load()
+}
+
+// accept checks the caller the way the hello exchange does on the TCP
+// transport and returns the session its requests are checked against, along
+// with ctx carrying the caller's trace context.
+func (t *GRPCTransport) accept(ctx context.Context) (context.Context, raft.RPCHandler, session, error) {
+	t.mu.RLock()
+	handler := t.handler
+	t.mu.RUnlock()
+	if handler == nil {
+		return ctx, nil, session{}, status.Error(codes.Unavailable, ErrTransportClosed.Error())
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	hello := helloMessage{
+		ClusterID: firstMetadata(md, grpcClusterHeader),
+		NodeID:    firstMetadata(md, grpcNodeHeader),
+		TargetID:  firstMetadata(md, grpcTargetHeader),
+	}
+	var cert *x509.Certificate
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.PeerCertificates) > 0 {
+			cert = info.State.PeerCertificates[0]
+		}
+	}
+	if err := checkHello(t.clusterID, t.id, cert, hello); err != nil {
+		return ctx, nil, session{}, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return tracing.ExtractIncoming(ctx), handler, session{peerID: hello.NodeID, cert: cert}, nil
+}
+
+type grpcRaftServer struct {
+	raftv1.UnimplementedRaftServer
+	transport *GRPCTransport
+}
+
+func (s grpcRaftServer) RequestVote(ctx context.Context, in *raftv1.RequestVoteRequest) (*raftv1.RequestVoteResponse, error) {
+	ctx, handler, sess, err := s.transport.accept(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := sess.checkPeer(in.GetCandidateId()); err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	resp, err := handler.HandleRequestVote(ctx, raft.RequestVoteRequest{
+		Term:         in.GetTerm(),
+		CandidateID:  in.GetCandidateId(),
+		LastLogIndex: in.GetLastLogIndex(),
+		LastLogTerm:  in.GetLastLogTerm(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &raftv1.RequestVoteResponse{Term: resp.Term, VoteGranted: resp.VoteGranted}, nil
+}
+
+func (s grpcRaftServer) AppendEntries(ctx context.Context, in *raftv1.AppendEntriesRequest) (*raftv1.AppendEntriesResponse, error) {
+	ctx, handler, sess, err := s.transport.accept(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := sess.checkPeer(in.GetLeaderId()); err != nil {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	req := raft.AppendEntriesRequest{
+		Term:         in.GetTerm(),
+		LeaderID:     in.GetLeaderId(),
+		PrevLogIndex: in.GetPrevLogIndex(),
+		PrevLogTerm:  in.GetPrevLogTerm(),
+		LeaderCommit: in.GetLeaderCommit(),
+		ReadContext:  in.GetReadContext(),
+	}
+	if entries := in.GetEntries(); len(entries) > 0 {
+		req.Entries = make([]raft.LogEntry, len(entries))
+		for i, entry := range entries {
+			req.Entries[i] = raft.LogEntry{
+				Index: entry.GetIndex(),
+				Term:  entry.GetTerm(),
+				Type:  raft.EntryType(entry.GetType()),
+				Data:  entry.GetData(),
+			}
+		}
+	}
+	resp, err := handler.HandleAppendEntries(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &raftv1.AppendEntriesResponse{
+		Term:          resp.Term,
+		Success:       resp.Success,
+		ReadContext:   resp.ReadContext,
+		ConflictIndex: resp.ConflictIndex,
+		ConflictTerm:  resp.ConflictTerm,
+	}, nil
+}
+
+func (s grpcRaftServer) InstallSnapshot(stream raftv1.Raft_InstallSnapshotServer) error {
+	ctx := stream.Context()
+	ctx, handler, sess, err := s.transport.accept(ctx)
+	if err != nil {
+		return err
+	}
+
+	var req raft.InstallSnapshotRequest
+	for first := true; ; first = false {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			if first {
+				return status.Error(codes.InvalidArgument, "raftnet: empty snapshot stream")
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if first {
+			req = raft.InstallSnapshotRequest{
+				Term:              chunk.GetTerm(),
+				LeaderID:          chunk.GetLeaderId(),
+				LastIncludedIndex: chunk.GetLastIncludedIndex(),
+				LastIncludedTerm:  chunk.GetLastIncludedTerm(),
+			}
+			if err := sess.checkPeer(req.LeaderID); err != nil {
+				return status.Error(codes.PermissionDenied, err.Error())
+			}
+		}
+		if len(req.Data)+len(chunk.GetData()) > maxFramePayloadSize {
+			return status.Error(codes.ResourceExhausted, "raftnet: snapshot exceeds limit")
+		}
+		req.Data = append(req.Data, chunk.GetData()...)
+	}
+
+	resp, err := handler.HandleInstallSnapshot(ctx, req)
+	if err != nil {
+		return err
+	}
+	return stream.SendAndClose(&raftv1.InstallSnapshotResponse{Term: resp.Term})
+}
+
+func firstMetadata(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// grpcServerTLSConfig adds the h2 protocol that gRPC negotiates through ALPN
+// to the per-client configs of the shared server config.
+func grpcServerTLSConfig(certs *certReloader) *tls.Config {
+	cfg := certs.serverConfig()
+	getConfig := cfg.GetConfigForClient
+	cfg.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		clientCfg, err := getConfig(hello)
+		if clientCfg != nil {
+			clientCfg.NextProtos = []string{"h2"}
+		}
+		return clientCfg, err
+	}
+	return cfg
+}
+
+type countingListener struct {
+	net.Listener
+	accepted *atomic.Uint64
+}
+
+func (l countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.accepted.Add(1)
+	}
+	return conn, err
+}
+
+type grpcPeerKey struct{}
+
+type grpcMethodKey struct{}
+
+// grpcFrameStats reports sent messages to the frame observer with the peer
+// and message labels of the TCP transport.
+type grpcFrameStats struct {
+	observe FrameObserver
+}
+
+func (h grpcFrameStats) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	return context.WithValue(ctx, grpcMethodKey{}, info.FullMethodName)
+}
+
+func (h grpcFrameStats) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	out, ok := s.(*stats.OutPayload)
+	if !ok {
+		return
+	}
+	method, _ := ctx.Value(grpcMethodKey{}).(string)
+	types, ok := grpcMessageTypes[method]
+	if !ok {
+		return
+	}
+	if out.Client {
+		target, _ := ctx.Value(grpcPeerKey{}).(string)
+		h.observe(target, types[0].String(), out.Length, out.CompressedLength)
+		return
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	h.observe(firstMetadata(md, grpcNodeHeader), types[1].String(), out.Length, out.CompressedLength)
+}
+
+func (grpcFrameStats) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (grpcFrameStats) HandleConn(context.Context, stats.ConnStats) {}
@@ -2,6 +2,8 @@ package transport
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"net"
@@ -19,6 +21,17 @@ var (
 	ErrTransportClosed = errors.New("raftnet: transport closed")
 )
 
+// Endpoint is a raft transport that also serves the local node. Transport
+// and GRPCTransport implement it.
+type Endpoint interface {
+	raft.Transport
+	Start(handler raft.RPCHandler) error
+	Addr() string
+	SetPeer(id string, addr string)
+	ReloadTLS() error
+	Close() error
+}
+
 type Transport struct {
 	id         string
 	listenAddr string
@@ -26,6 +39,7 @@ type Transport struct {
 	peerAddrs  map[string]string
 	peers      map[string]*peerClient
 	handler    raft.RPCHandler
+	options
 	listener   net.Listener
 	conns      map[net.Conn]struct{}
 	wg         sync.WaitGroup
@@ -35,7 +49,7 @@ type Transport struct {
 	requestSeq atomic.Uint64
 }
 
-func New(id string, listenAddr string, peerAddrs map[string]string) (*Transport, error) {
+func New(id string, listenAddr string, peerAddrs map[string]string, opts ...Option) (*Transport, error) {
 	if id == "" {
 		return nil, errors.New("raftnet: node id is empty")
 	}
@@ -48,11 +62,16 @@ func New(id string, listenAddr string, peerAddrs map[string]string) (*Transport,
 			copied[peer] = addr
 		}
 	}
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
 	return &Transport{
 		id:         id,
 		listenAddr: listenAddr,
 		peerAddrs:  copied,
 		peers:      make(map[string]*peerClient),
+		options:    o,
 		conns:      make(map[net.Conn]struct{}),
 		closed:     make(chan struct{}),
 	}, nil
@@ -66,6 +85,9 @@ func (t *Transport) Start(handler raft.RPCHandler) error {
 	if err != nil {
 		return err
 	}
+	if t.tls != nil {
+		listener = tls.NewListener(listener, t.tls.serverConfig())
+	}
 
 	t.mu.Lock()
 	if t.listener != nil {
@@ -94,6 +116,15 @@ func (t *Transport) Addr() string {
 	return t.listenAddr
 }
 
+// ReloadTLS re-reads the certificate files. Changed files are also picked up
+// by the next handshake without calling it.
+func (t *Transport) ReloadTLS() error {
+	if t.tls == nil {
+		return errors.New("raftnet: tls is not enabled")
+	}
+	return t.tls.reload()
+}
+
 func (t *Transport) SetPeer(id string, addr string) {
 	if id == "" || addr == "" {
 		return
@@ -207,24 +238,61 @@ func (t *Transport) acceptLoop(listener net.Listener) {
 }
 
 func (t *Transport) serveConn(conn net.Conn) {
-	for {
+	var peerCert *x509.Certificate
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		_ = conn.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+		if err := tlsConn.Handshake(); err != nil {
+			return
+		}
+		_ = conn.SetDeadline(time.Time{})
+		peerCert = tlsConn.ConnectionState().PeerCertificates[0]
+	}
+
+	sess := session{cert: peerCert, version: legacyProtocolVersion}
+	for first := true; ; first = false {
 		frame, err := readFrame(conn)
 		if err != nil {
 			return
 		}
 
-		responseType, payload, err := t.handleFrame(frame.typ, frame.payload)
+		var responseType messageType
+		var payload []byte
+		replyVersion, replyFeatures, fatal := sess.version, sess.features, false
+		switch {
+		case frame.compressed && sess.features&featureCompression == 0:
+			err = errors.New("raftnet: compressed frame on a connection that did not negotiate compression")
+			fatal = true
+		case frame.traced && sess.features&featureTraceContext == 0:
+			err = errors.New("raftnet: traced frame on a connection that did not negotiate trace context")
+			fatal = true
+		case first && frame.typ == messageHello:
+			var resp helloResponse
+			sess, resp, err = t.acceptHello(peerCert, frame.payload)
+			if err == nil {
+				responseType = messageHelloResponse
+				payload, err = encodeHelloResponse(resp)
+			}
+			replyVersion, replyFeatures, fatal = legacyProtocolVersion, 0, err != nil
+		case first && t.minVersion > legacyProtocolVersion:
+			err = fmt.Errorf("%w: peer sent no hello, version %d or newer is required", ErrHandshake, t.minVersion)
+			fatal = true
+		case frame.version != sess.version:
+			err = fmt.Errorf("raftnet: version %d frame on a version %d connection", frame.version, sess.version)
+			fatal = true
+		default:
+			responseType, payload, err = t.handleFrame(extractTraceContext(frame.trace), sess, frame.typ, frame.payload)
+		}
 		if err != nil {
 			responseType = messageErrorResponse
 			payload, _ = encodeErrorResponse(err)
 		}
-		if err := writeFrame(conn, responseType, frame.id, payload); err != nil {
+		if err := t.writer.write(conn, sess.peerID, replyFeatures, replyVersion, responseType, frame.id, nil, payload); err != nil || fatal {
 			return
 		}
 	}
 }
 
-func (t *Transport) handleFrame(typ messageType, payload []byte) (messageType, []byte, error) {
+func (t *Transport) handleFrame(ctx context.Context, sess session, typ messageType, payload []byte) (messageType, []byte, error) {
 	t.mu.RLock()
 	handler := t.handler
 	t.mu.RUnlock()
@@ -238,7 +306,10 @@ func (t *Transport) handleFrame(typ messageType, payload []byte) (messageType, [
 		if err != nil {
 			return 0, nil, err
 		}
-		resp, err := handler.HandleRequestVote(context.Background(), req)
+		if err := sess.checkPeer(req.CandidateID); err != nil {
+			return 0, nil, err
+		}
+		resp, err := handler.HandleRequestVote(ctx, req)
 		if err != nil {
 			return 0, nil, err
 		}
@@ -249,7 +320,10 @@ func (t *Transport) handleFrame(typ messageType, payload []byte) (messageType, [
 		if err != nil {
 			return 0, nil, err
 		}
-		resp, err := handler.HandleAppendEntries(context.Background(), req)
+		if err := sess.checkPeer(req.LeaderID); err != nil {
+			return 0, nil, err
+		}
+		resp, err := handler.HandleAppendEntries(ctx, req)
 		if err != nil {
 			return 0, nil, err
 		}
@@ -260,7 +334,10 @@ func (t *Transport) handleFrame(typ messageType, payload []byte) (messageType, [
 		if err != nil {
 			return 0, nil, err
 		}
-		resp, err := handler.HandleInstallSnapshot(context.Background(), req)
+		if err := sess.checkPeer(req.LeaderID); err != nil {
+			return 0, nil, err
+		}
+		resp, err := handler.HandleInstallSnapshot(ctx, req)
 		if err != nil {
 			return 0, nil, err
 		}
@@ -311,7 +388,7 @@ func (t *Transport) peerClient(target string) (*peerClient, error) {
 	if peer != nil {
 		old = peer
 	}
-	peer = newPeerClient(addr)
+	peer = newPeerClient(target, addr, t.tls, t.hello(target), t.minVersion <= legacyProtocolVersion, t.writer)
 	t.peers[target] = peer
 	t.mu.Unlock()
 
@@ -338,24 +415,36 @@ func (t *Transport) acceptedConnCount() uint64 {
 }
 
 type peerClient struct {
-	addr   string
-	lanes  []peerConn
-	next   atomic.Uint64
-	mu     sync.RWMutex
-	closed bool
+	id       string
+	addr     string
+	tls      *certReloader
+	hello    helloMessage
+	legacyOK bool
+	writer   frameWriter
+	lanes    []peerConn
+	next     atomic.Uint64
+	mu       sync.RWMutex
+	closed   bool
 }
 
 type peerConn struct {
-	owner  *peerClient
-	mu     sync.Mutex
-	connMu sync.Mutex
-	conn   net.Conn
+	owner    *peerClient
+	mu       sync.Mutex
+	connMu   sync.Mutex
+	conn     net.Conn
+	version  byte
+	features featureSet
 }
 
-func newPeerClient(addr string) *peerClient {
+func newPeerClient(id string, addr string, certs *certReloader, hello helloMessage, legacyOK bool, writer frameWriter) *peerClient {
 	client := &peerClient{
-		addr:  addr,
-		lanes: make([]peerConn, peerConnPoolSize),
+		id:       id,
+		addr:     addr,
+		tls:      certs,
+		hello:    hello,
+		legacyOK: legacyOK,
+		writer:   writer,
+		lanes:    make([]peerConn, peerConnPoolSize),
 	}
 	for i := range client.lanes {
 		client.lanes[i].owner = client
@@ -418,7 +507,7 @@ func (c *peerClient) close() {
 	}
 }
 
-func (c *peerClient) storeConn(lane *peerConn, conn net.Conn) error {
+func (c *peerClient) storeConn(lane *peerConn, conn net.Conn, version byte, features featureSet) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if c.closed {
@@ -427,7 +516,7 @@ func (c *peerClient) storeConn(lane *peerConn, conn net.Conn) error {
 	}
 
 	lane.connMu.Lock()
-	lane.conn = conn
+	lane.conn, lane.version, lane.features = conn, version, features
 	lane.connMu.Unlock()
 	return nil
 }
@@ -437,7 +526,7 @@ func (c *peerConn) callLocked(ctx context.Context, requestType messageType, resp
 		return nil, err
 	}
 
-	conn, err := c.ensureConn(ctx)
+	conn, version, features, err := c.ensureConn(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -448,7 +537,11 @@ func (c *peerConn) callLocked(ctx context.Context, requestType messageType, resp
 		_ = conn.SetDeadline(time.Time{})
 	}
 
-	if err := writeFrame(conn, requestType, id, payload); err != nil {
+	var traceContext []byte
+	if features&featureTraceContext != 0 {
+		traceContext = injectTraceContext(ctx)
+	}
+	if err := c.owner.writer.write(conn, c.owner.id, features, version, requestType, id, traceContext, payload); err != nil {
 		c.failConn(conn)
 		if ctxErr := ctx.Err(); ctxErr != nil {
 			return nil, ctxErr
@@ -468,6 +561,14 @@ func (c *peerConn) callLocked(ctx context.Context, requestType messageType, resp
 		c.failConn(conn)
 		return nil, errors.New("raftnet: response id mismatch")
 	}
+	if frame.version != version {
+		c.failConn(conn)
+		return nil, fmt.Errorf("raftnet: version %d response on a version %d connection", frame.version, version)
+	}
+	if frame.compressed && features&featureCompression == 0 {
+		c.failConn(conn)
+		return nil, errors.New("raftnet: compressed response on a connection that did not negotiate compression")
+	}
 	if frame.typ == messageErrorResponse {
 		message, err := decodeErrorResponse(frame.payload)
 		if err != nil {
@@ -481,23 +582,39 @@ func (c *peerConn) callLocked(ctx context.Context, requestType messageType, resp
 	return frame.payload, nil
 }
 
-func (c *peerConn) ensureConn(ctx context.Context) (net.Conn, error) {
+func (c *peerConn) ensureConn(ctx context.Context) (net.Conn, byte, featureSet, error) {
 	c.connMu.Lock()
-	conn := c.conn
+	conn, version, features := c.conn, c.version, c.features
 	c.connMu.Unlock()
 	if conn != nil {
-		return conn, nil
+		return conn, version, features, nil
 	}
 
 	dialer := net.Dialer{}
 	conn, err := dialer.DialContext(ctx, "tcp", c.owner.addr)
 	if err != nil {
-		return nil, err
+		return nil, 0, 0, err
 	}
-	if err := c.owner.storeConn(c, conn); err != nil {
-		return nil, err
+	if c.owner.tls != nil {
+		tlsConn := tls.Client(conn, c.owner.tls.clientConfig(c.owner.id))
+		handshakeCtx, cancel := context.WithTimeout(ctx, tlsHandshakeTimeout)
+		err := tlsConn.HandshakeContext(handshakeCtx)
+		cancel()
+		if err != nil {
+			_ = conn.Close()
+			return nil, 0, 0, fmt.Errorf("raftnet: tls handshake with %s: %w", c.owner.id, err)
+		}
+		conn = tlsConn
+	}
+	version, features, err = c.owner.handshake(ctx, conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, 0, 0, err
+	}
+	if err := c.owner.storeConn(c, conn, version, features); err != nil {
+		return nil, 0, 0, err
 	}
-	return conn, nil
+	return conn, version, features, nil
 }
 
 func (c *peerConn) failConn(conn net.Conn) {
@@ -82,7 +82,7 @@ func BenchmarkTransportInstallSnapshot(b *testing.B) {
 
 	req := raft.InstallSnapshotRequest{
 		Term:              7,
-		LeaderID:          "node1",
+		LeaderID:          "node2",
 		LastIncludedIndex: 4096,
 		LastIncludedTerm:  6,
 		Data:              make([]byte, 64*1024),
@@ -137,7 +137,7 @@ func benchmarkAppendEntriesRequest() raft.AppendEntriesRequest {
 	}
 	return raft.AppendEntriesRequest{
 		Term:         7,
-		LeaderID:     "node1",
+		LeaderID:     "node2",
 		PrevLogIndex: 4096,
 		PrevLogTerm:  6,
 		Entries:      entries,
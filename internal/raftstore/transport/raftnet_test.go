@@ -3,266 +3,737 @@ package transport
 import (
 	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+
+	"mini-kv/internal/config"
 	"mini-kv/internal/raft"
 	"mini-kv/internal/raft/logstore"
+	"mini-kv/internal/tracing"
 )
 
 func TestRoundTrip(t *testing.T) {
-	handler := &stubHandler{}
-	server, err := New("node1", "127.0.0.1:0", nil)
-	if err != nil {
-		t.Fatalf("new server transport: %v", err)
-	}
-	if err := server.Start(handler); err != nil {
-		t.Fatalf("start server transport: %v", err)
-	}
-	defer server.Close()
+	forEachTransport(t, func(t *testing.T, newTransport newTransportFunc) {
+		handler := &stubHandler{}
+		server, err := newTransport("node1", "127.0.0.1:0", nil)
+		if err != nil {
+			t.Fatalf("new server transport: %v", err)
+		}
+		if err := server.Start(handler); err != nil {
+			t.Fatalf("start server transport: %v", err)
+		}
+		defer server.Close()
 
-	client, err := New("node2", "127.0.0.1:0", map[string]string{
-		"node1": server.Addr(),
-	})
-	if err != nil {
-		t.Fatalf("new client transport: %v", err)
-	}
+		client, err := newTransport("node2", "127.0.0.1:0", map[string]string{
+			"node1": server.Addr(),
+		})
+		if err != nil {
+			t.Fatalf("new client transport: %v", err)
+		}
 
-	resp, err := client.RequestVote(context.Background(), "node1", raft.RequestVoteRequest{
-		Term:        3,
-		CandidateID: "node2",
+		resp, err := client.RequestVote(context.Background(), "node1", raft.RequestVoteRequest{
+			Term:        3,
+			CandidateID: "node2",
+		})
+		if err != nil {
+			t.Fatalf("request vote: %v", err)
+		}
+		if resp.Term != 3 || !resp.VoteGranted {
+			t.Fatalf("vote resp = %+v", resp)
+		}
 	})
-	if err != nil {
-		t.Fatalf("request vote: %v", err)
-	}
-	if resp.Term != 3 || !resp.VoteGranted {
-		t.Fatalf("vote resp = %+v", resp)
-	}
 }
 
 func TestAppendEntriesReusesConnection(t *testing.T) {
-	handler := &stubHandler{}
-	server, err := New("node1", "127.0.0.1:0", nil)
+	forEachTransport(t, func(t *testing.T, newTransport newTransportFunc) {
+		handler := &stubHandler{}
+		server, err := newTransport("node1", "127.0.0.1:0", nil)
+		if err != nil {
+			t.Fatalf("new server transport: %v", err)
+		}
+		if err := server.Start(handler); err != nil {
+			t.Fatalf("start server transport: %v", err)
+		}
+		defer server.Close()
+
+		client, err := newTransport("node2", "127.0.0.1:0", map[string]string{
+			"node1": server.Addr(),
+		})
+		if err != nil {
+			t.Fatalf("new client transport: %v", err)
+		}
+		defer client.Close()
+
+		for i := 0; i < 10; i++ {
+			resp, err := client.AppendEntries(context.Background(), "node1", raft.AppendEntriesRequest{
+				Term:     uint64(i + 1),
+				LeaderID: "node2",
+			})
+			if err != nil {
+				t.Fatalf("append entries %d: %v", i, err)
+			}
+			if resp.Term != uint64(i+1) || !resp.Success {
+				t.Fatalf("append response %d = %+v", i, resp)
+			}
+		}
+		if accepted := server.acceptedConnCount(); accepted != 1 {
+			t.Fatalf("accepted connections = %d, want 1", accepted)
+		}
+	})
+}
+
+func TestConcurrentAppendEntries(t *testing.T) {
+	forEachTransport(t, func(t *testing.T, newTransport newTransportFunc) {
+		handler := &stubHandler{}
+		server, err := newTransport("node1", "127.0.0.1:0", nil)
+		if err != nil {
+			t.Fatalf("new server transport: %v", err)
+		}
+		if err := server.Start(handler); err != nil {
+			t.Fatalf("start server transport: %v", err)
+		}
+		defer server.Close()
+
+		client, err := newTransport("node2", "127.0.0.1:0", map[string]string{
+			"node1": server.Addr(),
+		})
+		if err != nil {
+			t.Fatalf("new client transport: %v", err)
+		}
+		defer client.Close()
+
+		const goroutines = 16
+		const callsPerGoroutine = 20
+		errCh := make(chan error, goroutines*callsPerGoroutine)
+		var wg sync.WaitGroup
+		wg.Add(goroutines)
+		for i := 0; i < goroutines; i++ {
+			go func(id int) {
+				defer wg.Done()
+				for j := 0; j < callsPerGoroutine; j++ {
+					term := uint64(id*callsPerGoroutine + j + 1)
+					resp, err := client.AppendEntries(context.Background(), "node1", raft.AppendEntriesRequest{
+						Term:     term,
+						LeaderID: "node2",
+					})
+					if err != nil {
+						errCh <- err
+						continue
+					}
+					if resp.Term != term || !resp.Success {
+						errCh <- errors.New("unexpected append response")
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+		close(errCh)
+
+		for err := range errCh {
+			if err != nil {
+				t.Fatalf("append entries: %v", err)
+			}
+		}
+		if accepted := server.acceptedConnCount(); accepted == 0 || accepted > peerConnPoolSize {
+			t.Fatalf("accepted connections = %d, want 1..%d", accepted, peerConnPoolSize)
+		}
+	})
+}
+
+func TestSetPeerClosesOldConnection(t *testing.T) {
+	forEachTransport(t, func(t *testing.T, newTransport newTransportFunc) {
+		first, err := newTransport("node1", "127.0.0.1:0", nil)
+		if err != nil {
+			t.Fatalf("new first server: %v", err)
+		}
+		if err := first.Start(&termHandler{term: 11}); err != nil {
+			t.Fatalf("start first server: %v", err)
+		}
+		defer first.Close()
+
+		second, err := newTransport("node1", "127.0.0.1:0", nil)
+		if err != nil {
+			t.Fatalf("new second server: %v", err)
+		}
+		if err := second.Start(&termHandler{term: 22}); err != nil {
+			t.Fatalf("start second server: %v", err)
+		}
+		defer second.Close()
+
+		client, err := newTransport("node2", "127.0.0.1:0", map[string]string{
+			"node1": first.Addr(),
+		})
+		if err != nil {
+			t.Fatalf("new client transport: %v", err)
+		}
+		defer client.Close()
+
+		resp, err := client.RequestVote(context.Background(), "node1", raft.RequestVoteRequest{CandidateID: "node2"})
+		if err != nil {
+			t.Fatalf("request vote first: %v", err)
+		}
+		if resp.Term != 11 {
+			t.Fatalf("first response term = %d, want 11", resp.Term)
+		}
+
+		client.SetPeer("node1", second.Addr())
+		resp, err = client.RequestVote(context.Background(), "node1", raft.RequestVoteRequest{CandidateID: "node2"})
+		if err != nil {
+			t.Fatalf("request vote second: %v", err)
+		}
+		if resp.Term != 22 {
+			t.Fatalf("second response term = %d, want 22", resp.Term)
+		}
+	})
+}
+
+func TestCloseRejectsNewCalls(t *testing.T) {
+	forEachTransport(t, func(t *testing.T, newTransport newTransportFunc) {
+		client, err := newTransport("node2", "127.0.0.1:0", map[string]string{
+			"node1": "127.0.0.1:1",
+		})
+		if err != nil {
+			t.Fatalf("new client transport: %v", err)
+		}
+		if err := client.Close(); err != nil {
+			t.Fatalf("close client: %v", err)
+		}
+		_, err = client.AppendEntries(context.Background(), "node1", raft.AppendEntriesRequest{})
+		if !errors.Is(err, ErrTransportClosed) {
+			t.Fatalf("append after close error = %v, want %v", err, ErrTransportClosed)
+		}
+	})
+}
+
+func TestMutualTLSRoundTrip(t *testing.T) {
+	forEachTransport(t, func(t *testing.T, newTransport newTransportFunc) {
+		ca := newTestCA(t)
+		server, err := newTransport("node1", "127.0.0.1:0", nil, WithTLS(ca.issue(t, "node1")))
+		if err != nil {
+			t.Fatalf("new server transport: %v", err)
+		}
+		if err := server.Start(&stubHandler{}); err != nil {
+			t.Fatalf("start server transport: %v", err)
+		}
+		defer server.Close()
+
+		client, err := newTransport("node2", "127.0.0.1:0", map[string]string{"node1": server.Addr()}, WithTLS(ca.issue(t, "node2")))
+		if err != nil {
+			t.Fatalf("new client transport: %v", err)
+		}
+		defer client.Close()
+		resp, err := client.RequestVote(context.Background(), "node1", raft.RequestVoteRequest{Term: 2, CandidateID: "node2"})
+		if err != nil {
+			t.Fatalf("request vote over tls: %v", err)
+		}
+		if resp.Term != 2 || !resp.VoteGranted {
+			t.Fatalf("vote resp = %+v", resp)
+		}
+
+		_, err = client.AppendEntries(context.Background(), "node1", raft.AppendEntriesRequest{Term: 2, LeaderID: "node3"})
+		if err == nil || !strings.Contains(err.Error(), "identity mismatch") {
+			t.Fatalf("spoofed leader error = %v, want identity mismatch", err)
+		}
+
+		plain, err := newTransport("node2", "127.0.0.1:0", map[string]string{"node1": server.Addr()})
+		if err != nil {
+			t.Fatalf("new plaintext transport: %v", err)
+		}
+		defer plain.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if _, err := plain.RequestVote(ctx, "node1", raft.RequestVoteRequest{CandidateID: "node2"}); err == nil {
+			t.Fatal("plaintext client reached tls server")
+		}
+
+		impostor, err := newTransport("node2", "127.0.0.1:0", map[string]string{"node3": server.Addr()}, WithTLS(ca.issue(t, "node2")))
+		if err != nil {
+			t.Fatalf("new impostor transport: %v", err)
+		}
+		defer impostor.Close()
+		if _, err := impostor.RequestVote(context.Background(), "node3", raft.RequestVoteRequest{CandidateID: "node2"}); !errors.Is(err, ErrPeerIdentity) {
+			t.Fatalf("dial wrong identity error = %v, want %v", err, ErrPeerIdentity)
+		}
+	})
+}
+
+func TestTLSReloadsRotatedCertificate(t *testing.T) {
+	forEachTransport(t, func(t *testing.T, newTransport newTransportFunc) {
+		ca := newTestCA(t)
+		server, err := newTransport("node1", "127.0.0.1:0", nil, WithTLS(ca.issue(t, "node1")))
+		if err != nil {
+			t.Fatalf("new server transport: %v", err)
+		}
+		if err := server.Start(&stubHandler{}); err != nil {
+			t.Fatalf("start server transport: %v", err)
+		}
+		defer server.Close()
+
+		clientFiles := newTestCA(t).issue(t, "node2")
+		client, err := newTransport("node2", "127.0.0.1:0", map[string]string{"node1": server.Addr()}, WithTLS(clientFiles))
+		if err != nil {
+			t.Fatalf("new client transport: %v", err)
+		}
+		defer client.Close()
+		if _, err := client.RequestVote(context.Background(), "node1", raft.RequestVoteRequest{CandidateID: "node2"}); err == nil {
+			t.Fatal("untrusted client certificate accepted")
+		}
+
+		rotated := ca.issue(t, "node2")
+		for _, pair := range [][2]string{
+			{rotated.CertFile, clientFiles.CertFile},
+			{rotated.KeyFile, clientFiles.KeyFile},
+			{rotated.CAFile, clientFiles.CAFile},
+		} {
+			data, err := os.ReadFile(pair[0])
+			if err != nil {
+				t.Fatalf("read rotated file: %v", err)
+			}
+			if err := os.WriteFile(pair[1], data, 0o600); err != nil {
+				t.Fatalf("rotate file: %v", err)
+			}
+			future := time.Now().Add(time.Minute)
+			if err := os.Chtimes(pair[1], future, future); err != nil {
+				t.Fatalf("touch rotated file: %v", err)
+			}
+		}
+		if _, err := client.RequestVote(context.Background(), "node1", raft.RequestVoteRequest{CandidateID: "node2"}); err != nil {
+			t.Fatalf("request vote after rotation: %v", err)
+		}
+		if err := client.ReloadTLS(); err != nil {
+			t.Fatalf("explicit reload: %v", err)
+		}
+	})
+}
+
+func TestHandshakeRejectsMismatchedPeers(t *testing.T) {
+	forEachTransport(t, func(t *testing.T, newTransport newTransportFunc) {
+		server, err := newTransport("node1", "127.0.0.1:0", nil, WithClusterID("alpha"))
+		if err != nil {
+			t.Fatalf("new server transport: %v", err)
+		}
+		if err := server.Start(&termHandler{term: 3}); err != nil {
+			t.Fatalf("start server transport: %v", err)
+		}
+		defer server.Close()
+
+		member, err := newTransport("node2", "127.0.0.1:0", map[string]string{"node1": server.Addr()}, WithClusterID("alpha"))
+		if err != nil {
+			t.Fatalf("new member transport: %v", err)
+		}
+		defer member.Close()
+		resp, err := member.RequestVote(context.Background(), "node1", raft.RequestVoteRequest{CandidateID: "node2"})
+		if err != nil {
+			t.Fatalf("member request vote: %v", err)
+		}
+		if resp.Term != 3 {
+			t.Fatalf("member response term = %d, want 3", resp.Term)
+		}
+		if tcp, ok := member.(*Transport); ok {
+			if lane := &tcp.peers["node1"].lanes[0]; lane.version != maxProtocolVersion {
+				t.Fatalf("negotiated version = %d, want %d", lane.version, maxProtocolVersion)
+			}
+		}
+
+		stranger, err := newTransport("node2", "127.0.0.1:0", map[string]string{"node1": server.Addr()}, WithClusterID("beta"))
+		if err != nil {
+			t.Fatalf("new stranger transport: %v", err)
+		}
+		defer stranger.Close()
+		_, err = stranger.RequestVote(context.Background(), "node1", raft.RequestVoteRequest{CandidateID: "node2"})
+		if !errors.Is(err, ErrHandshake) || !strings.Contains(err.Error(), `cluster "beta"`) {
+			t.Fatalf("foreign cluster error = %v, want %v naming the cluster", err, ErrHandshake)
+		}
+
+		misrouted, err := newTransport("node2", "127.0.0.1:0", map[string]string{"node3": server.Addr()}, WithClusterID("alpha"))
+		if err != nil {
+			t.Fatalf("new misrouted transport: %v", err)
+		}
+		defer misrouted.Close()
+		_, err = misrouted.RequestVote(context.Background(), "node3", raft.RequestVoteRequest{CandidateID: "node2"})
+		if !errors.Is(err, ErrHandshake) || !strings.Contains(err.Error(), `reached "node1"`) {
+			t.Fatalf("misrouted error = %v, want %v naming the reached node", err, ErrHandshake)
+		}
+
+		_, err = member.AppendEntries(context.Background(), "node1", raft.AppendEntriesRequest{LeaderID: "node4"})
+		if err == nil || !strings.Contains(err.Error(), ErrPeerIdentity.Error()) {
+			t.Fatalf("spoofed leader error = %v, want identity mismatch", err)
+		}
+	})
+}
+
+func TestHandshakeFallsBackForLegacyPeers(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
-		t.Fatalf("new server transport: %v", err)
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					frame, err := readFrame(conn)
+					if err != nil || frame.version != legacyProtocolVersion {
+						return
+					}
+					typ, payload := messageRequestVoteResponse, []byte(nil)
+					if frame.typ == messageHello {
+						typ = messageErrorResponse
+						payload, _ = encodeErrorResponse(fmt.Errorf("raftnet: unknown message type %d", frame.typ))
+					} else {
+						payload, _ = encodeRequestVoteResponse(raft.RequestVoteResponse{Term: 5})
+					}
+					if err := writeFrame(conn, legacyProtocolVersion, typ, frame.id, payload); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	strict, err := New("node2", "127.0.0.1:0", map[string]string{"node1": listener.Addr().String()}, WithMinProtocolVersion(2))
+	if err != nil {
+		t.Fatalf("new strict transport: %v", err)
 	}
-	if err := server.Start(handler); err != nil {
-		t.Fatalf("start server transport: %v", err)
+	defer strict.Close()
+	if _, err := strict.RequestVote(context.Background(), "node1", raft.RequestVoteRequest{CandidateID: "node2"}); !errors.Is(err, ErrHandshake) {
+		t.Fatalf("strict request vote error = %v, want %v", err, ErrHandshake)
 	}
-	defer server.Close()
 
-	client, err := New("node2", "127.0.0.1:0", map[string]string{
-		"node1": server.Addr(),
-	})
+	client, err := New("node2", "127.0.0.1:0", map[string]string{"node1": listener.Addr().String()})
 	if err != nil {
 		t.Fatalf("new client transport: %v", err)
 	}
 	defer client.Close()
+	resp, err := client.RequestVote(context.Background(), "node1", raft.RequestVoteRequest{CandidateID: "node2"})
+	if err != nil {
+		t.Fatalf("legacy request vote: %v", err)
+	}
+	if resp.Term != 5 {
+		t.Fatalf("legacy response term = %d, want 5", resp.Term)
+	}
 
-	for i := 0; i < 10; i++ {
-		resp, err := client.AppendEntries(context.Background(), "node1", raft.AppendEntriesRequest{
-			Term:     uint64(i + 1),
-			LeaderID: "node2",
-		})
+	for _, minVersion := range []byte{0, 2} {
+		server, err := New("node1", "127.0.0.1:0", nil, WithMinProtocolVersion(minVersion))
 		if err != nil {
-			t.Fatalf("append entries %d: %v", i, err)
+			t.Fatalf("new server transport: %v", err)
 		}
-		if resp.Term != uint64(i+1) || !resp.Success {
-			t.Fatalf("append response %d = %+v", i, resp)
+		if err := server.Start(&termHandler{term: 9}); err != nil {
+			t.Fatalf("start server transport: %v", err)
 		}
-	}
-	if accepted := server.acceptedConnCount(); accepted != 1 {
-		t.Fatalf("accepted connections = %d, want 1", accepted)
+		conn, err := net.Dial("tcp", server.Addr())
+		if err != nil {
+			t.Fatalf("dial server: %v", err)
+		}
+		payload, _ := encodeRequestVoteRequest(raft.RequestVoteRequest{CandidateID: "node2"})
+		if err := writeFrame(conn, legacyProtocolVersion, messageRequestVote, 1, payload); err != nil {
+			t.Fatalf("write legacy frame: %v", err)
+		}
+		frame, err := readFrame(conn)
+		if err != nil {
+			t.Fatalf("read legacy response: %v", err)
+		}
+		want := messageRequestVoteResponse
+		if minVersion > legacyProtocolVersion {
+			want = messageErrorResponse
+		}
+		if frame.typ != want {
+			t.Fatalf("min version %d: legacy response type = %d, want %d", minVersion, frame.typ, want)
+		}
+		_ = conn.Close()
+		_ = server.Close()
 	}
 }
 
-func TestConcurrentAppendEntries(t *testing.T) {
-	handler := &stubHandler{}
-	server, err := New("node1", "127.0.0.1:0", nil)
+func TestCompressionNegotiatedPerConnection(t *testing.T) {
+	serverFrames := &frameRecorder{}
+	server, err := New("node1", "127.0.0.1:0", nil, WithCompression(256), WithFrameObserver(serverFrames.observe))
 	if err != nil {
 		t.Fatalf("new server transport: %v", err)
 	}
-	if err := server.Start(handler); err != nil {
+	if err := server.Start(&stubHandler{}); err != nil {
 		t.Fatalf("start server transport: %v", err)
 	}
 	defer server.Close()
 
-	client, err := New("node2", "127.0.0.1:0", map[string]string{
-		"node1": server.Addr(),
-	})
-	if err != nil {
-		t.Fatalf("new client transport: %v", err)
-	}
-	defer client.Close()
-
-	const goroutines = 16
-	const callsPerGoroutine = 20
-	errCh := make(chan error, goroutines*callsPerGoroutine)
-	var wg sync.WaitGroup
-	wg.Add(goroutines)
-	for i := 0; i < goroutines; i++ {
-		go func(id int) {
-			defer wg.Done()
-			for j := 0; j < callsPerGoroutine; j++ {
-				term := uint64(id*callsPerGoroutine + j + 1)
-				resp, err := client.AppendEntries(context.Background(), "node1", raft.AppendEntriesRequest{
-					Term:     term,
-					LeaderID: "node2",
-				})
-				if err != nil {
-					errCh <- err
-					continue
-				}
-				if resp.Term != term || !resp.Success {
-					errCh <- errors.New("unexpected append response")
-				}
-			}
-		}(i)
+	req := raft.AppendEntriesRequest{
+		Term:     2,
+		LeaderID: "node2",
+		Entries:  []raft.LogEntry{{Index: 1, Term: 2, Type: raft.EntryNormal, Data: bytes.Repeat([]byte("value-"), 1000)}},
 	}
-	wg.Wait()
-	close(errCh)
-
-	for err := range errCh {
+	for _, compress := range []bool{true, false} {
+		frames := &frameRecorder{}
+		opts := []Option{WithFrameObserver(frames.observe)}
+		if compress {
+			opts = append(opts, WithCompression(256))
+		}
+		client, err := New("node2", "127.0.0.1:0", map[string]string{"node1": server.Addr()}, opts...)
 		if err != nil {
-			t.Fatalf("append entries: %v", err)
+			t.Fatalf("new client transport: %v", err)
+		}
+		if _, err := client.AppendEntries(context.Background(), "node1", req); err != nil {
+			t.Fatalf("compress=%v append entries: %v", compress, err)
+		}
+		if _, err := client.RequestVote(context.Background(), "node1", raft.RequestVoteRequest{CandidateID: "node2"}); err != nil {
+			t.Fatalf("compress=%v request vote: %v", compress, err)
 		}
+		if got := client.peers["node1"].lanes[0].features&featureCompression != 0; got != compress {
+			t.Fatalf("compress=%v: negotiated compression = %v", compress, got)
+		}
+
+		raw, wire := frames.get("node1", "append_entries")
+		if compress && wire >= raw/10 {
+			t.Fatalf("compressed append entries sent %d of %d bytes", wire, raw)
+		}
+		if !compress && wire != raw {
+			t.Fatalf("uncompressed append entries sent %d of %d bytes", wire, raw)
+		}
+		if raw, wire := frames.get("node1", "request_vote"); raw == 0 || wire != raw {
+			t.Fatalf("request vote below threshold sent %d of %d bytes", wire, raw)
+		}
+		_ = client.Close()
 	}
-	if accepted := server.acceptedConnCount(); accepted == 0 || accepted > peerConnPoolSize {
-		t.Fatalf("accepted connections = %d, want 1..%d", accepted, peerConnPoolSize)
+	if raw, wire := serverFrames.get("node2", "append_entries_response"); raw == 0 || wire != raw {
+		t.Fatalf("server append response sent %d of %d bytes", wire, raw)
 	}
-}
 
-func TestSetPeerClosesOldConnection(t *testing.T) {
-	first, err := New("node1", "127.0.0.1:0", nil)
+	conn, err := net.Dial("tcp", server.Addr())
 	if err != nil {
-		t.Fatalf("new first server: %v", err)
+		t.Fatalf("dial server: %v", err)
 	}
-	if err := first.Start(&termHandler{term: 11}); err != nil {
-		t.Fatalf("start first server: %v", err)
+	defer conn.Close()
+	payload, _ := encodeAppendEntriesRequest(req)
+	compressed, ok := compressPayload(payload)
+	if !ok {
+		t.Fatal("append entries payload did not compress")
 	}
-	defer first.Close()
-
-	second, err := New("node3", "127.0.0.1:0", nil)
+	if err := writeFrameFlags(conn, legacyProtocolVersion, messageAppendEntries, frameFlagCompressed, 1, compressed); err != nil {
+		t.Fatalf("write compressed frame: %v", err)
+	}
+	frame, err := readFrame(conn)
 	if err != nil {
-		t.Fatalf("new second server: %v", err)
+		t.Fatalf("read response: %v", err)
 	}
-	if err := second.Start(&termHandler{term: 22}); err != nil {
-		t.Fatalf("start second server: %v", err)
+	if frame.typ != messageErrorResponse {
+		t.Fatalf("compressed frame without negotiation got response type %d, want error", frame.typ)
 	}
-	defer second.Close()
+}
 
-	client, err := New("node2", "127.0.0.1:0", map[string]string{
-		"node1": first.Addr(),
-	})
+func TestTraceContextPropagates(t *testing.T) {
+	// Tracers bind to the first global provider, so every run shares one.
+	provider, err := memoryTracing()
 	if err != nil {
-		t.Fatalf("new client transport: %v", err)
+		t.Fatalf("setup tracing: %v", err)
 	}
-	defer client.Close()
+	provider.Reset()
+
+	forEachTransport(t, func(t *testing.T, newTransport newTransportFunc) {
+		handler := &traceHandler{}
+		server, err := newTransport("node1", "127.0.0.1:0", nil, WithCompression(64))
+		if err != nil {
+			t.Fatalf("new server transport: %v", err)
+		}
+		if err := server.Start(handler); err != nil {
+			t.Fatalf("start server transport: %v", err)
+		}
+		defer server.Close()
+
+		client, err := newTransport("node2", "127.0.0.1:0", map[string]string{"node1": server.Addr()}, WithCompression(64))
+		if err != nil {
+			t.Fatalf("new client transport: %v", err)
+		}
+		defer client.Close()
+
+		ctx, span := otel.Tracer("test").Start(context.Background(), "replicate")
+		defer span.End()
+		req := raft.AppendEntriesRequest{
+			Term:     1,
+			LeaderID: "node2",
+			Entries:  []raft.LogEntry{{Index: 1, Term: 1, Type: raft.EntryNormal, Data: bytes.Repeat([]byte("traced-"), 100)}},
+		}
+		if _, err := client.AppendEntries(ctx, "node1", req); err != nil {
+			t.Fatalf("traced append entries: %v", err)
+		}
+		got := handler.last()
+		if !got.IsRemote() || got.TraceID() != span.SpanContext().TraceID() || got.SpanID() != span.SpanContext().SpanID() {
+			t.Fatalf("handler span context = %+v, want remote child of %+v", got, span.SpanContext())
+		}
+
+		if _, err := client.AppendEntries(context.Background(), "node1", req); err != nil {
+			t.Fatalf("untraced append entries: %v", err)
+		}
+		if got := handler.last(); got.IsValid() {
+			t.Fatalf("untraced call delivered span context %+v", got)
+		}
+	})
+}
 
-	resp, err := client.RequestVote(context.Background(), "node1", raft.RequestVoteRequest{})
+var memoryTracing = sync.OnceValues(func() (*tracing.Provider, error) {
+	return tracing.Setup(context.Background(), config.TracingConfig{Exporter: "memory", SampleRatio: 1}, "node2")
+})
+
+func TestGRPCStreamsSnapshotInChunks(t *testing.T) {
+	handler := &snapshotHandler{}
+	server, err := NewGRPC("node1", "127.0.0.1:0", nil, WithCompression(0))
 	if err != nil {
-		t.Fatalf("request vote first: %v", err)
+		t.Fatalf("new server transport: %v", err)
 	}
-	if resp.Term != 11 {
-		t.Fatalf("first response term = %d, want 11", resp.Term)
+	if err := server.Start(handler); err != nil {
+		t.Fatalf("start server transport: %v", err)
 	}
+	defer server.Close()
 
-	client.SetPeer("node1", second.Addr())
-	resp, err = client.RequestVote(context.Background(), "node1", raft.RequestVoteRequest{})
+	frames := &frameRecorder{}
+	client, err := NewGRPC("node2", "127.0.0.1:0", map[string]string{"node1": server.Addr()}, WithCompression(0), WithFrameObserver(frames.observe))
 	if err != nil {
-		t.Fatalf("request vote second: %v", err)
-	}
-	if resp.Term != 22 {
-		t.Fatalf("second response term = %d, want 22", resp.Term)
+		t.Fatalf("new client transport: %v", err)
 	}
-}
+	defer client.Close()
 
-func TestCloseRejectsNewCalls(t *testing.T) {
-	client, err := New("node2", "127.0.0.1:0", map[string]string{
-		"node1": "127.0.0.1:1",
-	})
+	req := raft.InstallSnapshotRequest{
+		Term:              4,
+		LeaderID:          "node2",
+		LastIncludedIndex: 30,
+		LastIncludedTerm:  3,
+		Data:              bytes.Repeat([]byte("snapshot-"), grpcSnapshotChunkSize/3),
+	}
+	resp, err := client.InstallSnapshot(context.Background(), "node1", req)
 	if err != nil {
-		t.Fatalf("new client transport: %v", err)
+		t.Fatalf("install snapshot: %v", err)
 	}
-	if err := client.Close(); err != nil {
-		t.Fatalf("close client: %v", err)
+	if resp.Term != 4 {
+		t.Fatalf("install snapshot term = %d, want 4", resp.Term)
 	}
-	_, err = client.AppendEntries(context.Background(), "node1", raft.AppendEntriesRequest{})
-	if !errors.Is(err, ErrTransportClosed) {
-		t.Fatalf("append after close error = %v, want %v", err, ErrTransportClosed)
+	got := handler.last()
+	if got.LeaderID != req.LeaderID || got.LastIncludedIndex != req.LastIncludedIndex || got.LastIncludedTerm != req.LastIncludedTerm || !bytes.Equal(got.Data, req.Data) {
+		t.Fatalf("snapshot received = index %d term %d, %d bytes; want index %d term %d, %d bytes",
+			got.LastIncludedIndex, got.LastIncludedTerm, len(got.Data), req.LastIncludedIndex, req.LastIncludedTerm, len(req.Data))
+	}
+	if raw, wire := frames.get("node1", "install_snapshot"); raw < len(req.Data) || wire >= raw/10 {
+		t.Fatalf("compressed snapshot sent %d of %d bytes", wire, raw)
 	}
 }
 
 func TestCluster(t *testing.T) {
-	ids := []string{"node1", "node2", "node3"}
-	transports := make(map[string]*Transport, len(ids))
-	nodes := make(map[string]raft.Node, len(ids))
-
-	for _, id := range ids {
-		tr, err := New(id, "127.0.0.1:0", nil)
-		if err != nil {
-			t.Fatalf("new transport %s: %v", id, err)
+	forEachTransport(t, func(t *testing.T, newTransport newTransportFunc) {
+		ids := []string{"node1", "node2", "node3"}
+		transports := make(map[string]testTransport, len(ids))
+		nodes := make(map[string]raft.Node, len(ids))
+
+		for _, id := range ids {
+			tr, err := newTransport(id, "127.0.0.1:0", nil)
+			if err != nil {
+				t.Fatalf("new transport %s: %v", id, err)
+			}
+			transports[id] = tr
 		}
-		transports[id] = tr
-	}
 
-	for _, id := range ids {
-		node, err := raft.NewNode(raft.Config{
-			ID:               id,
-			Peers:            ids,
-			Storage:          logstore.NewMemoryStorage(),
-			Transport:        transports[id],
-			ElectionTimeout:  80 * time.Millisecond,
-			HeartbeatTimeout: 20 * time.Millisecond,
-			ApplyBufferSize:  16,
-		})
-		if err != nil {
-			t.Fatalf("new node %s: %v", id, err)
+		for _, id := range ids {
+			node, err := raft.NewNode(raft.Config{
+				ID:               id,
+				Peers:            ids,
+				Storage:          logstore.NewMemoryStorage(),
+				Transport:        transports[id],
+				ElectionTimeout:  80 * time.Millisecond,
+				HeartbeatTimeout: 20 * time.Millisecond,
+				ApplyBufferSize:  16,
+			})
+			if err != nil {
+				t.Fatalf("new node %s: %v", id, err)
+			}
+			handler := node.(raft.RPCHandler)
+			if err := transports[id].Start(handler); err != nil {
+				t.Fatalf("start transport %s: %v", id, err)
+			}
+			nodes[id] = node
 		}
-		handler := node.(raft.RPCHandler)
-		if err := transports[id].Start(handler); err != nil {
-			t.Fatalf("start transport %s: %v", id, err)
+
+		for _, tr := range transports {
+			for peer, peerTr := range transports {
+				tr.SetPeer(peer, peerTr.Addr())
+			}
 		}
-		nodes[id] = node
-	}
 
-	for _, tr := range transports {
-		for peer, peerTr := range transports {
-			tr.SetPeer(peer, peerTr.Addr())
+		for _, node := range nodes {
+			if err := node.Start(); err != nil {
+				t.Fatalf("start node: %v", err)
+			}
 		}
-	}
+		defer func() {
+			for _, node := range nodes {
+				_ = node.Stop()
+			}
+			for _, tr := range transports {
+				_ = tr.Close()
+			}
+		}()
 
-	for _, node := range nodes {
-		if err := node.Start(); err != nil {
-			t.Fatalf("start node: %v", err)
+		leaderID := waitLead(t, nodes, 2*time.Second)
+		index, err := nodes[leaderID].Propose(context.Background(), []byte("net-cmd"))
+		if err != nil {
+			t.Fatalf("propose: %v", err)
 		}
-	}
-	defer func() {
-		for _, node := range nodes {
-			_ = node.Stop()
+		if index == 0 {
+			t.Fatalf("index should be non-zero")
 		}
-		for _, tr := range transports {
-			_ = tr.Close()
+
+		for id, node := range nodes {
+			msg := waitMsg(t, node.ApplyCh(), []byte("net-cmd"), 2*time.Second)
+			if msg.Index != index {
+				t.Fatalf("node=%s index=%d want=%d", id, msg.Index, index)
+			}
 		}
-	}()
+	})
+}
 
-	leaderID := waitLead(t, nodes, 2*time.Second)
-	index, err := nodes[leaderID].Propose(context.Background(), []byte("net-cmd"))
-	if err != nil {
-		t.Fatalf("propose: %v", err)
-	}
-	if index == 0 {
-		t.Fatalf("index should be non-zero")
-	}
+type testTransport interface {
+	Endpoint
+	acceptedConnCount() uint64
+}
 
-	for id, node := range nodes {
-		msg := waitMsg(t, node.ApplyCh(), []byte("net-cmd"), 2*time.Second)
-		if msg.Index != index {
-			t.Fatalf("node=%s index=%d want=%d", id, msg.Index, index)
-		}
-	}
+type newTransportFunc func(id string, listenAddr string, peerAddrs map[string]string, opts ...Option) (testTransport, error)
+
+func forEachTransport(t *testing.T, run func(t *testing.T, newTransport newTransportFunc)) {
+	t.Run("tcp", func(t *testing.T) {
+		run(t, func(id string, listenAddr string, peerAddrs map[string]string, opts ...Option) (testTransport, error) {
+			tr, err := New(id, listenAddr, peerAddrs, opts...)
+			if err != nil {
+				return nil, err
+			}
+			return tr, nil
+		})
+	})
+	t.Run("grpc", func(t *testing.T) {
+		run(t, func(id string, listenAddr string, peerAddrs map[string]string, opts ...Option) (testTransport, error) {
+			tr, err := NewGRPC(id, listenAddr, peerAddrs, opts...)
+			if err != nil {
+				return nil, err
+			}
+			return tr, nil
+		})
+	})
 }
 
 type stubHandler struct{}
@@ -279,6 +750,66 @@ func (s *stubHandler) HandleInstallSnapshot(ctx context.Context, req raft.Instal
 	return raft.InstallSnapshotResponse{Term: req.Term}, nil
 }
 
+type traceHandler struct {
+	stubHandler
+	mu   sync.Mutex
+	span trace.SpanContext
+}
+
+func (h *traceHandler) HandleAppendEntries(ctx context.Context, req raft.AppendEntriesRequest) (raft.AppendEntriesResponse, error) {
+	h.mu.Lock()
+	h.span = trace.SpanContextFromContext(ctx)
+	h.mu.Unlock()
+	return h.stubHandler.HandleAppendEntries(ctx, req)
+}
+
+func (h *traceHandler) last() trace.SpanContext {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.span
+}
+
+type frameRecorder struct {
+	mu    sync.Mutex
+	bytes map[string][2]int
+}
+
+func (r *frameRecorder) observe(peer, message string, rawBytes, wireBytes int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.bytes == nil {
+		r.bytes = make(map[string][2]int)
+	}
+	item := r.bytes[peer+"|"+message]
+	r.bytes[peer+"|"+message] = [2]int{item[0] + rawBytes, item[1] + wireBytes}
+}
+
+func (r *frameRecorder) get(peer, message string) (int, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	item := r.bytes[peer+"|"+message]
+	return item[0], item[1]
+}
+
+type snapshotHandler struct {
+	stubHandler
+	mu  sync.Mutex
+	req raft.InstallSnapshotRequest
+}
+
+func (s *snapshotHandler) HandleInstallSnapshot(ctx context.Context, req raft.InstallSnapshotRequest) (raft.InstallSnapshotResponse, error) {
+	s.mu.Lock()
+	s.req = req
+	s.mu.Unlock()
+	return raft.InstallSnapshotResponse{Term: req.Term}, nil
+}
+
+func (s *snapshotHandler) last() raft.InstallSnapshotRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.req
+}
+
 type termHandler struct {
 	term uint64
 }
@@ -338,3 +869,82 @@ func waitMsg(t *testing.T, ch <-chan raft.ApplyMsg, data []byte, timeout time.Du
 		}
 	}
 }
+
+type testCA struct {
+	dir  string
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ca key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "mini-kv test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create ca certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse ca certificate: %v", err)
+	}
+	ca := &testCA{dir: t.TempDir(), cert: cert, key: key}
+	ca.pem = ca.write(t, "ca.pem", "CERTIFICATE", der)
+	return ca
+}
+
+func (ca *testCA) issue(t *testing.T, id string) TLSConfig {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate node key: %v", err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatalf("generate serial: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: id},
+		DNSNames:     []string{id},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("create node certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal node key: %v", err)
+	}
+	prefix := id + "-" + serial.String()
+	return TLSConfig{
+		CertFile: ca.write(t, prefix+".pem", "CERTIFICATE", der),
+		KeyFile:  ca.write(t, prefix+"-key.pem", "EC PRIVATE KEY", keyDER),
+		CAFile:   ca.pem,
+	}
+}
+
+func (ca *testCA) write(t *testing.T, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(ca.dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
@@ -0,0 +1,64 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// The second-highest bit of the header type byte marks a payload prefixed with
+// trace context propagation fields.
+const frameFlagTraced byte = 0x40
+
+// injectTraceContext returns the propagation fields of the span in ctx, or
+// nil when there is nothing to propagate.
+func injectTraceContext(ctx context.Context) []byte {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	keys := carrier.Keys()
+	sort.Strings(keys)
+	enc := newFrameEncoder(64)
+	enc.u32(uint32(len(keys)))
+	for _, key := range keys {
+		enc.string(key)
+		enc.string(carrier[key])
+	}
+	if enc.err != nil {
+		return nil
+	}
+	return enc.buf
+}
+
+// splitTraceContext separates the propagation fields from the message payload
+// of a traced frame.
+func splitTraceContext(payload []byte) (propagation.MapCarrier, []byte, error) {
+	dec := newFrameDecoder(payload)
+	count := dec.u32()
+	if dec.err == nil && uint64(count) > uint64(len(dec.data))/8 {
+		return nil, nil, errors.New("raftnet: trace context field count exceeds payload")
+	}
+	carrier := make(propagation.MapCarrier, count)
+	for i := uint32(0); i < count && dec.err == nil; i++ {
+		key := dec.string()
+		carrier[key] = dec.string()
+	}
+	if dec.err != nil {
+		return nil, nil, fmt.Errorf("raftnet: decode trace context: %w", dec.err)
+	}
+	return carrier, dec.data, nil
+}
+
+func extractTraceContext(carrier propagation.MapCarrier) context.Context {
+	ctx := context.Background()
+	if len(carrier) == 0 {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, carrier)
+}
@@ -0,0 +1,36 @@
+package grpcserver
+
+import (
+	"context"
+
+	minikvv1 "mini-kv/api/minikv/v1"
+	"mini-kv/internal/service/minikv"
+)
+
+type adminHandler struct {
+	minikvv1.UnimplementedAdminServer
+
+	admin minikv.Admin
+}
+
+func newAdminHandler(admin minikv.Admin) *adminHandler {
+	return &adminHandler{admin: admin}
+}
+
+func (h *adminHandler) CompactRange(ctx context.Context, req *minikvv1.CompactRangeRequest) (*minikvv1.CompactRangeResponse, error) {
+	if err := h.admin.CompactRange(ctx, req.GetStart(), req.GetEnd()); err != nil {
+		return nil, statusError(err)
+	}
+	return &minikvv1.CompactRangeResponse{}, nil
+}
+
+func (h *adminHandler) ApproximateSize(ctx context.Context, req *minikvv1.ApproximateSizeRequest) (*minikvv1.ApproximateSizeResponse, error) {
+	size, count, err := h.admin.ApproximateSize(ctx, req.GetStart(), req.GetEnd())
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &minikvv1.ApproximateSizeResponse{
+		SizeBytes: size,
+		Count:     count,
+	}, nil
+}
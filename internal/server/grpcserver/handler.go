@@ -2,8 +2,13 @@ package grpcserver
 
 import (
 	"context"
+	"errors"
 
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	minikvv1 "mini-kv/api/minikv/v1"
+	"mini-kv/internal/raftstore"
 	"mini-kv/internal/service/minikv"
 )
 
@@ -20,7 +25,7 @@ func newKVHandler(service minikv.Service) *kvHandler {
 func (h *kvHandler) Get(ctx context.Context, req *minikvv1.GetRequest) (*minikvv1.GetResponse, error) {
 	value, found, err := h.service.Get(ctx, req.GetKey())
 	if err != nil {
-		return nil, err
+		return nil, statusError(err)
 	}
 	return &minikvv1.GetResponse{
 		Value: value,
@@ -30,14 +35,62 @@ func (h *kvHandler) Get(ctx context.Context, req *minikvv1.GetRequest) (*minikvv
 
 func (h *kvHandler) Set(ctx context.Context, req *minikvv1.SetRequest) (*minikvv1.SetResponse, error) {
 	if err := h.service.Set(ctx, req.GetKey(), req.GetValue()); err != nil {
-		return nil, err
+		return nil, statusError(err)
 	}
 	return &minikvv1.SetResponse{}, nil
 }
 
 func (h *kvHandler) Delete(ctx context.Context, req *minikvv1.DeleteRequest) (*minikvv1.DeleteResponse, error) {
 	if err := h.service.Delete(ctx, req.GetKey()); err != nil {
-		return nil, err
+		return nil, statusError(err)
 	}
 	return &minikvv1.DeleteResponse{}, nil
 }
+
+// Leader reports the leader's node ID. Services that are not replicated serve
+// every request themselves, so they answer with an empty ID.
+func (h *kvHandler) Leader(ctx context.Context, _ *minikvv1.LeaderRequest) (*minikvv1.LeaderResponse, error) {
+	leadership, ok := h.service.(minikv.Leadership)
+	if !ok {
+		return &minikvv1.LeaderResponse{}, nil
+	}
+	leaderID, err := leadership.Leader(ctx)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &minikvv1.LeaderResponse{LeaderId: leaderID}, nil
+}
+
+// statusError maps known service errors to gRPC status codes. Followers
+// answer Unavailable with an ErrorInfo naming the leader, and writes that lost
+// leadership after being appended carry an OUTCOME_UNKNOWN ErrorInfo, so that
+// clients can tell a rejected request from one that may have been executed.
+func statusError(err error) error {
+	var notLeader raftstore.NotLeaderError
+	switch {
+	case errors.As(err, &notLeader):
+		st, detailErr := status.New(codes.Unavailable, err.Error()).WithDetails(&errdetails.ErrorInfo{
+			Reason:   minikvv1.ReasonNotLeader,
+			Domain:   minikvv1.ErrorDomain,
+			Metadata: map[string]string{minikvv1.LeaderIDMetadataKey: notLeader.LeaderID},
+		})
+		if detailErr != nil {
+			return status.Error(codes.Unavailable, err.Error())
+		}
+		return st.Err()
+	case errors.Is(err, raftstore.ErrOutcomeUnknown):
+		st, detailErr := status.New(codes.Unavailable, err.Error()).WithDetails(&errdetails.ErrorInfo{
+			Reason: minikvv1.ReasonOutcomeUnknown,
+			Domain: minikvv1.ErrorDomain,
+		})
+		if detailErr != nil {
+			return status.Error(codes.Unavailable, err.Error())
+		}
+		return st.Err()
+	case errors.Is(err, raftstore.ErrResourceExhausted):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, raftstore.ErrUnsupported):
+		return status.Error(codes.Unimplemented, err.Error())
+	}
+	return err
+}
@@ -5,13 +5,19 @@ import (
 	"errors"
 	"net"
 	"sync"
+	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
 	minikvv1 "mini-kv/api/minikv/v1"
+	"mini-kv/internal/auth"
 	"mini-kv/internal/config"
 	"mini-kv/internal/logger"
 	"mini-kv/internal/observability"
+	"mini-kv/internal/server/servertls"
 	"mini-kv/internal/service/minikv"
+	"mini-kv/internal/tracing"
 )
 
 type Server struct {
@@ -19,18 +25,20 @@ type Server struct {
 	logger   *logger.Logger
 	service  minikv.Service
 	registry *observability.Registry
+	slowLog  *observability.SlowLog
 
 	mu         sync.RWMutex
 	listener   net.Listener
 	grpcServer *grpc.Server
 }
 
-func New(cfg config.Config, l *logger.Logger, service minikv.Service, registry *observability.Registry) *Server {
+func New(cfg config.Config, l *logger.Logger, service minikv.Service, registry *observability.Registry, slowLog *observability.SlowLog) *Server {
 	return &Server{
 		cfg:      cfg,
 		logger:   l,
 		service:  service,
 		registry: registry,
+		slowLog:  slowLog,
 	}
 }
 
@@ -40,8 +48,16 @@ func (s *Server) Run(ctx context.Context) error {
 		return err
 	}
 
-	server := grpc.NewServer(grpc.UnaryInterceptor(observability.UnaryServerInterceptor(s.registry)))
+	opts, err := s.serverOptions()
+	if err != nil {
+		_ = listen.Close()
+		return err
+	}
+	server := grpc.NewServer(opts...)
 	minikvv1.RegisterKVServer(server, newKVHandler(s.service))
+	if admin, ok := s.service.(minikv.Admin); ok {
+		minikvv1.RegisterAdminServer(server, newAdminHandler(admin))
+	}
 
 	s.mu.Lock()
 	s.listener = listen
@@ -63,6 +79,37 @@ func (s *Server) Run(ctx context.Context) error {
 	return err
 }
 
+func (s *Server) serverOptions() ([]grpc.ServerOption, error) {
+	if err := servertls.CheckAuth("grpc", s.cfg.Host, s.cfg.TLS, s.cfg.Auth); err != nil {
+		return nil, err
+	}
+	guard, err := auth.FromConfig(s.cfg.Auth)
+	if err != nil {
+		return nil, err
+	}
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(
+			tracing.UnaryServerInterceptor(),
+			observability.UnaryServerInterceptor(s.registry),
+			authInterceptor(guard, s.registry),
+			slowLogInterceptor(s.slowLog),
+		),
+		// Clients ping idle connections to notice dead endpoints early.
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             5 * time.Second,
+			PermitWithoutStream: true,
+		}),
+	}
+	if servertls.Enabled(s.cfg.TLS) {
+		tlsConfig, err := servertls.Config("grpc", s.cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	return opts, nil
+}
+
 func (s *Server) Addr() string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
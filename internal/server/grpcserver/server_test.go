@@ -3,13 +3,24 @@ package grpcserver
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
+	"strings"
 	"testing"
 
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
 	minikvv1 "mini-kv/api/minikv/v1"
+	"mini-kv/internal/auth"
+	"mini-kv/internal/config"
+	"mini-kv/internal/logger"
+	"mini-kv/internal/observability"
+	"mini-kv/internal/raftstore"
 	"mini-kv/internal/service/minikv"
 )
 
@@ -88,6 +99,195 @@ func TestErrors(t *testing.T) {
 	}
 }
 
+func TestResourceExhaustedStatus(t *testing.T) {
+	t.Parallel()
+
+	client, cleanup := newClient(t, stalledService{})
+	defer cleanup()
+
+	_, err := client.Set(context.Background(), &minikvv1.SetRequest{Key: "a", Value: []byte("1")})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("set status = %v, want %v", status.Code(err), codes.ResourceExhausted)
+	}
+}
+
+func TestNotLeaderStatus(t *testing.T) {
+	t.Parallel()
+
+	client, cleanup := newClient(t, followerService{})
+	defer cleanup()
+
+	_, err := client.Set(context.Background(), &minikvv1.SetRequest{Key: "a", Value: []byte("1")})
+	st := status.Convert(err)
+	if st.Code() != codes.Unavailable || len(st.Details()) != 1 {
+		t.Fatalf("set status = %v, want unavailable with details", st)
+	}
+	info, ok := st.Details()[0].(*errdetails.ErrorInfo)
+	if !ok || info.GetReason() != minikvv1.ReasonNotLeader || info.GetMetadata()[minikvv1.LeaderIDMetadataKey] != "node2" {
+		t.Fatalf("set status details = %v, want not leader naming node2", st.Details())
+	}
+}
+
+func TestOutcomeUnknownStatus(t *testing.T) {
+	t.Parallel()
+
+	client, cleanup := newClient(t, lostLeaderService{})
+	defer cleanup()
+
+	_, err := client.Set(context.Background(), &minikvv1.SetRequest{Key: "a", Value: []byte("1")})
+	st := status.Convert(err)
+	if st.Code() != codes.Unavailable || len(st.Details()) != 1 {
+		t.Fatalf("set status = %v, want unavailable with details", st)
+	}
+	info, ok := st.Details()[0].(*errdetails.ErrorInfo)
+	if !ok || info.GetReason() != minikvv1.ReasonOutcomeUnknown {
+		t.Fatalf("set status details = %v, want outcome unknown", st.Details())
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	t.Parallel()
+
+	admin := &fakeAdmin{}
+	client, cleanup := newAdminClient(t, admin)
+	defer cleanup()
+
+	ctx := context.Background()
+	if _, err := client.CompactRange(ctx, &minikvv1.CompactRangeRequest{Start: "a", End: "m"}); err != nil {
+		t.Fatalf("compact range error: %v", err)
+	}
+	if admin.compacted != "a-m" {
+		t.Fatalf("compacted range = %q, want a-m", admin.compacted)
+	}
+	resp, err := client.ApproximateSize(ctx, &minikvv1.ApproximateSizeRequest{Start: "a"})
+	if err != nil {
+		t.Fatalf("approximate size error: %v", err)
+	}
+	if resp.GetSizeBytes() != 4096 || resp.GetCount() != 32 {
+		t.Fatalf("approximate size = %d bytes %d entries, want 4096 32", resp.GetSizeBytes(), resp.GetCount())
+	}
+
+	admin.err = raftstore.ErrUnsupported
+	_, err = client.CompactRange(ctx, &minikvv1.CompactRangeRequest{})
+	if status.Code(err) != codes.Unimplemented {
+		t.Fatalf("compact range status = %v, want %v", status.Code(err), codes.Unimplemented)
+	}
+}
+
+func TestAuthInterceptor(t *testing.T) {
+	t.Parallel()
+
+	guard, err := auth.FromConfig(config.AuthConfig{
+		Enabled: true,
+		Tokens:  []config.AuthToken{{Token: "tenant-token", Principal: "tenant"}},
+		Principals: []config.AuthPrincipal{{Name: "tenant", Grants: []config.AuthGrant{
+			{Prefix: "tenant/", Permissions: []string{"read", "write"}},
+			{Prefix: "public/", Permissions: []string{"read"}},
+		}}},
+	})
+	if err != nil {
+		t.Fatalf("auth from config: %v", err)
+	}
+	registry := observability.NewRegistry()
+	service := newSvc()
+	conn, cleanup := dialBufconn(t, func(server *grpc.Server) {
+		minikvv1.RegisterKVServer(server, newKVHandler(service))
+	}, grpc.ChainUnaryInterceptor(observability.UnaryServerInterceptor(registry), authInterceptor(guard, registry)))
+	defer cleanup()
+	client := minikvv1.NewKVClient(conn)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer tenant-token")
+	if _, err := client.Set(ctx, &minikvv1.SetRequest{Key: "tenant/a", Value: []byte("1")}); err != nil {
+		t.Fatalf("allowed set error: %v", err)
+	}
+	if _, err := client.Get(ctx, &minikvv1.GetRequest{Key: "public/a"}); err != nil {
+		t.Fatalf("allowed get error: %v", err)
+	}
+	_, err = client.Set(ctx, &minikvv1.SetRequest{Key: "public/a", Value: []byte("1")})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("read-only set status = %v, want %v", status.Code(err), codes.PermissionDenied)
+	}
+	_, err = client.Delete(ctx, &minikvv1.DeleteRequest{Key: "other/a"})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("foreign delete status = %v, want %v", status.Code(err), codes.PermissionDenied)
+	}
+	_, err = client.Get(context.Background(), &minikvv1.GetRequest{Key: "tenant/a"})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("anonymous get status = %v, want %v", status.Code(err), codes.Unauthenticated)
+	}
+	if _, ok := service.values["public/a"]; ok {
+		t.Fatal("denied set reached the service")
+	}
+
+	denied := registry.Snapshot().AuthDenied
+	if denied["Set|permission_denied"] != 1 || denied["Delete|permission_denied"] != 1 || denied["Get|unauthenticated"] != 1 {
+		t.Fatalf("auth denied metrics = %v", denied)
+	}
+	if !strings.Contains(registry.RenderPrometheus(), `mini_kv_auth_denied_total{method="Set",reason="permission_denied"} 1`) {
+		t.Fatal("prometheus output misses auth denied counter")
+	}
+}
+
+func TestAuthNeedsTLSOffLoopback(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Default()
+	cfg.Host = "0.0.0.0"
+	cfg.Port = 0
+	cfg.Auth = config.AuthConfig{
+		Enabled:    true,
+		Tokens:     []config.AuthToken{{Token: "secret", Principal: "app"}},
+		Principals: []config.AuthPrincipal{{Name: "app"}},
+	}
+	err := New(cfg, logger.NewDiscard(), newSvc(), observability.NewRegistry(), nil).Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "grpc: auth on a non-loopback listener needs tls") {
+		t.Fatalf("run with plaintext auth = %v, want refusal", err)
+	}
+}
+
+type fakeAdmin struct {
+	compacted string
+	err       error
+}
+
+var _ minikv.Admin = (*fakeAdmin)(nil)
+
+func (a *fakeAdmin) CompactRange(_ context.Context, start, end string) error {
+	if a.err != nil {
+		return a.err
+	}
+	a.compacted = start + "-" + end
+	return nil
+}
+
+func (a *fakeAdmin) ApproximateSize(context.Context, string, string) (int64, int64, error) {
+	return 4096, 32, a.err
+}
+
+type stalledService struct {
+	errorService
+}
+
+func (stalledService) Set(context.Context, string, []byte) error {
+	return fmt.Errorf("%w: write stall", raftstore.ErrResourceExhausted)
+}
+
+type followerService struct {
+	errorService
+}
+
+func (followerService) Set(context.Context, string, []byte) error {
+	return raftstore.NotLeaderError{LeaderID: "node2"}
+}
+
+type lostLeaderService struct {
+	errorService
+}
+
+func (lostLeaderService) Set(context.Context, string, []byte) error {
+	return raftstore.ErrOutcomeUnknown
+}
+
 type errorService struct{}
 
 var _ minikv.Service = errorService{}
@@ -107,9 +307,27 @@ func (errorService) Delete(context.Context, string) error {
 func newClient(t *testing.T, service minikv.Service) (minikvv1.KVClient, func()) {
 	t.Helper()
 
+	conn, cleanup := dialBufconn(t, func(server *grpc.Server) {
+		minikvv1.RegisterKVServer(server, newKVHandler(service))
+	})
+	return minikvv1.NewKVClient(conn), cleanup
+}
+
+func newAdminClient(t *testing.T, admin minikv.Admin) (minikvv1.AdminClient, func()) {
+	t.Helper()
+
+	conn, cleanup := dialBufconn(t, func(server *grpc.Server) {
+		minikvv1.RegisterAdminServer(server, newAdminHandler(admin))
+	})
+	return minikvv1.NewAdminClient(conn), cleanup
+}
+
+func dialBufconn(t *testing.T, register func(*grpc.Server), opts ...grpc.ServerOption) (*grpc.ClientConn, func()) {
+	t.Helper()
+
 	listener := bufconn.Listen(bufSize)
-	server := grpc.NewServer()
-	minikvv1.RegisterKVServer(server, newKVHandler(service))
+	server := grpc.NewServer(opts...)
+	register(server)
 
 	go func() {
 		if err := server.Serve(listener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
@@ -137,5 +355,5 @@ func newClient(t *testing.T, service minikv.Service) (minikvv1.KVClient, func())
 		_ = listener.Close()
 	}
 
-	return minikvv1.NewKVClient(conn), cleanup
+	return conn, cleanup
 }
@@ -0,0 +1,49 @@
+package grpcserver
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	minikvv1 "mini-kv/api/minikv/v1"
+	"mini-kv/internal/observability"
+)
+
+// slowLogInterceptor measures every request against the slow log threshold.
+// The layers below add their phase timings through the request context.
+func slowLogInterceptor(slowLog *observability.SlowLog) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if slowLog == nil {
+			return handler(ctx, req)
+		}
+		method := info.FullMethod[strings.LastIndexByte(info.FullMethod, '/')+1:]
+		size := 0
+		if message, ok := req.(proto.Message); ok {
+			size = proto.Size(message)
+		}
+		ctx, op := slowLog.Start(ctx, method, requestKey(req), size)
+		resp, err := handler(ctx, req)
+		op.Finish(err)
+		return resp, err
+	}
+}
+
+// requestKey names the key a request touches; range requests report their
+// start key.
+func requestKey(req interface{}) string {
+	switch req := req.(type) {
+	case *minikvv1.GetRequest:
+		return req.GetKey()
+	case *minikvv1.SetRequest:
+		return req.GetKey()
+	case *minikvv1.DeleteRequest:
+		return req.GetKey()
+	case *minikvv1.ApproximateSizeRequest:
+		return req.GetStart()
+	case *minikvv1.CompactRangeRequest:
+		return req.GetStart()
+	}
+	return ""
+}
@@ -0,0 +1,398 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"mini-kv/internal/auth"
+	"mini-kv/internal/raftstore"
+	"mini-kv/internal/service/minikv"
+)
+
+const (
+	maxBodyBytes   = 32 << 20
+	maxBatchOps    = 1024
+	jsonType       = "application/json"
+	rawType        = "application/octet-stream"
+	bearerPrefix   = "bearer "
+	forwardedBy    = "X-Minikv-Forwarded-By"
+	leaderIDHeader = "X-Minikv-Leader"
+)
+
+// httpError is a failure with a fixed HTTP status. code is the matching gRPC
+// code under which the request is recorded in the registry.
+type httpError struct {
+	status int
+	code   codes.Code
+	msg    string
+}
+
+func (e httpError) Error() string {
+	return e.msg
+}
+
+type kvResponse struct {
+	Key     string `json:"key"`
+	Value   []byte `json:"value,omitempty"`
+	Found   bool   `json:"found"`
+	Deleted int64  `json:"deleted,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type batchOp struct {
+	Op    string `json:"op"`
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+type batchResponse struct {
+	Results []kvResponse `json:"results"`
+}
+
+type errorResponse struct {
+	Error  string `json:"error"`
+	Leader string `json:"leader,omitempty"`
+}
+
+// request is the per-call state passed to handlers.
+type request struct {
+	ctx       context.Context
+	method    string
+	principal auth.Principal
+	body      []byte
+}
+
+func (s *Server) handleGet(writer http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	s.serve(writer, r, "Get", key, func(req request) error {
+		if key == "" {
+			return badRequest("key is empty")
+		}
+		if err := s.authorize(req, auth.PermissionRead, key); err != nil {
+			return err
+		}
+		value, found, err := s.service.Get(req.ctx, key)
+		if err != nil {
+			return err
+		}
+		httpStatus := http.StatusOK
+		if !found {
+			httpStatus = http.StatusNotFound
+		}
+		if negotiate(r.Header.Get("Accept")) == rawType {
+			writer.Header().Set("Content-Type", rawType)
+			writer.WriteHeader(httpStatus)
+			_, _ = writer.Write(value)
+			return nil
+		}
+		writeJSON(writer, httpStatus, kvResponse{Key: key, Value: value, Found: found})
+		return nil
+	})
+}
+
+// handlePut stores the request body as is, or the base64 "value" field of a
+// JSON body.
+func (s *Server) handlePut(writer http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	s.serve(writer, r, "Set", key, func(req request) error {
+		if key == "" {
+			return badRequest("key is empty")
+		}
+		if err := s.authorize(req, auth.PermissionWrite, key); err != nil {
+			return err
+		}
+		value := req.body
+		if mediaType(r.Header.Get("Content-Type")) == jsonType {
+			var body struct {
+				Value []byte `json:"value"`
+			}
+			if err := json.Unmarshal(req.body, &body); err != nil {
+				return badRequest("decode json body: %v", err)
+			}
+			value = body.Value
+		}
+		if err := s.service.Set(req.ctx, key, value); err != nil {
+			return err
+		}
+		writer.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+}
+
+func (s *Server) handleDelete(writer http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	s.serve(writer, r, "Delete", key, func(req request) error {
+		if key == "" {
+			return badRequest("key is empty")
+		}
+		if err := s.authorize(req, auth.PermissionWrite, key); err != nil {
+			return err
+		}
+		deleted, err := s.delete(req.ctx, key)
+		if err != nil {
+			return err
+		}
+		writeJSON(writer, http.StatusOK, kvResponse{Key: key, Found: deleted > 0, Deleted: deleted})
+		return nil
+	})
+}
+
+// handleBatch runs a JSON array of get, put and delete operations in order.
+// The batch is not atomic: every operation reports its own result.
+func (s *Server) handleBatch(writer http.ResponseWriter, r *http.Request) {
+	s.serve(writer, r, "Batch", "", func(req request) error {
+		if mediaType(r.Header.Get("Content-Type")) != jsonType {
+			return httpError{status: http.StatusUnsupportedMediaType, code: codes.InvalidArgument, msg: "batch body must be " + jsonType}
+		}
+		var ops []batchOp
+		if err := json.Unmarshal(req.body, &ops); err != nil {
+			return badRequest("decode batch: %v", err)
+		}
+		if len(ops) > maxBatchOps {
+			return badRequest("batch has %d operations, limit is %d", len(ops), maxBatchOps)
+		}
+		for _, op := range ops {
+			perm := auth.PermissionWrite
+			switch op.Op {
+			case "get":
+				perm = auth.PermissionRead
+			case "put", "delete":
+			default:
+				return badRequest("unknown batch operation %q", op.Op)
+			}
+			if op.Key == "" {
+				return badRequest("batch operation %q has no key", op.Op)
+			}
+			if err := s.authorize(req, perm, op.Key); err != nil {
+				return err
+			}
+		}
+
+		results := make([]kvResponse, len(ops))
+		for i, op := range ops {
+			result := kvResponse{Key: op.Key}
+			var err error
+			switch op.Op {
+			case "get":
+				result.Value, result.Found, err = s.service.Get(req.ctx, op.Key)
+			case "put":
+				err = s.service.Set(req.ctx, op.Key, op.Value)
+			case "delete":
+				result.Deleted, err = s.delete(req.ctx, op.Key)
+				result.Found = result.Deleted > 0
+			}
+			if err != nil {
+				result.Error = err.Error()
+			}
+			results[i] = result
+		}
+		writeJSON(writer, http.StatusOK, batchResponse{Results: results})
+		return nil
+	})
+}
+
+func (s *Server) delete(ctx context.Context, key string) (int64, error) {
+	if deleter, ok := s.service.(minikv.Deleter); ok {
+		return deleter.DeleteKeys(ctx, key)
+	}
+	if err := s.service.Delete(ctx, key); err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+// serve authenticates the request, forwards it to the leader when this node
+// is a follower and otherwise runs handle, recording the call like a gRPC one.
+func (s *Server) serve(writer http.ResponseWriter, r *http.Request, method, key string, handle func(request) error) {
+	startedAt := time.Now()
+	body, err := io.ReadAll(http.MaxBytesReader(writer, r.Body, maxBodyBytes))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		err = httpError{status: http.StatusRequestEntityTooLarge, code: codes.ResourceExhausted, msg: err.Error()}
+	}
+
+	ctx := r.Context()
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+	ctx, slowOp := s.slowLog.Start(ctx, method, key, len(body))
+
+	var principal auth.Principal
+	if err == nil {
+		principal, err = s.authenticate(ctx, r, method)
+	}
+	if err == nil && s.leader != nil && !s.leader.IsLeader() {
+		err = raftstore.NotLeaderError{LeaderID: s.leader.LeaderID()}
+	}
+	if err == nil {
+		err = handle(request{ctx: ctx, method: method, principal: principal, body: body})
+	}
+	slowOp.Finish(err)
+
+	var notLeader raftstore.NotLeaderError
+	if errors.As(err, &notLeader) && s.forward(writer, r, body, notLeader.LeaderID) {
+		// The leader records the call it serves.
+		return
+	}
+	if err != nil {
+		httpStatus, code := statusOf(err)
+		response := errorResponse{Error: err.Error()}
+		if errors.As(err, &notLeader) {
+			response.Leader = notLeader.LeaderID
+		}
+		writeJSON(writer, httpStatus, response)
+		s.registry.ObserveGRPC(method, time.Since(startedAt), status.Error(code, err.Error()))
+		return
+	}
+	s.registry.ObserveGRPC(method, time.Since(startedAt), nil)
+}
+
+// forward sends the request to the leader's HTTP address, with a 307 redirect
+// or by proxying it. It reports false when the leader cannot be reached that
+// way, including for requests another node already forwarded.
+func (s *Server) forward(writer http.ResponseWriter, r *http.Request, body []byte, leaderID string) bool {
+	addr := s.cfg.HTTP.PeerAddrs[leaderID]
+	if addr == "" || r.Header.Get(forwardedBy) != "" {
+		return false
+	}
+	writer.Header().Set(leaderIDHeader, leaderID)
+	if s.leaderMode != "proxy" {
+		http.Redirect(writer, r, s.scheme+"://"+addr+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+		return true
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	proxy := &httputil.ReverseProxy{
+		Transport: s.peerTransport,
+		Rewrite: func(out *httputil.ProxyRequest) {
+			out.SetURL(&url.URL{Scheme: s.scheme, Host: addr})
+			out.Out.Header.Set(forwardedBy, s.cfg.Raft.ID)
+		},
+		ErrorHandler: func(writer http.ResponseWriter, _ *http.Request, err error) {
+			writeJSON(writer, http.StatusBadGateway, errorResponse{Error: fmt.Sprintf("proxy to leader: %v", err), Leader: leaderID})
+		},
+	}
+	proxy.ServeHTTP(writer, r)
+	return true
+}
+
+func (s *Server) authenticate(ctx context.Context, r *http.Request, method string) (auth.Principal, error) {
+	if s.guard == nil {
+		return auth.Principal{}, nil
+	}
+	var creds auth.Credentials
+	if value := r.Header.Get("Authorization"); len(value) > len(bearerPrefix) && strings.EqualFold(value[:len(bearerPrefix)], bearerPrefix) {
+		creds.Token = strings.TrimSpace(value[len(bearerPrefix):])
+	}
+	principal, err := s.guard.Authenticator.Authenticate(ctx, creds)
+	if err != nil {
+		s.registry.IncAuthDenied(method, "unauthenticated")
+		return auth.Principal{}, err
+	}
+	return principal, nil
+}
+
+func (s *Server) authorize(req request, perm auth.Permission, key string) error {
+	if s.guard == nil {
+		return nil
+	}
+	if err := s.guard.Policy.AuthorizeKey(req.principal, perm, key); err != nil {
+		s.registry.IncAuthDenied(req.method, "permission_denied")
+		return err
+	}
+	return nil
+}
+
+func statusOf(err error) (int, codes.Code) {
+	var httpErr httpError
+	var notLeader raftstore.NotLeaderError
+	switch {
+	case errors.As(err, &httpErr):
+		return httpErr.status, httpErr.code
+	case errors.As(err, &notLeader):
+		return http.StatusServiceUnavailable, codes.Unavailable
+	case errors.Is(err, auth.ErrUnauthenticated), errors.Is(err, auth.ErrNoCredentials):
+		return http.StatusUnauthorized, codes.Unauthenticated
+	case errors.Is(err, auth.ErrPermissionDenied):
+		return http.StatusForbidden, codes.PermissionDenied
+	case errors.Is(err, raftstore.ErrOutcomeUnknown):
+		return http.StatusServiceUnavailable, codes.Unavailable
+	case errors.Is(err, raftstore.ErrResourceExhausted):
+		return http.StatusServiceUnavailable, codes.ResourceExhausted
+	case errors.Is(err, raftstore.ErrUnsupported):
+		return http.StatusNotImplemented, codes.Unimplemented
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		return http.StatusServiceUnavailable, codes.Canceled
+	}
+	return http.StatusInternalServerError, codes.Internal
+}
+
+func badRequest(format string, args ...any) error {
+	return httpError{status: http.StatusBadRequest, code: codes.InvalidArgument, msg: fmt.Sprintf(format, args...)}
+}
+
+// negotiate picks the response type for an Accept header: raw bytes when the
+// client prefers application/octet-stream, JSON otherwise.
+func negotiate(accept string) string {
+	best, bestQ := jsonType, -1.0
+	for _, part := range strings.Split(accept, ",") {
+		media, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		candidate := ""
+		switch media {
+		case rawType:
+			candidate = rawType
+		case jsonType, "application/*", "*/*":
+			candidate = jsonType
+		}
+		if candidate != "" && q > 0 && q > bestQ {
+			best, bestQ = candidate, q
+		}
+	}
+	return best
+}
+
+func mediaType(contentType string) string {
+	media, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return media
+}
+
+func writeJSON(writer http.ResponseWriter, status int, value any) {
+	payload, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writer.Header().Set("Content-Type", jsonType)
+	writer.WriteHeader(status)
+	_, _ = writer.Write(payload)
+}
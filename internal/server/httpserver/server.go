@@ -0,0 +1,181 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"mini-kv/internal/auth"
+	"mini-kv/internal/config"
+	"mini-kv/internal/logger"
+	"mini-kv/internal/observability"
+	"mini-kv/internal/server/servertls"
+	"mini-kv/internal/service/minikv"
+)
+
+// LeaderSource reports whether this node leads the raft group and which node
+// does. raftstore.Runtime implements it.
+type LeaderSource interface {
+	IsLeader() bool
+	LeaderID() string
+}
+
+// Server exposes the KV API as HTTP/JSON for scripts and browser tools.
+type Server struct {
+	cfg      config.Config
+	logger   *logger.Logger
+	service  minikv.Service
+	leader   LeaderSource
+	registry *observability.Registry
+	slowLog  *observability.SlowLog
+	guard    *auth.Guard
+	timeout  time.Duration
+
+	// leaderMode is the resolved http.leader_mode; scheme and peerTransport
+	// are used to reach the leader's gateway.
+	leaderMode    string
+	scheme        string
+	peerTransport http.RoundTripper
+
+	mu       sync.Mutex
+	listener net.Listener
+	server   *http.Server
+}
+
+func New(cfg config.Config, l *logger.Logger, service minikv.Service, leader LeaderSource, registry *observability.Registry, slowLog *observability.SlowLog) *Server {
+	return &Server{
+		cfg:      cfg,
+		logger:   l,
+		service:  service,
+		leader:   leader,
+		registry: registry,
+		slowLog:  slowLog,
+		timeout:  time.Duration(cfg.HTTP.TimeoutMS) * time.Millisecond,
+	}
+}
+
+func (s *Server) Run(ctx context.Context) error {
+	if s == nil || !s.cfg.HTTP.Enabled {
+		return nil
+	}
+	handler, err := s.Handler()
+	if err != nil {
+		return err
+	}
+	if err := servertls.CheckAuth("http", s.cfg.HTTP.Host, s.cfg.HTTP.TLS, s.cfg.Auth); err != nil {
+		return err
+	}
+	listen, err := servertls.Listen("http", s.cfg.HTTP.Address(), s.cfg.HTTP.TLS)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	s.mu.Lock()
+	s.listener = listen
+	s.server = server
+	s.mu.Unlock()
+
+	s.logger.Infof("mini-kv HTTP listening on %s", listen.Addr().String())
+
+	go func() {
+		<-ctx.Done()
+		s.Close()
+	}()
+
+	err = server.Serve(listen)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Handler returns the gateway's routes. It fails when the auth or leader
+// forwarding settings are invalid.
+//
+// leader_mode defaults to redirect, or to proxy when auth is enabled: HTTP
+// clients drop the Authorization header when a redirect points at another
+// host, so redirect cannot be combined with auth.
+func (s *Server) Handler() (http.Handler, error) {
+	guard, err := auth.FromConfig(s.cfg.Auth)
+	if err != nil {
+		return nil, err
+	}
+	s.guard = guard
+
+	s.leaderMode = s.cfg.HTTP.LeaderMode
+	switch s.leaderMode {
+	case "":
+		s.leaderMode = "redirect"
+		if guard != nil {
+			s.leaderMode = "proxy"
+		}
+	case "redirect":
+		if guard != nil {
+			return nil, errors.New("http leader_mode redirect cannot be used with auth: clients drop the Authorization header on cross-host redirects; use proxy")
+		}
+	case "proxy":
+	default:
+		return nil, fmt.Errorf("unknown http leader_mode %q", s.cfg.HTTP.LeaderMode)
+	}
+	s.scheme = "http"
+	s.peerTransport = http.DefaultTransport
+	if servertls.Enabled(s.cfg.HTTP.TLS) {
+		// Peers share the gateway's TLS settings, so the leader is reached over
+		// https and verified against peer_ca_file (system roots when empty).
+		s.scheme = "https"
+		if s.cfg.HTTP.PeerCAFile != "" {
+			caPEM, err := os.ReadFile(s.cfg.HTTP.PeerCAFile)
+			if err != nil {
+				return nil, fmt.Errorf("read http peer ca: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(caPEM) {
+				return nil, fmt.Errorf("no certificates in %s", s.cfg.HTTP.PeerCAFile)
+			}
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12, RootCAs: pool}
+			s.peerTransport = transport
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/kv/{key...}", s.handleGet)
+	mux.HandleFunc("PUT /v1/kv/{key...}", s.handlePut)
+	mux.HandleFunc("DELETE /v1/kv/{key...}", s.handleDelete)
+	mux.HandleFunc("POST /v1/batch", s.handleBatch)
+	return mux, nil
+}
+
+func (s *Server) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return ""
+	}
+	return s.listener.Addr().String()
+}
+
+func (s *Server) Close() {
+	s.mu.Lock()
+	server := s.server
+	s.server = nil
+	s.listener = nil
+	s.mu.Unlock()
+
+	if server != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}
+}
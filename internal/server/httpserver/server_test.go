@@ -0,0 +1,422 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"mini-kv/internal/config"
+	"mini-kv/internal/logger"
+	"mini-kv/internal/observability"
+	"mini-kv/internal/service/minikv"
+)
+
+type fakeService struct {
+	mu     sync.Mutex
+	values map[string][]byte
+}
+
+var _ minikv.Service = (*fakeService)(nil)
+
+func newSvc() *fakeService {
+	return &fakeService{values: make(map[string][]byte)}
+}
+
+func (s *fakeService) Get(_ context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.values[key]
+	return append([]byte(nil), value...), ok, nil
+}
+
+func (s *fakeService) Set(_ context.Context, key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = append([]byte(nil), value...)
+	return nil
+}
+
+func (s *fakeService) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, key)
+	return nil
+}
+
+type fakeLeader struct {
+	leader   bool
+	leaderID string
+}
+
+func (l fakeLeader) IsLeader() bool   { return l.leader }
+func (l fakeLeader) LeaderID() string { return l.leaderID }
+
+func TestKV(t *testing.T) {
+	t.Parallel()
+
+	registry := observability.NewRegistry()
+	srv := newTestServer(t, newSvc(), nil, registry, nil)
+
+	resp := do(t, http.MethodPut, srv.URL+"/v1/kv/dir/a", "", []byte("raw\x00bytes"))
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("raw put status = %d", resp.StatusCode)
+	}
+	var got kvResponse
+	resp = do(t, http.MethodGet, srv.URL+"/v1/kv/dir/a", "", nil)
+	decode(t, resp, &got)
+	if resp.StatusCode != http.StatusOK || !got.Found || string(got.Value) != "raw\x00bytes" {
+		t.Fatalf("json get = %d %+v", resp.StatusCode, got)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/v1/kv/dir/a", nil)
+	req.Header.Set("Accept", "application/json;q=0.5, application/octet-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("raw get error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.Header.Get("Content-Type") != rawType || string(body) != "raw\x00bytes" {
+		t.Fatalf("raw get = %q %q", resp.Header.Get("Content-Type"), body)
+	}
+
+	resp = do(t, http.MethodPut, srv.URL+"/v1/kv/b", jsonType, []byte(`{"value":"aGVsbG8="}`))
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("json put status = %d", resp.StatusCode)
+	}
+	resp = do(t, http.MethodDelete, srv.URL+"/v1/kv/b", "", nil)
+	decode(t, resp, &got)
+	if resp.StatusCode != http.StatusOK || got.Deleted != 1 {
+		t.Fatalf("delete = %d %+v", resp.StatusCode, got)
+	}
+	resp = do(t, http.MethodGet, srv.URL+"/v1/kv/b", "", nil)
+	decode(t, resp, &got)
+	if resp.StatusCode != http.StatusNotFound || got.Found {
+		t.Fatalf("get deleted = %d %+v", resp.StatusCode, got)
+	}
+	if resp := do(t, http.MethodPut, srv.URL+"/v1/kv/c", jsonType, []byte(`{"value":`)); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("bad json put status = %d", resp.StatusCode)
+	}
+
+	grpc := registry.Snapshot().GRPC
+	if grpc["Set|ok"].Count != 2 || grpc["Get|ok"].Count != 3 || grpc["Delete|ok"].Count != 1 || grpc["Set|invalidargument"].Count != 1 {
+		t.Fatalf("registry grpc stats = %+v", grpc)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t, newSvc(), nil, nil, nil)
+
+	ops := `[{"op":"put","key":"a","value":"MQ=="},{"op":"get","key":"a"},{"op":"delete","key":"a"},{"op":"get","key":"a"}]`
+	resp := do(t, http.MethodPost, srv.URL+"/v1/batch", jsonType, []byte(ops))
+	var got batchResponse
+	decode(t, resp, &got)
+	if resp.StatusCode != http.StatusOK || len(got.Results) != 4 {
+		t.Fatalf("batch = %d %+v", resp.StatusCode, got)
+	}
+	if !got.Results[1].Found || string(got.Results[1].Value) != "1" || got.Results[2].Deleted != 1 || got.Results[3].Found {
+		t.Fatalf("batch results = %+v", got.Results)
+	}
+
+	if resp := do(t, http.MethodPost, srv.URL+"/v1/batch", "text/plain", []byte(ops)); resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Fatalf("text batch status = %d", resp.StatusCode)
+	}
+	if resp := do(t, http.MethodPost, srv.URL+"/v1/batch", jsonType, []byte(`[{"op":"incr","key":"a"}]`)); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("unknown op status = %d", resp.StatusCode)
+	}
+}
+
+func TestFollowerForwardsToLeader(t *testing.T) {
+	t.Parallel()
+
+	leaderService := newSvc()
+	leader := newTestServer(t, leaderService, fakeLeader{leader: true, leaderID: "node1"}, nil, nil)
+	leaderAddr := strings.TrimPrefix(leader.URL, "http://")
+
+	for _, mode := range []string{"redirect", "proxy"} {
+		follower := newTestServer(t, newSvc(), fakeLeader{leaderID: "node1"}, nil, func(cfg *config.Config) {
+			cfg.HTTP.LeaderMode = mode
+			cfg.HTTP.PeerAddrs = map[string]string{"node1": leaderAddr}
+		})
+
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		req, _ := http.NewRequest(http.MethodPut, follower.URL+"/v1/kv/"+mode, bytes.NewReader([]byte("v")))
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s put error: %v", mode, err)
+		}
+		resp.Body.Close()
+		switch mode {
+		case "redirect":
+			if resp.StatusCode != http.StatusTemporaryRedirect || resp.Header.Get("Location") != leader.URL+"/v1/kv/redirect" {
+				t.Fatalf("redirect = %d %q", resp.StatusCode, resp.Header.Get("Location"))
+			}
+			// Clients that follow redirects resend the body to the leader.
+			if resp := do(t, http.MethodPut, follower.URL+"/v1/kv/redirect", "", []byte("v")); resp.StatusCode != http.StatusNoContent {
+				t.Fatalf("followed redirect status = %d", resp.StatusCode)
+			}
+		case "proxy":
+			if resp.StatusCode != http.StatusNoContent || resp.Header.Get(leaderIDHeader) != "node1" {
+				t.Fatalf("proxied put = %d", resp.StatusCode)
+			}
+		}
+		if value, ok, _ := leaderService.Get(context.Background(), mode); !ok || string(value) != "v" {
+			t.Fatalf("%s: leader value = %q, %v", mode, value, ok)
+		}
+	}
+
+	orphan := newTestServer(t, newSvc(), fakeLeader{leaderID: "node9"}, nil, nil)
+	resp := do(t, http.MethodGet, orphan.URL+"/v1/kv/a", "", nil)
+	var got errorResponse
+	decode(t, resp, &got)
+	if resp.StatusCode != http.StatusServiceUnavailable || got.Leader != "node9" {
+		t.Fatalf("unknown leader address = %d %+v", resp.StatusCode, got)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer(t, newSvc(), nil, nil, func(cfg *config.Config) {
+		cfg.Auth = config.AuthConfig{
+			Enabled: true,
+			Tokens:  []config.AuthToken{{Token: "secret", Principal: "app"}},
+			Principals: []config.AuthPrincipal{{
+				Name:   "app",
+				Grants: []config.AuthGrant{{Prefix: "app/", Permissions: []string{"read", "write"}}},
+			}},
+		}
+	})
+
+	tests := []struct {
+		token string
+		key   string
+		want  int
+	}{
+		{"", "app/a", http.StatusUnauthorized},
+		{"wrong", "app/a", http.StatusUnauthorized},
+		{"secret", "other", http.StatusForbidden},
+		{"secret", "app/a", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/v1/kv/"+tt.key, nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("get error: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Fatalf("token %q key %q status = %d, want %d", tt.token, tt.key, resp.StatusCode, tt.want)
+		}
+	}
+}
+
+func TestLeaderModeWithAuth(t *testing.T) {
+	t.Parallel()
+
+	authCfg := config.AuthConfig{
+		Enabled: true,
+		Tokens:  []config.AuthToken{{Token: "secret", Principal: "app"}},
+		Principals: []config.AuthPrincipal{{
+			Name:   "app",
+			Grants: []config.AuthGrant{{Prefix: "app/", Permissions: []string{"read", "write"}}},
+		}},
+	}
+	cfg := config.Default()
+	cfg.Auth = authCfg
+	cfg.HTTP.LeaderMode = "redirect"
+	if _, err := New(cfg, logger.NewDiscard(), newSvc(), nil, nil, nil).Handler(); err == nil {
+		t.Fatalf("redirect with auth: handler built, want error")
+	}
+	cfg.HTTP.LeaderMode = ""
+	cfg.HTTP.Host = "0.0.0.0"
+	cfg.HTTP.Enabled = true
+	if err := New(cfg, logger.NewDiscard(), newSvc(), nil, nil, nil).Run(context.Background()); err == nil || !strings.Contains(err.Error(), "needs tls") {
+		t.Fatalf("auth without tls = %v, want refusal", err)
+	}
+
+	// With the default leader_mode a follower proxies to the leader over
+	// TLS and the token reaches the leader.
+	tlsCfg, pool := writeTestCert(t)
+	configure := func(cfg *config.Config) {
+		cfg.Auth = authCfg
+		cfg.HTTP.TLS = tlsCfg
+		cfg.HTTP.PeerCAFile = tlsCfg.CertFile
+	}
+	leaderService := newSvc()
+	leaderAddr := runServer(t, leaderService, fakeLeader{leader: true, leaderID: "node1"}, configure)
+	followerAddr := runServer(t, newSvc(), fakeLeader{leaderID: "node1"}, func(cfg *config.Config) {
+		configure(cfg)
+		cfg.HTTP.PeerAddrs = map[string]string{"node1": leaderAddr}
+	})
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	for _, tt := range []struct {
+		token string
+		want  int
+	}{
+		{"", http.StatusUnauthorized},
+		{"secret", http.StatusNoContent},
+	} {
+		req, _ := http.NewRequest(http.MethodPut, "https://"+followerAddr+"/v1/kv/app/a", bytes.NewReader([]byte("v")))
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("put error: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Fatalf("token %q status = %d, want %d", tt.token, resp.StatusCode, tt.want)
+		}
+	}
+	if value, ok, _ := leaderService.Get(context.Background(), "app/a"); !ok || string(value) != "v" {
+		t.Fatalf("leader value = %q, %v", value, ok)
+	}
+}
+
+func newTestServer(t *testing.T, service minikv.Service, leader LeaderSource, registry *observability.Registry, configure func(*config.Config)) *httptest.Server {
+	t.Helper()
+
+	cfg := config.Default()
+	if configure != nil {
+		configure(&cfg)
+	}
+	handler, err := New(cfg, logger.NewDiscard(), service, leader, registry, nil).Handler()
+	if err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// runServer starts the gateway with Run and returns its address as
+// localhost:port, which the test certificate covers.
+func runServer(t *testing.T, service minikv.Service, leader LeaderSource, configure func(*config.Config)) string {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.HTTP.Enabled = true
+	cfg.HTTP.Port = 0
+	if configure != nil {
+		configure(&cfg)
+	}
+	srv := New(cfg, logger.NewDiscard(), service, leader, observability.NewRegistry(), nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("run error: %v", err)
+		}
+	})
+
+	deadline := time.Now().Add(time.Second)
+	for srv.Addr() == "" {
+		if time.Now().After(deadline) {
+			t.Fatalf("HTTP server did not start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	_, port, _ := net.SplitHostPort(srv.Addr())
+	return net.JoinHostPort("localhost", port)
+}
+
+func do(t *testing.T, method, url, contentType string, body []byte) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s error: %v", method, url, err)
+	}
+	payload, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(payload))
+	return resp
+}
+
+func decode(t *testing.T, resp *http.Response, out any) {
+	t.Helper()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		t.Fatalf("decode response (%d): %v", resp.StatusCode, err)
+	}
+}
+
+// writeTestCert writes a self-signed certificate for localhost and returns a
+// pool that trusts it.
+func writeTestCert(t *testing.T) (config.TLSConfig, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	dir := t.TempDir()
+	cfg := config.TLSConfig{CertFile: filepath.Join(dir, "cert.pem"), KeyFile: filepath.Join(dir, "key.pem")}
+	if err := os.WriteFile(cfg.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write cert: %v", err)
+	}
+	if err := os.WriteFile(cfg.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return cfg, pool
+}
@@ -0,0 +1,432 @@
+package respserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"mini-kv/internal/auth"
+	"mini-kv/internal/raftstore"
+	"mini-kv/internal/service/minikv"
+)
+
+// replyError is sent to the client as is; it starts with the error code.
+type replyError string
+
+func (e replyError) Error() string {
+	return string(e)
+}
+
+type command struct {
+	// arity counts the command name; a negative arity is a minimum.
+	arity int
+	// keyed commands take their first key right after the name.
+	keyed bool
+	// open commands may run before the client authenticates.
+	open bool
+	run  func(s *Server, ctx context.Context, c *conn, args [][]byte) error
+}
+
+var commands = map[string]command{
+	"ping":   {arity: -1, run: (*Server).ping},
+	"hello":  {arity: -1, open: true, run: (*Server).hello},
+	"auth":   {arity: -2, open: true, run: (*Server).auth},
+	"quit":   {arity: -1, open: true, run: (*Server).quit},
+	"info":   {arity: -1, run: (*Server).info},
+	"get":    {arity: 2, keyed: true, run: (*Server).get},
+	"set":    {arity: -3, keyed: true, run: (*Server).set},
+	"del":    {arity: -2, keyed: true, run: (*Server).del},
+	"exists": {arity: -2, keyed: true, run: (*Server).exists},
+	"mget":   {arity: -2, keyed: true, run: (*Server).mget},
+	"mset":   {arity: -3, keyed: true, run: (*Server).mset},
+}
+
+func (s *Server) execute(ctx context.Context, c *conn, args [][]byte) error {
+	name := strings.ToLower(string(args[0]))
+	cmd, ok := commands[name]
+	if !ok {
+		c.writer.error(fmt.Sprintf("ERR unknown command '%s', with args beginning with: %s", args[0], quoteArgs(args[1:])))
+		return nil
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		c.writer.error(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+		return nil
+	}
+	if s.guard != nil && !c.authenticated && !cmd.open {
+		s.registry.IncAuthDenied(strings.ToUpper(name), "unauthenticated")
+		c.writer.error("NOAUTH Authentication required.")
+		return nil
+	}
+
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+	key, size := "", 0
+	if cmd.keyed {
+		key = string(args[1])
+		for _, arg := range args[2:] {
+			size += len(arg)
+		}
+	}
+	ctx, slowOp := s.slowLog.Start(ctx, name, key, size)
+	startedAt := time.Now()
+	err := cmd.run(s, ctx, c, args)
+	slowOp.Finish(err)
+	s.processed.Add(1)
+
+	result := "ok"
+	if err != nil && !errors.Is(err, errQuit) {
+		result = "error"
+		c.writer.error(s.errorReply(err))
+	}
+	s.commands.Add(1, name, result)
+	s.duration.Observe(float64(time.Since(startedAt))/float64(time.Millisecond), name)
+	if errors.Is(err, errQuit) {
+		return err
+	}
+	return nil
+}
+
+// errorReply maps service errors to Redis error replies. A follower names the
+// leader in a MOVED error, so cluster-aware clients retry there.
+func (s *Server) errorReply(err error) string {
+	var reply replyError
+	if errors.As(err, &reply) {
+		return string(reply)
+	}
+	var notLeader raftstore.NotLeaderError
+	if errors.As(err, &notLeader) {
+		if notLeader.LeaderID == "" {
+			return "TRYAGAIN no raft leader elected"
+		}
+		if addr := s.cfg.RESP.PeerAddrs[notLeader.LeaderID]; addr != "" {
+			return "MOVED 0 " + addr
+		}
+		return fmt.Sprintf("TRYAGAIN leader %s has no known RESP address", notLeader.LeaderID)
+	}
+	if errors.Is(err, raftstore.ErrResourceExhausted) {
+		return "BUSY " + err.Error()
+	}
+	return "ERR " + err.Error()
+}
+
+func (s *Server) authorize(name string, c *conn, perm auth.Permission, keys ...[]byte) error {
+	if s.guard == nil {
+		return nil
+	}
+	for _, key := range keys {
+		if err := s.guard.Policy.AuthorizeKey(c.principal, perm, string(key)); err != nil {
+			s.registry.IncAuthDenied(strings.ToUpper(name), "permission_denied")
+			return replyError("NOPERM " + err.Error())
+		}
+	}
+	return nil
+}
+
+func (s *Server) authenticate(ctx context.Context, c *conn, password []byte) error {
+	principal, err := s.guard.Authenticator.Authenticate(ctx, auth.Credentials{Token: string(password)})
+	if err != nil {
+		s.registry.IncAuthDenied("AUTH", "unauthenticated")
+		return replyError("WRONGPASS invalid username-password pair or user is disabled.")
+	}
+	c.principal = principal
+	c.authenticated = true
+	return nil
+}
+
+func (s *Server) ping(_ context.Context, c *conn, args [][]byte) error {
+	switch len(args) {
+	case 1:
+		c.writer.simple("PONG")
+	case 2:
+		c.writer.bulk(args[1])
+	default:
+		return replyError("ERR wrong number of arguments for 'ping' command")
+	}
+	return nil
+}
+
+// hello switches the protocol version and optionally authenticates:
+// HELLO [protover [AUTH username password] [SETNAME clientname]].
+func (s *Server) hello(ctx context.Context, c *conn, args [][]byte) error {
+	proto := c.writer.proto
+	if len(args) > 1 {
+		version, err := strconv.Atoi(string(args[1]))
+		if err != nil {
+			return replyError("ERR Protocol version is not an integer or out of range")
+		}
+		if version != 2 && version != 3 {
+			return replyError("NOPROTO unsupported protocol version")
+		}
+		proto = version
+	}
+	var password []byte
+	for i := 2; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "auth":
+			if i+2 >= len(args) {
+				return replyError("ERR syntax error in HELLO option 'auth'")
+			}
+			password = args[i+2]
+			i += 2
+		case "setname":
+			if i+1 >= len(args) {
+				return replyError("ERR syntax error in HELLO option 'setname'")
+			}
+			i++
+		default:
+			return replyError(fmt.Sprintf("ERR syntax error in HELLO option '%s'", args[i]))
+		}
+	}
+	if password != nil {
+		if s.guard == nil {
+			return replyError("ERR AUTH called without any password configured")
+		}
+		if err := s.authenticate(ctx, c, password); err != nil {
+			return err
+		}
+	}
+	if s.guard != nil && !c.authenticated {
+		return replyError("NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time")
+	}
+
+	c.writer.proto = proto
+	c.writer.mapHeader(4)
+	c.writer.bulkString("server")
+	c.writer.bulkString("mini-kv")
+	c.writer.bulkString("proto")
+	c.writer.integer(int64(proto))
+	c.writer.bulkString("id")
+	c.writer.integer(c.id)
+	c.writer.bulkString("mode")
+	c.writer.bulkString("standalone")
+	return nil
+}
+
+// auth accepts AUTH password and AUTH username password; the password is
+// checked as a bearer token and the username is ignored.
+func (s *Server) auth(ctx context.Context, c *conn, args [][]byte) error {
+	if len(args) > 3 {
+		return replyError("ERR syntax error")
+	}
+	if s.guard == nil {
+		return replyError("ERR AUTH called without any password configured")
+	}
+	if err := s.authenticate(ctx, c, args[len(args)-1]); err != nil {
+		return err
+	}
+	c.writer.simple("OK")
+	return nil
+}
+
+func (s *Server) quit(_ context.Context, c *conn, _ [][]byte) error {
+	c.writer.simple("OK")
+	return errQuit
+}
+
+func (s *Server) get(ctx context.Context, c *conn, args [][]byte) error {
+	if err := s.authorize("get", c, auth.PermissionRead, args[1]); err != nil {
+		return err
+	}
+	value, found, err := s.service.Get(ctx, string(args[1]))
+	if err != nil {
+		return err
+	}
+	if !found {
+		c.writer.null()
+		return nil
+	}
+	c.writer.bulk(value)
+	return nil
+}
+
+// set supports only the plain form; expiry and conditional options need
+// support from the store.
+func (s *Server) set(ctx context.Context, c *conn, args [][]byte) error {
+	if len(args) != 3 {
+		return replyError("ERR syntax error")
+	}
+	if err := s.authorize("set", c, auth.PermissionWrite, args[1]); err != nil {
+		return err
+	}
+	if err := s.service.Set(ctx, string(args[1]), args[2]); err != nil {
+		return err
+	}
+	c.writer.simple("OK")
+	return nil
+}
+
+func (s *Server) del(ctx context.Context, c *conn, args [][]byte) error {
+	keys := args[1:]
+	if err := s.authorize("del", c, auth.PermissionWrite, keys...); err != nil {
+		return err
+	}
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		names[i] = string(key)
+	}
+	deleter, ok := s.service.(minikv.Deleter)
+	if !ok {
+		// Without a count from the service every deleted key is reported.
+		for _, name := range names {
+			if err := s.service.Delete(ctx, name); err != nil {
+				return err
+			}
+		}
+		c.writer.integer(int64(len(names)))
+		return nil
+	}
+	deleted, err := deleter.DeleteKeys(ctx, names...)
+	if err != nil {
+		return err
+	}
+	c.writer.integer(deleted)
+	return nil
+}
+
+func (s *Server) exists(ctx context.Context, c *conn, args [][]byte) error {
+	keys := args[1:]
+	if err := s.authorize("exists", c, auth.PermissionRead, keys...); err != nil {
+		return err
+	}
+	var count int64
+	for _, key := range keys {
+		_, found, err := s.service.Get(ctx, string(key))
+		if err != nil {
+			return err
+		}
+		if found {
+			count++
+		}
+	}
+	c.writer.integer(count)
+	return nil
+}
+
+func (s *Server) mget(ctx context.Context, c *conn, args [][]byte) error {
+	keys := args[1:]
+	if err := s.authorize("mget", c, auth.PermissionRead, keys...); err != nil {
+		return err
+	}
+	values := make([][]byte, len(keys))
+	found := make([]bool, len(keys))
+	for i, key := range keys {
+		var err error
+		values[i], found[i], err = s.service.Get(ctx, string(key))
+		if err != nil {
+			return err
+		}
+	}
+	c.writer.array(len(values))
+	for i, value := range values {
+		if !found[i] {
+			c.writer.null()
+			continue
+		}
+		c.writer.bulk(value)
+	}
+	return nil
+}
+
+// mset writes the pairs one after another. Unlike Redis it is not atomic: a
+// failure leaves the earlier pairs written.
+func (s *Server) mset(ctx context.Context, c *conn, args [][]byte) error {
+	if len(args)%2 != 1 {
+		return replyError("ERR wrong number of arguments for 'mset' command")
+	}
+	keys := make([][]byte, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		keys = append(keys, args[i])
+	}
+	if err := s.authorize("mset", c, auth.PermissionWrite, keys...); err != nil {
+		return err
+	}
+	for i := 1; i < len(args); i += 2 {
+		if err := s.service.Set(ctx, string(args[i]), args[i+1]); err != nil {
+			return err
+		}
+	}
+	c.writer.simple("OK")
+	return nil
+}
+
+// info reports the server, client and raft state and the observability
+// registry metrics, in INFO's "# Section" and "field:value" layout.
+func (s *Server) info(_ context.Context, c *conn, args [][]byte) error {
+	sections := make(map[string]bool)
+	for _, arg := range args[1:] {
+		sections[strings.ToLower(string(arg))] = true
+	}
+	all := len(sections) == 0 || sections["all"] || sections["default"] || sections["everything"]
+	snapshot := s.registry.Snapshot()
+
+	var builder strings.Builder
+	section := func(name string) bool {
+		if !all && !sections[strings.ToLower(name)] {
+			return false
+		}
+		if builder.Len() > 0 {
+			builder.WriteString("\r\n")
+		}
+		builder.WriteString("# " + name + "\r\n")
+		return true
+	}
+	field := func(name string, value any) {
+		fmt.Fprintf(&builder, "%s:%v\r\n", name, value)
+	}
+
+	if section("Server") {
+		field("server", "mini-kv")
+		field("node_id", s.cfg.Raft.ID)
+		field("tcp_port", s.cfg.RESP.Port)
+		if !snapshot.StartedAt.IsZero() {
+			field("uptime_in_seconds", int64(time.Since(snapshot.StartedAt).Seconds()))
+		}
+	}
+	if section("Clients") {
+		s.mu.Lock()
+		connected := len(s.conns)
+		s.mu.Unlock()
+		field("connected_clients", connected)
+	}
+	if section("Stats") {
+		field("total_connections_received", s.connections.Load())
+		field("total_commands_processed", s.processed.Load())
+	}
+	if section("Raft") {
+		for _, node := range sortedKeys(snapshot.RaftState) {
+			field(node, fmt.Sprintf("state=%s,leader=%s,commit_index=%d,applied_index=%d",
+				snapshot.RaftState[node], snapshot.RaftLeader[node], snapshot.CommitIndex[node], snapshot.AppliedIndex[node]))
+		}
+	}
+	if section("Metrics") {
+		for _, name := range sortedKeys(snapshot.Metrics) {
+			field(name, strconv.FormatFloat(snapshot.Metrics[name], 'f', -1, 64))
+		}
+	}
+	c.writer.verbatim(builder.String())
+	return nil
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func quoteArgs(args [][]byte) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = fmt.Sprintf("'%s'", arg)
+	}
+	return strings.Join(quoted, " ")
+}
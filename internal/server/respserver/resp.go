@@ -0,0 +1,223 @@
+package respserver
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxArgs      = 1024 * 1024
+	maxInlineLen = 64 * 1024
+	// maxBulkLen matches the 4 MiB gRPC receive limit of the KV service, and
+	// maxRequestLen the HTTP gateway's body limit.
+	maxBulkLen    = 4 << 20
+	maxRequestLen = 32 << 20
+	// Like Redis, clients that have not authenticated yet may only send small
+	// requests, so they cannot make the server allocate much.
+	maxUnauthArgs    = 10
+	maxUnauthBulkLen = 16 * 1024
+)
+
+// requestLimits bounds what one request may declare before it is read.
+type requestLimits struct {
+	args    int
+	bulkLen int
+}
+
+var (
+	authenticatedLimits   = requestLimits{args: maxArgs, bulkLen: maxBulkLen}
+	unauthenticatedLimits = requestLimits{args: maxUnauthArgs, bulkLen: maxUnauthBulkLen}
+)
+
+// protocolError is a malformed request. The connection cannot be resynced
+// after one, so it is reported and then closed.
+type protocolError struct {
+	msg string
+}
+
+func (e protocolError) Error() string {
+	return "Protocol error: " + e.msg
+}
+
+// readCommand reads one request, either a RESP array of bulk strings or an
+// inline command as typed into telnet. Declared lengths are only checked
+// against limits; buffers grow as the data actually arrives.
+func readCommand(reader *bufio.Reader, limits requestLimits) ([][]byte, error) {
+	line, err := readLine(reader)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, nil
+	}
+	if line[0] != '*' {
+		return inlineCommand(line), nil
+	}
+	count, err := strconv.Atoi(string(line[1:]))
+	if err != nil || count > maxArgs {
+		return nil, protocolError{"invalid multibulk length"}
+	}
+	if count > limits.args {
+		return nil, protocolError{"unauthenticated multibulk length"}
+	}
+	args := make([][]byte, 0, min(max(count, 0), 16))
+	total := 0
+	for i := 0; i < count; i++ {
+		line, err := readLine(reader)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, protocolError{fmt.Sprintf("expected '$', got '%s'", firstByte(line))}
+		}
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil || size < 0 || size > maxBulkLen {
+			return nil, protocolError{"invalid bulk length"}
+		}
+		if size > limits.bulkLen {
+			return nil, protocolError{"unauthenticated bulk length"}
+		}
+		if total += size; total > maxRequestLen {
+			return nil, protocolError{"too big request"}
+		}
+		arg, err := readBulk(reader, size)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// readBulk reads size bytes and the trailing CRLF.
+func readBulk(reader *bufio.Reader, size int) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, reader, int64(size)+2); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	arg := buf.Bytes()
+	if arg[size] != '\r' || arg[size+1] != '\n' {
+		return nil, protocolError{"bulk string is not terminated by CRLF"}
+	}
+	return arg[:size], nil
+}
+
+func readLine(reader *bufio.Reader) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := reader.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, chunk...)
+		if len(line) > maxInlineLen {
+			return nil, protocolError{"too big inline request"}
+		}
+		if !isPrefix {
+			return line, nil
+		}
+	}
+}
+
+func inlineCommand(line []byte) [][]byte {
+	fields := strings.Fields(string(line))
+	args := make([][]byte, len(fields))
+	for i, field := range fields {
+		args[i] = []byte(field)
+	}
+	return args
+}
+
+func firstByte(line []byte) string {
+	if len(line) == 0 {
+		return ""
+	}
+	return string(line[:1])
+}
+
+// replyWriter encodes replies for the protocol version the client negotiated
+// with HELLO. RESP2 clients get RESP3-only types in their RESP2 form.
+type replyWriter struct {
+	*bufio.Writer
+	proto int
+}
+
+func (w *replyWriter) simple(s string) {
+	w.WriteByte('+')
+	w.WriteString(s)
+	w.WriteString("\r\n")
+}
+
+// error writes an error reply; msg starts with the error code, e.g.
+// "ERR syntax error".
+func (w *replyWriter) error(msg string) {
+	w.WriteByte('-')
+	w.WriteString(strings.NewReplacer("\r", " ", "\n", " ").Replace(msg))
+	w.WriteString("\r\n")
+}
+
+func (w *replyWriter) integer(n int64) {
+	w.WriteByte(':')
+	w.WriteString(strconv.FormatInt(n, 10))
+	w.WriteString("\r\n")
+}
+
+func (w *replyWriter) bulk(b []byte) {
+	w.WriteByte('$')
+	w.WriteString(strconv.Itoa(len(b)))
+	w.WriteString("\r\n")
+	w.Write(b)
+	w.WriteString("\r\n")
+}
+
+func (w *replyWriter) bulkString(s string) {
+	w.bulk([]byte(s))
+}
+
+func (w *replyWriter) null() {
+	if w.proto >= 3 {
+		w.WriteString("_\r\n")
+		return
+	}
+	w.WriteString("$-1\r\n")
+}
+
+func (w *replyWriter) array(n int) {
+	w.WriteByte('*')
+	w.WriteString(strconv.Itoa(n))
+	w.WriteString("\r\n")
+}
+
+// mapHeader starts a map of n pairs, sent as a flat array to RESP2 clients.
+func (w *replyWriter) mapHeader(n int) {
+	if w.proto >= 3 {
+		w.WriteByte('%')
+		w.WriteString(strconv.Itoa(n))
+		w.WriteString("\r\n")
+		return
+	}
+	w.array(2 * n)
+}
+
+// verbatim writes text that is meant to be shown as is, like INFO output.
+func (w *replyWriter) verbatim(text string) {
+	if w.proto < 3 {
+		w.bulkString(text)
+		return
+	}
+	w.WriteByte('=')
+	w.WriteString(strconv.Itoa(len(text) + 4))
+	w.WriteString("\r\ntxt:")
+	w.WriteString(text)
+	w.WriteString("\r\n")
+}
+
+var errQuit = errors.New("respserver: client quit")
@@ -0,0 +1,201 @@
+package respserver
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"mini-kv/internal/auth"
+	"mini-kv/internal/config"
+	"mini-kv/internal/logger"
+	"mini-kv/internal/observability"
+	"mini-kv/internal/server/servertls"
+	"mini-kv/internal/service/minikv"
+)
+
+// Server speaks the Redis protocol (RESP2 and RESP3) in front of a
+// minikv.Service, so existing Redis clients can read and write keys.
+type Server struct {
+	cfg      config.Config
+	logger   *logger.Logger
+	service  minikv.Service
+	registry *observability.Registry
+	slowLog  *observability.SlowLog
+	guard    *auth.Guard
+	timeout  time.Duration
+
+	commands *observability.Counter
+	duration *observability.Histogram
+	clients  *observability.Gauge
+
+	connections atomic.Int64
+	processed   atomic.Int64
+	lastConnID  atomic.Int64
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[*conn]struct{}
+	wg       sync.WaitGroup
+}
+
+func New(cfg config.Config, l *logger.Logger, service minikv.Service, registry *observability.Registry, slowLog *observability.SlowLog) *Server {
+	return &Server{
+		cfg:      cfg,
+		logger:   l,
+		service:  service,
+		registry: registry,
+		slowLog:  slowLog,
+		timeout:  time.Duration(cfg.RESP.TimeoutMS) * time.Millisecond,
+		commands: registry.Counter("mini_kv_resp_commands_total", "RESP commands by command and result.", "command", "result"),
+		duration: registry.Histogram("mini_kv_resp_command_duration_ms", "RESP command latency in milliseconds.", observability.LatencyBucketsMS(), "command"),
+		clients:  registry.Gauge("mini_kv_resp_connected_clients", "Open RESP client connections."),
+		conns:    make(map[*conn]struct{}),
+	}
+}
+
+func (s *Server) Run(ctx context.Context) error {
+	if s == nil || !s.cfg.RESP.Enabled {
+		return nil
+	}
+	guard, err := auth.FromConfig(s.cfg.Auth)
+	if err != nil {
+		return err
+	}
+	if err := servertls.CheckAuth("resp", s.cfg.RESP.Host, s.cfg.RESP.TLS, s.cfg.Auth); err != nil {
+		return err
+	}
+	listen, err := servertls.Listen("resp", s.cfg.RESP.Address(), s.cfg.RESP.TLS)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.guard = guard
+	s.listener = listen
+	s.mu.Unlock()
+
+	s.logger.Infof("mini-kv RESP listening on %s", listen.Addr().String())
+
+	go func() {
+		<-ctx.Done()
+		s.Close()
+	}()
+
+	for {
+		netConn, err := listen.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				s.wg.Wait()
+				return nil
+			}
+			return err
+		}
+		c := s.newConn(netConn)
+		if c == nil {
+			_ = netConn.Close()
+			continue
+		}
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(ctx, c)
+		}()
+	}
+}
+
+func (s *Server) newConn(netConn net.Conn) *conn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	c := &conn{
+		id:      s.lastConnID.Add(1),
+		netConn: netConn,
+		reader:  bufio.NewReader(netConn),
+		writer:  &replyWriter{Writer: bufio.NewWriter(netConn), proto: 2},
+	}
+	s.conns[c] = struct{}{}
+	s.wg.Add(1)
+	s.connections.Add(1)
+	s.clients.Set(float64(len(s.conns)))
+	return c
+}
+
+func (s *Server) serveConn(ctx context.Context, c *conn) {
+	defer func() {
+		_ = c.netConn.Close()
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.clients.Set(float64(len(s.conns)))
+		s.mu.Unlock()
+	}()
+
+	for {
+		limits := authenticatedLimits
+		if s.guard != nil && !c.authenticated {
+			limits = unauthenticatedLimits
+		}
+		args, err := readCommand(c.reader, limits)
+		if err != nil {
+			var protoErr protocolError
+			if errors.As(err, &protoErr) {
+				c.writer.error("ERR " + protoErr.Error())
+				_ = c.writer.Flush()
+			} else if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				s.logger.Debugf("resp connection %s: %v", c.netConn.RemoteAddr(), err)
+			}
+			return
+		}
+		if len(args) > 0 {
+			err = s.execute(ctx, c, args)
+		}
+		// Pipelined requests are answered together once the client stops
+		// sending.
+		if c.reader.Buffered() == 0 || err != nil {
+			if flushErr := c.writer.Flush(); flushErr != nil {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return ""
+	}
+	return s.listener.Addr().String()
+}
+
+func (s *Server) Close() {
+	s.mu.Lock()
+	listener := s.listener
+	s.listener = nil
+	for c := range s.conns {
+		_ = c.netConn.Close()
+	}
+	s.mu.Unlock()
+
+	if listener != nil {
+		_ = listener.Close()
+	}
+}
+
+type conn struct {
+	id      int64
+	netConn net.Conn
+	reader  *bufio.Reader
+	writer  *replyWriter
+
+	principal     auth.Principal
+	authenticated bool
+}
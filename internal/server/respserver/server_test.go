@@ -0,0 +1,541 @@
+package respserver
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"mini-kv/internal/config"
+	"mini-kv/internal/logger"
+	"mini-kv/internal/observability"
+	"mini-kv/internal/raftstore"
+	"mini-kv/internal/service/minikv"
+)
+
+type fakeService struct {
+	mu     sync.Mutex
+	values map[string][]byte
+	err    error
+}
+
+var _ minikv.Service = (*fakeService)(nil)
+
+func newSvc() *fakeService {
+	return &fakeService{values: make(map[string][]byte)}
+}
+
+func (s *fakeService) Get(_ context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, false, s.err
+	}
+	value, ok := s.values[key]
+	return append([]byte(nil), value...), ok, nil
+}
+
+func (s *fakeService) Set(_ context.Context, key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.values[key] = append([]byte(nil), value...)
+	return nil
+}
+
+func (s *fakeService) Delete(_ context.Context, key string) error {
+	_, err := s.DeleteKeys(context.Background(), key)
+	return err
+}
+
+func (s *fakeService) DeleteKeys(_ context.Context, keys ...string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return 0, s.err
+	}
+	var deleted int64
+	for _, key := range keys {
+		if _, ok := s.values[key]; ok {
+			delete(s.values, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// respError is an error reply as seen by the test client.
+type respError string
+
+func TestCommands(t *testing.T) {
+	t.Parallel()
+
+	srv, _ := newServer(t, newSvc(), nil)
+	client := dial(t, srv)
+
+	tests := []struct {
+		args []string
+		want any
+	}{
+		{[]string{"PING"}, "PONG"},
+		{[]string{"ping", "hello"}, []byte("hello")},
+		{[]string{"SET", "a", "1"}, "OK"},
+		{[]string{"GET", "a"}, []byte("1")},
+		{[]string{"GET", "missing"}, nil},
+		{[]string{"MSET", "b", "2", "c", ""}, "OK"},
+		{[]string{"MGET", "a", "missing", "c"}, []any{[]byte("1"), nil, []byte("")}},
+		{[]string{"EXISTS", "a", "a", "missing"}, int64(2)},
+		{[]string{"DEL", "a", "b", "missing"}, int64(2)},
+		{[]string{"EXISTS", "a", "b", "c"}, int64(1)},
+		{[]string{"SET", "a", "1", "EX", "10"}, respError("ERR syntax error")},
+		{[]string{"MSET", "a"}, respError("ERR wrong number of arguments for 'mset' command")},
+		{[]string{"GET"}, respError("ERR wrong number of arguments for 'get' command")},
+		{[]string{"FLUSHALL"}, respError("ERR unknown command 'FLUSHALL', with args beginning with: ")},
+	}
+	for _, tt := range tests {
+		if got := client.do(t, tt.args...); !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("%v = %#v, want %#v", tt.args, got, tt.want)
+		}
+	}
+
+	info, ok := client.do(t, "INFO").([]byte)
+	if !ok {
+		t.Fatalf("INFO did not return a bulk string")
+	}
+	for _, want := range []string{"# Server\r\n", "server:mini-kv\r\n", "connected_clients:1\r\n", "mini_kv_resp_commands_total|set|ok:1\r\n"} {
+		if !strings.Contains(string(info), want) {
+			t.Fatalf("INFO is missing %q:\n%s", want, info)
+		}
+	}
+	if info := client.do(t, "INFO", "clients").([]byte); strings.Contains(string(info), "# Server") {
+		t.Fatalf("INFO clients returned other sections:\n%s", info)
+	}
+}
+
+func TestInlineAndRESP3(t *testing.T) {
+	t.Parallel()
+
+	srv, _ := newServer(t, newSvc(), nil)
+	client := dial(t, srv)
+
+	client.write(t, "PING\r\n")
+	if got := client.read(t); got != "PONG" {
+		t.Fatalf("inline PING = %#v, want PONG", got)
+	}
+
+	hello, ok := client.do(t, "HELLO", "3").(map[string]any)
+	if !ok || !reflect.DeepEqual(hello["server"], []byte("mini-kv")) || hello["proto"] != int64(3) {
+		t.Fatalf("HELLO 3 = %#v", hello)
+	}
+	if got := client.do(t, "GET", "missing"); got != nil {
+		t.Fatalf("RESP3 GET missing = %#v, want null", got)
+	}
+	if info, ok := client.do(t, "INFO", "server").(string); !ok || !strings.HasPrefix(info, "# Server") {
+		t.Fatalf("RESP3 INFO = %#v, want verbatim text", info)
+	}
+	if got := client.do(t, "HELLO", "4"); got != respError("NOPROTO unsupported protocol version") {
+		t.Fatalf("HELLO 4 = %#v", got)
+	}
+}
+
+func TestPipelineAndConcurrentClients(t *testing.T) {
+	t.Parallel()
+
+	srv, service := newServer(t, newSvc(), nil)
+
+	const clients, commands = 16, 200
+	var wg sync.WaitGroup
+	errs := make(chan error, clients)
+	for i := 0; i < clients; i++ {
+		client := dial(t, srv)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var request strings.Builder
+			for j := 0; j < commands; j++ {
+				request.WriteString(encodeCommand("SET", fmt.Sprintf("k%d-%d", i, j), strconv.Itoa(j)))
+			}
+			request.WriteString(encodeCommand("GET", fmt.Sprintf("k%d-%d", i, commands-1)))
+			if _, err := io.WriteString(client.conn, request.String()); err != nil {
+				errs <- err
+				return
+			}
+			for j := 0; j < commands; j++ {
+				if reply, err := client.readReply(); err != nil || reply != "OK" {
+					errs <- fmt.Errorf("client %d reply %d = %#v, %v", i, j, reply, err)
+					return
+				}
+			}
+			if reply, err := client.readReply(); err != nil || !reflect.DeepEqual(reply, []byte(strconv.Itoa(commands-1))) {
+				errs <- fmt.Errorf("client %d GET = %#v, %v", i, reply, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	service.mu.Lock()
+	defer service.mu.Unlock()
+	if len(service.values) != clients*commands {
+		t.Fatalf("stored %d keys, want %d", len(service.values), clients*commands)
+	}
+}
+
+func TestLeaderRedirect(t *testing.T) {
+	t.Parallel()
+
+	service := newSvc()
+	service.err = raftstore.NotLeaderError{LeaderID: "node2"}
+	srv, _ := newServer(t, service, func(cfg *config.Config) {
+		cfg.RESP.PeerAddrs = map[string]string{"node2": "10.0.0.2:6379"}
+	})
+	client := dial(t, srv)
+
+	if got := client.do(t, "SET", "a", "1"); got != respError("MOVED 0 10.0.0.2:6379") {
+		t.Fatalf("SET on follower = %#v, want MOVED to the leader", got)
+	}
+	service.mu.Lock()
+	service.err = raftstore.NotLeaderError{LeaderID: "node3"}
+	service.mu.Unlock()
+	if got := client.do(t, "GET", "a"); got != respError("TRYAGAIN leader node3 has no known RESP address") {
+		t.Fatalf("GET with unknown leader address = %#v", got)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	t.Parallel()
+
+	srv, _ := newServer(t, newSvc(), func(cfg *config.Config) {
+		cfg.Auth = config.AuthConfig{
+			Enabled: true,
+			Tokens:  []config.AuthToken{{Token: "secret", Principal: "app"}},
+			Principals: []config.AuthPrincipal{{
+				Name:   "app",
+				Grants: []config.AuthGrant{{Prefix: "app/", Permissions: []string{"read", "write"}}},
+			}},
+		}
+	})
+	client := dial(t, srv)
+
+	tests := []struct {
+		args []string
+		want any
+	}{
+		{[]string{"GET", "app/a"}, respError("NOAUTH Authentication required.")},
+		{[]string{"AUTH", "wrong"}, respError("WRONGPASS invalid username-password pair or user is disabled.")},
+		{[]string{"AUTH", "default", "secret"}, "OK"},
+		{[]string{"SET", "app/a", "1"}, "OK"},
+		{[]string{"MGET", "app/a", "other"}, respError(`NOPERM auth: permission denied: app may not read key "other"`)},
+	}
+	for _, tt := range tests {
+		if got := client.do(t, tt.args...); !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("%v = %#v, want %#v", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestRequestLimits(t *testing.T) {
+	t.Parallel()
+
+	srv, _ := newServer(t, newSvc(), func(cfg *config.Config) {
+		cfg.Auth = config.AuthConfig{
+			Enabled: true,
+			Tokens:  []config.AuthToken{{Token: "secret", Principal: "app"}},
+			Principals: []config.AuthPrincipal{{
+				Name:   "app",
+				Grants: []config.AuthGrant{{Prefix: "", Permissions: []string{"read", "write"}}},
+			}},
+		}
+	})
+
+	tests := []struct {
+		name    string
+		auth    bool
+		request string
+		want    any
+	}{
+		{"unauthenticated args", false, "*11\r\n", respError("ERR Protocol error: unauthenticated multibulk length")},
+		{"unauthenticated bulk", false, "*2\r\n$4\r\nAUTH\r\n$16385\r\n", respError("ERR Protocol error: unauthenticated bulk length")},
+		{"authenticated bulk", true, "*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$536870912\r\n", respError("ERR Protocol error: invalid bulk length")},
+		{"authenticated large value", true, encodeCommand("SET", "k", strings.Repeat("v", 64*1024)), "OK"},
+	}
+	for _, tt := range tests {
+		client := dial(t, srv)
+		if tt.auth {
+			if got := client.do(t, "AUTH", "secret"); got != "OK" {
+				t.Fatalf("%s: AUTH = %#v, want OK", tt.name, got)
+			}
+		}
+		client.write(t, tt.request)
+		if got := client.read(t); !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("%s: reply = %#v, want %#v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// Not parallel: it measures the bytes allocated while reading a request
+// that declares a large bulk but sends only a few bytes of it.
+func TestTLS(t *testing.T) {
+	t.Parallel()
+
+	authCfg := config.AuthConfig{
+		Enabled:    true,
+		Tokens:     []config.AuthToken{{Token: "secret", Principal: "app"}},
+		Principals: []config.AuthPrincipal{{Name: "app", Grants: []config.AuthGrant{{Permissions: []string{"read", "write"}}}}},
+	}
+
+	// Without TLS, auth is only allowed on a loopback listener.
+	cfg := config.Default()
+	cfg.RESP.Enabled = true
+	cfg.RESP.Host = "0.0.0.0"
+	cfg.RESP.Port = 0
+	cfg.Auth = authCfg
+	err := New(cfg, logger.NewDiscard(), newSvc(), observability.NewRegistry(), nil).Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "needs tls") {
+		t.Fatalf("run without tls = %v, want refusal", err)
+	}
+
+	tlsCfg, pool := writeTestCert(t)
+	srv, _ := newServer(t, newSvc(), func(cfg *config.Config) {
+		cfg.RESP.TLS = tlsCfg
+		cfg.Auth = authCfg
+	})
+	conn, err := tls.Dial("tcp", srv.Addr(), &tls.Config{RootCAs: pool, ServerName: "localhost"})
+	if err != nil {
+		t.Fatalf("tls dial: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	client := &testClient{conn: conn, reader: bufio.NewReader(conn)}
+	if got := client.do(t, "AUTH", "secret"); got != "OK" {
+		t.Fatalf("AUTH = %#v, want OK", got)
+	}
+	if got := client.do(t, "SET", "a", "1"); got != "OK" {
+		t.Fatalf("SET = %#v, want OK", got)
+	}
+}
+
+func TestReadCommandDoesNotTrustDeclaredLength(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader("*1\r\n$4000000\r\nabc"))
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := readCommand(reader, authenticatedLimits)
+	runtime.ReadMemStats(&after)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("readCommand error = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Fatalf("readCommand allocated %d bytes for a 3-byte bulk", allocated)
+	}
+}
+
+func newServer(t *testing.T, service *fakeService, configure func(*config.Config)) (*Server, *fakeService) {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.RESP.Enabled = true
+	cfg.RESP.Port = 0
+	if configure != nil {
+		configure(&cfg)
+	}
+	srv := New(cfg, logger.NewDiscard(), service, observability.NewRegistry(), nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("run error: %v", err)
+		}
+	})
+
+	deadline := time.Now().Add(time.Second)
+	for srv.Addr() == "" {
+		if time.Now().After(deadline) {
+			t.Fatalf("RESP server did not start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return srv, service
+}
+
+type testClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dial(t *testing.T, srv *Server) *testClient {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", srv.Addr())
+	if err != nil {
+		t.Fatalf("dial error: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return &testClient{conn: conn, reader: bufio.NewReader(conn)}
+}
+
+func (c *testClient) do(t *testing.T, args ...string) any {
+	t.Helper()
+	c.write(t, encodeCommand(args...))
+	return c.read(t)
+}
+
+func (c *testClient) write(t *testing.T, data string) {
+	t.Helper()
+	if _, err := io.WriteString(c.conn, data); err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+}
+
+func (c *testClient) read(t *testing.T) any {
+	t.Helper()
+	reply, err := c.readReply()
+	if err != nil {
+		t.Fatalf("read reply error: %v", err)
+	}
+	return reply
+}
+
+func encodeCommand(args ...string) string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&builder, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return builder.String()
+}
+
+// readReply decodes one RESP2 or RESP3 reply. Maps are returned keyed by
+// their string keys.
+func (c *testClient) readReply() (any, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("empty reply line")
+	}
+	body := line[1:]
+	switch line[0] {
+	case '+':
+		return body, nil
+	case '-':
+		return respError(body), nil
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '_':
+		return nil, nil
+	case '$', '=':
+		size, err := strconv.Atoi(body)
+		if err != nil || size < 0 {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(c.reader, data); err != nil {
+			return nil, err
+		}
+		if line[0] == '=' {
+			return string(data[4:size]), nil
+		}
+		return data[:size], nil
+	case '*':
+		count, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, err
+		}
+		items := make([]any, count)
+		for i := range items {
+			if items[i], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	case '%':
+		count, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, err
+		}
+		items := make(map[string]any, count)
+		for i := 0; i < count; i++ {
+			key, err := c.readReply()
+			if err != nil {
+				return nil, err
+			}
+			name, _ := key.([]byte)
+			if items[string(name)], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("unexpected reply %q", line)
+}
+
+// writeTestCert writes a self-signed certificate for localhost and returns a
+// pool that trusts it.
+func writeTestCert(t *testing.T) (config.TLSConfig, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	dir := t.TempDir()
+	cfg := config.TLSConfig{CertFile: filepath.Join(dir, "cert.pem"), KeyFile: filepath.Join(dir, "key.pem")}
+	if err := os.WriteFile(cfg.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write cert: %v", err)
+	}
+	if err := os.WriteFile(cfg.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return cfg, pool
+}
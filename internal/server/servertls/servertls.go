@@ -0,0 +1,90 @@
+// Package servertls builds the TLS settings shared by the client-facing
+// listeners (gRPC, RESP and HTTP).
+package servertls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
+	"mini-kv/internal/config"
+)
+
+// Enabled reports whether cfg asks the listener to serve TLS.
+func Enabled(cfg config.TLSConfig) bool {
+	return cfg.CertFile != "" || cfg.KeyFile != ""
+}
+
+// Config loads the listener's key pair. It verifies client certificates
+// against ClientCAFile when one is configured, so they can be used as
+// credentials; RequireClientCert turns that into mutual TLS. name prefixes
+// the errors, e.g. "grpc" or "resp".
+func Config(name string, cfg config.TLSConfig) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load %s tls key pair: %w", name, err)
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	if cfg.ClientCAFile == "" {
+		if cfg.RequireClientCert {
+			return nil, fmt.Errorf("%s tls: require_client_cert needs a client_ca_file", name)
+		}
+		return tlsConfig, nil
+	}
+	caPEM, err := os.ReadFile(cfg.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("read %s client ca: %w", name, err)
+	}
+	tlsConfig.ClientCAs = x509.NewCertPool()
+	if !tlsConfig.ClientCAs.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates in %s", cfg.ClientCAFile)
+	}
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	if cfg.RequireClientCert {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
+// Listen opens a TCP listener on addr, wrapped in TLS when cfg enables it.
+func Listen(name, addr string, cfg config.TLSConfig) (net.Listener, error) {
+	var tlsConfig *tls.Config
+	if Enabled(cfg) {
+		var err error
+		if tlsConfig, err = Config(name, cfg); err != nil {
+			return nil, err
+		}
+	}
+	listen, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		listen = tls.NewListener(listen, tlsConfig)
+	}
+	return listen, nil
+}
+
+// CheckAuth refuses to run a listener that would take passwords or tokens in
+// plaintext from other hosts: with auth enabled it must either serve TLS or
+// bind to a loopback address.
+func CheckAuth(name, host string, cfg config.TLSConfig, authCfg config.AuthConfig) error {
+	if !authCfg.Enabled || Enabled(cfg) || isLoopback(host) {
+		return nil
+	}
+	return errors.New(name + ": auth on a non-loopback listener needs tls.cert_file and tls.key_file")
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
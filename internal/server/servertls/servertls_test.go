@@ -0,0 +1,125 @@
+package servertls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"mini-kv/internal/config"
+)
+
+func TestCheckAuth(t *testing.T) {
+	enabled := config.AuthConfig{Enabled: true}
+	withTLS := config.TLSConfig{CertFile: "cert.pem", KeyFile: "key.pem"}
+	for _, tt := range []struct {
+		host    string
+		tls     config.TLSConfig
+		auth    config.AuthConfig
+		wantErr bool
+	}{
+		{"0.0.0.0", config.TLSConfig{}, config.AuthConfig{}, false},
+		{"0.0.0.0", config.TLSConfig{}, enabled, true},
+		{"", config.TLSConfig{}, enabled, true},
+		{"10.0.0.5", config.TLSConfig{}, enabled, true},
+		{"0.0.0.0", withTLS, enabled, false},
+		{"127.0.0.1", config.TLSConfig{}, enabled, false},
+		{"::1", config.TLSConfig{}, enabled, false},
+		{"localhost", config.TLSConfig{}, enabled, false},
+	} {
+		err := CheckAuth("resp", tt.host, tt.tls, tt.auth)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("CheckAuth(%q, tls=%v, auth=%v) = %v, want error %v", tt.host, Enabled(tt.tls), tt.auth.Enabled, err, tt.wantErr)
+		}
+	}
+}
+
+func TestConfigRequiresClientCAForMutualTLS(t *testing.T) {
+	cfg := writeTestCert(t)
+	cfg.RequireClientCert = true
+	if _, err := Config("http", cfg); err == nil || !strings.Contains(err.Error(), "http tls: require_client_cert") {
+		t.Fatalf("Config error = %v, want missing client_ca_file", err)
+	}
+}
+
+func TestListenServesTLS(t *testing.T) {
+	cfg := writeTestCert(t)
+	listen, err := Listen("resp", "127.0.0.1:0", cfg)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer func() { _ = listen.Close() }()
+	go func() {
+		conn, err := listen.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		_, _ = conn.Write([]byte("ok"))
+	}()
+
+	pool := x509.NewCertPool()
+	caPEM, err := os.ReadFile(cfg.CertFile)
+	if err != nil {
+		t.Fatalf("read cert: %v", err)
+	}
+	pool.AppendCertsFromPEM(caPEM)
+	conn, err := tls.Dial("tcp", listen.Addr().String(), &tls.Config{RootCAs: pool, ServerName: "localhost"})
+	if err != nil {
+		t.Fatalf("tls dial: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+	got, err := io.ReadAll(conn)
+	if err != nil || string(got) != "ok" {
+		t.Fatalf("read = %q, %v; want ok", got, err)
+	}
+}
+
+// writeTestCert writes a self-signed certificate for localhost and 127.0.0.1.
+func writeTestCert(t *testing.T) config.TLSConfig {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	dir := t.TempDir()
+	cfg := config.TLSConfig{CertFile: filepath.Join(dir, "cert.pem"), KeyFile: filepath.Join(dir, "key.pem")}
+	if err := os.WriteFile(cfg.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write cert: %v", err)
+	}
+	if err := os.WriteFile(cfg.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	return cfg
+}
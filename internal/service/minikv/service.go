@@ -14,6 +14,23 @@ type Service interface {
 	Delete(ctx context.Context, key string) error
 }
 
+// Deleter 由能报告实际删除 key 数量的实现提供，协议层据此返回 DEL 之类命令的计数
+type Deleter interface {
+	DeleteKeys(ctx context.Context, keys ...string) (int64, error)
+}
+
+// Admin 是节点本地的运维接口，操作只作用于当前节点的存储，不经过 Raft 复制
+type Admin interface {
+	CompactRange(ctx context.Context, start, end string) error
+	ApproximateSize(ctx context.Context, start, end string) (size int64, count int64, err error)
+}
+
+// Leadership 由基于 Raft 的实现提供：当前节点是 leader 时返回自己的节点 ID，
+// 否则返回 raftstore.NotLeaderError，协议层据此告诉客户端 leader 在哪里
+type Leadership interface {
+	Leader(ctx context.Context) (string, error)
+}
+
 // RaftService 基于 raftstore.Runtime 实现 Service
 type RaftService struct {
 	runtime *raftstore.Runtime
@@ -21,6 +38,9 @@ type RaftService struct {
 
 // 编译期检查是否实现了接口
 var _ Service = (*RaftService)(nil)
+var _ Admin = (*RaftService)(nil)
+var _ Deleter = (*RaftService)(nil)
+var _ Leadership = (*RaftService)(nil)
 
 func NewRaft(runtime *raftstore.Runtime) *RaftService {
 	return &RaftService{runtime: runtime}
@@ -38,3 +58,23 @@ func (s *RaftService) Delete(ctx context.Context, key string) error {
 	_, err := s.runtime.Delete(ctx, key)
 	return err
 }
+
+func (s *RaftService) DeleteKeys(ctx context.Context, keys ...string) (int64, error) {
+	return s.runtime.Delete(ctx, keys...)
+}
+
+func (s *RaftService) Leader(context.Context) (string, error) {
+	leaderID := s.runtime.LeaderID()
+	if !s.runtime.IsLeader() {
+		return "", raftstore.NotLeaderError{LeaderID: leaderID}
+	}
+	return leaderID, nil
+}
+
+func (s *RaftService) CompactRange(ctx context.Context, start, end string) error {
+	return s.runtime.CompactRange(ctx, start, end)
+}
+
+func (s *RaftService) ApproximateSize(_ context.Context, start, end string) (int64, int64, error) {
+	return s.runtime.ApproximateSize(start, end)
+}
@@ -43,14 +43,17 @@ func makeRecordBatch(writeBatch *WriteBatch, seqStart uint64) (batch, error) {
 	entries := make([]entry, 0, len(writeBatch.Ops))
 	seq := seqStart
 	for _, op := range writeBatch.Ops {
+		var item entry
 		switch op.Type {
 		case OpPut:
 			// 创建 Put 条目，使用当前序列号 seq，然后 seq 递增
-			entries = append(entries, record.NewPut(op.Key, op.Value, seq))
+			item = record.NewPut(op.Key, op.Value, seq)
 		case OpDelete:
 			// 创建 Delete 条目，同样分配序列号
-			entries = append(entries, record.NewDelete(op.Key, seq))
+			item = record.NewDelete(op.Key, seq)
 		}
+		item.Family = op.Family.ID() // 记录所属列族，回放时据此恢复到对应的内存表
+		entries = append(entries, item)
 		seq++
 	}
 
@@ -58,4 +61,17 @@ func makeRecordBatch(writeBatch *WriteBatch, seqStart uint64) (batch, error) {
 		SeqStart: seqStart,
 		Entries:  entries,
 	}, nil
-}
\ No newline at end of file
+}
+
+// validateFamilies 校验批次中引用的列族均由本引擎打开
+func (e *Engine) validateFamilies(writeBatch *WriteBatch) error {
+	for i, op := range writeBatch.Ops {
+		if op.Family == nil {
+			continue
+		}
+		if _, err := e.family(op.Family); err != nil {
+			return fmt.Errorf("op %d: %w", i, err)
+		}
+	}
+	return nil
+}
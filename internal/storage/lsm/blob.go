@@ -0,0 +1,331 @@
+package lsm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"mini-kv/internal/storage/lsm/record"
+	"mini-kv/internal/storage/lsm/sstable"
+	"mini-kv/internal/storage/lsm/vlog"
+)
+
+// separateValues 在刷写时把长度达到列族阈值的值写入新的 Blob 文件，返回以值指针替换后的条目
+// 未启用键值分离或没有大值时原样返回，不创建文件
+func (e *Engine) separateValues(ctx context.Context, fam *family, entries []entry) ([]entry, []blobMeta, error) {
+	minValueSize := e.familyOptions(fam).MinBlobValueSize
+	if minValueSize <= 0 {
+		return entries, nil, nil
+	}
+	var writer *vlog.Writer
+	var fileNum uint64
+	out := make([]entry, len(entries))
+	for i, item := range entries {
+		out[i] = item
+		if item.Kind != record.KindPut || len(item.Value) < minValueSize {
+			continue
+		}
+		if writer == nil {
+			fileNum = e.allocateFileNum()
+			created, err := vlog.Create(e.dir, fileNum)
+			if err != nil {
+				return nil, nil, wrapIO("create blob file", err)
+			}
+			writer = created
+		}
+		if err := e.rateLimiter.Wait(ctx, sstable.WriteReasonFlush, len(item.Value)); err != nil {
+			return nil, nil, errors.Join(wrapContext("flush canceled", err), writer.Abort())
+		}
+		ptr, err := writer.Add(item.Key, item.Value)
+		if err != nil {
+			return nil, nil, errors.Join(wrapIO("write blob record", err), writer.Abort())
+		}
+		out[i] = entry{Key: item.Key, Value: ptr.Encode(), Seq: item.Seq, Kind: record.KindValuePointer, Family: item.Family}
+	}
+	if writer == nil {
+		return entries, nil, nil
+	}
+	size, count, err := writer.Finish()
+	if err != nil {
+		return nil, nil, errors.Join(wrapIO("finish blob file", err), vlog.Remove(e.dir, fileNum))
+	}
+	return out, []blobMeta{{FileNum: fileNum, Size: size, Count: count}}, nil
+}
+
+// entryValue 返回条目对用户可见的值，值指针会从 Blob 文件中解析
+func (e *Engine) entryValue(item entry) ([]byte, bool, error) {
+	if item.Kind != record.KindValuePointer {
+		return visibleValue(item)
+	}
+	value, err := e.readBlobValue(item)
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// resolveEntries 将条目中的值指针替换为实际值，调用方需持有 blobMu 读锁
+func (e *Engine) resolveEntries(entries []entry) ([]entry, error) {
+	for i := range entries {
+		if entries[i].Kind != record.KindValuePointer {
+			continue
+		}
+		value, err := e.readBlobValue(entries[i])
+		if err != nil {
+			return nil, err
+		}
+		entries[i].Value = value
+		entries[i].Kind = record.KindPut
+	}
+	return entries, nil
+}
+
+// readBlobValue 按条目中的值指针读取 Blob 文件中的值
+func (e *Engine) readBlobValue(item entry) ([]byte, error) {
+	ptr, err := vlog.DecodePointer(item.Value)
+	if err != nil {
+		return nil, wrapBlobCorrupt("decode pointer", err)
+	}
+	reader, err := vlog.Open(e.dir, ptr.FileNum)
+	if err != nil {
+		return nil, wrapBlobCorrupt("open", err)
+	}
+	value, err := reader.Read(ptr, item.Key)
+	closeErr := reader.Close()
+	if err != nil {
+		return nil, wrapBlobCorrupt("read", err)
+	}
+	if closeErr != nil {
+		return nil, wrapBlobCorrupt("close", closeErr)
+	}
+	return value, nil
+}
+
+// droppedBlobValues 统计合并中被丢弃的值指针，即出现在输入中但未保留到输出的记录
+func droppedBlobValues(inputs, outputs []entry) ([]blobGarbage, error) {
+	kept := make(map[string]struct{})
+	for _, item := range outputs {
+		if item.Kind == record.KindValuePointer {
+			kept[string(item.Value)] = struct{}{}
+		}
+	}
+	var garbage []blobGarbage
+	for _, item := range inputs {
+		if item.Kind != record.KindValuePointer {
+			continue
+		}
+		if _, ok := kept[string(item.Value)]; ok {
+			continue
+		}
+		ptr, err := vlog.DecodePointer(item.Value)
+		if err != nil {
+			return nil, wrapBlobCorrupt("decode pointer", err)
+		}
+		garbage = addBlobGarbage(garbage, blobGarbage{FileNum: ptr.FileNum, Bytes: int64(ptr.Size), Count: 1})
+	}
+	return garbage, nil
+}
+
+// addBlobGarbage 按文件编号累加失效统计
+func addBlobGarbage(garbage []blobGarbage, add blobGarbage) []blobGarbage {
+	for i := range garbage {
+		if garbage[i].FileNum == add.FileNum {
+			garbage[i].Bytes += add.Bytes
+			garbage[i].Count += add.Count
+			return garbage
+		}
+	}
+	return append(garbage, add)
+}
+
+// collectBlobGarbage 重写失效比例达到 BlobGCRatio 的 Blob 文件，与合并任务串行执行
+func (e *Engine) collectBlobGarbage(ctx context.Context) error {
+	if e.manifest == nil {
+		return nil
+	}
+	e.compactMu.Lock()
+	defer e.compactMu.Unlock()
+	for _, meta := range e.currentVersion().Blobs {
+		if meta.GarbageRatio() < e.opts.BlobGCRatio {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return wrapContext("blob gc canceled", err)
+		}
+		if err := e.rewriteBlob(ctx, meta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// liveBlobValue 是回收时仍被最新版本引用的 Blob 记录
+type liveBlobValue struct {
+	family uint32 // 引用该记录的列族
+	key    []byte
+	value  []byte
+	ptr    []byte // 原值指针编码
+}
+
+// rewriteBlob 把 Blob 文件中仍存活的值复制到新文件，通过写入新的值指针让 LSM 引用新文件，再删除旧文件
+// 顺序：新文件落盘并写入 MANIFEST → 经 WAL 写入新指针 → MANIFEST 删除旧文件 → 删除旧文件
+// 任一步骤崩溃时旧文件仍在 MANIFEST 中，已写入的指针也都指向已登记的文件
+func (e *Engine) rewriteBlob(ctx context.Context, meta blobMeta) error {
+	reader, err := vlog.Open(e.dir, meta.FileNum)
+	if err != nil {
+		return wrapBlobCorrupt("open gc input", err)
+	}
+	readSeq := e.lastSeq.Load()
+	var live []liveBlobValue
+	err = reader.Iterate(func(ptr vlog.Pointer, key, value []byte) error {
+		encoded := ptr.Encode()
+		familyID, ok, err := e.blobValueOwner(key, encoded, readSeq)
+		if err != nil || !ok {
+			return err
+		}
+		live = append(live, liveBlobValue{family: familyID, key: record.CloneBytes(key), value: record.CloneBytes(value), ptr: encoded})
+		return nil
+	})
+	closeErr := reader.Close()
+	if err != nil {
+		return wrapBlobCorrupt("read gc input", err)
+	}
+	if closeErr != nil {
+		return wrapBlobCorrupt("close gc input", closeErr)
+	}
+
+	var garbage []blobGarbage
+	if len(live) > 0 {
+		output, ptrs, err := e.writeBlob(ctx, live)
+		if err != nil {
+			return err
+		}
+		edit := versionEdit{NextFileNum: e.nextFileNum.Load(), AddedBlobs: []blobMeta{output}}
+		if err := e.manifest.Apply(edit); err != nil {
+			return errors.Join(fmt.Errorf("manifest apply blob gc output: %w", err), vlog.Remove(e.dir, output.FileNum))
+		}
+		e.publishVersion(edit)
+		if garbage, err = e.relocateBlobValues(live, ptrs); err != nil {
+			return err
+		}
+	}
+
+	edit := versionEdit{
+		NextFileNum:  e.nextFileNum.Load(),
+		DeletedBlobs: []uint64{meta.FileNum},
+		BlobGarbage:  garbage,
+	}
+	if err := e.manifest.Apply(edit); err != nil {
+		return fmt.Errorf("manifest apply blob gc: %w", err)
+	}
+	e.publishVersion(edit)
+
+	// 等待正在解析旧指针的读取结束后再删除文件
+	e.blobMu.Lock()
+	defer e.blobMu.Unlock()
+	if err := vlog.Remove(e.dir, meta.FileNum); err != nil {
+		return wrapBlobCorrupt("remove obsolete blob", err)
+	}
+	e.metrics.blobGCRuns.Add(1)
+	return nil
+}
+
+// writeBlob 将存活的值写入新的 Blob 文件，返回文件元数据及各值的新指针
+func (e *Engine) writeBlob(ctx context.Context, live []liveBlobValue) (blobMeta, []vlog.Pointer, error) {
+	fileNum := e.allocateFileNum()
+	writer, err := vlog.Create(e.dir, fileNum)
+	if err != nil {
+		return blobMeta{}, nil, wrapIO("create blob file", err)
+	}
+	ptrs := make([]vlog.Pointer, len(live))
+	for i, item := range live {
+		if err := e.rateLimiter.Wait(ctx, sstable.WriteReasonCompaction, len(item.value)); err != nil {
+			return blobMeta{}, nil, errors.Join(wrapContext("blob gc canceled", err), writer.Abort())
+		}
+		if ptrs[i], err = writer.Add(item.key, item.value); err != nil {
+			return blobMeta{}, nil, errors.Join(wrapIO("write blob record", err), writer.Abort())
+		}
+	}
+	size, count, err := writer.Finish()
+	if err != nil {
+		return blobMeta{}, nil, errors.Join(wrapIO("finish blob file", err), vlog.Remove(e.dir, fileNum))
+	}
+	return blobMeta{FileNum: fileNum, Size: size, Count: count}, ptrs, nil
+}
+
+// relocateBlobValues 持有写锁重新确认每个值仍被最新版本引用，并以新序列号写入指向新文件的值指针
+// 期间被覆盖或删除的值不再写入，返回它们在新文件中占用的失效统计
+func (e *Engine) relocateBlobValues(live []liveBlobValue, ptrs []vlog.Pointer) ([]blobGarbage, error) {
+	e.writeMu.Lock()
+	defer e.writeMu.Unlock()
+
+	readSeq := e.lastSeq.Load()
+	relocated := batch{SeqStart: readSeq + 1}
+	var garbage []blobGarbage
+	for i, item := range live {
+		ok, err := e.blobValueLive(e.families[item.family], item.key, item.ptr, readSeq)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			garbage = addBlobGarbage(garbage, blobGarbage{FileNum: ptrs[i].FileNum, Bytes: int64(ptrs[i].Size), Count: 1})
+			continue
+		}
+		relocated.Entries = append(relocated.Entries, entry{
+			Key:    item.key,
+			Value:  ptrs[i].Encode(),
+			Seq:    relocated.SeqStart + uint64(len(relocated.Entries)),
+			Kind:   record.KindValuePointer,
+			Family: item.family,
+		})
+	}
+	if len(relocated.Entries) == 0 {
+		return garbage, nil
+	}
+
+	// 新指针必须先持久化到 WAL，旧文件才能删除
+	if e.wal != nil {
+		if err := e.wal.Append(relocated, false); err != nil {
+			return nil, wrapWAL("append", wrapIO("append blob relocation", err))
+		}
+		if err := e.wal.Sync(); err != nil {
+			return nil, wrapWAL("sync", wrapIO("sync blob relocation", err))
+		}
+	}
+	e.memMu.Lock()
+	if err := e.applyEntriesLocked(relocated.Entries); err != nil {
+		e.memMu.Unlock()
+		return nil, err
+	}
+	e.lastSeq.Store(relocated.SeqStart + uint64(len(relocated.Entries)) - 1)
+	rotated := e.rotateFamiliesLocked(relocated.Entries)
+	e.memMu.Unlock()
+	if rotated {
+		e.requestFlush()
+	}
+	return garbage, nil
+}
+
+// blobValueOwner 查找最新版本仍引用指定值指针的列族；值指针在所有列族中唯一，至多一个列族引用
+func (e *Engine) blobValueOwner(key, ptr []byte, readSeq uint64) (uint32, bool, error) {
+	for _, fam := range e.sortedFamilies() {
+		ok, err := e.blobValueLive(fam, key, ptr, readSeq)
+		if err != nil {
+			return 0, false, err
+		}
+		if ok {
+			return fam.handle.id, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// blobValueLive 判断列族中键在 readSeq 下的最新版本是否仍是指定的值指针
+func (e *Engine) blobValueLive(fam *family, key, ptr []byte, readSeq uint64) (bool, error) {
+	item, ok, err := e.getEntry(fam, key, readSeq)
+	if err != nil || !ok {
+		return false, err
+	}
+	return item.Kind == record.KindValuePointer && bytes.Equal(item.Value, ptr), nil
+}
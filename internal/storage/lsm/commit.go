@@ -0,0 +1,169 @@
+package lsm
+
+import "fmt"
+
+// maxWriteGroupBytes 限制单次组提交合并的批次字节数，避免 leader 携带过大的写入组
+const maxWriteGroupBytes = 1 << 20
+
+// writeRequest 表示写入队列中的一个写请求
+type writeRequest struct {
+	batch *WriteBatch   // 待写入的批次
+	sync  bool          // 是否要求落盘
+	err   error         // 组提交结果，由 leader 填写
+	done  bool          // 是否已被其他 leader 提交
+	ready chan struct{} // 关闭时表示请求已完成或轮到该请求担任 leader
+}
+
+// commitWrite 将写请求加入队列，队首请求担任 leader 合并后续请求一起写 WAL 与 MemTable
+func (e *Engine) commitWrite(req *writeRequest) error {
+	e.writeQueueMu.Lock()
+	e.writeQueue = append(e.writeQueue, req)
+	leader := len(e.writeQueue) == 1
+	e.writeQueueMu.Unlock()
+
+	if !leader {
+		<-req.ready
+		if req.done {
+			return req.err // 已由其他 leader 提交
+		}
+	}
+
+	group := e.pickWriteGroup()
+	err := e.applyWriteGroup(group)
+
+	// 出队并唤醒同组 follower，再把 leader 身份交给新的队首
+	e.writeQueueMu.Lock()
+	e.writeQueue = e.writeQueue[len(group):]
+	var next *writeRequest
+	if len(e.writeQueue) > 0 {
+		next = e.writeQueue[0]
+	}
+	e.writeQueueMu.Unlock()
+
+	for _, follower := range group[1:] {
+		follower.err = err
+		follower.done = true
+		close(follower.ready)
+	}
+	if next != nil {
+		close(next.ready)
+	}
+	return err
+}
+
+// pickWriteGroup 从队首开始选取本次要合并提交的请求
+func (e *Engine) pickWriteGroup() []*writeRequest {
+	e.writeQueueMu.Lock()
+	defer e.writeQueueMu.Unlock()
+
+	size := writeBatchSize(e.writeQueue[0].batch)
+	n := 1
+	for ; n < len(e.writeQueue); n++ {
+		size += writeBatchSize(e.writeQueue[n].batch)
+		if size > maxWriteGroupBytes {
+			break
+		}
+	}
+	return append([]*writeRequest(nil), e.writeQueue[:n]...)
+}
+
+// applyWriteGroup 为写入组分配连续序列号，合并为一条 WAL 记录并至多同步一次，再按顺序写入 MemTable
+func (e *Engine) applyWriteGroup(group []*writeRequest) error {
+	e.writeMu.Lock()
+	defer e.writeMu.Unlock()
+
+	// 分配序列号并合并批次
+	seqStart := e.lastSeq.Load() + 1
+	merged := batch{SeqStart: seqStart}
+	shouldSync := false
+	for _, req := range group {
+		recordBatch, err := makeRecordBatch(req.batch, seqStart+uint64(len(merged.Entries)))
+		if err != nil {
+			return err
+		}
+		merged.Entries = append(merged.Entries, recordBatch.Entries...)
+		shouldSync = shouldSync || req.sync
+	}
+	e.metrics.observeWriteGroup(len(group))
+
+	// 先写 WAL
+	if e.wal != nil {
+		if err := e.wal.Append(merged, false); err != nil {
+			return wrapWAL("append", wrapIO("append record", err))
+		}
+		if shouldSync {
+			startedAt := e.clock.Now()
+			if err := e.wal.Sync(); err != nil {
+				return wrapWAL("sync", wrapIO("sync record", err))
+			}
+			e.observeWALSync(e.clock.Now().Sub(startedAt))
+		}
+	}
+
+	// 再按列族写 MemTable
+	e.memMu.Lock()
+	if err := e.applyEntriesLocked(merged.Entries); err != nil {
+		e.memMu.Unlock()
+		return err
+	}
+	e.lastSeq.Store(seqStart + uint64(len(merged.Entries)) - 1)
+	// 检查涉及的列族是否需要冻结 MemTable
+	rotated := e.rotateFamiliesLocked(merged.Entries)
+	e.memMu.Unlock()
+
+	// 若发生了冻结，触发刷写
+	if rotated {
+		e.requestFlush()
+	}
+	return nil
+}
+
+// applyEntriesLocked 将条目按列族分组写入各自的活跃 MemTable，调用方需持有 memMu
+func (e *Engine) applyEntriesLocked(entries []entry) error {
+	if len(e.families) == 1 {
+		// 只有默认列族时无需分组
+		if err := e.defaultFamily.mem.Apply(entries); err != nil {
+			return fmt.Errorf("memtable apply: %w", err)
+		}
+		return nil
+	}
+	grouped := make(map[uint32][]entry)
+	for _, item := range entries {
+		grouped[item.Family] = append(grouped[item.Family], item)
+	}
+	for id, items := range grouped {
+		fam, ok := e.families[id]
+		if !ok {
+			return fmt.Errorf("%w: unknown column family %d", ErrInvalidBatch, id)
+		}
+		if err := fam.mem.Apply(items); err != nil {
+			return fmt.Errorf("memtable apply: %w", err)
+		}
+	}
+	return nil
+}
+
+// rotateFamiliesLocked 检查条目涉及的列族是否需要冻结 MemTable，返回是否发生了冻结
+func (e *Engine) rotateFamiliesLocked(entries []entry) bool {
+	rotated := false
+	seen := make(map[uint32]bool)
+	for _, item := range entries {
+		if seen[item.Family] {
+			continue
+		}
+		seen[item.Family] = true
+		if fam, ok := e.families[item.Family]; ok && e.rotateMemTableLocked(fam) {
+			rotated = true
+		}
+	}
+	return rotated
+}
+
+// writeBatchSize 估算批次编码后的字节数
+func writeBatchSize(writeBatch *WriteBatch) int {
+	size := 0
+	for _, op := range writeBatch.Ops {
+		size += len(op.Key) + len(op.Value)
+	}
+	return size
+}
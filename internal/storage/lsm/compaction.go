@@ -5,9 +5,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 
 	"mini-kv/internal/storage/lsm/compact"
 	"mini-kv/internal/storage/lsm/record"
+	"mini-kv/internal/storage/lsm/sstable"
+	"mini-kv/internal/storage/lsm/vlog"
 )
 
 // flushRequest 表示一次刷写请求，可选地携带用于接收结果的错误通道。
@@ -16,8 +19,11 @@ type flushRequest struct {
 }
 
 // compactionRequest 表示一次合并请求，可选地携带用于接收结果的错误通道。
+// manual 非空时表示对 family 的手动范围合并，否则对所有列族执行常规的 Level 0 合并。
 type compactionRequest struct {
-	errCh chan<- error
+	errCh  chan<- error
+	family *family
+	manual *keyBounds
 }
 
 // compactionJob 描述一次合并任务的目标层级。
@@ -66,7 +72,8 @@ func (e *Engine) flushWorker(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case request := <-e.flushCh:
-			err := e.flushMemTables(ctx)
+			// 手动刷写冻结所有列族的活跃表，后台刷写只处理已冻结的不可变表
+			err := e.flushMemTables(ctx, request.errCh != nil)
 			e.setBackgroundError(err)
 			if request.errCh != nil {
 				select {
@@ -78,7 +85,7 @@ func (e *Engine) flushWorker(ctx context.Context) {
 	}
 }
 
-// compactionWorker 是后台合并协程，循环处理合并请求并执行 runCompaction。
+// compactionWorker 是后台合并协程，循环处理合并请求并执行 runCompaction，之后执行 Blob 回收。
 func (e *Engine) compactionWorker(ctx context.Context) {
 	defer e.wg.Done()
 	for {
@@ -86,7 +93,20 @@ func (e *Engine) compactionWorker(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case request := <-e.compactCh:
-			err := e.runCompaction(ctx, compactionJob{level: 0})
+			var err error
+			if request.manual != nil {
+				err = e.compactRange(ctx, request.family, *request.manual)
+			} else {
+				for _, fam := range e.sortedFamilies() {
+					if err = e.runCompaction(ctx, fam, compactionJob{level: 0}); err != nil {
+						break
+					}
+				}
+			}
+			// 合并会产生失效的 Blob 记录，随后回收失效比例过高的 Blob 文件
+			if err == nil {
+				err = e.collectBlobGarbage(ctx)
+			}
 			e.setBackgroundError(err)
 			if request.errCh != nil {
 				select {
@@ -98,40 +118,73 @@ func (e *Engine) compactionWorker(ctx context.Context) {
 	}
 }
 
-// flushMemTables 将当前活跃 MemTable 冻结并刷写到 Level 0 的 SSTable。
-// 刷写完成后更新 MANIFEST，清理 WAL，并在必要时触发合并。
-func (e *Engine) flushMemTables(ctx context.Context) error {
+// flushMemTables 在 freezeActive 时冻结各列族的活跃 MemTable，再把每个列族最早的不可变表刷写到 Level 0 的 SSTable。
+// 刷写完成后更新 MANIFEST，清理所有列族都不再需要的 WAL，并在必要时触发合并。
+func (e *Engine) flushMemTables(ctx context.Context, freezeActive bool) error {
 	if err := ctx.Err(); err != nil {
 		return wrapContext("flush canceled", err)
 	}
 
-	e.writeMu.Lock()
-	defer e.writeMu.Unlock()
-
 	// 冻结活跃 MemTable，若未超过不可变表数量限制则生成新的活跃表
+	// 只在冻结时持有写锁，构建 SSTable 期间写入可继续进入活跃表，由节流机制控制堆积
+	e.writeMu.Lock()
 	e.memMu.Lock()
-	if e.mem != nil && e.mem.ApproximateSize() > 0 && len(e.imm) < e.opts.MaxImmutableTables {
-		e.imm = append(e.imm, e.mem.Freeze())
-		e.mem = e.memTableFactory.NewMutable()
-		e.publishViewLocked()
+	families := e.sortedFamiliesLocked()
+	for _, fam := range families {
+		if freezeActive && fam.mem != nil && fam.mem.ApproximateSize() > 0 && len(fam.imm) < fam.opts.MaxImmutableTables {
+			e.freezeMemTableLocked(fam)
+		}
 	}
-	if len(e.imm) == 0 {
-		e.memMu.Unlock()
-		return nil
+	e.writeMu.Unlock()
+	// 每个列族取最早的不可变表进行刷写
+	oldest := make(map[*family]immutableMemTable)
+	for _, fam := range families {
+		if len(fam.imm) > 0 {
+			oldest[fam] = fam.imm[0]
+		}
 	}
-	// 取最早的不可变表进行刷写
-	immutable := e.imm[0]
-	entries := immutable.Entries()
 	e.memMu.Unlock()
+	if len(oldest) == 0 {
+		return nil
+	}
+
+	for _, fam := range families {
+		immutable, ok := oldest[fam]
+		if !ok {
+			continue
+		}
+		if err := e.flushImmutable(ctx, fam, immutable); err != nil {
+			return err
+		}
+	}
 
+	// 刷写成功后清理所有列族都已刷写的 WAL
+	e.memMu.RLock()
+	purgeSeq := e.walPurgeSeqLocked()
+	pending := false
+	for _, fam := range families {
+		pending = pending || len(fam.imm) > 0
+	}
+	e.memMu.RUnlock()
+	if e.wal != nil {
+		if err := e.wal.Purge(purgeSeq); err != nil {
+			return wrapWAL("purge", err)
+		}
+	}
+	e.notifyStallWaiters()
+	// 仍有待刷写的不可变表时继续刷写，避免写入因不可变表堆积而停顿
+	if pending {
+		e.requestFlush()
+	}
+	return nil
+}
+
+// flushImmutable 将列族的一个不可变表刷写为 Level 0 的 SSTable，并从不可变表队列中移除。
+func (e *Engine) flushImmutable(ctx context.Context, fam *family, immutable immutableMemTable) error {
+	entries := immutable.Entries()
 	if len(entries) == 0 {
 		// 空表直接移除
-		e.memMu.Lock()
-		if len(e.imm) > 0 && e.imm[0] == immutable {
-			e.imm = e.imm[1:]
-			e.publishViewLocked()
-		}
-		e.memMu.Unlock()
+		e.removeImmutable(fam, immutable)
 		return nil
 	}
 
@@ -139,54 +192,79 @@ func (e *Engine) flushMemTables(ctx context.Context) error {
 		return ErrNotImplemented
 	}
 
+	startedAt := e.clock.Now()
+	// 启用键值分离时先把大值写入 Blob 文件
+	flushCtx := sstable.ContextWithColumnFamily(sstable.ContextWithWriteReason(ctx, sstable.WriteReasonFlush), fam.handle.id)
+	tableEntries, blobs, err := e.separateValues(flushCtx, fam, entries)
+	if err != nil {
+		return err
+	}
+
 	// 分配文件编号并构建 SSTable
 	fileNum := e.allocateFileNum()
-	meta, err := e.tables.Build(ctx, fileNum, 0, entries)
+	meta, err := e.tables.Build(flushCtx, fileNum, 0, tableEntries)
 	if err != nil {
-		return wrapSSTableCorrupt("build", err)
+		return errors.Join(wrapSSTableCorrupt("build", err), e.removeUncommittedBlobs(blobs))
 	}
 
-	// 生成版本变更记录
+	// 生成版本变更记录，FlushedSeq 记录该列族已持久化到 SSTable 的进度
 	edit := versionEdit{
 		NextFileNum: e.nextFileNum.Load(),
 		LastSeq:     maxSeq(entries),
+		Family:      fam.handle.id,
+		FlushedSeq:  maxSeq(entries),
 		Added:       []tableMeta{meta},
+		AddedBlobs:  blobs,
 	}
 	if err := e.manifest.Apply(edit); err != nil {
-		// MANIFEST 写入失败，删除已生成的 SSTable
-		removeErr := e.tables.Remove(fileNum)
+		// MANIFEST 写入失败，删除已生成的 SSTable 与 Blob 文件
+		removeErr := errors.Join(e.removeUncommittedBlobs(blobs), e.tables.Remove(fileNum))
 		if removeErr != nil {
 			return errors.Join(fmt.Errorf("manifest apply flush: %w", err), wrapSSTableCorrupt("remove uncommitted flush output", removeErr))
 		}
 		return fmt.Errorf("manifest apply flush: %w", err)
 	}
 	e.publishVersion(edit)
+	e.removeImmutable(fam, immutable)
+	flushed := meta.Size
+	for _, blob := range blobs {
+		flushed += blob.Size
+	}
+	e.observeFlush(fam, flushed, e.clock.Now().Sub(startedAt))
 
-	// 刷写成功后清理对应序列号之前的 WAL
-	if e.wal != nil {
-		if err := e.wal.Purge(edit.LastSeq); err != nil {
-			return wrapWAL("purge", err)
-		}
+	// 检查 Level 0 文件数是否达到触发合并的阈值
+	if l0Count := len(e.familyVersion(fam.handle.id).FilesInRange(0, nil, nil)); l0Count >= e.familyOptions(fam).L0CompactionTrigger {
+		e.requestCompaction()
 	}
+	return nil
+}
 
-	// 从不可变表列表中移除已刷写的表
+// removeImmutable 从列族的不可变表队列中移除已刷写的表。
+func (e *Engine) removeImmutable(fam *family, immutable immutableMemTable) {
 	e.memMu.Lock()
-	if len(e.imm) > 0 && e.imm[0] == immutable {
-		e.imm = e.imm[1:]
-		e.publishViewLocked()
+	defer e.memMu.Unlock()
+	if len(fam.imm) > 0 && fam.imm[0] == immutable {
+		fam.imm = fam.imm[1:]
+		fam.publishViewLocked()
 	}
-	e.memMu.Unlock()
+}
 
-	// 检查 Level 0 文件数是否达到触发合并的阈值
-	if l0Count := len(e.currentVersion().FilesInRange(0, nil, nil)); l0Count >= e.opts.L0CompactionTrigger {
-		e.requestCompaction()
+// walPurgeSeqLocked 返回可以安全清理的 WAL 序列号上限：仍有未刷写数据的列族需要保留其刷写进度之后的全部记录。
+// 调用方需持有 memMu，此时已分配序列号的写入都已进入内存表。
+func (e *Engine) walPurgeSeqLocked() uint64 {
+	purgeSeq := e.lastSeq.Load()
+	state := e.currentVersion()
+	for id, fam := range e.families {
+		if fam.hasUnflushedLocked() {
+			purgeSeq = min(purgeSeq, state.FlushedSeq(id))
+		}
 	}
-	return nil
+	return purgeSeq
 }
 
-// runCompaction 执行一次合并任务，将 Level 0 的全部文件合并到 Level 1。
+// runCompaction 执行一次合并任务，将列族 Level 0 的全部文件合并到 Level 1。
 // 合并过程：读取所有输入文件条目 → 去重保留最新可见版本 → 生成新 SSTable → 更新 MANIFEST → 删除旧文件。
-func (e *Engine) runCompaction(ctx context.Context, job compactionJob) error {
+func (e *Engine) runCompaction(ctx context.Context, fam *family, job compactionJob) error {
 	if err := ctx.Err(); err != nil {
 		return wrapContext("compaction canceled", err)
 	}
@@ -197,9 +275,11 @@ func (e *Engine) runCompaction(ctx context.Context, job compactionJob) error {
 		return fmt.Errorf("%w: negative compaction level", ErrInvalidState)
 	}
 
-	state := e.currentVersion()
+	e.compactMu.Lock()
+	defer e.compactMu.Unlock()
+	state := e.familyVersion(fam.handle.id)
 	// 使用 Picker 选择需要合并的 Level 0 文件
-	picked, ok := (compact.Picker{L0Trigger: e.opts.L0CompactionTrigger}).Pick(state)
+	picked, ok := (compact.Picker{L0Trigger: e.familyOptions(fam).L0CompactionTrigger}).Pick(state)
 	if !ok || picked.Level != job.level {
 		return nil
 	}
@@ -213,66 +293,81 @@ func (e *Engine) runCompaction(ctx context.Context, job compactionJob) error {
 			inputs = append(inputs, meta)
 		}
 	}
+	return e.compactTables(ctx, fam, inputs, job.level+1)
+}
 
-	// 读取所有输入文件的条目
-	entries := make([]entry, 0)
-	for _, meta := range inputs {
-		reader, err := e.tables.Open(meta)
-		if err != nil {
-			return wrapSSTableCorrupt("open compaction input", err)
-		}
-		tableEntries, err := reader.Entries()
-		closeErr := reader.Close()
-		if err != nil {
-			return wrapSSTableCorrupt("read compaction input", err)
-		}
-		if closeErr != nil {
-			return wrapSSTableCorrupt("close compaction input", closeErr)
-		}
-		entries = append(entries, tableEntries...)
-	}
-
-	// 合并条目，去重并保留最新可见版本
-	merged, err := mergeVisibleEntries(entries)
+// compactTables 将输入文件合并为位于 outputLevel 的新 SSTable，并删除全部输入文件。
+// 输入较大时按键范围拆分为多个子合并并行执行，每个子合并输出一个文件，输出文件之间互不重叠。
+// 输出层必须是最底层或输入已覆盖所有更低层的重叠文件，因为合并时会丢弃删除标记。
+func (e *Engine) compactTables(ctx context.Context, fam *family, inputs []tableMeta, outputLevel int) error {
+	ranges, err := e.subcompactionRanges(inputs)
 	if err != nil {
 		return err
 	}
-	outputLevel := job.level + 1
-	var added []tableMeta
-	var outputFileNum uint64
-	if len(merged) > 0 {
-		// 构建合并后的新 SSTable，放入下一层
-		outputFileNum = e.allocateFileNum()
-		meta, err := e.tables.Build(ctx, outputFileNum, outputLevel, merged)
-		if err != nil {
-			return wrapSSTableCorrupt("build compaction output", err)
+	ctx = sstable.ContextWithColumnFamily(sstable.ContextWithWriteReason(ctx, sstable.WriteReasonCompaction), fam.handle.id)
+	startedAt := e.clock.Now()
+
+	// 每个子合并独立读取、合并并构建输出文件
+	outputs := make([]tableMeta, len(ranges))
+	garbage := make([][]blobGarbage, len(ranges))
+	errs := make([]error, len(ranges))
+	var wg sync.WaitGroup
+	for i, bounds := range ranges {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			outputs[i], garbage[i], errs[i] = e.runSubcompaction(ctx, inputs, bounds, outputLevel)
+		}()
+	}
+	wg.Wait()
+	e.metrics.subcompactions.Add(uint64(len(ranges)))
+
+	added := make([]tableMeta, 0, len(outputs))
+	for _, meta := range outputs {
+		if meta.FileNum != 0 {
+			added = append(added, meta)
 		}
-		added = []tableMeta{meta}
+	}
+	if err := errors.Join(errs...); err != nil {
+		// 部分子合并失败，删除其它子合并已生成的文件
+		return errors.Join(err, e.removeUncommitted(added))
 	}
 
 	// 准备被删除的旧文件列表
 	deleted := make([]uint64, 0, len(inputs))
+	var lastSeq uint64
+	var bytesRead, bytesWritten int64
 	for _, input := range inputs {
 		deleted = append(deleted, input.FileNum)
+		lastSeq = max(lastSeq, input.MaxSeq)
+		bytesRead += input.Size
+	}
+	for _, meta := range added {
+		bytesWritten += meta.Size
+	}
+
+	// 汇总被丢弃的值指针，计入对应 Blob 文件的失效统计
+	var dropped []blobGarbage
+	for _, items := range garbage {
+		for _, item := range items {
+			dropped = addBlobGarbage(dropped, item)
+		}
 	}
 
 	edit := versionEdit{
 		NextFileNum: e.nextFileNum.Load(),
-		LastSeq:     maxSeq(entries),
+		LastSeq:     lastSeq,
+		Family:      fam.handle.id,
 		Added:       added,
 		Deleted:     deleted,
+		BlobGarbage: dropped,
 	}
 	if err := e.manifest.Apply(edit); err != nil {
 		// MANIFEST 写入失败，删除新生成的 SSTable
-		if outputFileNum != 0 {
-			removeErr := e.tables.Remove(outputFileNum)
-			if removeErr != nil {
-				return errors.Join(fmt.Errorf("manifest apply compaction: %w", err), wrapSSTableCorrupt("remove uncommitted compaction output", removeErr))
-			}
-		}
-		return fmt.Errorf("manifest apply compaction: %w", err)
+		return errors.Join(fmt.Errorf("manifest apply compaction: %w", err), e.removeUncommitted(added))
 	}
 	e.publishVersion(edit)
+	e.observeCompaction(fam, outputLevel, bytesRead, bytesWritten, e.clock.Now().Sub(startedAt))
 
 	// 删除旧的 SSTable 文件
 	if err := e.removeTables(deleted); err != nil {
@@ -281,6 +376,28 @@ func (e *Engine) runCompaction(ctx context.Context, job compactionJob) error {
 	return nil
 }
 
+// removeUncommitted 删除未写入 MANIFEST 的合并输出文件。
+func (e *Engine) removeUncommitted(outputs []tableMeta) error {
+	var err error
+	for _, meta := range outputs {
+		if removeErr := e.tables.Remove(meta.FileNum); removeErr != nil {
+			err = errors.Join(err, wrapSSTableCorrupt("remove uncommitted compaction output", removeErr))
+		}
+	}
+	return err
+}
+
+// removeUncommittedBlobs 删除未写入 MANIFEST 的 Blob 文件。
+func (e *Engine) removeUncommittedBlobs(blobs []blobMeta) error {
+	var err error
+	for _, meta := range blobs {
+		if removeErr := vlog.Remove(e.dir, meta.FileNum); removeErr != nil {
+			err = errors.Join(err, wrapBlobCorrupt("remove uncommitted blob", removeErr))
+		}
+	}
+	return err
+}
+
 func tableKeyRange(files []tableMeta) ([]byte, []byte, bool) {
 	if len(files) == 0 {
 		return nil, nil, false
@@ -315,17 +432,6 @@ func overlappingTables(state *versionState, level int, lower, upper []byte) []ta
 	return out
 }
 
-// removeTables 批量删除指定的 SSTable 文件，收集所有错误并合并返回。
-func (e *Engine) removeTables(fileNums []uint64) error {
-	var err error
-	for _, fileNum := range fileNums {
-		if removeErr := e.tables.Remove(fileNum); removeErr != nil {
-			err = errors.Join(err, wrapSSTableCorrupt("remove obsolete table", removeErr))
-		}
-	}
-	return err
-}
-
 // maxSeq 返回条目切片中的最大序列号。
 func maxSeq(entries []record.Entry) uint64 {
 	var max uint64
@@ -18,6 +18,7 @@ type walOptions struct {
 // walStore 抽象了预写日志的必需操作。
 type walStore interface {
 	Append(b batch, syncWrite bool) error
+	Sync() error
 	Replay(func(batch) error) error
 	Purge(flushedSeq uint64) error
 	Close() error
@@ -61,8 +62,13 @@ type tableManager interface {
 // tableReader 提供对单个 SSTable 的读取能力。
 type tableReader interface {
 	Get(key []byte, seq uint64) (entry, bool, error)
+	MayContain(key []byte) (mayContain, filtered bool)
 	NewIterator(seq uint64, bounds keyBounds) (internalIterator, error)
 	Entries() ([]entry, error)
+	EntriesInRange(bounds keyBounds) ([]entry, error)
+	IndexEntries() []sstable.IndexEntry
+	VerifyChecksums() error
+	ApproximateRange(lower, upper []byte) (int64, int64)
 	Close() error
 }
 
@@ -102,10 +108,11 @@ type components struct {
 	TableManager    tableManager
 	ManifestFactory manifestFactory
 	Clock           clock
+	RateLimiter     *sstable.RateLimiter
 }
 
-// defaultComponents 返回基于真实实现的默认组件集合。
-func defaultComponents(dir string, opts Options) components {
+// defaultComponents 返回基于真实实现的默认组件集合，默认 SSTable 管理器使用给定的写入限速器。
+func defaultComponents(dir string, opts Options, limiter *sstable.RateLimiter) components {
 	return components{
 		WALFactory: walFactoryFunc(func(dir string, fileNum uint64, opts walOptions) (walStore, error) {
 			return wal.Open(dir, fileNum, wal.Options{SegmentSize: opts.SegmentSize})
@@ -113,17 +120,25 @@ func defaultComponents(dir string, opts Options) components {
 		MemTableFactory: memTableFactoryFunc(func() mutableMemTable {
 			return &memTableAdapter{table: memtable.New()}
 		}),
-		TableManager:    &tableManagerAdapter{manager: sstable.NewManager(dir, sstable.Options{BlockSize: opts.BlockSize})},
+		TableManager: &tableManagerAdapter{manager: sstable.NewManager(dir, sstable.Options{
+			BlockSize:     opts.BlockSize,
+			SkipChecksums: !opts.VerifyChecksums,
+			RateLimiter:   limiter,
+		})},
 		ManifestFactory: manifestFactoryFunc(func(dir string, fileNum uint64) (manifestStore, error) {
-			return manifest.Open(dir, fileNum)
+			return manifest.Open(dir, fileNum, manifest.Options{MaxFileSize: opts.ManifestMaxSize})
 		}),
-		Clock: systemClock{},
+		Clock:       systemClock{},
+		RateLimiter: limiter,
 	}
 }
 
 // withDefaults 用默认值填充 components 中未设置的字段。
 func (c components) withDefaults(dir string, opts Options) components {
-	defaults := defaultComponents(dir, opts)
+	if c.RateLimiter == nil {
+		c.RateLimiter = sstable.NewRateLimiter(opts.WriteRateLimit)
+	}
+	defaults := defaultComponents(dir, opts, c.RateLimiter)
 	if c.WALFactory == nil {
 		c.WALFactory = defaults.WALFactory
 	}
@@ -193,6 +208,10 @@ func (r *tableReaderAdapter) Get(key []byte, seq uint64) (entry, bool, error) {
 	return r.reader.Get(key, seq)
 }
 
+func (r *tableReaderAdapter) MayContain(key []byte) (bool, bool) {
+	return r.reader.MayContain(key)
+}
+
 func (r *tableReaderAdapter) NewIterator(seq uint64, bounds keyBounds) (internalIterator, error) {
 	return r.reader.NewIterator(seq, bounds)
 }
@@ -201,6 +220,22 @@ func (r *tableReaderAdapter) Entries() ([]entry, error) {
 	return r.reader.Entries()
 }
 
+func (r *tableReaderAdapter) EntriesInRange(bounds keyBounds) ([]entry, error) {
+	return r.reader.EntriesInRange(bounds)
+}
+
+func (r *tableReaderAdapter) IndexEntries() []sstable.IndexEntry {
+	return r.reader.IndexEntries()
+}
+
+func (r *tableReaderAdapter) VerifyChecksums() error {
+	return r.reader.VerifyChecksums()
+}
+
+func (r *tableReaderAdapter) ApproximateRange(lower, upper []byte) (int64, int64) {
+	return r.reader.ApproximateRange(lower, upper)
+}
+
 func (r *tableReaderAdapter) Close() error {
 	return r.reader.Close()
 }
@@ -260,4 +295,4 @@ type systemClock struct{}
 
 func (systemClock) Now() time.Time {
 	return time.Now()
-}
\ No newline at end of file
+}
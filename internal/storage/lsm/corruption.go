@@ -0,0 +1,88 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"mini-kv/internal/storage/lsm/sstable"
+)
+
+// VerifyChecksums 校验所有存活 SSTable 的索引、布隆过滤器与数据块，损坏的表会被标记
+func (e *Engine) VerifyChecksums() error {
+	e.lifecycleMu.RLock()
+	defer e.lifecycleMu.RUnlock()
+	if e.isClosed {
+		return ErrClosed
+	}
+	if e.tables == nil {
+		return nil
+	}
+
+	files := e.pinTables(func() []tableMeta {
+		state := e.currentVersion()
+		var files []tableMeta
+		for _, id := range state.FamilyIDs() {
+			files = append(files, state.Family(id).AllFiles()...)
+		}
+		return files
+	})
+	defer e.unpinTables(files)
+	var errs []error
+	for _, meta := range files {
+		reader, err := e.tables.Open(meta)
+		if err != nil {
+			errs = append(errs, e.tableError(meta, "verify open", err))
+			continue
+		}
+		verifyErr := reader.VerifyChecksums()
+		closeErr := reader.Close()
+		if verifyErr != nil {
+			errs = append(errs, e.tableError(meta, "verify", verifyErr))
+		}
+		if closeErr != nil {
+			errs = append(errs, wrapSSTableCorrupt("close", closeErr))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// BadTables 返回已检测到损坏的 SSTable 文件编号
+func (e *Engine) BadTables() []uint64 {
+	e.badMu.Lock()
+	defer e.badMu.Unlock()
+	fileNums := make([]uint64, 0, len(e.badTables))
+	for fileNum := range e.badTables {
+		fileNums = append(fileNums, fileNum)
+	}
+	slices.Sort(fileNums)
+	return fileNums
+}
+
+// badTableError 若表已被标记损坏则返回记录的错误，避免继续读取损坏数据
+func (e *Engine) badTableError(fileNum uint64) error {
+	e.badMu.Lock()
+	defer e.badMu.Unlock()
+	err, ok := e.badTables[fileNum]
+	if !ok {
+		return nil
+	}
+	return wrapSSTableCorrupt("read", fmt.Errorf("table %d marked bad: %w", fileNum, err))
+}
+
+// tableError 包装表读取错误，校验失败时将该表标记为损坏并计入指标
+func (e *Engine) tableError(meta tableMeta, op string, err error) error {
+	if errors.Is(err, sstable.ErrCorrupt) {
+		e.metrics.checksumFailures.Add(1)
+		e.badMu.Lock()
+		if e.badTables == nil {
+			e.badTables = make(map[uint64]error)
+		}
+		if _, ok := e.badTables[meta.FileNum]; !ok {
+			e.badTables[meta.FileNum] = err
+			e.metrics.badTables.Add(1)
+		}
+		e.badMu.Unlock()
+	}
+	return wrapSSTableCorrupt(op, err)
+}
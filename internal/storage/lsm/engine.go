@@ -8,9 +8,17 @@ import (
 	"sync"
 	"sync/atomic"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
 	"mini-kv/internal/storage/lsm/record"
+	"mini-kv/internal/storage/lsm/sstable"
 )
 
+var tracer = otel.Tracer("mini-kv/internal/storage/lsm")
+
 // Engine 是完整的 LSM 存储引擎实现
 type Engine struct {
 	dir  string         // 数据目录
@@ -19,21 +27,39 @@ type Engine struct {
 	lock *directoryLock // 目录文件锁，防止多实例冲突
 
 	writeMu sync.Mutex   // 写操作互斥锁，保证写入串行化
-	memMu   sync.RWMutex // 内存表结构锁，保护 mem 与 imm 切片
-
-	walFactory      walFactory              // WAL 工厂，可注入
-	memTableFactory memTableFactory         // MemTable 工厂
-	wal             walStore                // 当前 WAL 实例
-	mem             mutableMemTable         // 活跃内存表，接收写入
-	imm             []immutableMemTable     // 不可变内存表队列，等待刷盘
-	tables          tableManager            // SSTable 管理器
-	manifest        manifestStore           // MANIFEST 持久化
-	clock           clock                   // 时钟，便于测试
-	view            atomic.Pointer[memView] // 原子指针，指向最新的内存视图
-	lastSeq         atomic.Uint64           // 已分配的最大序列号
-	nextFileNum     atomic.Uint64           // 下一个可用的文件编号
-	versionMu       sync.RWMutex            // 版本状态锁
-	version         *versionState           // 当前文件版本状态
+	memMu   sync.RWMutex // 内存表结构锁，保护列族集合及各列族的 mem 与 imm 切片
+
+	writeQueueMu sync.Mutex      // 写入队列锁
+	writeQueue   []*writeRequest // 等待组提交的写入请求，队首为当前 leader
+	metrics      engineMetrics   // 运行指标计数器
+
+	stallMu   sync.Mutex    // 保护 stallWake
+	stallWake chan struct{} // 后台任务推进时关闭，唤醒被节流的写入
+
+	tableRefMu     sync.Mutex          // 保护 tableRefs 与 obsoleteTables，只在登记和释放引用时短暂持有
+	tableRefs      map[uint64]int      // 读取中的 SSTable 引用计数，读者只固定自己要读的文件
+	obsoleteTables map[uint64]struct{} // 已从版本中移除、等待最后一个读者释放后删除的文件
+
+	compactMu sync.Mutex // 串行化合并任务，避免并发合并选中相同的输入文件
+
+	blobMu sync.RWMutex // 解析值指针时持有读锁，删除已回收的 Blob 文件时持有写锁
+
+	badMu     sync.Mutex       // 保护 badTables
+	badTables map[uint64]error // 已检测到损坏的 SSTable 及其错误
+
+	walFactory      walFactory           // WAL 工厂，可注入
+	memTableFactory memTableFactory      // MemTable 工厂
+	wal             walStore             // 当前 WAL 实例
+	families        map[uint32]*family   // 所有列族，按编号索引
+	defaultFamily   *family              // 默认列族，未指定列族的读写使用
+	tables          tableManager         // SSTable 管理器
+	rateLimiter     *sstable.RateLimiter // 刷写与合并共享的写入限速器
+	manifest        manifestStore        // MANIFEST 持久化
+	clock           clock                // 时钟，便于测试
+	lastSeq         atomic.Uint64        // 已分配的最大序列号
+	nextFileNum     atomic.Uint64        // 下一个可用的文件编号
+	versionMu       sync.RWMutex         // 版本状态锁
+	version         *versionState        // 当前文件版本状态
 
 	lifecycleMu sync.RWMutex           // 生命周期锁，控制关闭、后台错误等
 	isClosed    bool                   // 是否已关闭
@@ -102,6 +128,7 @@ func newEngine(ctx context.Context, dir string, deps components, opts ...Option)
 		walFactory:      deps.WALFactory,
 		memTableFactory: deps.MemTableFactory,
 		tables:          deps.TableManager,
+		rateLimiter:     deps.RateLimiter,
 		clock:           deps.Clock,
 		doneCh:          make(chan struct{}),
 		cancel:          cancel,
@@ -116,12 +143,6 @@ func newEngine(ctx context.Context, dir string, deps components, opts ...Option)
 		}
 	}()
 
-	// 创建活跃内存表
-	engine.mem = engine.memTableFactory.NewMutable()
-	if engine.mem == nil {
-		return nil, fmt.Errorf("%w: nil memtable", ErrInvalidState)
-	}
-
 	// 初始化 WAL（如果工厂存在）
 	if engine.walFactory != nil {
 		wal, err := engine.walFactory.Open(dir, 1, walOptions{SegmentSize: options.WALSegmentSize})
@@ -153,24 +174,42 @@ func newEngine(ctx context.Context, dir string, deps components, opts ...Option)
 	engine.nextFileNum.Store(state.NextFileNum)
 	engine.lastSeq.Store(state.LastSeq)
 
-	// 回放 WAL 恢复 MemTable
+	// 为默认列族和 MANIFEST 中登记的列族创建活跃内存表，列族配置在 OpenColumnFamily 时覆盖
+	engine.families = make(map[uint32]*family, len(state.Families)+1)
+	engine.defaultFamily, err = engine.newFamily(&ColumnFamily{name: DefaultColumnFamilyName}, &engine.opts)
+	if err != nil {
+		return nil, err
+	}
+	engine.families[0] = engine.defaultFamily
+	for _, meta := range state.Families {
+		familyOpts := options
+		fam, err := engine.newFamily(&ColumnFamily{id: meta.ID, name: meta.Name}, &familyOpts)
+		if err != nil {
+			return nil, err
+		}
+		engine.families[meta.ID] = fam
+	}
+
+	// 回放 WAL 恢复各列族的 MemTable，跳过该列族已刷写到 SSTable 的条目
 	if engine.wal != nil {
 		if err := engine.wal.Replay(func(replayed batch) error {
-			entries := make([]entry, 0, len(replayed.Entries))
+			grouped := make(map[uint32][]entry)
 			for _, item := range replayed.Entries {
-				if item.Seq > engine.lastSeq.Load() {
-					entries = append(entries, item.Clone())
+				if _, ok := engine.families[item.Family]; !ok {
+					return fmt.Errorf("%w: unknown column family %d at seq %d", ErrCorrupt, item.Family, item.Seq)
+				}
+				if item.Seq > state.FlushedSeq(item.Family) {
+					grouped[item.Family] = append(grouped[item.Family], item.Clone())
 				}
 			}
-			if len(entries) == 0 {
-				return nil
-			}
-			if err := engine.mem.Apply(entries); err != nil {
-				return fmt.Errorf("replay memtable apply: %w", err)
-			}
-			for _, item := range entries {
-				if item.Seq > engine.lastSeq.Load() {
-					engine.lastSeq.Store(item.Seq)
+			for id, entries := range grouped {
+				if err := engine.families[id].mem.Apply(entries); err != nil {
+					return fmt.Errorf("replay memtable apply: %w", err)
+				}
+				for _, item := range entries {
+					if item.Seq > engine.lastSeq.Load() {
+						engine.lastSeq.Store(item.Seq)
+					}
 				}
 			}
 			return nil
@@ -180,14 +219,21 @@ func newEngine(ctx context.Context, dir string, deps components, opts ...Option)
 	}
 
 	// 发布初始内存视图并启动后台任务
-	engine.publishViewLocked()
+	for _, fam := range engine.families {
+		fam.publishViewLocked()
+	}
 	engine.startWorkers(workerCtx)
 	openOK = true
 	return engine, nil
 }
 
-// Get 根据键查询值，执行快照读
+// Get 根据键查询默认列族中的值，执行快照读
 func (e *Engine) Get(key []byte) ([]byte, bool, error) {
+	return e.GetCF(nil, key)
+}
+
+// GetCF 根据键查询指定列族中的值，cf 为 nil 时使用默认列族
+func (e *Engine) GetCF(cf *ColumnFamily, key []byte) ([]byte, bool, error) {
 	e.lifecycleMu.RLock()
 	defer e.lifecycleMu.RUnlock()
 	if e.isClosed {
@@ -196,23 +242,47 @@ func (e *Engine) Get(key []byte) ([]byte, bool, error) {
 	if err := e.backgroundError(); err != nil {
 		return nil, false, err
 	}
+	fam, err := e.family(cf)
+	if err != nil {
+		return nil, false, err
+	}
 
+	// 先于确定快照序列号持有 blobMu，保证值指针指向的 Blob 文件在解析前不会被回收
+	e.blobMu.RLock()
+	defer e.blobMu.RUnlock()
 	readSeq := e.lastSeq.Load() // 获取读取快照的序列号
-	view := e.loadView()        // 加载当前内存视图
-	e.memMu.RLock()
-	value, ok, matched, err := getFromView(view, key, readSeq) // 先在内存中查找
-	e.memMu.RUnlock()
-	if err != nil || matched {
-		return value, ok, err
+	item, ok, err := e.getEntry(fam, key, readSeq)
+	if err != nil || !ok {
+		return nil, false, err
 	}
-	return e.getFromTables(key, readSeq) // 未命中则查询 SSTable
+	return e.entryValue(item)
 }
 
 // Write 将 WriteBatch 原子写入引擎
 func (e *Engine) Write(writeBatch *WriteBatch, options WriteOptions) error {
+	return e.WriteWithContext(context.TODO(), writeBatch, options)
+}
+
+// WriteWithContext 与 Write 相同，ctx 携带的 trace 会记录本次写入的节流与组提交耗时
+func (e *Engine) WriteWithContext(ctx context.Context, writeBatch *WriteBatch, options WriteOptions) (err error) {
+	if ctx == nil {
+		ctx = context.TODO()
+	}
+	ctx, span := tracer.Start(ctx, "lsm.Write", trace.WithAttributes(
+		attribute.Int("lsm.ops", writeBatch.Len()),
+		attribute.Bool("lsm.sync", options.Sync || e.opts.SyncWrites),
+	))
+	defer func() { endSpan(span, err) }()
+
 	if err := validateWriteBatch(writeBatch); err != nil {
 		return err
 	}
+	// 刷写或合并落后时先节流，等待期间不持有生命周期锁以免阻塞 Close
+	if writeBatch != nil && len(writeBatch.Ops) > 0 {
+		if err := e.throttleWrite(options); err != nil {
+			return err
+		}
+	}
 
 	e.lifecycleMu.RLock()
 	defer e.lifecycleMu.RUnlock()
@@ -225,43 +295,31 @@ func (e *Engine) Write(writeBatch *WriteBatch, options WriteOptions) error {
 	if writeBatch == nil || len(writeBatch.Ops) == 0 {
 		return nil
 	}
-
-	e.writeMu.Lock()
-	defer e.writeMu.Unlock()
-
-	// 分配序列号
-	seqStart := e.lastSeq.Load() + 1
-	recordBatch, err := makeRecordBatch(writeBatch, seqStart)
-	if err != nil {
+	// 写入 WAL 前确认批次涉及的列族都已打开，避免回放时遇到未登记的列族
+	if err := e.validateFamilies(writeBatch); err != nil {
 		return err
 	}
-	shouldSync := options.Sync || e.opts.SyncWrites
-	// 先写 WAL
-	if e.wal != nil {
-		if err := e.wal.Append(recordBatch, shouldSync); err != nil {
-			return wrapWAL("append", wrapIO("append record", err))
-		}
-	}
 
-	// 再写 MemTable
-	e.memMu.Lock()
-	if err := e.mem.Apply(recordBatch.Entries); err != nil {
-		e.memMu.Unlock()
-		return fmt.Errorf("memtable apply: %w", err)
-	}
-	e.lastSeq.Store(seqStart + uint64(len(recordBatch.Entries)) - 1)
-	// 检查是否需要冻结 MemTable
-	rotated := e.rotateMemTableLocked()
-	e.memMu.Unlock()
+	// 进入写入队列，由组提交 leader 合并写入
+	_, commitSpan := tracer.Start(ctx, "lsm.commit")
+	err = e.commitWrite(&writeRequest{
+		batch: writeBatch,
+		sync:  options.Sync || e.opts.SyncWrites,
+		ready: make(chan struct{}),
+	})
+	endSpan(commitSpan, err)
+	return err
+}
 
-	// 若发生了冻结，触发刷写
-	if rotated {
-		e.requestFlush()
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 	}
-	return nil
+	span.End()
 }
 
-// NewIterator 创建一个范围迭代器，返回可见的键值对
+// NewIterator 创建一个范围迭代器，返回 options 指定列族中可见的键值对
 func (e *Engine) NewIterator(options IterOptions) *Iterator {
 	e.lifecycleMu.RLock()
 	defer e.lifecycleMu.RUnlock()
@@ -271,16 +329,20 @@ func (e *Engine) NewIterator(options IterOptions) *Iterator {
 	if err := e.backgroundError(); err != nil {
 		return newErrorIterator(err)
 	}
+	fam, err := e.family(options.ColumnFamily)
+	if err != nil {
+		return newErrorIterator(err)
+	}
 
 	// 收集所有满足条件的可见条目
-	entries, err := e.collectEntries(makeKeyBounds(options))
+	entries, err := e.collectEntries([]*family{fam}, makeKeyBounds(options))
 	if err != nil {
 		return newErrorIterator(err)
 	}
-	return newSliceIterator(entries, nil)
+	return newSliceIterator(entries[fam.handle.id], nil)
 }
 
-// Snapshot 创建引擎的一致性快照，可反复查询
+// Snapshot 创建引擎的一致性快照，可反复查询，所有列族共享同一个快照序列号
 func (e *Engine) Snapshot() (*Snapshot, error) {
 	e.lifecycleMu.RLock()
 	defer e.lifecycleMu.RUnlock()
@@ -291,8 +353,8 @@ func (e *Engine) Snapshot() (*Snapshot, error) {
 		return nil, err
 	}
 
-	// 收集所有条目，无键范围限制
-	entries, err := e.collectEntries(keyBounds{})
+	// 收集所有列族的条目，无键范围限制
+	entries, err := e.collectEntries(e.sortedFamilies(), keyBounds{})
 	if err != nil {
 		return nil, err
 	}
@@ -344,6 +406,11 @@ func (e *Engine) FlushWithContext(ctx context.Context) error {
 	}
 }
 
+// SetWriteRateLimit 在运行时调整刷写与合并写入 SSTable 的总速率上限（字节/秒），0 表示不限速
+func (e *Engine) SetWriteRateLimit(bytesPerSec int64) {
+	e.rateLimiter.SetRate(bytesPerSec)
+}
+
 // Close 优雅关闭引擎：
 // 1. 标记引擎已关闭，关闭 doneCh 并取消后台协程
 // 2. 等待所有后台协程退出
@@ -431,69 +498,61 @@ func (e *Engine) setBackgroundError(err error) {
 	e.fatalErr = fmt.Errorf("%w: %w", ErrBackground, err)
 }
 
-// loadView 以原子方式加载当前内存视图快照，若尚未发布则返回空视图
-func (e *Engine) loadView() *memView {
-	view := e.view.Load()
-	if view != nil {
-		return view
-	}
-	return &memView{}
-}
-
-// publishViewLocked 在持有 memMu 时更新原子内存视图，供读取路径使用
-func (e *Engine) publishViewLocked() {
-	immutable := make([]immutableMemTable, len(e.imm))
-	copy(immutable, e.imm) // 复制一份不可变表切片，避免共享底层数组
-	e.view.Store(&memView{
-		mutable:   e.mem,
-		immutable: immutable,
-	})
-}
-
-// rotateMemTableLocked 检查是否需要冻结活跃 MemTable，若大小超过阈值且未超过最大不可变表数量则执行冻结
-// 返回 true 表示发生了冻结（可能需要触发刷写）
-func (e *Engine) rotateMemTableLocked() bool {
-	if e.mem == nil || e.mem.ApproximateSize() < e.opts.MemTableSize {
-		return false
+// collectEntries 按同一个 readSeq 收集各列族满足 bounds 的可见条目，先收集内存视图，再收集 SSTable，最后合并
+// 用于 Snapshot 和 NewIterator 构建一致性视图，值指针在返回前解析为实际值
+func (e *Engine) collectEntries(families []*family, bounds keyBounds) (map[uint32][]entry, error) {
+	e.blobMu.RLock()
+	defer e.blobMu.RUnlock()
+	readSeq := e.lastSeq.Load() // 确定快照序列号
+	views := make([]*memView, len(families))
+	for i, fam := range families {
+		views[i] = fam.loadView() // 内存视图
 	}
-	if len(e.imm) >= e.opts.MaxImmutableTables {
-		return false // 不可变表已满，暂时不冻结
+	e.memMu.RLock()
+	defer e.memMu.RUnlock()
+	out := make(map[uint32][]entry, len(families))
+	for i, fam := range families {
+		entries, err := collectVisibleEntries(views[i], readSeq, bounds) // 内存层可见条目
+		if err != nil {
+			return nil, err
+		}
+		tableEntries, err := e.collectTableEntries(fam.handle.id, readSeq, bounds) // 磁盘层可见条目
+		if err != nil {
+			return nil, err
+		}
+		merged, err := mergeVisibleEntries(entries, tableEntries) // 合并两层的条目
+		if err != nil {
+			return nil, err
+		}
+		if out[fam.handle.id], err = e.resolveEntries(merged); err != nil {
+			return nil, err
+		}
 	}
-	e.imm = append(e.imm, e.mem.Freeze())
-	e.mem = e.memTableFactory.NewMutable()
-	e.publishViewLocked()
-	return true
+	return out, nil
 }
 
-// collectEntries 收集所有满足 readSeq 和 bounds 的可见条目，先收集内存视图，再收集 SSTable，最后合并
-// 用于 Snapshot 和 NewIterator 构建一致性视图
-func (e *Engine) collectEntries(bounds keyBounds) ([]entry, error) {
-	readSeq := e.lastSeq.Load() // 确定快照序列号
-	view := e.loadView()        // 内存视图
+// getEntry 按内存表 → SSTable 的顺序查找列族中键在 readSeq 下的最新版本，值指针不解析
+func (e *Engine) getEntry(fam *family, key []byte, readSeq uint64) (entry, bool, error) {
+	view := fam.loadView() // 加载当前内存视图
 	e.memMu.RLock()
-	defer e.memMu.RUnlock()
-	entries, err := collectVisibleEntries(view, readSeq, bounds) // 内存层可见条目
-	if err != nil {
-		return nil, err
-	}
-	tableEntries, err := e.collectTableEntries(readSeq, bounds) // 磁盘层可见条目
-	if err != nil {
-		return nil, err
+	item, ok := getFromView(view, key, readSeq) // 先在内存中查找
+	e.memMu.RUnlock()
+	if ok {
+		return item, true, nil
 	}
-	return mergeVisibleEntries(entries, tableEntries) // 合并两层的条目
+	return e.getFromTables(fam.handle.id, key, readSeq) // 未命中则查询 SSTable
 }
 
-// getFromView 在内存视图中查找指定键的可见版本，返回原始值或 nil
+// getFromView 在内存视图中查找指定键的可见版本，返回找到的条目（可能是删除标记）
 // 遍历顺序：活跃 MemTable → 不可变 MemTable（从新到旧）
-func getFromView(view *memView, key []byte, readSeq uint64) ([]byte, bool, bool, error) {
+func getFromView(view *memView, key []byte, readSeq uint64) (entry, bool) {
 	if view == nil {
-		return nil, false, false, nil
+		return entry{}, false
 	}
 	// 先查活跃表（最新写入）
 	if view.mutable != nil {
-		if entry, ok := view.mutable.Get(key, readSeq); ok {
-			value, visible, err := visibleValue(entry)
-			return value, visible, true, err
+		if item, ok := view.mutable.Get(key, readSeq); ok {
+			return item, true
 		}
 	}
 	// 再从新到旧查不可变表
@@ -501,12 +560,11 @@ func getFromView(view *memView, key []byte, readSeq uint64) ([]byte, bool, bool,
 		if view.immutable[i] == nil {
 			continue
 		}
-		if entry, ok := view.immutable[i].Get(key, readSeq); ok {
-			value, visible, err := visibleValue(entry)
-			return value, visible, true, err
+		if item, ok := view.immutable[i].Get(key, readSeq); ok {
+			return item, true
 		}
 	}
-	return nil, false, false, nil
+	return entry{}, false
 }
 
 // visibleValue 根据 entry 的种类返回用户可见的值
@@ -537,12 +595,26 @@ func (e *Engine) currentVersion() *versionState {
 	return e.version.Clone()
 }
 
+// familyVersion 返回只包含指定列族层级的当前版本状态
+func (e *Engine) familyVersion(id uint32) *versionState {
+	e.versionMu.RLock()
+	defer e.versionMu.RUnlock()
+	return e.version.Family(id)
+}
+
 // publishVersion 应用一次版本编辑并更新内存中的版本状态及下一个文件编号
 func (e *Engine) publishVersion(edit versionEdit) {
 	e.versionMu.Lock()
 	defer e.versionMu.Unlock()
 	e.version = e.version.Apply(edit)
-	e.nextFileNum.Store(e.version.NextFileNum)
+	defer e.notifyStallWaiters()
+	// 后台刷写与合并并发分配文件编号，这里只允许前进，避免回退后复用正在构建的编号
+	for {
+		current := e.nextFileNum.Load()
+		if current >= e.version.NextFileNum || e.nextFileNum.CompareAndSwap(current, e.version.NextFileNum) {
+			return
+		}
+	}
 }
 
 // allocateFileNum 原子递增并返回下一个可用的 SSTable/WAL 文件编号
@@ -550,57 +622,82 @@ func (e *Engine) allocateFileNum() uint64 {
 	return e.nextFileNum.Add(1) - 1
 }
 
-// getFromTables 在 SSTable 层查找指定键，遍历可能包含该键的所有文件（由 FilesForKey 提供），
+// getFromTables 在列族的 SSTable 层查找指定键，遍历可能包含该键的所有文件（由 FilesForKey 提供），
 // 找到第一个可见版本即返回
-func (e *Engine) getFromTables(key []byte, readSeq uint64) ([]byte, bool, error) {
+func (e *Engine) getFromTables(familyID uint32, key []byte, readSeq uint64) (entry, bool, error) {
 	if e.tables == nil {
-		return nil, false, nil
+		return entry{}, false, nil
 	}
-	state := e.currentVersion()
-	for _, meta := range state.FilesForKey(key) { // 可能包含该键的文件列表
+	files := e.pinTables(func() []tableMeta {
+		return e.familyVersion(familyID).FilesForKey(key) // 可能包含该键的文件列表
+	})
+	defer e.unpinTables(files)
+	for _, meta := range files {
+		if err := e.badTableError(meta.FileNum); err != nil {
+			return entry{}, false, err
+		}
 		reader, err := e.tables.Open(meta)
 		if err != nil {
-			return nil, false, wrapSSTableCorrupt("open", err)
+			return entry{}, false, e.tableError(meta, "open", err)
+		}
+		// 先单独询问布隆过滤器，以便统计过滤器的命中情况
+		var item entry
+		var ok bool
+		var getErr error
+		mayContain, filtered := reader.MayContain(key)
+		if mayContain {
+			item, ok, getErr = reader.Get(key, readSeq)
 		}
-		entry, ok, getErr := reader.Get(key, readSeq)
 		closeErr := reader.Close()
+		if filtered && getErr == nil {
+			e.metrics.observeBloom(mayContain, ok)
+		}
 		if getErr != nil {
-			return nil, false, wrapSSTableCorrupt("get", getErr)
+			return entry{}, false, e.tableError(meta, "get", getErr)
 		}
 		if closeErr != nil {
-			return nil, false, wrapSSTableCorrupt("close", closeErr)
+			return entry{}, false, wrapSSTableCorrupt("close", closeErr)
 		}
 		if ok {
-			return visibleValue(entry)
+			return item, true, nil
 		}
 	}
-	return nil, false, nil
+	return entry{}, false, nil
 }
 
-// collectTableEntries 从所有 SSTable 中收集满足 readSeq 和 bounds 的可见条目，用于构建快照/迭代器
-func (e *Engine) collectTableEntries(readSeq uint64, bounds keyBounds) ([]entry, error) {
+// collectTableEntries 从列族的所有 SSTable 中收集满足 readSeq 和 bounds 的可见条目，用于构建快照/迭代器
+func (e *Engine) collectTableEntries(familyID uint32, readSeq uint64, bounds keyBounds) ([]entry, error) {
 	if e.tables == nil {
 		return nil, nil
 	}
-	state := e.currentVersion()
-	files := state.AllFiles() // 获取全部文件元数据
+	files := e.pinTables(func() []tableMeta {
+		var files []tableMeta
+		for _, meta := range e.familyVersion(familyID).AllFiles() {
+			// 快速排除键范围完全无交集的 SSTable
+			if len(bounds.Upper) > 0 && bytes.Compare(meta.Smallest, bounds.Upper) >= 0 {
+				continue
+			}
+			if len(bounds.Lower) > 0 && bytes.Compare(meta.Largest, bounds.Lower) < 0 {
+				continue
+			}
+			files = append(files, meta)
+		}
+		return files
+	})
+	defer e.unpinTables(files)
 	entries := make([]entry, 0)
 	for _, meta := range files {
-		// 快速排除键范围完全无交集的 SSTable
-		if len(bounds.Upper) > 0 && bytes.Compare(meta.Smallest, bounds.Upper) >= 0 {
-			continue
-		}
-		if len(bounds.Lower) > 0 && bytes.Compare(meta.Largest, bounds.Lower) < 0 {
-			continue
+		if err := e.badTableError(meta.FileNum); err != nil {
+			return nil, err
 		}
 		reader, err := e.tables.Open(meta)
 		if err != nil {
-			return nil, wrapSSTableCorrupt("open", err)
+			return nil, e.tableError(meta, "open", err)
 		}
 		tableEntries, err := reader.Entries() // 读取所有条目（当前实现一次性加载）
 		closeErr := reader.Close()
 		if err != nil {
-			return nil, wrapSSTableCorrupt("entries", err)
+			return nil, e.tableError(meta, "entries", err)
 		}
 		if closeErr != nil {
 			return nil, wrapSSTableCorrupt("close", closeErr)
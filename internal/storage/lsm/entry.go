@@ -11,3 +11,7 @@ type keyBounds = record.KeyBounds
 type tableMeta = version.TableMeta
 type versionEdit = version.Edit
 type versionState = version.State
+type blobMeta = version.BlobMeta
+type blobGarbage = version.BlobGarbage
+type familyMeta = version.FamilyMeta
+type familyState = version.FamilyState
@@ -19,6 +19,8 @@ var (
 	ErrLocked          = errors.New("lsm: directory locked") // 目录已被其他实例锁定
 	ErrBackground      = errors.New("lsm: background error") // 后台任务发生错误，引擎不可用
 	ErrNotImplemented  = errors.New("lsm: not implemented")  // 功能尚未实现
+	ErrWriteStall      = errors.New("lsm: write stall")      // 刷写或合并落后，写入被节流，可稍后重试
+	ErrBlobCorrupt     = errors.New("lsm: blob corrupt")     // Blob 文件或值指针损坏
 )
 
 // wrapWAL 将 WAL 操作错误包装为统一格式，包含操作名。
@@ -45,6 +47,14 @@ func wrapSSTableCorrupt(op string, err error) error {
 	return fmt.Errorf("sstable %s: %w", op, errors.Join(ErrSSTableCorrupt, err))
 }
 
+// wrapBlobCorrupt 包装 Blob 文件损坏错误，若底层错误为空则单独使用 ErrBlobCorrupt。
+func wrapBlobCorrupt(op string, err error) error {
+	if err == nil {
+		return fmt.Errorf("blob %s: %w", op, ErrBlobCorrupt)
+	}
+	return fmt.Errorf("blob %s: %w", op, errors.Join(ErrBlobCorrupt, err))
+}
+
 // wrapIO 包装 I/O 错误，将 ErrIO 和底层错误合并。
 func wrapIO(op string, err error) error {
 	if err == nil {
@@ -0,0 +1,243 @@
+package lsm
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+)
+
+// DefaultColumnFamilyName 是默认列族的名称，未指定列族的读写都作用于默认列族
+const DefaultColumnFamilyName = "default"
+
+// ColumnFamily 是列族句柄，每个列族有独立的内存表、SSTable 集合与配置，
+// 所有列族共享同一个 WAL 和 MANIFEST，因此跨列族的 WriteBatch 仍是原子的
+type ColumnFamily struct {
+	id   uint32
+	name string
+}
+
+// ID 返回列族编号，默认列族为 0
+func (cf *ColumnFamily) ID() uint32 {
+	if cf == nil {
+		return 0
+	}
+	return cf.id
+}
+
+// Name 返回列族名称
+func (cf *ColumnFamily) Name() string {
+	if cf == nil {
+		return DefaultColumnFamilyName
+	}
+	return cf.name
+}
+
+// family 保存一个列族的内存表与配置，opts、mem 与 imm 受 Engine.memMu 保护
+type family struct {
+	handle *ColumnFamily
+	opts   *Options                // 列族配置，默认列族直接使用引擎配置
+	mem    mutableMemTable         // 活跃内存表，接收写入
+	imm    []immutableMemTable     // 不可变内存表队列，等待刷盘
+	view   atomic.Pointer[memView] // 原子指针，指向最新的内存视图
+}
+
+// newFamily 创建带空活跃内存表的列族
+func (e *Engine) newFamily(handle *ColumnFamily, opts *Options) (*family, error) {
+	fam := &family{handle: handle, opts: opts, mem: e.memTableFactory.NewMutable()}
+	if fam.mem == nil {
+		return nil, fmt.Errorf("%w: nil memtable", ErrInvalidState)
+	}
+	fam.publishViewLocked()
+	return fam, nil
+}
+
+// DefaultColumnFamily 返回默认列族句柄
+func (e *Engine) DefaultColumnFamily() *ColumnFamily {
+	return e.defaultFamily.handle
+}
+
+// ColumnFamily 按名称返回已打开的列族句柄，不创建新列族
+func (e *Engine) ColumnFamily(name string) (*ColumnFamily, bool) {
+	fam := e.familyByName(name)
+	if fam == nil {
+		return nil, false
+	}
+	return fam.handle, true
+}
+
+// ColumnFamilies 返回所有列族句柄，按编号升序
+func (e *Engine) ColumnFamilies() []*ColumnFamily {
+	e.memMu.RLock()
+	defer e.memMu.RUnlock()
+	handles := make([]*ColumnFamily, 0, len(e.families))
+	for _, fam := range e.families {
+		handles = append(handles, fam.handle)
+	}
+	sort.Slice(handles, func(i, j int) bool { return handles[i].id < handles[j].id })
+	return handles
+}
+
+// OpenColumnFamily 返回指定名称的列族，不存在时创建并写入 MANIFEST
+// opts 在引擎配置的基础上生效，只影响该列族的内存表大小、不可变表数量、Level 0 合并与节流阈值以及键值分离阈值；
+// 列族配置不持久化，每次打开引擎后都需要重新调用
+func (e *Engine) OpenColumnFamily(name string, opts ...Option) (*ColumnFamily, error) {
+	if name == "" {
+		return nil, fmt.Errorf("%w: empty column family name", ErrInvalidOptions)
+	}
+	options := e.opts
+	for _, option := range opts {
+		if option == nil {
+			continue
+		}
+		if err := option(&options); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateOptions(options); err != nil {
+		return nil, err
+	}
+
+	e.lifecycleMu.RLock()
+	defer e.lifecycleMu.RUnlock()
+	if e.isClosed {
+		return nil, ErrClosed
+	}
+	if err := e.backgroundError(); err != nil {
+		return nil, err
+	}
+
+	// 持有写锁创建列族，保证写入看到的列族集合与 MANIFEST 一致
+	e.writeMu.Lock()
+	defer e.writeMu.Unlock()
+	if fam := e.familyByName(name); fam != nil {
+		if len(opts) > 0 {
+			if fam == e.defaultFamily {
+				return nil, fmt.Errorf("%w: default column family uses engine options", ErrInvalidOptions)
+			}
+			// 从 MANIFEST 恢复的列族先使用引擎配置，这里替换为调用方指定的配置
+			e.memMu.Lock()
+			*fam.opts = options
+			e.memMu.Unlock()
+		}
+		return fam.handle, nil
+	}
+	if e.manifest == nil {
+		return nil, ErrNotImplemented
+	}
+
+	var id uint32 = 1
+	for _, existing := range e.currentVersion().FamilyIDs() {
+		id = max(id, existing+1)
+	}
+	handle := &ColumnFamily{id: id, name: name}
+	fam, err := e.newFamily(handle, &options)
+	if err != nil {
+		return nil, err
+	}
+	edit := versionEdit{
+		NextFileNum:   e.nextFileNum.Load(),
+		AddedFamilies: []familyMeta{{ID: id, Name: name}},
+	}
+	if err := e.manifest.Apply(edit); err != nil {
+		return nil, fmt.Errorf("manifest apply column family: %w", err)
+	}
+	e.publishVersion(edit)
+	e.memMu.Lock()
+	e.families[id] = fam
+	e.memMu.Unlock()
+	return handle, nil
+}
+
+// familyByName 按名称查找列族
+func (e *Engine) familyByName(name string) *family {
+	e.memMu.RLock()
+	defer e.memMu.RUnlock()
+	for _, fam := range e.families {
+		if fam.handle.name == name {
+			return fam
+		}
+	}
+	return nil
+}
+
+// family 返回句柄对应的列族，nil 表示默认列族
+func (e *Engine) family(cf *ColumnFamily) (*family, error) {
+	if cf == nil {
+		return e.defaultFamily, nil
+	}
+	e.memMu.RLock()
+	defer e.memMu.RUnlock()
+	fam, ok := e.families[cf.id]
+	if !ok || fam.handle != cf {
+		return nil, fmt.Errorf("%w: unknown column family %q", ErrInvalidBatch, cf.name)
+	}
+	return fam, nil
+}
+
+// sortedFamiliesLocked 返回按编号升序的列族列表，调用方需持有 memMu
+func (e *Engine) sortedFamiliesLocked() []*family {
+	out := make([]*family, 0, len(e.families))
+	for _, fam := range e.families {
+		out = append(out, fam)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].handle.id < out[j].handle.id })
+	return out
+}
+
+// sortedFamilies 返回按编号升序的列族列表
+func (e *Engine) sortedFamilies() []*family {
+	e.memMu.RLock()
+	defer e.memMu.RUnlock()
+	return e.sortedFamiliesLocked()
+}
+
+// familyOptions 返回列族配置的副本
+func (e *Engine) familyOptions(fam *family) Options {
+	e.memMu.RLock()
+	defer e.memMu.RUnlock()
+	return *fam.opts
+}
+
+// loadView 以原子方式加载列族当前内存视图快照，若尚未发布则返回空视图
+func (f *family) loadView() *memView {
+	view := f.view.Load()
+	if view != nil {
+		return view
+	}
+	return &memView{}
+}
+
+// publishViewLocked 在持有 memMu 时更新原子内存视图，供读取路径使用
+func (f *family) publishViewLocked() {
+	immutable := make([]immutableMemTable, len(f.imm))
+	copy(immutable, f.imm) // 复制一份不可变表切片，避免共享底层数组
+	f.view.Store(&memView{
+		mutable:   f.mem,
+		immutable: immutable,
+	})
+}
+
+// rotateMemTableLocked 检查是否需要冻结活跃 MemTable，若大小超过阈值且未超过最大不可变表数量则执行冻结
+// 返回 true 表示发生了冻结（可能需要触发刷写）
+func (e *Engine) rotateMemTableLocked(fam *family) bool {
+	if fam.mem == nil || fam.mem.ApproximateSize() < fam.opts.MemTableSize {
+		return false
+	}
+	if len(fam.imm) >= fam.opts.MaxImmutableTables {
+		return false // 不可变表已满，暂时不冻结
+	}
+	e.freezeMemTableLocked(fam)
+	return true
+}
+
+// freezeMemTableLocked 冻结活跃 MemTable 并换上新的空表
+func (e *Engine) freezeMemTableLocked(fam *family) {
+	fam.imm = append(fam.imm, fam.mem.Freeze())
+	fam.mem = e.memTableFactory.NewMutable()
+	fam.publishViewLocked()
+}
+
+// hasUnflushedLocked 判断列族是否还有未刷写到 SSTable 的写入
+func (f *family) hasUnflushedLocked() bool {
+	return len(f.imm) > 0 || (f.mem != nil && f.mem.ApproximateSize() > 0)
+}
@@ -181,7 +181,7 @@ func collectVisibleEntries(view *memView, readSeq uint64, bounds keyBounds) ([]e
 	// 从 latest 映射生成最终条目切片
 	entries := make([]entry, 0, len(latest))
 	for _, item := range latest {
-		if item.Kind != record.KindPut && item.Kind != record.KindDelete {
+		if item.Kind != record.KindPut && item.Kind != record.KindDelete && item.Kind != record.KindValuePointer {
 			return nil, fmt.Errorf("%w: unknown entry kind", ErrCorrupt)
 		}
 		entries = append(entries, item.Clone())
@@ -194,7 +194,7 @@ func collectVisibleEntries(view *memView, readSeq uint64, bounds keyBounds) ([]e
 }
 
 // mergeVisibleEntries 合并多组已经预处理过的条目切片，去重并只保留每个键的最新可见版本
-// 结果按键升序排序，可用于组合内存层和 SSTable 层的条目
+// 结果按键升序排序，可用于组合内存层和 SSTable 层的条目；值指针原样保留
 func mergeVisibleEntries(groups ...[]entry) ([]entry, error) {
 	latest := make(map[string]entry)
 	for _, entries := range groups {
@@ -211,7 +211,7 @@ func mergeVisibleEntries(groups ...[]entry) ([]entry, error) {
 		if item.Kind == record.KindDelete {
 			continue
 		}
-		if item.Kind != record.KindPut {
+		if item.Kind != record.KindPut && item.Kind != record.KindValuePointer {
 			return nil, fmt.Errorf("%w: unknown entry kind", ErrCorrupt)
 		}
 		merged = append(merged, item.Clone())
@@ -56,6 +56,30 @@ func BenchmarkEngineWriteSyncWAL(b *testing.B) {
 	}
 }
 
+func BenchmarkEngineWriteSyncWALParallel(b *testing.B) {
+	keys := benchmarkLSMKeys(4096)
+	value := bytes.Repeat([]byte("x"), 128)
+	engine, err := Open(b.TempDir(), WithMemTableSize(1<<30), WithL0CompactionTrigger(1<<30))
+	if err != nil {
+		b.Fatalf("Open error = %v", err)
+	}
+	defer func() { _ = engine.Close() }()
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			var batch WriteBatch
+			batch.Put(keys[i&(len(keys)-1)], value)
+			if err := engine.Write(&batch, WriteOptions{Sync: true}); err != nil {
+				b.Errorf("Write error = %v", err)
+				return
+			}
+			i++
+		}
+	})
+}
+
 func BenchmarkEngineWriteFlushBoundary(b *testing.B) {
 	keys := benchmarkLSMKeys(256)
 	value := bytes.Repeat([]byte("x"), 128)
@@ -221,7 +245,7 @@ func BenchmarkCompactionL0ToL1(b *testing.B) {
 		engine.opts.L0CompactionTrigger = 1
 		b.StartTimer()
 
-		if err := engine.runCompaction(context.Background(), compactionJob{level: 0}); err != nil {
+		if err := engine.runCompaction(context.Background(), engine.defaultFamily, compactionJob{level: 0}); err != nil {
 			b.Fatalf("runCompaction error = %v", err)
 		}
 
@@ -304,6 +328,10 @@ func (benchmarkNoopWAL) Append(batch, bool) error {
 	return nil
 }
 
+func (benchmarkNoopWAL) Sync() error {
+	return nil
+}
+
 func (benchmarkNoopWAL) Replay(func(batch) error) error {
 	return nil
 }
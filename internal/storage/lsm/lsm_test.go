@@ -1,13 +1,21 @@
 package lsm
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
 	"slices"
+	"sync"
 	"testing"
+	"time"
+
+	"mini-kv/internal/storage/lsm/record"
+	"mini-kv/internal/storage/lsm/sstable"
 )
 
 func TestOpenValidatesOptions(t *testing.T) {
@@ -167,6 +175,131 @@ func TestEngineWrapsWALErrors(t *testing.T) {
 	}
 }
 
+func TestEngineGroupCommitMergesQueuedWrites(t *testing.T) {
+	release := make(chan struct{})
+	wal := &fakeWAL{entered: make(chan struct{}), release: release}
+	engine, err := openWithComponents(t.TempDir(), components{
+		WALFactory: fakeWALFactory{wal: wal},
+	})
+	if err != nil {
+		t.Fatalf("openWithComponents error = %v", err)
+	}
+	defer func() { _ = engine.Close() }()
+
+	write := func(key string, errCh chan<- error) {
+		var batch WriteBatch
+		batch.Put([]byte(key), []byte("v-"+key))
+		errCh <- engine.Write(&batch, WriteOptions{Sync: true})
+	}
+
+	// 第一个写入作为 leader 阻塞在 WAL 追加上
+	errCh := make(chan error, 5)
+	go write("a", errCh)
+	<-wal.entered
+
+	const followers = 4
+	for i := 0; i < followers; i++ {
+		go write(string(rune('b'+i)), errCh)
+	}
+	for {
+		engine.writeQueueMu.Lock()
+		queued := len(engine.writeQueue)
+		engine.writeQueueMu.Unlock()
+		if queued == followers+1 {
+			break
+		}
+		runtime.Gosched()
+	}
+	close(release)
+
+	for i := 0; i < followers+1; i++ {
+		if err := <-errCh; err != nil {
+			t.Fatalf("Write error = %v", err)
+		}
+	}
+
+	if len(wal.batches) != 2 {
+		t.Fatalf("wal records = %d, want 2", len(wal.batches))
+	}
+	grouped := wal.batches[1]
+	if grouped.SeqStart != 2 || len(grouped.Entries) != followers {
+		t.Fatalf("grouped record = seq %d with %d entries, want seq 2 with %d entries", grouped.SeqStart, len(grouped.Entries), followers)
+	}
+	for i, entry := range grouped.Entries {
+		if entry.Seq != grouped.SeqStart+uint64(i) {
+			t.Fatalf("grouped entry %d seq = %d, want %d", i, entry.Seq, grouped.SeqStart+uint64(i))
+		}
+	}
+	if wal.syncs != 2 {
+		t.Fatalf("wal syncs = %d, want 2", wal.syncs)
+	}
+
+	metrics := engine.Metrics()
+	if metrics.WriteGroups != 2 || metrics.WriteBatches != followers+1 || metrics.MaxWriteGroupSize != followers || metrics.WALSyncs != 2 {
+		t.Fatalf("metrics = %+v, want 2 groups of %d batches with 2 syncs", metrics, followers+1)
+	}
+	for i := 0; i < followers+1; i++ {
+		key := string(rune('a' + i))
+		value, ok, err := engine.Get([]byte(key))
+		if err != nil || !ok || string(value) != "v-"+key {
+			t.Fatalf("Get(%s) = (%q, %v, %v), want v-%s", key, value, ok, err, key)
+		}
+	}
+}
+
+func TestConcurrentSyncWritesSurviveReopen(t *testing.T) {
+	dir := t.TempDir()
+	engine, err := Open(dir, WithSyncWrites(true))
+	if err != nil {
+		t.Fatalf("Open error = %v", err)
+	}
+
+	const writers, perWriter = 8, 25
+	var wg sync.WaitGroup
+	errCh := make(chan error, writers)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				var batch WriteBatch
+				batch.Put([]byte(fmt.Sprintf("w%d-%03d", w, i)), []byte(fmt.Sprintf("%d", i)))
+				if err := engine.Write(&batch, WriteOptions{}); err != nil {
+					errCh <- err
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errCh)
+	for err := range errCh {
+		t.Fatalf("Write error = %v", err)
+	}
+	metrics := engine.Metrics()
+	if metrics.WriteBatches != writers*perWriter || metrics.WALSyncs != metrics.WriteGroups {
+		t.Fatalf("metrics = %+v, want %d batches and one sync per group", metrics, writers*perWriter)
+	}
+	if err := engine.Close(); err != nil {
+		t.Fatalf("Close error = %v", err)
+	}
+
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatalf("reopen error = %v", err)
+	}
+	defer func() { _ = reopened.Close() }()
+	for w := 0; w < writers; w++ {
+		for i := 0; i < perWriter; i++ {
+			key := fmt.Sprintf("w%d-%03d", w, i)
+			value, ok, err := reopened.Get([]byte(key))
+			if err != nil || !ok || string(value) != fmt.Sprintf("%d", i) {
+				t.Fatalf("Get(%s) = (%q, %v, %v), want %d", key, value, ok, err, i)
+			}
+		}
+	}
+}
+
 func TestConcurrentWriteAndRead(t *testing.T) {
 	engine, err := Open(t.TempDir(), WithMemTableSize(128))
 	if err != nil {
@@ -327,7 +460,7 @@ func TestEngineCompactionKeepsLatestValue(t *testing.T) {
 		}
 	}
 	engine.opts.L0CompactionTrigger = 1
-	if err := engine.runCompaction(context.Background(), compactionJob{level: 0}); err != nil {
+	if err := engine.runCompaction(context.Background(), engine.defaultFamily, compactionJob{level: 0}); err != nil {
 		t.Fatalf("runCompaction error = %v", err)
 	}
 	got, ok, err := engine.Get([]byte("a"))
@@ -356,7 +489,7 @@ func TestEngineCompactionDeleteDoesNotResurrectLowerLevelValue(t *testing.T) {
 		t.Fatalf("Flush initial value error = %v", err)
 	}
 	engine.opts.L0CompactionTrigger = 1
-	if err := engine.runCompaction(context.Background(), compactionJob{level: 0}); err != nil {
+	if err := engine.runCompaction(context.Background(), engine.defaultFamily, compactionJob{level: 0}); err != nil {
 		t.Fatalf("compact initial value error = %v", err)
 	}
 
@@ -368,7 +501,7 @@ func TestEngineCompactionDeleteDoesNotResurrectLowerLevelValue(t *testing.T) {
 	if err := engine.Flush(); err != nil {
 		t.Fatalf("Flush delete error = %v", err)
 	}
-	if err := engine.runCompaction(context.Background(), compactionJob{level: 0}); err != nil {
+	if err := engine.runCompaction(context.Background(), engine.defaultFamily, compactionJob{level: 0}); err != nil {
 		t.Fatalf("compact delete error = %v", err)
 	}
 
@@ -396,6 +529,148 @@ func TestEngineCompactionDeleteDoesNotResurrectLowerLevelValue(t *testing.T) {
 	}
 }
 
+func TestEngineMarksCorruptTableBad(t *testing.T) {
+	dir := t.TempDir()
+	engine, err := Open(dir, WithL0CompactionTrigger(100))
+	if err != nil {
+		t.Fatalf("Open error = %v", err)
+	}
+	defer func() { _ = engine.Close() }()
+
+	var batch WriteBatch
+	batch.Put([]byte("a"), []byte("value-a"))
+	if err := engine.Write(&batch, WriteOptions{}); err != nil {
+		t.Fatalf("Write error = %v", err)
+	}
+	if err := engine.Flush(); err != nil {
+		t.Fatalf("Flush error = %v", err)
+	}
+	if err := engine.VerifyChecksums(); err != nil {
+		t.Fatalf("VerifyChecksums before corruption error = %v", err)
+	}
+
+	files := engine.currentVersion().AllFiles()
+	if len(files) != 1 {
+		t.Fatalf("live tables = %d, want 1", len(files))
+	}
+	path := filepath.Join(dir, sstable.FileName(files[0].FileNum))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile error = %v", err)
+	}
+	data[8] ^= 0xff // 翻转首个数据块中的一个字节
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("WriteFile error = %v", err)
+	}
+
+	_, _, err = engine.Get([]byte("a"))
+	var corruption *sstable.CorruptionError
+	if !errors.Is(err, ErrSSTableCorrupt) || !errors.As(err, &corruption) || corruption.Path != path {
+		t.Fatalf("Get error = %v, want corruption in %s", err, path)
+	}
+	if bad := engine.BadTables(); len(bad) != 1 || bad[0] != files[0].FileNum {
+		t.Fatalf("BadTables = %v, want [%d]", bad, files[0].FileNum)
+	}
+	if err := engine.VerifyChecksums(); !errors.Is(err, sstable.ErrCorrupt) {
+		t.Fatalf("VerifyChecksums error = %v, want %v", err, sstable.ErrCorrupt)
+	}
+	metrics := engine.Metrics()
+	if metrics.BadTables != 1 || metrics.ChecksumFailures != 2 {
+		t.Fatalf("metrics = %+v, want 1 bad table and 2 checksum failures", metrics)
+	}
+}
+
+func TestEngineStopsWritesWhenImmutableMemTablesPileUp(t *testing.T) {
+	dir := t.TempDir()
+	tables := &gatedTableManager{
+		tableManager: defaultComponents(dir, defaultOptions(), sstable.NewRateLimiter(0)).TableManager,
+		release:      make(chan struct{}),
+	}
+	engine, err := openWithComponents(dir, components{TableManager: tables}, WithMemTableSize(64), WithMaxImmutableTables(1))
+	if err != nil {
+		t.Fatalf("openWithComponents error = %v", err)
+	}
+	defer func() { _ = engine.Close() }()
+
+	// 刷写被阻塞，写满一个不可变表和活跃表后进入停写状态
+	for i := 0; engine.WriteStall().Condition != StallStopped; i++ {
+		if i > 100 {
+			t.Fatalf("stall state = %+v, want stopped", engine.WriteStall())
+		}
+		var batch WriteBatch
+		batch.Put([]byte(fmt.Sprintf("key-%03d", i)), bytes.Repeat([]byte("v"), 32))
+		if err := engine.Write(&batch, WriteOptions{}); err != nil {
+			t.Fatalf("Write error = %v", err)
+		}
+	}
+	if state := engine.WriteStall(); state.Reason != StallReasonImmutableMemTables || state.ImmutableMemTables != 1 {
+		t.Fatalf("stall state = %+v, want immutable memtables", state)
+	}
+
+	var batch WriteBatch
+	batch.Put([]byte("late"), []byte("1"))
+	if err := engine.Write(&batch, WriteOptions{NoSlowdown: true}); !errors.Is(err, ErrWriteStall) {
+		t.Fatalf("Write NoSlowdown error = %v, want %v", err, ErrWriteStall)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- engine.Write(&batch, WriteOptions{}) }()
+	select {
+	case err := <-done:
+		t.Fatalf("stalled Write returned early: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(tables.release)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Write after stall error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Write still stalled after flush resumed")
+	}
+	if metrics := engine.Metrics(); metrics.StallStoppedWrites == 0 || metrics.StallTime <= 0 {
+		t.Fatalf("metrics = %+v, want stopped writes recorded", metrics)
+	}
+}
+
+func TestEngineSlowsWritesOnL0FileCount(t *testing.T) {
+	engine, err := Open(t.TempDir(), WithL0CompactionTrigger(100), WithL0StallTriggers(2, 3))
+	if err != nil {
+		t.Fatalf("Open error = %v", err)
+	}
+	defer func() { _ = engine.Close() }()
+
+	flushKey := func(key string) {
+		t.Helper()
+		var batch WriteBatch
+		batch.Put([]byte(key), []byte("v"))
+		if err := engine.Write(&batch, WriteOptions{}); err != nil {
+			t.Fatalf("Write(%s) error = %v", key, err)
+		}
+		if err := engine.Flush(); err != nil {
+			t.Fatalf("Flush error = %v", err)
+		}
+	}
+	flushKey("a")
+	flushKey("b")
+	if state := engine.WriteStall(); state.Condition != StallDelayed || state.Reason != StallReasonL0Files || state.L0Files != 2 {
+		t.Fatalf("stall state = %+v, want delayed by l0 files", state)
+	}
+	flushKey("c")
+	if metrics := engine.Metrics(); metrics.StallDelayedWrites != 1 {
+		t.Fatalf("delayed writes = %d, want 1", metrics.StallDelayedWrites)
+	}
+	if state := engine.WriteStall(); state.Condition != StallStopped || state.Reason != StallReasonL0Files {
+		t.Fatalf("stall state = %+v, want stopped by l0 files", state)
+	}
+	var batch WriteBatch
+	batch.Put([]byte("d"), []byte("v"))
+	if err := engine.Write(&batch, WriteOptions{NoSlowdown: true}); !errors.Is(err, ErrWriteStall) {
+		t.Fatalf("Write NoSlowdown error = %v, want %v", err, ErrWriteStall)
+	}
+}
+
 func TestEngineFlushPurgesOldWALSegments(t *testing.T) {
 	dir := t.TempDir()
 	engine, err := Open(dir, WithWALSegmentSize(96), WithL0CompactionTrigger(100))
@@ -461,7 +736,7 @@ func TestEngineCompactionRemovesObsoleteSSTables(t *testing.T) {
 		t.Fatalf("sstable count before compaction = %d, want 3", before)
 	}
 	engine.opts.L0CompactionTrigger = 1
-	if err := engine.runCompaction(context.Background(), compactionJob{level: 0}); err != nil {
+	if err := engine.runCompaction(context.Background(), engine.defaultFamily, compactionJob{level: 0}); err != nil {
 		t.Fatalf("runCompaction error = %v", err)
 	}
 	after := countFiles(t, dir, "*.sst")
@@ -470,6 +745,747 @@ func TestEngineCompactionRemovesObsoleteSSTables(t *testing.T) {
 	}
 }
 
+func TestEngineDefersTableDeletionWhileReadersPinIt(t *testing.T) {
+	dir := t.TempDir()
+	engine, err := Open(dir, WithL0CompactionTrigger(100))
+	if err != nil {
+		t.Fatalf("Open error = %v", err)
+	}
+	defer func() { _ = engine.Close() }()
+
+	for round := 0; round < 2; round++ {
+		var batch WriteBatch
+		for i := 0; i < 10; i++ {
+			batch.Put([]byte(fmt.Sprintf("k%02d", i)), []byte(fmt.Sprintf("v%d", round)))
+		}
+		if err := engine.Write(&batch, WriteOptions{}); err != nil {
+			t.Fatalf("Write error = %v", err)
+		}
+		if err := engine.Flush(); err != nil {
+			t.Fatalf("Flush error = %v", err)
+		}
+	}
+
+	// 模拟一个长时间扫描固定住当前的两个 SSTable
+	pinned := engine.pinTables(func() []tableMeta {
+		return engine.familyVersion(engine.defaultFamily.handle.id).AllFiles()
+	})
+	if len(pinned) != 2 {
+		t.Fatalf("pinned tables = %d, want 2", len(pinned))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := engine.CompactRange(ctx, nil, nil); err != nil {
+		t.Fatalf("CompactRange error = %v", err)
+	}
+	if got := countFiles(t, dir, "*.sst"); got != 3 {
+		t.Fatalf("sstable count while pinned = %d, want 3", got)
+	}
+	if value, ok, err := engine.Get([]byte("k03")); err != nil || !ok || string(value) != "v1" {
+		t.Fatalf("Get while pinned = (%q, %v, %v), want v1", value, ok, err)
+	}
+
+	engine.unpinTables(pinned)
+	if got := countFiles(t, dir, "*.sst"); got != 1 {
+		t.Fatalf("sstable count after unpin = %d, want 1", got)
+	}
+	if value, ok, err := engine.Get([]byte("k03")); err != nil || !ok || string(value) != "v1" {
+		t.Fatalf("Get after unpin = (%q, %v, %v), want v1", value, ok, err)
+	}
+}
+
+func TestEngineCompactRangeDropsTombstones(t *testing.T) {
+	dir := t.TempDir()
+	engine, err := Open(dir, WithL0CompactionTrigger(100))
+	if err != nil {
+		t.Fatalf("Open error = %v", err)
+	}
+	defer func() { _ = engine.Close() }()
+
+	var batch WriteBatch
+	for i := 0; i < 50; i++ {
+		batch.Put([]byte(fmt.Sprintf("k%02d", i)), bytes.Repeat([]byte("v"), 64))
+	}
+	if err := engine.Write(&batch, WriteOptions{}); err != nil {
+		t.Fatalf("Write puts error = %v", err)
+	}
+	if err := engine.Flush(); err != nil {
+		t.Fatalf("Flush puts error = %v", err)
+	}
+	batch.Reset()
+	for i := 0; i < 40; i++ {
+		batch.Delete([]byte(fmt.Sprintf("k%02d", i)))
+	}
+	if err := engine.Write(&batch, WriteOptions{}); err != nil {
+		t.Fatalf("Write deletes error = %v", err)
+	}
+
+	// 删除标记仍在内存表中，CompactRange 需要先刷写
+	if err := engine.CompactRange(context.Background(), nil, nil); err != nil {
+		t.Fatalf("CompactRange error = %v", err)
+	}
+	if got := countFiles(t, dir, "*.sst"); got != 1 {
+		t.Fatalf("sstable count after CompactRange = %d, want 1", got)
+	}
+	count, err := engine.ApproximateCount(nil, nil)
+	if err != nil {
+		t.Fatalf("ApproximateCount error = %v", err)
+	}
+	if count != 10 {
+		t.Fatalf("ApproximateCount = %d, want 10", count)
+	}
+	size, err := engine.ApproximateSize([]byte("k40"), []byte("k50"))
+	if err != nil {
+		t.Fatalf("ApproximateSize error = %v", err)
+	}
+	if size <= 0 {
+		t.Fatalf("ApproximateSize(k40, k50) = %d, want > 0", size)
+	}
+	if size, err := engine.ApproximateSize([]byte("x"), nil); err != nil || size != 0 {
+		t.Fatalf("ApproximateSize(x, nil) = (%d, %v), want 0 nil", size, err)
+	}
+	for i := 0; i < 50; i++ {
+		key := []byte(fmt.Sprintf("k%02d", i))
+		_, ok, err := engine.Get(key)
+		if err != nil {
+			t.Fatalf("Get(%s) error = %v", key, err)
+		}
+		if ok != (i >= 40) {
+			t.Fatalf("Get(%s) found = %v, want %v", key, ok, i >= 40)
+		}
+	}
+	if err := engine.CompactRange(context.Background(), []byte("b"), []byte("a")); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("CompactRange inverted error = %v, want %v", err, ErrInvalidKey)
+	}
+}
+
+func TestEngineMetricsReportMemTablesLevelsAndEvents(t *testing.T) {
+	var mu sync.Mutex
+	var flushes []FlushInfo
+	var compactions []CompactionInfo
+	var syncs int
+	listener := EventListener{
+		FlushCompleted: func(info FlushInfo) {
+			mu.Lock()
+			flushes = append(flushes, info)
+			mu.Unlock()
+		},
+		CompactionCompleted: func(info CompactionInfo) {
+			mu.Lock()
+			compactions = append(compactions, info)
+			mu.Unlock()
+		},
+		WALSynced: func(time.Duration) {
+			mu.Lock()
+			syncs++
+			mu.Unlock()
+		},
+	}
+	engine, err := Open(t.TempDir(), WithL0CompactionTrigger(100), WithEventListener(listener))
+	if err != nil {
+		t.Fatalf("Open error = %v", err)
+	}
+	defer func() { _ = engine.Close() }()
+
+	var batch WriteBatch
+	for i := 0; i < 50; i++ {
+		batch.Put([]byte(fmt.Sprintf("k%02d", i)), bytes.Repeat([]byte("v"), 64))
+	}
+	if err := engine.Write(&batch, WriteOptions{Sync: true}); err != nil {
+		t.Fatalf("Write error = %v", err)
+	}
+	metrics := engine.Metrics()
+	if metrics.MemTableBytes <= 0 || metrics.MemTables != 1 || metrics.ImmutableMemTables != 0 {
+		t.Fatalf("memtable metrics = %d bytes in %d tables (%d immutable), want data in 1 active table", metrics.MemTableBytes, metrics.MemTables, metrics.ImmutableMemTables)
+	}
+	if len(metrics.Levels) != defaultMaxLevels || metrics.Levels[0].Files != 0 {
+		t.Fatalf("levels before flush = %+v, want %d empty levels", metrics.Levels, defaultMaxLevels)
+	}
+
+	if err := engine.Flush(); err != nil {
+		t.Fatalf("Flush error = %v", err)
+	}
+	metrics = engine.Metrics()
+	if metrics.Flushes != 1 || metrics.Levels[0].Files != 1 || metrics.Levels[0].Bytes <= 0 {
+		t.Fatalf("metrics after flush = %d flushes, L0 %+v, want 1 flush and 1 L0 file", metrics.Flushes, metrics.Levels[0])
+	}
+	if metrics.MemTableBytes != 0 {
+		t.Fatalf("memtable bytes after flush = %d, want 0", metrics.MemTableBytes)
+	}
+
+	// 范围内不存在的键要么被布隆过滤器排除，要么计为误判
+	const misses = 100
+	for i := 0; i < misses; i++ {
+		key := []byte(fmt.Sprintf("k%02d-missing-%d", i%49, i))
+		if _, ok, err := engine.Get(key); err != nil || ok {
+			t.Fatalf("Get(%s) = (%v, %v), want not found", key, ok, err)
+		}
+	}
+	metrics = engine.Metrics()
+	if metrics.BloomUseful+metrics.BloomFalsePositives != misses || metrics.BloomUseful == 0 {
+		t.Fatalf("bloom metrics = %d useful, %d false positives, want %d lookups mostly filtered", metrics.BloomUseful, metrics.BloomFalsePositives, misses)
+	}
+
+	if err := engine.CompactRange(context.Background(), nil, nil); err != nil {
+		t.Fatalf("CompactRange error = %v", err)
+	}
+	metrics = engine.Metrics()
+	var output LevelMetrics
+	for _, level := range metrics.Levels {
+		if level.Files > 0 {
+			output = level
+		}
+	}
+	if metrics.Compactions == 0 || metrics.CompactionBytesRead <= 0 || metrics.Levels[0].Files != 0 || output.Files != 1 {
+		t.Fatalf("metrics after compaction = %d compactions reading %d bytes, levels %+v", metrics.Compactions, metrics.CompactionBytesRead, metrics.Levels)
+	}
+	if amp := metrics.WriteAmplification(); amp <= 1 {
+		t.Fatalf("WriteAmplification = %v, want > 1 after compaction", amp)
+	}
+	if metrics.BackgroundError {
+		t.Fatal("BackgroundError = true, want false")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(flushes) != 1 || flushes[0].Family != DefaultColumnFamilyName || flushes[0].Bytes <= 0 {
+		t.Fatalf("flush events = %+v, want one default family flush", flushes)
+	}
+	if uint64(len(compactions)) != metrics.Compactions || compactions[len(compactions)-1].OutputLevel != output.Level {
+		t.Fatalf("compaction events = %+v, want %d ending at level %d", compactions, metrics.Compactions, output.Level)
+	}
+	if syncs != 1 {
+		t.Fatalf("WAL sync events = %d, want 1", syncs)
+	}
+}
+
+func TestEngineSplitsLargeCompactionIntoSubcompactions(t *testing.T) {
+	dir := t.TempDir()
+	engine, err := Open(dir, WithBlockSize(256), WithL0CompactionTrigger(100), WithSubcompactions(4, 1024))
+	if err != nil {
+		t.Fatalf("Open error = %v", err)
+	}
+	defer func() { _ = engine.Close() }()
+
+	// 两个 Level 0 文件覆盖相同键范围，后者覆盖一半键并删除另一半中的部分键
+	var batch WriteBatch
+	for i := 0; i < 400; i++ {
+		batch.Put([]byte(fmt.Sprintf("k%04d", i)), bytes.Repeat([]byte("a"), 32))
+	}
+	if err := engine.Write(&batch, WriteOptions{}); err != nil {
+		t.Fatalf("Write error = %v", err)
+	}
+	if err := engine.Flush(); err != nil {
+		t.Fatalf("Flush error = %v", err)
+	}
+	batch.Reset()
+	for i := 0; i < 400; i += 2 {
+		batch.Put([]byte(fmt.Sprintf("k%04d", i)), bytes.Repeat([]byte("b"), 32))
+	}
+	for i := 1; i < 400; i += 4 {
+		batch.Delete([]byte(fmt.Sprintf("k%04d", i)))
+	}
+	if err := engine.Write(&batch, WriteOptions{}); err != nil {
+		t.Fatalf("Write error = %v", err)
+	}
+	if err := engine.Flush(); err != nil {
+		t.Fatalf("Flush error = %v", err)
+	}
+
+	engine.opts.L0CompactionTrigger = 1
+	if err := engine.runCompaction(context.Background(), engine.defaultFamily, compactionJob{level: 0}); err != nil {
+		t.Fatalf("runCompaction error = %v", err)
+	}
+	metrics := engine.Metrics()
+	if metrics.Subcompactions != 4 {
+		t.Fatalf("subcompactions = %d, want 4", metrics.Subcompactions)
+	}
+	if metrics.FlushBytes <= 0 || metrics.CompactionBytes <= 0 {
+		t.Fatalf("bytes written = flush %d compaction %d, want both > 0", metrics.FlushBytes, metrics.CompactionBytes)
+	}
+
+	l1 := engine.currentVersion().FilesInRange(1, nil, nil)
+	if len(l1) != 4 {
+		t.Fatalf("level 1 files = %d, want 4", len(l1))
+	}
+	for i := 1; i < len(l1); i++ {
+		if bytes.Compare(l1[i-1].Largest, l1[i].Smallest) >= 0 {
+			t.Fatalf("level 1 files overlap: %q >= %q", l1[i-1].Largest, l1[i].Smallest)
+		}
+	}
+	for i := 0; i < 400; i++ {
+		key := []byte(fmt.Sprintf("k%04d", i))
+		value, ok, err := engine.Get(key)
+		if err != nil {
+			t.Fatalf("Get(%s) error = %v", key, err)
+		}
+		switch {
+		case i%2 == 0:
+			if !ok || value[0] != 'b' {
+				t.Fatalf("Get(%s) = (%q, %v), want b value", key, value, ok)
+			}
+		case i%4 == 1:
+			if ok {
+				t.Fatalf("Get(%s) = %q, want deleted", key, value)
+			}
+		default:
+			if !ok || value[0] != 'a' {
+				t.Fatalf("Get(%s) = (%q, %v), want a value", key, value, ok)
+			}
+		}
+	}
+}
+
+func TestEngineWriteRateLimitIsTunable(t *testing.T) {
+	engine, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open error = %v", err)
+	}
+	defer func() { _ = engine.Close() }()
+
+	engine.SetWriteRateLimit(64 << 10)
+	var batch WriteBatch
+	for i := 0; i < 100; i++ {
+		batch.Put([]byte(fmt.Sprintf("k%03d", i)), bytes.Repeat([]byte("v"), 128))
+	}
+	if err := engine.Write(&batch, WriteOptions{}); err != nil {
+		t.Fatalf("Write error = %v", err)
+	}
+	if err := engine.Flush(); err != nil {
+		t.Fatalf("Flush error = %v", err)
+	}
+	if wait := engine.Metrics().RateLimitWait; wait <= 0 {
+		t.Fatalf("RateLimitWait = %v, want > 0 under a low limit", wait)
+	}
+}
+
+func TestEngineValueSeparationStoresLargeValuesInBlobFiles(t *testing.T) {
+	dir := t.TempDir()
+	engine, err := Open(dir, WithValueSeparation(64, 0.5))
+	if err != nil {
+		t.Fatalf("Open error = %v", err)
+	}
+
+	large := bytes.Repeat([]byte("L"), 256)
+	var batch WriteBatch
+	batch.Put([]byte("big"), large)
+	batch.Put([]byte("small"), []byte("s"))
+	if err := engine.Write(&batch, WriteOptions{}); err != nil {
+		t.Fatalf("Write error = %v", err)
+	}
+	if err := engine.Flush(); err != nil {
+		t.Fatalf("Flush error = %v", err)
+	}
+	if got := countFiles(t, dir, "*.blob"); got != 1 {
+		t.Fatalf("blob file count = %d, want 1", got)
+	}
+	if metrics := engine.Metrics(); metrics.BlobFiles != 1 || metrics.BlobBytes <= int64(len(large)) {
+		t.Fatalf("blob metrics = %d files %d bytes, want 1 file > %d bytes", metrics.BlobFiles, metrics.BlobBytes, len(large))
+	}
+
+	// Get、迭代器和快照都应透明解析值指针
+	if value, ok, err := engine.Get([]byte("big")); err != nil || !ok || !bytes.Equal(value, large) {
+		t.Fatalf("Get(big) = (%d bytes, %v, %v), want large value", len(value), ok, err)
+	}
+	iter := engine.NewIterator(IterOptions{})
+	got := make(map[string]int)
+	for ok := iter.First(); ok; ok = iter.Next() {
+		got[string(iter.Key())] = len(iter.Value())
+	}
+	if err := iter.Error(); err != nil {
+		t.Fatalf("iterator error = %v", err)
+	}
+	_ = iter.Close()
+	if got["big"] != len(large) || got["small"] != 1 {
+		t.Fatalf("iterator value lengths = %v, want big=%d small=1", got, len(large))
+	}
+	snapshot, err := engine.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot error = %v", err)
+	}
+	if value, ok, err := snapshot.Get([]byte("big")); err != nil || !ok || !bytes.Equal(value, large) {
+		t.Fatalf("snapshot Get(big) = (%d bytes, %v, %v), want large value", len(value), ok, err)
+	}
+	_ = snapshot.Close()
+
+	if err := engine.Close(); err != nil {
+		t.Fatalf("Close error = %v", err)
+	}
+	reopened, err := Open(dir, WithValueSeparation(64, 0.5))
+	if err != nil {
+		t.Fatalf("reopen error = %v", err)
+	}
+	defer func() { _ = reopened.Close() }()
+	if value, ok, err := reopened.Get([]byte("big")); err != nil || !ok || !bytes.Equal(value, large) {
+		t.Fatalf("reopened Get(big) = (%d bytes, %v, %v), want large value", len(value), ok, err)
+	}
+}
+
+func TestEngineBlobGCRewritesMostlyDeadFiles(t *testing.T) {
+	dir := t.TempDir()
+	engine, err := Open(dir, WithValueSeparation(64, 0.5), WithL0CompactionTrigger(100))
+	if err != nil {
+		t.Fatalf("Open error = %v", err)
+	}
+
+	value := func(round, i int) []byte {
+		return bytes.Repeat([]byte{byte('a' + round), byte('0' + i)}, 64)
+	}
+	for round := 0; round < 2; round++ {
+		var batch WriteBatch
+		for i := 0; i < 8; i++ {
+			// 第二轮只覆盖前 6 个键，使第一个 Blob 文件中 3/4 的记录失效
+			if round == 1 && i >= 6 {
+				continue
+			}
+			batch.Put([]byte(fmt.Sprintf("k%d", i)), value(round, i))
+		}
+		if err := engine.Write(&batch, WriteOptions{}); err != nil {
+			t.Fatalf("Write round %d error = %v", round, err)
+		}
+		if err := engine.Flush(); err != nil {
+			t.Fatalf("Flush round %d error = %v", round, err)
+		}
+	}
+	if got := engine.Metrics().BlobFiles; got != 2 {
+		t.Fatalf("blob files before compaction = %d, want 2", got)
+	}
+
+	// 合并丢弃旧版本后，后台回收重写第一个 Blob 文件中仍存活的 2 条记录
+	if err := engine.CompactRange(context.Background(), nil, nil); err != nil {
+		t.Fatalf("CompactRange error = %v", err)
+	}
+	metrics := engine.Metrics()
+	if metrics.BlobGCRuns != 1 || metrics.BlobFiles != 2 || metrics.BlobGarbageBytes != 0 {
+		t.Fatalf("blob metrics after gc = %d runs %d files %d garbage bytes, want 1 run 2 files 0 garbage",
+			metrics.BlobGCRuns, metrics.BlobFiles, metrics.BlobGarbageBytes)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "000001.blob")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("first blob file stat error = %v, want not exist", err)
+	}
+	check := func(engine *Engine) {
+		t.Helper()
+		for i := 0; i < 8; i++ {
+			want := value(1, i)
+			if i >= 6 {
+				want = value(0, i)
+			}
+			got, ok, err := engine.Get([]byte(fmt.Sprintf("k%d", i)))
+			if err != nil || !ok || !bytes.Equal(got, want) {
+				t.Fatalf("Get(k%d) = (%q, %v, %v), want %q", i, got, ok, err, want)
+			}
+		}
+	}
+	check(engine)
+
+	if err := engine.Close(); err != nil {
+		t.Fatalf("Close error = %v", err)
+	}
+	reopened, err := Open(dir, WithValueSeparation(64, 0.5))
+	if err != nil {
+		t.Fatalf("reopen error = %v", err)
+	}
+	defer func() { _ = reopened.Close() }()
+	check(reopened)
+}
+
+func TestEngineColumnFamiliesShareAtomicBatches(t *testing.T) {
+	engine, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open error = %v", err)
+	}
+	defer func() { _ = engine.Close() }()
+	meta, err := engine.OpenColumnFamily("meta", WithMemTableSize(1<<20))
+	if err != nil {
+		t.Fatalf("OpenColumnFamily error = %v", err)
+	}
+	if again, err := engine.OpenColumnFamily("meta"); err != nil || again != meta {
+		t.Fatalf("OpenColumnFamily again = (%v, %v), want same handle", again, err)
+	}
+
+	var batch WriteBatch
+	batch.Put([]byte("a"), []byte("data"))
+	batch.PutCF(meta, []byte("a"), []byte("meta"))
+	batch.PutCF(meta, []byte("b"), []byte("meta-b"))
+	if err := engine.Write(&batch, WriteOptions{}); err != nil {
+		t.Fatalf("Write error = %v", err)
+	}
+	if got, ok, err := engine.Get([]byte("a")); err != nil || !ok || string(got) != "data" {
+		t.Fatalf("Get(a) = (%q, %v, %v), want data", got, ok, err)
+	}
+	if got, ok, err := engine.GetCF(meta, []byte("a")); err != nil || !ok || string(got) != "meta" {
+		t.Fatalf("GetCF(meta, a) = (%q, %v, %v), want meta", got, ok, err)
+	}
+	if _, ok, err := engine.Get([]byte("b")); err != nil || ok {
+		t.Fatalf("Get(b) = (%v, %v), want missing in default family", ok, err)
+	}
+
+	snapshot, err := engine.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot error = %v", err)
+	}
+	defer func() { _ = snapshot.Close() }()
+	var remove WriteBatch
+	remove.DeleteCF(meta, []byte("a"))
+	if err := engine.Write(&remove, WriteOptions{}); err != nil {
+		t.Fatalf("Write delete error = %v", err)
+	}
+	if got, ok, err := snapshot.GetCF(meta, []byte("a")); err != nil || !ok || string(got) != "meta" {
+		t.Fatalf("snapshot GetCF(meta, a) = (%q, %v, %v), want meta", got, ok, err)
+	}
+	iter := engine.NewIterator(IterOptions{ColumnFamily: meta})
+	var keys []string
+	for iter.First(); iter.Valid(); iter.Next() {
+		keys = append(keys, string(iter.Key()))
+	}
+	if err := iter.Close(); err != nil {
+		t.Fatalf("iterator Close error = %v", err)
+	}
+	if !slices.Equal(keys, []string{"b"}) {
+		t.Fatalf("meta keys = %v, want [b]", keys)
+	}
+
+	other, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open other error = %v", err)
+	}
+	defer func() { _ = other.Close() }()
+	foreign, err := other.OpenColumnFamily("meta")
+	if err != nil {
+		t.Fatalf("OpenColumnFamily other error = %v", err)
+	}
+	var bad WriteBatch
+	bad.Put([]byte("c"), []byte("1"))
+	bad.PutCF(foreign, []byte("c"), []byte("1"))
+	if err := engine.Write(&bad, WriteOptions{}); !errors.Is(err, ErrInvalidBatch) {
+		t.Fatalf("Write with foreign family error = %v, want %v", err, ErrInvalidBatch)
+	}
+	if _, ok, err := engine.Get([]byte("c")); err != nil || ok {
+		t.Fatalf("Get(c) after rejected batch = (%v, %v), want missing", ok, err)
+	}
+}
+
+func TestEngineColumnFamiliesFlushIndependentlyAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	engine, err := Open(dir, WithL0CompactionTrigger(100))
+	if err != nil {
+		t.Fatalf("Open error = %v", err)
+	}
+	meta, err := engine.OpenColumnFamily("meta")
+	if err != nil {
+		t.Fatalf("OpenColumnFamily error = %v", err)
+	}
+	var batch WriteBatch
+	batch.Put([]byte("a"), []byte("1"))
+	batch.PutCF(meta, []byte("m"), []byte("2"))
+	if err := engine.Write(&batch, WriteOptions{Sync: true}); err != nil {
+		t.Fatalf("Write error = %v", err)
+	}
+
+	// 只刷写 meta 列族，默认列族的写入仍只在 WAL 中
+	fam, err := engine.family(meta)
+	if err != nil {
+		t.Fatalf("family error = %v", err)
+	}
+	engine.memMu.Lock()
+	engine.freezeMemTableLocked(fam)
+	engine.memMu.Unlock()
+	if err := engine.flushMemTables(context.Background(), false); err != nil {
+		t.Fatalf("flushMemTables error = %v", err)
+	}
+	if got := len(engine.familyVersion(meta.ID()).AllFiles()); got != 1 {
+		t.Fatalf("meta table count = %d, want 1", got)
+	}
+	if got := len(engine.currentVersion().AllFiles()); got != 0 {
+		t.Fatalf("default table count = %d, want 0", got)
+	}
+	var more WriteBatch
+	more.PutCF(meta, []byte("n"), []byte("3"))
+	if err := engine.Write(&more, WriteOptions{Sync: true}); err != nil {
+		t.Fatalf("Write more error = %v", err)
+	}
+	if err := engine.Close(); err != nil {
+		t.Fatalf("Close error = %v", err)
+	}
+
+	engine, err = Open(dir, WithL0CompactionTrigger(100))
+	if err != nil {
+		t.Fatalf("reopen error = %v", err)
+	}
+	defer func() { _ = engine.Close() }()
+	reopened, err := engine.OpenColumnFamily("meta")
+	if err != nil || reopened.ID() != meta.ID() {
+		t.Fatalf("OpenColumnFamily after reopen = (%v, %v), want id %d", reopened, err, meta.ID())
+	}
+	if got, ok, err := engine.Get([]byte("a")); err != nil || !ok || string(got) != "1" {
+		t.Fatalf("Get(a) after reopen = (%q, %v, %v), want 1", got, ok, err)
+	}
+	for key, want := range map[string]string{"m": "2", "n": "3"} {
+		if got, ok, err := engine.GetCF(reopened, []byte(key)); err != nil || !ok || string(got) != want {
+			t.Fatalf("GetCF(meta, %s) after reopen = (%q, %v, %v), want %s", key, got, ok, err, want)
+		}
+	}
+}
+
+func TestRepairRebuildsLostManifestAndSalvagesWAL(t *testing.T) {
+	dir := t.TempDir()
+	engine, err := Open(dir, WithL0CompactionTrigger(100))
+	if err != nil {
+		t.Fatalf("Open error = %v", err)
+	}
+	for _, key := range []string{"a", "b"} {
+		var batch WriteBatch
+		batch.Put([]byte(key), []byte("v-"+key))
+		if err := engine.Write(&batch, WriteOptions{Sync: true}); err != nil {
+			t.Fatalf("Write(%s) error = %v", key, err)
+		}
+	}
+	if err := engine.Flush(); err != nil {
+		t.Fatalf("Flush error = %v", err)
+	}
+	var unflushed WriteBatch
+	unflushed.Put([]byte("c"), []byte("v-c"))
+	if err := engine.Write(&unflushed, WriteOptions{Sync: true}); err != nil {
+		t.Fatalf("Write(c) error = %v", err)
+	}
+	if err := engine.Close(); err != nil {
+		t.Fatalf("Close error = %v", err)
+	}
+
+	// 丢失 MANIFEST，并在 WAL 尾部追加一个校验和错误的帧，正常打开会失败
+	manifests, err := filepath.Glob(filepath.Join(dir, "MANIFEST-*"))
+	if err != nil || len(manifests) != 1 {
+		t.Fatalf("manifests = (%v, %v), want one", manifests, err)
+	}
+	for _, path := range append(manifests, filepath.Join(dir, "CURRENT")) {
+		if err := os.Remove(path); err != nil {
+			t.Fatalf("Remove(%s) error = %v", path, err)
+		}
+	}
+	segments, err := filepath.Glob(filepath.Join(dir, "WAL-*"))
+	if err != nil || len(segments) == 0 {
+		t.Fatalf("wal segments = (%v, %v)", segments, err)
+	}
+	file, err := os.OpenFile(segments[len(segments)-1], os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("open wal error = %v", err)
+	}
+	if _, err := file.Write([]byte{4, 0, 0, 0, 1, 2, 3, 4, 9, 9, 9, 9}); err != nil {
+		t.Fatalf("append garbage error = %v", err)
+	}
+	_ = file.Close()
+
+	report, err := Repair(dir)
+	if err != nil {
+		t.Fatalf("Repair error = %v", err)
+	}
+	if report.ManifestError == nil || len(report.Recovered) != 1 || len(report.Tables) != 1 {
+		t.Fatalf("report = %+v, want one recovered table and a manifest error", report)
+	}
+	var dropped int64
+	for _, result := range report.WAL {
+		dropped += result.Dropped
+	}
+	if dropped != 12 {
+		t.Fatalf("dropped wal bytes = %d, want 12", dropped)
+	}
+
+	engine, err = Open(dir, WithL0CompactionTrigger(100))
+	if err != nil {
+		t.Fatalf("Open after repair error = %v", err)
+	}
+	defer func() { _ = engine.Close() }()
+	for _, key := range []string{"a", "b", "c"} {
+		if got, ok, err := engine.Get([]byte(key)); err != nil || !ok || string(got) != "v-"+key {
+			t.Fatalf("Get(%s) after repair = (%q, %v, %v), want v-%s", key, got, ok, err, key)
+		}
+	}
+}
+
+func TestRepairRecoversTablesIntoTheirColumnFamily(t *testing.T) {
+	dir := t.TempDir()
+	engine, err := Open(dir, WithL0CompactionTrigger(100))
+	if err != nil {
+		t.Fatalf("Open error = %v", err)
+	}
+	data, err := engine.OpenColumnFamily("data")
+	if err != nil {
+		t.Fatalf("OpenColumnFamily error = %v", err)
+	}
+	manifests, err := filepath.Glob(filepath.Join(dir, "MANIFEST-*"))
+	if err != nil || len(manifests) != 1 {
+		t.Fatalf("manifests = (%v, %v), want one", manifests, err)
+	}
+	info, err := os.Stat(manifests[0])
+	if err != nil {
+		t.Fatalf("Stat manifest error = %v", err)
+	}
+	for _, value := range []string{"old", "new"} {
+		var batch WriteBatch
+		batch.PutCF(data, []byte("k"), []byte(value))
+		if err := engine.Write(&batch, WriteOptions{Sync: true}); err != nil {
+			t.Fatalf("Write(%s) error = %v", value, err)
+		}
+		if err := engine.Flush(); err != nil {
+			t.Fatalf("Flush error = %v", err)
+		}
+	}
+	if err := engine.Close(); err != nil {
+		t.Fatalf("Close error = %v", err)
+	}
+
+	// MANIFEST 只剩列族定义，两次刷写的登记记录损坏；写入都已刷写，WAL 不再参与恢复
+	file, err := os.OpenFile(manifests[0], os.O_RDWR, 0o644)
+	if err != nil {
+		t.Fatalf("open manifest error = %v", err)
+	}
+	if err := file.Truncate(info.Size()); err != nil {
+		t.Fatalf("Truncate manifest error = %v", err)
+	}
+	if _, err := file.WriteAt([]byte{4, 0, 0, 0, 1, 2, 3, 4, 9, 9, 9, 9}, info.Size()); err != nil {
+		t.Fatalf("append garbage error = %v", err)
+	}
+	_ = file.Close()
+	segments, err := filepath.Glob(filepath.Join(dir, "WAL-*"))
+	if err != nil {
+		t.Fatalf("wal segments error = %v", err)
+	}
+	for _, path := range segments {
+		if err := os.Remove(path); err != nil {
+			t.Fatalf("Remove(%s) error = %v", path, err)
+		}
+	}
+	// 页脚没有列族的表无法确定归属，应移入 lost 目录
+	if _, err := sstable.NewManager(dir, sstable.Options{}).Build(context.Background(), 1000, 0,
+		[]entry{record.NewPut([]byte("k"), []byte("stale"), 1)}); err != nil {
+		t.Fatalf("Build unowned table error = %v", err)
+	}
+
+	report, err := Repair(dir)
+	if err != nil {
+		t.Fatalf("Repair error = %v", err)
+	}
+	if report.ManifestError == nil || len(report.Recovered) != 2 || !slices.Contains(report.Lost, sstable.FileName(1000)) {
+		t.Fatalf("report = %+v, want two recovered tables and the unowned table in lost", report)
+	}
+
+	engine, err = Open(dir, WithL0CompactionTrigger(100))
+	if err != nil {
+		t.Fatalf("Open after repair error = %v", err)
+	}
+	defer func() { _ = engine.Close() }()
+	data, err = engine.OpenColumnFamily("data")
+	if err != nil {
+		t.Fatalf("OpenColumnFamily after repair error = %v", err)
+	}
+	if got, ok, err := engine.GetCF(data, []byte("k")); err != nil || !ok || string(got) != "new" {
+		t.Fatalf("GetCF(data, k) after repair = (%q, %v, %v), want new", got, ok, err)
+	}
+	if got, ok, err := engine.Get([]byte("k")); err != nil || ok {
+		t.Fatalf("Get(k) after repair = (%q, %v, %v), want not found in default family", got, ok, err)
+	}
+}
+
 func TestEngineBackgroundErrorIsObservable(t *testing.T) {
 	engine, err := openWithComponents(t.TempDir(), components{
 		TableManager: &failingTableManager{buildErr: io.ErrClosedPipe},
@@ -561,25 +1577,44 @@ func countFiles(t *testing.T, dir, pattern string) int {
 
 type fakeWALFactory struct {
 	appendErr error
+	wal       *fakeWAL
 }
 
 func (f fakeWALFactory) Open(string, uint64, walOptions) (walStore, error) {
+	if f.wal != nil {
+		return f.wal, nil
+	}
 	return &fakeWAL{appendErr: f.appendErr}, nil
 }
 
 type fakeWAL struct {
 	appendErr error
 	batches   []batch
+	syncs     int
+	entered   chan struct{}
+	release   chan struct{}
 }
 
 func (w *fakeWAL) Append(batch batch, _ bool) error {
 	if w.appendErr != nil {
 		return w.appendErr
 	}
+	if w.release != nil {
+		// 首次追加时阻塞，便于测试构造排队的写入组
+		release := w.release
+		w.release = nil
+		close(w.entered)
+		<-release
+	}
 	w.batches = append(w.batches, batch.Clone())
 	return nil
 }
 
+func (w *fakeWAL) Sync() error {
+	w.syncs++
+	return nil
+}
+
 func (w *fakeWAL) Replay(fn func(batch) error) error {
 	for _, batch := range slices.Clone(w.batches) {
 		if err := fn(batch.Clone()); err != nil {
@@ -597,6 +1632,20 @@ func (w *fakeWAL) Close() error {
 	return nil
 }
 
+type gatedTableManager struct {
+	tableManager
+	release chan struct{}
+}
+
+func (m *gatedTableManager) Build(ctx context.Context, fileNum uint64, level int, entries []entry) (tableMeta, error) {
+	select {
+	case <-m.release:
+	case <-ctx.Done():
+		return tableMeta{}, ctx.Err()
+	}
+	return m.tableManager.Build(ctx, fileNum, level, entries)
+}
+
 type failingTableManager struct {
 	buildErr error
 }
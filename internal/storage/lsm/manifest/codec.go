@@ -0,0 +1,322 @@
+package manifest
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	version "mini-kv/internal/storage/lsm/sstable"
+)
+
+// 记录类型，位于每帧载荷的第一个字节
+const (
+	editRecord     = byte(1) // 一次版本变更
+	snapshotRecord = byte(2) // 完整版本状态，轮转后新文件的第一条记录
+	legacyRecord   = byte('{')
+)
+
+// 字段标签，每个字段以 uvarint 标签开头，便于以后追加字段
+const (
+	tagNextFileNum   = 1  // 下一个可分配的文件编号
+	tagLastSeq       = 2  // 最新序列号
+	tagFamily        = 3  // 变更所属的列族
+	tagFlushedSeq    = 4  // 变更所属列族的刷写进度
+	tagAddedTable    = 5  // 新增的表
+	tagDeletedTable  = 6  // 删除的表
+	tagAddedFamily   = 7  // 新建的列族
+	tagAddedBlob     = 8  // 新增的 Blob 文件
+	tagDeletedBlob   = 9  // 删除的 Blob 文件
+	tagBlobGarbage   = 10 // Blob 文件新增的失效统计
+	tagFamilyTable   = 11 // 快照中带列族编号的表
+	tagFamilyFlushed = 12 // 快照中各列族的刷写进度
+)
+
+// maxLevel 是解码时接受的最大层级，防止损坏的记录导致超大分配
+const maxLevel = 64
+
+// ErrCorrupt 表示 MANIFEST 记录无法解码
+var ErrCorrupt = errors.New("manifest: corrupt record")
+
+// encodeEdit 将版本变更编码为二进制载荷，零值字段不写入
+func encodeEdit(edit version.Edit) []byte {
+	enc := encoder{buf: []byte{editRecord}}
+	enc.field(tagNextFileNum, edit.NextFileNum)
+	enc.field(tagLastSeq, edit.LastSeq)
+	enc.field(tagFamily, uint64(edit.Family))
+	enc.field(tagFlushedSeq, edit.FlushedSeq)
+	for _, meta := range edit.Added {
+		enc.uvarint(tagAddedTable)
+		enc.table(meta)
+	}
+	for _, fileNum := range edit.Deleted {
+		enc.uvarint(tagDeletedTable)
+		enc.uvarint(fileNum)
+	}
+	for _, meta := range edit.AddedFamilies {
+		enc.uvarint(tagAddedFamily)
+		enc.family(meta)
+	}
+	for _, meta := range edit.AddedBlobs {
+		enc.uvarint(tagAddedBlob)
+		enc.blob(meta)
+	}
+	for _, fileNum := range edit.DeletedBlobs {
+		enc.uvarint(tagDeletedBlob)
+		enc.uvarint(fileNum)
+	}
+	for _, garbage := range edit.BlobGarbage {
+		enc.uvarint(tagBlobGarbage)
+		enc.uvarint(garbage.FileNum)
+		enc.uvarint(uint64(garbage.Bytes))
+		enc.uvarint(uint64(garbage.Count))
+	}
+	return enc.buf
+}
+
+// encodeSnapshot 将完整版本状态编码为二进制载荷
+func encodeSnapshot(state *version.State) []byte {
+	enc := encoder{buf: []byte{snapshotRecord}}
+	enc.field(tagNextFileNum, state.NextFileNum)
+	enc.field(tagLastSeq, state.LastSeq)
+	for _, family := range state.Families {
+		enc.uvarint(tagAddedFamily)
+		enc.family(family.FamilyMeta)
+	}
+	for _, id := range state.FamilyIDs() {
+		for _, meta := range state.Family(id).AllFiles() {
+			enc.uvarint(tagFamilyTable)
+			enc.uvarint(uint64(id))
+			enc.table(meta)
+		}
+		if seq, ok := state.FlushedSeqs[id]; ok {
+			enc.uvarint(tagFamilyFlushed)
+			enc.uvarint(uint64(id))
+			enc.uvarint(seq)
+		}
+	}
+	for _, meta := range state.Blobs {
+		enc.uvarint(tagAddedBlob)
+		enc.blob(meta)
+	}
+	return enc.buf
+}
+
+// decodeEdit 解码 encodeEdit 生成的载荷（不含记录类型字节）
+func decodeEdit(data []byte) (version.Edit, error) {
+	var edit version.Edit
+	dec := decoder{buf: data}
+	for dec.more() {
+		switch tag := dec.uvarint(); tag {
+		case tagNextFileNum:
+			edit.NextFileNum = dec.uvarint()
+		case tagLastSeq:
+			edit.LastSeq = dec.uvarint()
+		case tagFamily:
+			edit.Family = dec.uint32()
+		case tagFlushedSeq:
+			edit.FlushedSeq = dec.uvarint()
+		case tagAddedTable:
+			edit.Added = append(edit.Added, dec.table())
+		case tagDeletedTable:
+			edit.Deleted = append(edit.Deleted, dec.uvarint())
+		case tagAddedFamily:
+			edit.AddedFamilies = append(edit.AddedFamilies, dec.family())
+		case tagAddedBlob:
+			edit.AddedBlobs = append(edit.AddedBlobs, dec.blob())
+		case tagDeletedBlob:
+			edit.DeletedBlobs = append(edit.DeletedBlobs, dec.uvarint())
+		case tagBlobGarbage:
+			edit.BlobGarbage = append(edit.BlobGarbage, version.BlobGarbage{
+				FileNum: dec.uvarint(),
+				Bytes:   int64(dec.uvarint()),
+				Count:   int(dec.uvarint()),
+			})
+		default:
+			dec.fail(fmt.Errorf("unknown edit tag %d", tag))
+		}
+	}
+	return edit, dec.err
+}
+
+// decodeSnapshot 解码 encodeSnapshot 生成的载荷（不含记录类型字节）
+func decodeSnapshot(data []byte) (*version.State, error) {
+	state := &version.State{}
+	dec := decoder{buf: data}
+	for dec.more() {
+		switch tag := dec.uvarint(); tag {
+		case tagNextFileNum:
+			state.NextFileNum = dec.uvarint()
+		case tagLastSeq:
+			state.LastSeq = dec.uvarint()
+		case tagAddedFamily:
+			state.Families = append(state.Families, version.FamilyState{FamilyMeta: dec.family()})
+		case tagFamilyTable:
+			id := dec.uint32()
+			meta := dec.table()
+			if dec.err != nil {
+				break
+			}
+			levels := &state.Levels
+			if id != 0 {
+				levels = nil
+				for i := range state.Families {
+					if state.Families[i].ID == id {
+						levels = &state.Families[i].Levels
+					}
+				}
+				if levels == nil {
+					dec.fail(fmt.Errorf("table %d in unknown column family %d", meta.FileNum, id))
+					break
+				}
+			}
+			for len(*levels) <= meta.Level {
+				*levels = append(*levels, nil)
+			}
+			(*levels)[meta.Level] = append((*levels)[meta.Level], meta)
+		case tagFamilyFlushed:
+			id := dec.uint32()
+			seq := dec.uvarint()
+			if state.FlushedSeqs == nil {
+				state.FlushedSeqs = make(map[uint32]uint64)
+			}
+			state.FlushedSeqs[id] = seq
+		case tagAddedBlob:
+			state.Blobs = append(state.Blobs, dec.blob())
+		default:
+			dec.fail(fmt.Errorf("unknown snapshot tag %d", tag))
+		}
+	}
+	if dec.err != nil {
+		return nil, dec.err
+	}
+	return state.Clone(), nil
+}
+
+// encoder 追加写入 uvarint 与带长度前缀的字节串
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) uvarint(value uint64) {
+	e.buf = binary.AppendUvarint(e.buf, value)
+}
+
+func (e *encoder) bytes(value []byte) {
+	e.uvarint(uint64(len(value)))
+	e.buf = append(e.buf, value...)
+}
+
+// field 写入非零的标量字段
+func (e *encoder) field(tag, value uint64) {
+	if value == 0 {
+		return
+	}
+	e.uvarint(tag)
+	e.uvarint(value)
+}
+
+func (e *encoder) table(meta version.TableMeta) {
+	e.uvarint(meta.FileNum)
+	e.uvarint(uint64(meta.Level))
+	e.bytes(meta.Smallest)
+	e.bytes(meta.Largest)
+	e.uvarint(meta.MinSeq)
+	e.uvarint(meta.MaxSeq)
+	e.uvarint(uint64(meta.Size))
+}
+
+func (e *encoder) family(meta version.FamilyMeta) {
+	e.uvarint(uint64(meta.ID))
+	e.bytes([]byte(meta.Name))
+}
+
+func (e *encoder) blob(meta version.BlobMeta) {
+	e.uvarint(meta.FileNum)
+	e.uvarint(uint64(meta.Size))
+	e.uvarint(uint64(meta.Count))
+	e.uvarint(uint64(meta.GarbageBytes))
+	e.uvarint(uint64(meta.GarbageCount))
+}
+
+// decoder 顺序读取字段，记录第一个错误，之后的读取均返回零值
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) more() bool {
+	return d.err == nil && len(d.buf) > 0
+}
+
+func (d *decoder) fail(err error) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: %w", ErrCorrupt, err)
+	}
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	value, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.fail(errors.New("bad uvarint"))
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return value
+}
+
+func (d *decoder) uint32() uint32 {
+	value := d.uvarint()
+	if value > uint64(^uint32(0)) {
+		d.fail(fmt.Errorf("value %d overflows uint32", value))
+		return 0
+	}
+	return uint32(value)
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.uvarint()
+	if d.err != nil {
+		return nil
+	}
+	if n > uint64(len(d.buf)) {
+		d.fail(errors.New("short byte string"))
+		return nil
+	}
+	out := append([]byte(nil), d.buf[:n]...)
+	d.buf = d.buf[n:]
+	return out
+}
+
+func (d *decoder) table() version.TableMeta {
+	meta := version.TableMeta{
+		FileNum:  d.uvarint(),
+		Level:    int(d.uvarint()),
+		Smallest: d.bytes(),
+		Largest:  d.bytes(),
+		MinSeq:   d.uvarint(),
+		MaxSeq:   d.uvarint(),
+		Size:     int64(d.uvarint()),
+	}
+	if meta.Level < 0 || meta.Level > maxLevel {
+		d.fail(fmt.Errorf("table %d level %d out of range", meta.FileNum, meta.Level))
+		return version.TableMeta{}
+	}
+	return meta
+}
+
+func (d *decoder) family() version.FamilyMeta {
+	return version.FamilyMeta{ID: d.uint32(), Name: string(d.bytes())}
+}
+
+func (d *decoder) blob() version.BlobMeta {
+	return version.BlobMeta{
+		FileNum:      d.uvarint(),
+		Size:         int64(d.uvarint()),
+		Count:        int(d.uvarint()),
+		GarbageBytes: int64(d.uvarint()),
+		GarbageCount: int(d.uvarint()),
+	}
+}
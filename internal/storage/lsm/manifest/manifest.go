@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"mini-kv/internal/storage/lsm/record"
@@ -13,27 +14,49 @@ import (
 )
 
 const (
-	currentFile   = "CURRENT"         // 指向当前 MANIFEST 文件名的指针文件
-	manifestFmt   = "MANIFEST-%06d"   // MANIFEST 文件名模板，如 MANIFEST-000001
-	defaultNumber = uint64(1)         // 默认起始文件编号
+	currentFile        = "CURRENT"       // 指向当前 MANIFEST 文件名的指针文件
+	manifestFmt        = "MANIFEST-%06d" // MANIFEST 文件名模板，如 MANIFEST-000001
+	manifestPrefix     = "MANIFEST-"     // MANIFEST 文件名前缀
+	defaultNumber      = uint64(1)       // 默认起始文件编号
+	defaultMaxFileSize = 4 << 20         // 默认的 MANIFEST 轮转阈值，4MB
 )
 
+// Options 配置 MANIFEST 的轮转策略
+type Options struct {
+	MaxFileSize int64 // 当前 MANIFEST 达到该字节数时写入完整快照并轮转到新文件，0 使用默认值
+}
+
 // Store 负责持久化和管理 LSM 版本状态
-// 所有版本变更（Edit）先追加写入 MANIFEST 文件并立即刷盘，再更新内存中的 State
+// 所有版本变更（Edit）先以二进制帧追加写入 MANIFEST 文件并立即刷盘，再更新内存中的 State；
+// 文件过大时把当前 State 作为快照写入新文件，通过 CURRENT 原子切换后删除旧文件，避免启动时重放过长的变更日志
 type Store struct {
-	mu      sync.Mutex      // 互斥锁，保证所有操作串行化
-	dir     string          // MANIFEST 文件存放目录
-	fileNum uint64          // 当前 MANIFEST 文件编号
-	file    *os.File        // 当前 MANIFEST 文件句柄
-	state   *version.State  // 内存中重放后的最新版本状态
+	mu      sync.Mutex     // 互斥锁，保证所有操作串行化
+	dir     string         // MANIFEST 文件存放目录
+	fileNum uint64         // 当前 MANIFEST 文件编号
+	file    *os.File       // 当前 MANIFEST 文件句柄
+	size    int64          // 当前 MANIFEST 文件字节数
+	maxSize int64          // 轮转阈值
+	state   *version.State // 内存中重放后的最新版本状态
+}
+
+// Record 是 MANIFEST 中的一条记录，Snapshot 与 Edit 恰有一个非空
+type Record struct {
+	Offset   int64          // 记录帧在文件中的偏移
+	Snapshot *version.State // 完整版本状态
+	Edit     *version.Edit  // 版本变更
+	Legacy   bool           // 是否为旧版 JSON 编码的变更
 }
 
 // Open 打开或创建 MANIFEST，返回可用的 Store
-// 若 CURRENT 文件存在则沿用其指向的 MANIFEST，否则创建新的并写入 CURRENT
-func Open(dir string, fileNum uint64) (*Store, error) {
+// 若 CURRENT 文件存在则沿用其指向的 MANIFEST，否则以 fileNum 创建新的并写入 CURRENT；
+// 旧版 JSON 编码的 MANIFEST 在打开时重写为二进制格式
+func Open(dir string, fileNum uint64, opts Options) (*Store, error) {
 	if fileNum == 0 {
 		fileNum = defaultNumber
 	}
+	if opts.MaxFileSize <= 0 {
+		opts.MaxFileSize = defaultMaxFileSize
+	}
 	// 确保目录存在
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return nil, fmt.Errorf("create manifest dir: %w", err)
@@ -43,30 +66,57 @@ func Open(dir string, fileNum uint64) (*Store, error) {
 	if err != nil {
 		return nil, err
 	}
-	// 若 CURRENT 不存在则创建新的 MANIFEST 文件并记录
+	// 若 CURRENT 不存在则创建以空快照开头的 MANIFEST 文件并记录
 	if name == "" {
 		name = manifestName(fileNum)
+		file, _, err := createManifest(dir, fileNum, (&version.State{NextFileNum: 1}).Clone())
+		if err != nil {
+			return nil, err
+		}
+		if err := file.Close(); err != nil {
+			return nil, fmt.Errorf("close manifest: %w", err)
+		}
 		if err := writeCurrent(dir, name); err != nil {
 			return nil, err
 		}
+	} else if _, err := fmt.Sscanf(name, manifestFmt, &fileNum); err != nil {
+		return nil, fmt.Errorf("%w: bad current manifest name %q", ErrCorrupt, name)
 	}
-	// 打开 MANIFEST 文件（追加模式）
+
+	// 重放 MANIFEST 中的快照与 Edit
 	path := filepath.Join(dir, name)
-	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
-	if err != nil {
-		return nil, fmt.Errorf("open manifest: %w", err)
-	}
-	// 初始化状态并重放 MANIFEST 中的所有 Edit
 	store := &Store{
 		dir:     dir,
 		fileNum: fileNum,
-		file:    file,
+		maxSize: opts.MaxFileSize,
 		state:   (&version.State{NextFileNum: 1}).Clone(),
 	}
-	if err := store.replayLocked(path); err != nil {
+	legacy, err := store.replayLocked(path)
+	if err != nil {
+		return nil, err
+	}
+	// 打开 MANIFEST 文件（追加模式）
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open manifest: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("stat manifest: %w", err)
+	}
+	store.file, store.size = file, info.Size()
+	// 清理轮转中途崩溃遗留的 MANIFEST 文件
+	if err := removeObsolete(dir, name); err != nil {
 		_ = file.Close()
 		return nil, err
 	}
+	if legacy {
+		if err := store.rotateLocked(); err != nil {
+			_ = store.file.Close()
+			return nil, fmt.Errorf("rewrite legacy manifest: %w", err)
+		}
+	}
 	return store, nil
 }
 
@@ -78,27 +128,36 @@ func (s *Store) Load() (*version.State, error) {
 }
 
 // Apply 将一个版本变更 Edit 持久化到 MANIFEST 并更新内存状态
-// Edit 先序列化为 JSON 帧写入文件并 Sync，再调用 state.Apply 更新内存
+// Edit 先编码为二进制帧写入文件并 Sync，再调用 state.Apply 更新内存；文件超过阈值时轮转
 func (s *Store) Apply(edit version.Edit) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	payload, err := json.Marshal(edit.Clone())
-	if err != nil {
-		return fmt.Errorf("marshal manifest edit: %w", err)
-	}
+	frame := record.EncodeFrame(encodeEdit(edit))
 	// 写入编码帧
-	if _, err := s.file.Write(record.EncodeFrame(payload)); err != nil {
+	if _, err := s.file.Write(frame); err != nil {
 		return fmt.Errorf("write manifest edit: %w", err)
 	}
 	// 强制刷盘，保证 MANIFEST 和之前的状态一致
 	if err := s.file.Sync(); err != nil {
 		return fmt.Errorf("sync manifest edit: %w", err)
 	}
+	s.size += int64(len(frame))
 	s.state = s.state.Apply(edit)
+	if s.size >= s.maxSize {
+		// Edit 已经持久化，轮转失败只意味着继续追加到旧文件，下次 Apply 时重试
+		_ = s.rotateLocked()
+	}
 	return nil
 }
 
+// FileNum 返回当前 MANIFEST 文件编号
+func (s *Store) FileNum() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fileNum
+}
+
 // Close 关闭 MANIFEST 文件句柄
 func (s *Store) Close() error {
 	s.mu.Lock()
@@ -112,32 +171,207 @@ func (s *Store) Close() error {
 	return err
 }
 
-// replayLocked 在持有锁时重放 MANIFEST 文件中的所有 Edit，重建 State
+// rotateLocked 将当前 State 作为快照写入新的 MANIFEST，切换 CURRENT 后删除旧文件
+// CURRENT 切换前崩溃时旧文件仍然有效，新文件在下次打开时被清理
+func (s *Store) rotateLocked() error {
+	nextNum := s.fileNum + 1
+	nextName := manifestName(nextNum)
+	file, size, err := createManifest(s.dir, nextNum, s.state)
+	if err != nil {
+		return err
+	}
+	if err := writeCurrent(s.dir, nextName); err != nil {
+		// rename 成功但目录同步失败时 CURRENT 已经指向新文件，只能继续使用新文件
+		if current, readErr := readCurrent(s.dir); readErr != nil || current != nextName {
+			_ = file.Close()
+			_ = os.Remove(filepath.Join(s.dir, nextName))
+			return err
+		}
+	}
+	oldPath := filepath.Join(s.dir, manifestName(s.fileNum))
+	_ = s.file.Close()
+	s.file, s.size, s.fileNum = file, size, nextNum
+	if err := os.Remove(oldPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove old manifest: %w", err)
+	}
+	return nil
+}
+
+// replayLocked 在持有锁时重放 MANIFEST 文件中的所有记录，重建 State，返回文件是否含旧版 JSON 记录
 // 遇到不完整帧时截断文件，保证下次打开不会再次失败
-func (s *Store) replayLocked(path string) error {
+func (s *Store) replayLocked(path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("read manifest: %w", err)
+	}
+	legacy := false
+	end, err := decodeRecords(data, func(rec Record) error {
+		legacy = legacy || rec.Legacy
+		if rec.Snapshot != nil {
+			s.state = rec.Snapshot
+			return nil
+		}
+		s.state = s.state.Apply(*rec.Edit)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	if end < len(data) {
+		// 不完整帧在崩溃时可能出现，截断尾部保证数据一致性
+		if truncateErr := os.Truncate(path, int64(end)); truncateErr != nil {
+			return false, fmt.Errorf("truncate manifest tail: %w", truncateErr)
+		}
+	}
+	return legacy, nil
+}
+
+// ReadFile 按顺序回调 MANIFEST 文件中的每条记录，供调试工具使用，不修改文件
+// 尾部不完整的帧被忽略
+func ReadFile(path string, fn func(Record) error) error {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return fmt.Errorf("read manifest: %w", err)
 	}
+	_, err = decodeRecords(data, fn)
+	return err
+}
+
+// CurrentPath 返回目录中 CURRENT 指向的 MANIFEST 文件路径
+func CurrentPath(dir string) (string, error) {
+	name, err := readCurrent(dir)
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		return "", fmt.Errorf("read current manifest: %w", os.ErrNotExist)
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// Rewrite 把 state 作为快照写入编号大于目录中所有 MANIFEST 的新文件，切换 CURRENT 并删除其他 MANIFEST，返回新文件路径
+// 供离线修复使用，调用方需保证没有引擎打开该目录
+func Rewrite(dir string, state *version.State) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("create manifest dir: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("list manifest dir: %w", err)
+	}
+	fileNum := defaultNumber
+	for _, entry := range entries {
+		var num uint64
+		if _, err := fmt.Sscanf(entry.Name(), manifestFmt, &num); err == nil && num >= fileNum {
+			fileNum = num + 1
+		}
+	}
+	file, _, err := createManifest(dir, fileNum, state.Clone())
+	if err != nil {
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("close manifest: %w", err)
+	}
+	name := manifestName(fileNum)
+	if err := writeCurrent(dir, name); err != nil {
+		return "", err
+	}
+	if err := removeObsolete(dir, name); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// decodeRecords 解码 data 中的全部完整记录，返回最后一条完整记录之后的偏移
+func decodeRecords(data []byte, fn func(Record) error) (int, error) {
 	offset := 0
 	for offset < len(data) {
 		payload, consumed, err := record.DecodeFrame(data[offset:])
 		if err != nil {
-			// 不完整帧在崩溃时可能出现，截断尾部保证数据一致性
 			if errors.Is(err, record.ErrPartial) {
-				if truncateErr := os.Truncate(path, int64(offset)); truncateErr != nil {
-					return fmt.Errorf("truncate manifest tail: %w", truncateErr)
-				}
-				return nil
+				return offset, nil
 			}
-			return fmt.Errorf("decode manifest edit: %w", err)
+			return offset, fmt.Errorf("decode manifest record at %d: %w", offset, err)
+		}
+		rec, err := decodeRecord(payload)
+		if err != nil {
+			return offset, fmt.Errorf("manifest record at %d: %w", offset, err)
+		}
+		rec.Offset = int64(offset)
+		if err := fn(rec); err != nil {
+			return offset, err
 		}
+		offset += consumed
+	}
+	return offset, nil
+}
+
+// decodeRecord 按记录类型解码一条载荷，兼容旧版 JSON 编码的 Edit
+func decodeRecord(payload []byte) (Record, error) {
+	if len(payload) == 0 {
+		return Record{}, fmt.Errorf("%w: empty record", ErrCorrupt)
+	}
+	switch payload[0] {
+	case editRecord:
+		edit, err := decodeEdit(payload[1:])
+		if err != nil {
+			return Record{}, err
+		}
+		return Record{Edit: &edit}, nil
+	case snapshotRecord:
+		state, err := decodeSnapshot(payload[1:])
+		if err != nil {
+			return Record{}, err
+		}
+		return Record{Snapshot: state}, nil
+	case legacyRecord:
 		var edit version.Edit
 		if err := json.Unmarshal(payload, &edit); err != nil {
-			return fmt.Errorf("unmarshal manifest edit: %w", err)
+			return Record{}, fmt.Errorf("%w: unmarshal legacy edit: %w", ErrCorrupt, err)
+		}
+		return Record{Edit: &edit, Legacy: true}, nil
+	default:
+		return Record{}, fmt.Errorf("%w: unknown record type %d", ErrCorrupt, payload[0])
+	}
+}
+
+// createManifest 创建以 state 快照开头的 MANIFEST 文件并刷盘，返回可追加写入的句柄与文件大小
+func createManifest(dir string, fileNum uint64, state *version.State) (*os.File, int64, error) {
+	path := filepath.Join(dir, manifestName(fileNum))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, 0, fmt.Errorf("create manifest: %w", err)
+	}
+	frame := record.EncodeFrame(encodeSnapshot(state))
+	if _, err := file.Write(frame); err != nil {
+		_ = file.Close()
+		return nil, 0, fmt.Errorf("write manifest snapshot: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return nil, 0, fmt.Errorf("sync manifest snapshot: %w", err)
+	}
+	return file, int64(len(frame)), nil
+}
+
+// removeObsolete 删除 CURRENT 未指向的 MANIFEST 文件
+func removeObsolete(dir, current string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("list manifest dir: %w", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || name == current || !strings.HasPrefix(name, manifestPrefix) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("remove obsolete manifest: %w", err)
 		}
-		s.state = s.state.Apply(edit)
-		offset += consumed
 	}
 	return nil
 }
@@ -207,4 +441,4 @@ func syncDir(dir string) error {
 		return fmt.Errorf("sync manifest dir: %w", err)
 	}
 	return nil
-}
\ No newline at end of file
+}
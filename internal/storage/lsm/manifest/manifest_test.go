@@ -1,14 +1,20 @@
 package manifest
 
 import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 
+	"mini-kv/internal/storage/lsm/record"
 	version "mini-kv/internal/storage/lsm/sstable"
 )
 
 func TestStoreApplyAndLoad(t *testing.T) {
 	dir := t.TempDir()
-	store, err := Open(dir, 1)
+	store, err := Open(dir, 1, Options{})
 	if err != nil {
 		t.Fatalf("Open error = %v", err)
 	}
@@ -32,7 +38,7 @@ func TestStoreApplyAndLoad(t *testing.T) {
 		t.Fatalf("Close error = %v", err)
 	}
 
-	store, err = Open(dir, 1)
+	store, err = Open(dir, 1, Options{})
 	if err != nil {
 		t.Fatalf("reopen error = %v", err)
 	}
@@ -45,3 +51,116 @@ func TestStoreApplyAndLoad(t *testing.T) {
 		t.Fatalf("state = %+v, want replayed edit", state)
 	}
 }
+
+func TestStoreRotatesIntoSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(dir, 1, Options{MaxFileSize: 256})
+	if err != nil {
+		t.Fatalf("Open error = %v", err)
+	}
+	if err := store.Apply(version.Edit{AddedFamilies: []version.FamilyMeta{{ID: 1, Name: "meta"}}}); err != nil {
+		t.Fatalf("Apply family error = %v", err)
+	}
+	for i := uint64(1); i <= 20; i++ {
+		edit := version.Edit{
+			NextFileNum: i + 1,
+			LastSeq:     i,
+			Family:      uint32(i % 2),
+			FlushedSeq:  i,
+			Added: []version.TableMeta{{
+				FileNum: i, Smallest: []byte("a"), Largest: []byte("z"), MinSeq: i, MaxSeq: i, Size: 10,
+			}},
+			AddedBlobs: []version.BlobMeta{{FileNum: 100 + i, Size: 50, Count: 2}},
+		}
+		if i > 1 {
+			edit.Deleted = []uint64{i - 1}
+			edit.BlobGarbage = []version.BlobGarbage{{FileNum: 100 + i - 1, Bytes: 25, Count: 1}}
+		}
+		if err := store.Apply(edit); err != nil {
+			t.Fatalf("Apply(%d) error = %v", i, err)
+		}
+	}
+	if store.FileNum() == 1 {
+		t.Fatalf("manifest did not rotate")
+	}
+	want, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load error = %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close error = %v", err)
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, "MANIFEST-*"))
+	if err != nil || len(matches) != 1 {
+		t.Fatalf("manifest files = %v (%v), want exactly one", matches, err)
+	}
+
+	store, err = Open(dir, 1, Options{MaxFileSize: 256})
+	if err != nil {
+		t.Fatalf("reopen error = %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	got, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load after reopen error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("state after reopen = %+v, want %+v", got, want)
+	}
+}
+
+func TestStoreRewritesLegacyJSONManifest(t *testing.T) {
+	dir := t.TempDir()
+	payload, err := json.Marshal(version.Edit{
+		NextFileNum: 3,
+		LastSeq:     7,
+		Added:       []version.TableMeta{{FileNum: 2, Smallest: []byte("a"), Largest: []byte("b"), MaxSeq: 7}},
+	})
+	if err != nil {
+		t.Fatalf("marshal legacy edit: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "MANIFEST-000001"), record.EncodeFrame(payload), 0o644); err != nil {
+		t.Fatalf("write legacy manifest: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "CURRENT"), []byte("MANIFEST-000001"), 0o644); err != nil {
+		t.Fatalf("write CURRENT: %v", err)
+	}
+
+	store, err := Open(dir, 1, Options{})
+	if err != nil {
+		t.Fatalf("Open error = %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	state, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load error = %v", err)
+	}
+	if state.LastSeq != 7 || len(state.AllFiles()) != 1 {
+		t.Fatalf("state = %+v, want legacy edit applied", state)
+	}
+
+	path, err := CurrentPath(dir)
+	if err != nil {
+		t.Fatalf("CurrentPath error = %v", err)
+	}
+	var records []Record
+	if err := ReadFile(path, func(rec Record) error {
+		records = append(records, rec)
+		return nil
+	}); err != nil {
+		t.Fatalf("ReadFile error = %v", err)
+	}
+	if len(records) != 1 || records[0].Snapshot == nil || records[0].Legacy {
+		t.Fatalf("records after rewrite = %+v, want one binary snapshot", records)
+	}
+}
+
+func TestDecodeRecordRejectsCorruptEdit(t *testing.T) {
+	payload := encodeEdit(version.Edit{Added: []version.TableMeta{{FileNum: 1, Smallest: []byte("abc")}}})
+	if _, err := decodeRecord(payload[:len(payload)-3]); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("decodeRecord truncated error = %v, want ErrCorrupt", err)
+	}
+	if _, err := decodeRecord([]byte{9}); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("decodeRecord unknown type error = %v, want ErrCorrupt", err)
+	}
+}
@@ -0,0 +1,255 @@
+package lsm
+
+import (
+	"sync/atomic"
+	"time"
+
+	"mini-kv/internal/storage/lsm/sstable"
+)
+
+// Metrics 是引擎运行指标的快照
+type Metrics struct {
+	WriteGroups        uint64        // 组提交次数
+	WriteBatches       uint64        // 经组提交写入的批次数
+	MaxWriteGroupSize  uint64        // 单次组提交合并的最大批次数
+	WALSyncs           uint64        // WAL 同步次数
+	WALSyncTotal       time.Duration // WAL 同步累计耗时
+	WALSyncMax         time.Duration // WAL 同步最大耗时
+	ChecksumFailures   uint64        // SSTable 校验失败次数
+	BadTables          uint64        // 被标记为损坏的 SSTable 数量
+	StallDelayedWrites uint64        // 被减速的写入次数
+	StallStoppedWrites uint64        // 被停写阻塞的写入次数
+	StallTime          time.Duration // 写入因节流累计等待的时间
+	Subcompactions     uint64        // 执行的子合并次数
+	FlushBytes         int64         // 刷写写入 SSTable 与 Blob 文件的字节数
+	CompactionBytes    int64         // 合并与 Blob 回收写入的字节数
+	RateLimitWait      time.Duration // 刷写与合并因限速累计等待的时间
+	BlobFiles          int           // 存活的 Blob 文件数
+	BlobBytes          int64         // Blob 文件总字节数
+	BlobGarbageBytes   int64         // Blob 文件中已失效记录的字节数
+	BlobGCRuns         uint64        // 已回收的 Blob 文件数
+
+	MemTableBytes       int64          // 各列族活跃与不可变 MemTable 的近似总字节数
+	MemTables           int            // 活跃与不可变 MemTable 总数
+	ImmutableMemTables  int            // 等待刷写的不可变 MemTable 数
+	Levels              []LevelMetrics // 各层级的文件数与字节数，汇总所有列族
+	Flushes             uint64         // 完成的刷写次数
+	FlushTime           time.Duration  // 刷写累计耗时
+	Compactions         uint64         // 完成的合并次数
+	CompactionTime      time.Duration  // 合并累计耗时
+	CompactionBytesRead int64          // 合并读取的输入 SSTable 字节数
+	BloomUseful         uint64         // 布隆过滤器直接排除 SSTable 的点查次数
+	BloomFalsePositives uint64         // 布隆过滤器判定可能存在但文件中没有可见版本的次数
+	BackgroundError     bool           // 是否已发生后台致命错误，发生后引擎拒绝读写
+}
+
+// LevelMetrics 是单个层级的文件统计
+type LevelMetrics struct {
+	Level int   // 层级编号
+	Files int   // 文件数
+	Bytes int64 // 文件总字节数
+}
+
+// WriteAmplification 返回写放大系数，即刷写与合并写入的总字节数与刷写字节数之比，尚未刷写时为 0
+func (m Metrics) WriteAmplification() float64 {
+	if m.FlushBytes <= 0 {
+		return 0
+	}
+	return float64(m.FlushBytes+m.CompactionBytes) / float64(m.FlushBytes)
+}
+
+// EventListener 接收引擎后台事件的通知，回调在后台协程中同步执行，不应阻塞；未设置的回调被忽略
+type EventListener struct {
+	FlushCompleted      func(FlushInfo)      // 一次刷写提交到 MANIFEST 后调用
+	CompactionCompleted func(CompactionInfo) // 一次合并提交到 MANIFEST 后调用
+	WALSynced           func(time.Duration)  // 一次 WAL 同步完成后调用，参数为同步耗时
+}
+
+// FlushInfo 描述一次完成的刷写
+type FlushInfo struct {
+	Family   string        // 列族名称
+	Bytes    int64         // 写入 SSTable 与 Blob 文件的字节数
+	Duration time.Duration // 从开始构建到提交的耗时
+}
+
+// CompactionInfo 描述一次完成的合并
+type CompactionInfo struct {
+	Family       string        // 列族名称
+	OutputLevel  int           // 输出层级
+	BytesRead    int64         // 输入 SSTable 字节数
+	BytesWritten int64         // 输出 SSTable 字节数
+	Duration     time.Duration // 从开始合并到提交的耗时
+}
+
+// engineMetrics 以原子计数器记录引擎指标
+type engineMetrics struct {
+	writeGroups        atomic.Uint64
+	writeBatches       atomic.Uint64
+	maxWriteGroupSize  atomic.Uint64
+	walSyncs           atomic.Uint64
+	walSyncTotal       atomic.Int64
+	walSyncMax         atomic.Int64
+	checksumFailures   atomic.Uint64
+	badTables          atomic.Uint64
+	stallDelayedWrites atomic.Uint64
+	stallStoppedWrites atomic.Uint64
+	stallTime          atomic.Int64
+	subcompactions     atomic.Uint64
+	blobGCRuns         atomic.Uint64
+
+	flushes             atomic.Uint64
+	flushTime           atomic.Int64
+	compactions         atomic.Uint64
+	compactionTime      atomic.Int64
+	compactionBytesRead atomic.Int64
+	bloomUseful         atomic.Uint64
+	bloomFalsePositives atomic.Uint64
+}
+
+// Metrics 返回当前引擎指标快照
+func (e *Engine) Metrics() Metrics {
+	metrics := Metrics{
+		WriteGroups:        e.metrics.writeGroups.Load(),
+		WriteBatches:       e.metrics.writeBatches.Load(),
+		MaxWriteGroupSize:  e.metrics.maxWriteGroupSize.Load(),
+		WALSyncs:           e.metrics.walSyncs.Load(),
+		WALSyncTotal:       time.Duration(e.metrics.walSyncTotal.Load()),
+		WALSyncMax:         time.Duration(e.metrics.walSyncMax.Load()),
+		ChecksumFailures:   e.metrics.checksumFailures.Load(),
+		BadTables:          e.metrics.badTables.Load(),
+		StallDelayedWrites: e.metrics.stallDelayedWrites.Load(),
+		StallStoppedWrites: e.metrics.stallStoppedWrites.Load(),
+		StallTime:          time.Duration(e.metrics.stallTime.Load()),
+		Subcompactions:     e.metrics.subcompactions.Load(),
+		FlushBytes:         e.rateLimiter.BytesWritten(sstable.WriteReasonFlush),
+		CompactionBytes:    e.rateLimiter.BytesWritten(sstable.WriteReasonCompaction),
+		RateLimitWait:      e.rateLimiter.WaitTime(),
+		BlobGCRuns:         e.metrics.blobGCRuns.Load(),
+
+		Flushes:             e.metrics.flushes.Load(),
+		FlushTime:           time.Duration(e.metrics.flushTime.Load()),
+		Compactions:         e.metrics.compactions.Load(),
+		CompactionTime:      time.Duration(e.metrics.compactionTime.Load()),
+		CompactionBytesRead: e.metrics.compactionBytesRead.Load(),
+		BloomUseful:         e.metrics.bloomUseful.Load(),
+		BloomFalsePositives: e.metrics.bloomFalsePositives.Load(),
+		BackgroundError:     e.backgroundError() != nil,
+	}
+
+	e.memMu.RLock()
+	for _, fam := range e.families {
+		if fam.mem != nil {
+			metrics.MemTables++
+			metrics.MemTableBytes += fam.mem.ApproximateSize()
+		}
+		for _, immutable := range fam.imm {
+			metrics.ImmutableMemTables++
+			metrics.MemTableBytes += immutable.ApproximateSize()
+		}
+	}
+	e.memMu.RUnlock()
+	metrics.MemTables += metrics.ImmutableMemTables
+
+	state := e.currentVersion()
+	for _, blob := range state.Blobs {
+		metrics.BlobFiles++
+		metrics.BlobBytes += blob.Size
+		metrics.BlobGarbageBytes += blob.GarbageBytes
+	}
+	// 每个层级都输出一项，空层级的文件数与字节数为 0
+	metrics.Levels = make([]LevelMetrics, e.opts.MaxLevels)
+	for level := range metrics.Levels {
+		metrics.Levels[level].Level = level
+	}
+	addLevels := func(levels [][]tableMeta) {
+		for level, files := range levels {
+			if level >= len(metrics.Levels) {
+				metrics.Levels = append(metrics.Levels, LevelMetrics{Level: level})
+			}
+			for _, meta := range files {
+				metrics.Levels[level].Files++
+				metrics.Levels[level].Bytes += meta.Size
+			}
+		}
+	}
+	addLevels(state.Levels)
+	for _, fam := range state.Families {
+		addLevels(fam.Levels)
+	}
+	return metrics
+}
+
+// observeWriteGroup 记录一次组提交及其批次数
+func (m *engineMetrics) observeWriteGroup(size int) {
+	m.writeGroups.Add(1)
+	m.writeBatches.Add(uint64(size))
+	storeMaxUint64(&m.maxWriteGroupSize, uint64(size))
+}
+
+// observeWALSync 记录一次 WAL 同步耗时
+func (m *engineMetrics) observeWALSync(elapsed time.Duration) {
+	m.walSyncs.Add(1)
+	m.walSyncTotal.Add(int64(elapsed))
+	storeMaxInt64(&m.walSyncMax, int64(elapsed))
+}
+
+// observeWALSync 记录一次 WAL 同步耗时并通知监听器
+func (e *Engine) observeWALSync(elapsed time.Duration) {
+	e.metrics.observeWALSync(elapsed)
+	if listener := e.opts.EventListener.WALSynced; listener != nil {
+		listener(elapsed)
+	}
+}
+
+// observeFlush 记录一次完成的刷写并通知监听器
+func (e *Engine) observeFlush(fam *family, bytes int64, elapsed time.Duration) {
+	e.metrics.flushes.Add(1)
+	e.metrics.flushTime.Add(int64(elapsed))
+	if listener := e.opts.EventListener.FlushCompleted; listener != nil {
+		listener(FlushInfo{Family: fam.handle.Name(), Bytes: bytes, Duration: elapsed})
+	}
+}
+
+// observeCompaction 记录一次完成的合并并通知监听器
+func (e *Engine) observeCompaction(fam *family, outputLevel int, bytesRead, bytesWritten int64, elapsed time.Duration) {
+	e.metrics.compactions.Add(1)
+	e.metrics.compactionTime.Add(int64(elapsed))
+	e.metrics.compactionBytesRead.Add(bytesRead)
+	if listener := e.opts.EventListener.CompactionCompleted; listener != nil {
+		listener(CompactionInfo{
+			Family:       fam.handle.Name(),
+			OutputLevel:  outputLevel,
+			BytesRead:    bytesRead,
+			BytesWritten: bytesWritten,
+			Duration:     elapsed,
+		})
+	}
+}
+
+// observeBloom 记录布隆过滤器对一次点查的判定结果，found 表示文件中找到了可见版本
+func (m *engineMetrics) observeBloom(mayContain, found bool) {
+	switch {
+	case !mayContain:
+		m.bloomUseful.Add(1)
+	case !found:
+		m.bloomFalsePositives.Add(1)
+	}
+}
+
+func storeMaxUint64(target *atomic.Uint64, value uint64) {
+	for {
+		current := target.Load()
+		if current >= value || target.CompareAndSwap(current, value) {
+			return
+		}
+	}
+}
+
+func storeMaxInt64(target *atomic.Int64, value int64) {
+	for {
+		current := target.Load()
+		if current >= value || target.CompareAndSwap(current, value) {
+			return
+		}
+	}
+}
@@ -9,6 +9,18 @@ const (
 	defaultMaxImmutableTables  = 2        // 最大不可变 MemTable 数量，防止写入阻塞
 	defaultL0CompactionTrigger = 4        // Level 0 文件数达到该值时触发合并
 	defaultMaxLevels           = 4        // 最大层级数
+	defaultL0SlowdownTrigger   = 8        // Level 0 文件数达到该值时写入减速
+	defaultL0StopTrigger       = 12       // Level 0 文件数达到该值时停止写入
+
+	defaultMaxSubcompactions     = 4       // 单次合并最多拆分的子合并数
+	defaultSubcompactionMinBytes = 8 << 20 // 每个子合并至少处理的输入字节数
+
+	defaultBlobGCRatio = 0.5 // Blob 文件失效字节比例达到该值时触发回收
+
+	defaultManifestMaxSize = 4 << 20 // MANIFEST 达到该大小时写入快照并轮转，默认 4MB
+
+	defaultSoftPendingCompactionBytes = 256 << 20 // 待合并字节数达到该值时写入减速
+	defaultHardPendingCompactionBytes = 1 << 30   // 待合并字节数达到该值时停止写入
 )
 
 // Options 包含引擎所有可配置项。
@@ -20,6 +32,23 @@ type Options struct {
 	L0CompactionTrigger int   // 触发 Level 0 合并的文件数阈值
 	MaxLevels           int   // 最大层级深度
 	SyncWrites          bool  // 是否每次写入均同步刷盘（保证持久性）
+	VerifyChecksums     bool  // 读取 SSTable 块时是否校验校验和
+
+	L0SlowdownTrigger          int   // Level 0 文件数减速阈值
+	L0StopTrigger              int   // Level 0 文件数停写阈值
+	SoftPendingCompactionBytes int64 // 待合并字节数减速阈值
+	HardPendingCompactionBytes int64 // 待合并字节数停写阈值
+
+	MaxSubcompactions     int   // 单次合并并行执行的最大子合并数，1 表示不拆分
+	SubcompactionMinBytes int64 // 每个子合并至少处理的输入字节数，输入较小时不拆分
+	WriteRateLimit        int64 // 刷写与合并写入 SSTable 的总速率上限（字节/秒），0 表示不限速
+
+	MinBlobValueSize int     // 值长度达到该阈值时在刷写时分离到 Blob 文件，0 表示不启用键值分离
+	BlobGCRatio      float64 // Blob 文件失效字节比例达到该值时由后台回收重写
+
+	ManifestMaxSize int64 // MANIFEST 达到该字节数时写入完整快照并轮转到新文件
+
+	EventListener EventListener // 刷写、合并与 WAL 同步事件的监听器，只在打开引擎时生效
 }
 
 // Option 是用于修改 Options 的函数选项类型。
@@ -81,6 +110,76 @@ func WithSyncWrites(enabled bool) Option {
 	}
 }
 
+// WithVerifyChecksums 控制读取 SSTable 时是否校验块校验和，关闭可减少热点路径开销。
+func WithVerifyChecksums(enabled bool) Option {
+	return func(opts *Options) error {
+		opts.VerifyChecksums = enabled
+		return nil
+	}
+}
+
+// WithL0StallTriggers 设置 Level 0 文件数的写入减速与停写阈值。
+func WithL0StallTriggers(slowdown, stop int) Option {
+	return func(opts *Options) error {
+		opts.L0SlowdownTrigger = slowdown
+		opts.L0StopTrigger = stop
+		return nil
+	}
+}
+
+// WithPendingCompactionBytesLimits 设置待合并字节数的写入减速与停写阈值。
+func WithPendingCompactionBytesLimits(soft, hard int64) Option {
+	return func(opts *Options) error {
+		opts.SoftPendingCompactionBytes = soft
+		opts.HardPendingCompactionBytes = hard
+		return nil
+	}
+}
+
+// WithSubcompactions 设置单次合并的最大并行子合并数，以及每个子合并至少处理的输入字节数。
+func WithSubcompactions(max int, minBytes int64) Option {
+	return func(opts *Options) error {
+		opts.MaxSubcompactions = max
+		opts.SubcompactionMinBytes = minBytes
+		return nil
+	}
+}
+
+// WithWriteRateLimit 设置刷写与合并写入 SSTable 的总速率上限（字节/秒），0 表示不限速。
+// 运行期间可通过 Engine.SetWriteRateLimit 调整。
+func WithWriteRateLimit(bytesPerSec int64) Option {
+	return func(opts *Options) error {
+		opts.WriteRateLimit = bytesPerSec
+		return nil
+	}
+}
+
+// WithValueSeparation 启用键值分离：长度不小于 minValueSize 的值写入 Blob 文件，LSM 中只保存指针；
+// 失效比例达到 gcRatio 的 Blob 文件由后台回收。
+func WithValueSeparation(minValueSize int, gcRatio float64) Option {
+	return func(opts *Options) error {
+		opts.MinBlobValueSize = minValueSize
+		opts.BlobGCRatio = gcRatio
+		return nil
+	}
+}
+
+// WithManifestMaxSize 设置 MANIFEST 轮转阈值。
+func WithManifestMaxSize(size int64) Option {
+	return func(opts *Options) error {
+		opts.ManifestMaxSize = size
+		return nil
+	}
+}
+
+// WithEventListener 设置后台事件监听器。
+func WithEventListener(listener EventListener) Option {
+	return func(opts *Options) error {
+		opts.EventListener = listener
+		return nil
+	}
+}
+
 // defaultOptions 返回所有配置项的默认值。
 func defaultOptions() Options {
 	return Options{
@@ -90,6 +189,19 @@ func defaultOptions() Options {
 		MaxImmutableTables:  defaultMaxImmutableTables,
 		L0CompactionTrigger: defaultL0CompactionTrigger,
 		MaxLevels:           defaultMaxLevels,
+		VerifyChecksums:     true,
+
+		L0SlowdownTrigger:          defaultL0SlowdownTrigger,
+		L0StopTrigger:              defaultL0StopTrigger,
+		SoftPendingCompactionBytes: defaultSoftPendingCompactionBytes,
+		HardPendingCompactionBytes: defaultHardPendingCompactionBytes,
+
+		MaxSubcompactions:     defaultMaxSubcompactions,
+		SubcompactionMinBytes: defaultSubcompactionMinBytes,
+
+		BlobGCRatio: defaultBlobGCRatio,
+
+		ManifestMaxSize: defaultManifestMaxSize,
 	}
 }
 
@@ -125,6 +237,20 @@ func validateOptions(opts Options) error {
 		return fmt.Errorf("%w: l0 compaction trigger must be positive", ErrInvalidOptions)
 	case opts.MaxLevels <= 0:
 		return fmt.Errorf("%w: max levels must be positive", ErrInvalidOptions)
+	case opts.L0SlowdownTrigger <= 0 || opts.L0StopTrigger < opts.L0SlowdownTrigger:
+		return fmt.Errorf("%w: l0 stall triggers must be positive and ordered", ErrInvalidOptions)
+	case opts.SoftPendingCompactionBytes <= 0 || opts.HardPendingCompactionBytes < opts.SoftPendingCompactionBytes:
+		return fmt.Errorf("%w: pending compaction byte limits must be positive and ordered", ErrInvalidOptions)
+	case opts.MaxSubcompactions <= 0 || opts.SubcompactionMinBytes <= 0:
+		return fmt.Errorf("%w: subcompaction limits must be positive", ErrInvalidOptions)
+	case opts.WriteRateLimit < 0:
+		return fmt.Errorf("%w: write rate limit must not be negative", ErrInvalidOptions)
+	case opts.MinBlobValueSize < 0:
+		return fmt.Errorf("%w: min blob value size must not be negative", ErrInvalidOptions)
+	case opts.BlobGCRatio <= 0 || opts.BlobGCRatio > 1:
+		return fmt.Errorf("%w: blob gc ratio must be in (0, 1]", ErrInvalidOptions)
+	case opts.ManifestMaxSize <= 0:
+		return fmt.Errorf("%w: manifest max size must be positive", ErrInvalidOptions)
 	default:
 		return nil
 	}
@@ -0,0 +1,179 @@
+package lsm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+)
+
+// CompactRange 将默认列族中与 [start, end) 重叠的所有层级文件合并到最底层，空边界表示不限
+func (e *Engine) CompactRange(ctx context.Context, start, end []byte) error {
+	return e.CompactRangeCF(ctx, nil, start, end)
+}
+
+// CompactRangeCF 将列族中与 [start, end) 重叠的所有层级文件合并到最底层，空边界表示不限
+// 合并前先刷写活跃内存表，使内存中的删除标记也能参与合并；合并在后台合并协程中执行，与自动合并串行
+func (e *Engine) CompactRangeCF(ctx context.Context, cf *ColumnFamily, start, end []byte) error {
+	if ctx == nil {
+		ctx = context.TODO()
+	}
+	if len(start) > 0 && len(end) > 0 && bytes.Compare(start, end) >= 0 {
+		return fmt.Errorf("%w: compaction range start must be less than end", ErrInvalidKey)
+	}
+	if err := e.FlushWithContext(ctx); err != nil {
+		return err
+	}
+
+	e.lifecycleMu.RLock()
+	defer e.lifecycleMu.RUnlock()
+	if e.isClosed {
+		return ErrClosed
+	}
+	if err := e.backgroundError(); err != nil {
+		return err
+	}
+	fam, err := e.family(cf)
+	if err != nil {
+		return err
+	}
+
+	bounds := keyBounds{Lower: start, Upper: end}.Clone()
+	errCh := make(chan error, 1)
+	request := compactionRequest{errCh: errCh, family: fam, manual: &bounds}
+	select {
+	case e.compactCh <- request:
+	case <-e.doneCh:
+		return ErrClosed
+	case <-ctx.Done():
+		return wrapContext("compaction canceled", ctx.Err())
+	}
+
+	// 等待合并完成或上下文取消
+	select {
+	case err := <-errCh:
+		return err
+	case <-e.doneCh:
+		return ErrClosed
+	case <-ctx.Done():
+		return wrapContext("compaction canceled", ctx.Err())
+	}
+}
+
+// ApproximateSize 根据表元数据和索引估算默认列族 [start, end) 范围在 SSTable 中占用的字节数，不含内存表
+func (e *Engine) ApproximateSize(start, end []byte) (int64, error) {
+	return e.ApproximateSizeCF(nil, start, end)
+}
+
+// ApproximateSizeCF 估算列族 [start, end) 范围在 SSTable 中占用的字节数，不含内存表
+func (e *Engine) ApproximateSizeCF(cf *ColumnFamily, start, end []byte) (int64, error) {
+	size, _, err := e.approximateRange(cf, keyBounds{Lower: start, Upper: end})
+	return size, err
+}
+
+// ApproximateCount 估算默认列族 [start, end) 范围在 SSTable 中的条目数，包含旧版本和删除标记，不含内存表
+func (e *Engine) ApproximateCount(start, end []byte) (int64, error) {
+	return e.ApproximateCountCF(nil, start, end)
+}
+
+// ApproximateCountCF 估算列族 [start, end) 范围在 SSTable 中的条目数，包含旧版本和删除标记，不含内存表
+func (e *Engine) ApproximateCountCF(cf *ColumnFamily, start, end []byte) (int64, error) {
+	_, count, err := e.approximateRange(cf, keyBounds{Lower: start, Upper: end})
+	return count, err
+}
+
+// approximateRange 累加列族中所有与范围重叠的 SSTable 的估算字节数与条目数
+func (e *Engine) approximateRange(cf *ColumnFamily, bounds keyBounds) (int64, int64, error) {
+	e.lifecycleMu.RLock()
+	defer e.lifecycleMu.RUnlock()
+	if e.isClosed {
+		return 0, 0, ErrClosed
+	}
+	fam, err := e.family(cf)
+	if err != nil {
+		return 0, 0, err
+	}
+	if e.tables == nil {
+		return 0, 0, nil
+	}
+	files := e.pinTables(func() []tableMeta {
+		state := e.familyVersion(fam.handle.id)
+		var files []tableMeta
+		for level := range state.Levels {
+			files = append(files, state.FilesInRange(level, bounds.Lower, bounds.Upper)...)
+		}
+		return files
+	})
+	defer e.unpinTables(files)
+	var size, count int64
+	for _, meta := range files {
+		if err := e.badTableError(meta.FileNum); err != nil {
+			return 0, 0, err
+		}
+		reader, err := e.tables.Open(meta)
+		if err != nil {
+			return 0, 0, e.tableError(meta, "open", err)
+		}
+		tableSize, tableCount := reader.ApproximateRange(bounds.Lower, bounds.Upper)
+		if closeErr := reader.Close(); closeErr != nil {
+			return 0, 0, wrapSSTableCorrupt("close", closeErr)
+		}
+		size += tableSize
+		count += tableCount
+	}
+	return size, count, nil
+}
+
+// compactRange 在合并协程中对列族执行手动范围合并
+func (e *Engine) compactRange(ctx context.Context, fam *family, bounds keyBounds) error {
+	if err := ctx.Err(); err != nil {
+		return wrapContext("compaction canceled", err)
+	}
+	if e.tables == nil || e.manifest == nil {
+		return ErrNotImplemented
+	}
+
+	e.compactMu.Lock()
+	defer e.compactMu.Unlock()
+	state := e.familyVersion(fam.handle.id)
+	seen := make(map[uint64]bool)
+	inputs := make([]tableMeta, 0)
+	add := func(files []tableMeta) bool {
+		added := false
+		for _, meta := range files {
+			if !seen[meta.FileNum] {
+				seen[meta.FileNum] = true
+				inputs = append(inputs, meta)
+				added = true
+			}
+		}
+		return added
+	}
+	for level := range state.Levels {
+		add(state.FilesInRange(level, bounds.Lower, bounds.Upper))
+	}
+	// 扩展到与输入键范围重叠的全部文件，保证输出后最底层文件互不重叠，且丢弃的删除标记不会遗漏更旧的版本
+	for {
+		lower, upper, ok := tableKeyRange(inputs)
+		if !ok {
+			return nil
+		}
+		grown := false
+		for level := range state.Levels {
+			if add(overlappingTables(state, level, lower, upper)) {
+				grown = true
+			}
+		}
+		if !grown {
+			break
+		}
+	}
+
+	bottom := max(1, len(state.Levels)-1)
+	// 输入已全部位于最底层时无需重写：最底层文件互不重叠且合并时已清除删除标记
+	for _, meta := range inputs {
+		if meta.Level != bottom {
+			return e.compactTables(ctx, fam, inputs, bottom)
+		}
+	}
+	return nil
+}
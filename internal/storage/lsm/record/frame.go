@@ -9,8 +9,9 @@ import (
 
 // 帧格式常量
 const (
-	frameHeaderSize = 8     // 帧头部固定长度：4 字节长度 + 4 字节 CRC32
-	batchPayload    = byte(1) // Batch 载荷的类型标记
+	frameHeaderSize    = 8       // 帧头部固定长度：4 字节长度 + 4 字节 CRC32
+	batchPayload       = byte(1) // Batch 载荷的类型标记
+	familyBatchPayload = byte(2) // 带列族编号的 Batch 载荷类型标记，每个条目多 4 字节列族编号
 )
 
 // 编解码过程中的错误哨兵
@@ -107,6 +108,14 @@ func EncodeBatchPayload(batch Batch) ([]byte, error) {
 	if len(batch.Entries) > int(^uint32(0)) {
 		return nil, fmt.Errorf("%w: too many entries", ErrBadRecord)
 	}
+	// 只有默认列族的批次沿用旧格式，保持与旧 WAL 兼容
+	payloadKind := batchPayload
+	for _, entry := range batch.Entries {
+		if entry.Family != 0 {
+			payloadKind = familyBatchPayload
+			break
+		}
+	}
 	// 计算总大小：类型标记(1) + seqStart(8) + count(4) + 每个 entry 的大小
 	size := 1 + 8 + 4
 	for _, entry := range batch.Entries {
@@ -114,10 +123,13 @@ func EncodeBatchPayload(batch Batch) ([]byte, error) {
 			return nil, fmt.Errorf("%w: entry too large", ErrBadRecord)
 		}
 		size += 1 + 8 + 4 + 4 + len(entry.Key) + len(entry.Value)
+		if payloadKind == familyBatchPayload {
+			size += 4
+		}
 	}
 	out := make([]byte, 0, size)
 	// 写入批次类型标记
-	out = append(out, batchPayload)
+	out = append(out, payloadKind)
 	// 写入起始序列号
 	out = binary.LittleEndian.AppendUint64(out, batch.SeqStart)
 	// 写入条目数量
@@ -125,6 +137,9 @@ func EncodeBatchPayload(batch Batch) ([]byte, error) {
 	// 依次写入每个条目
 	for _, entry := range batch.Entries {
 		out = append(out, byte(entry.Kind))
+		if payloadKind == familyBatchPayload {
+			out = binary.LittleEndian.AppendUint32(out, entry.Family)
+		}
 		out = binary.LittleEndian.AppendUint64(out, entry.Seq)
 		out = binary.LittleEndian.AppendUint32(out, uint32(len(entry.Key)))
 		out = binary.LittleEndian.AppendUint32(out, uint32(len(entry.Value)))
@@ -139,7 +154,7 @@ func DecodeBatchPayload(data []byte) (Batch, error) {
 	reader := payloadReader{data: data}
 	// 读取并检查类型标记
 	payloadKind, ok := reader.u8()
-	if !ok || payloadKind != batchPayload {
+	if !ok || (payloadKind != batchPayload && payloadKind != familyBatchPayload) {
 		return Batch{}, fmt.Errorf("%w: invalid batch payload", ErrBadRecord)
 	}
 	// 读取起始序列号
@@ -159,6 +174,12 @@ func DecodeBatchPayload(data []byte) (Batch, error) {
 		if !ok {
 			return Batch{}, fmt.Errorf("%w: missing kind", ErrBadRecord)
 		}
+		var family uint32
+		if payloadKind == familyBatchPayload {
+			if family, ok = reader.u32(); !ok {
+				return Batch{}, fmt.Errorf("%w: missing family", ErrBadRecord)
+			}
+		}
 		seq, ok := reader.u64()
 		if !ok {
 			return Batch{}, fmt.Errorf("%w: missing sequence", ErrBadRecord)
@@ -180,10 +201,11 @@ func DecodeBatchPayload(data []byte) (Batch, error) {
 			return Batch{}, fmt.Errorf("%w: truncated value", ErrBadRecord)
 		}
 		entries = append(entries, Entry{
-			Key:   key,
-			Value: value,
-			Seq:   seq,
-			Kind:  Kind(kind),
+			Key:    key,
+			Value:  value,
+			Seq:    seq,
+			Kind:   Kind(kind),
+			Family: family,
 		})
 	}
 	// 不允许残留数据
@@ -8,14 +8,16 @@ const (
 	KindUnknown Kind = iota
 	KindPut
 	KindDelete
+	KindValuePointer // 值存放在 Blob 文件中，Value 为编码后的值指针
 )
 
 // 条目
 type Entry struct {
-	Key   []byte
-	Value []byte
-	Seq   uint64
-	Kind  Kind
+	Key    []byte
+	Value  []byte
+	Seq    uint64
+	Kind   Kind
+	Family uint32 // 所属列族，0 为默认列族；只在 WAL 中持久化，SSTable 按文件归属列族
 }
 
 // 批量操作
@@ -49,10 +51,11 @@ func NewDelete(key []byte, seq uint64) Entry {
 
 func (e Entry) Clone() Entry {
 	return Entry{
-		Key:   CloneBytes(e.Key),
-		Value: CloneBytes(e.Value),
-		Seq:   e.Seq,
-		Kind:  e.Kind,
+		Key:    CloneBytes(e.Key),
+		Value:  CloneBytes(e.Value),
+		Seq:    e.Seq,
+		Kind:   e.Kind,
+		Family: e.Family,
 	}
 }
 
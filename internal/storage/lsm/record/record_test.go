@@ -51,6 +51,24 @@ func TestBatchFrameRoundTrip(t *testing.T) {
 	}
 }
 
+func TestBatchFrameRoundTripKeepsFamilies(t *testing.T) {
+	put := NewPut([]byte("a"), []byte("1"), 3)
+	put.Family = 2
+	batch := Batch{SeqStart: 3, Entries: []Entry{put, NewDelete([]byte("b"), 4)}}
+
+	encoded, err := EncodeBatchFrame(batch)
+	if err != nil {
+		t.Fatalf("EncodeBatchFrame error = %v", err)
+	}
+	got, _, err := DecodeBatchFrame(encoded)
+	if err != nil {
+		t.Fatalf("DecodeBatchFrame error = %v", err)
+	}
+	if len(got.Entries) != 2 || got.Entries[0].Family != 2 || got.Entries[1].Family != 0 {
+		t.Fatalf("decoded entries = %+v, want families 2 and 0", got.Entries)
+	}
+}
+
 func TestRecordFrameRoundTrip(t *testing.T) {
 	entry := NewPut([]byte("k"), []byte("v"), 11)
 	encoded, err := EncodeRecord(entry)
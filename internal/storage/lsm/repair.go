@@ -0,0 +1,303 @@
+package lsm
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"mini-kv/internal/storage/lsm/manifest"
+	"mini-kv/internal/storage/lsm/record"
+	"mini-kv/internal/storage/lsm/sstable"
+	"mini-kv/internal/storage/lsm/vlog"
+	"mini-kv/internal/storage/lsm/wal"
+)
+
+// lostDirName 是修复时存放无法使用的文件的子目录
+const lostDirName = "lost"
+
+// RepairReport 描述一次离线修复的结果
+type RepairReport struct {
+	Manifest      string              // 新 MANIFEST 路径
+	ManifestError error               // 读取旧 MANIFEST 时遇到的错误，为 nil 表示旧 MANIFEST 完整可读
+	Tables        []uint64            // 写入新 MANIFEST 的 SSTable
+	Recovered     []uint64            // 旧 MANIFEST 未登记、按页脚记录的列族恢复到 Level 0 的 SSTable
+	Blobs         []uint64            // 写入新 MANIFEST 的 Blob 文件
+	Missing       []uint64            // 旧 MANIFEST 登记但磁盘上缺失的文件
+	Lost          []string            // 移入 lost 目录的文件名
+	Families      []uint32            // 旧 MANIFEST 未登记、根据 WAL 或恢复的 SSTable 补登记的列族
+	WAL           []wal.SalvageResult // 各 WAL 段的修复结果
+}
+
+// Repair 离线修复 dir 中的引擎数据，调用时不能有引擎打开该目录
+// 以旧 MANIFEST 可读部分为基础，丢弃缺失或校验失败的 SSTable；旧 MANIFEST 不完整时，
+// 编号不小于其 NextFileNum 的未登记 SSTable 按页脚记录的列族恢复到 Level 0，
+// 页脚未记录列族的表与其余未登记文件一样移入 lost 目录，避免旧数据被放进错误的列族；
+// WAL 段截断到第一个无法解码的帧，列族的刷写进度回退到被丢弃表之前，使剩余 WAL 能够重新回放
+func Repair(dir string) (_ RepairReport, retErr error) {
+	lock, err := acquireDirectoryLock(dir)
+	if err != nil {
+		return RepairReport{}, err
+	}
+	defer func() { retErr = errors.Join(retErr, lock.Release()) }()
+
+	var report RepairReport
+	base := (&versionState{NextFileNum: 1}).Clone()
+	if path, err := manifest.CurrentPath(dir); err != nil {
+		report.ManifestError = err
+	} else {
+		report.ManifestError = manifest.ReadFile(path, func(rec manifest.Record) error {
+			if rec.Snapshot != nil {
+				base = rec.Snapshot
+			} else {
+				base = base.Apply(*rec.Edit)
+			}
+			return nil
+		})
+	}
+	damaged := report.ManifestError != nil
+
+	tables, blobs, err := listDataFiles(dir)
+	if err != nil {
+		return report, err
+	}
+	nextFileNum := base.NextFileNum
+	for _, fileNum := range append(slices.Clone(tables), blobs...) {
+		nextFileNum = max(nextFileNum, fileNum+1)
+	}
+
+	// 按列族保留旧 MANIFEST 中仍然可用的表，记录各列族被丢弃表的最小序列号
+	placed := make(map[uint64]bool)
+	kept := make(map[uint32][]tableMeta)
+	droppedSeq := make(map[uint32]uint64)
+	dropTable := func(id uint32, meta tableMeta) {
+		if seq, ok := droppedSeq[id]; !ok || meta.MinSeq < seq {
+			droppedSeq[id] = meta.MinSeq
+		}
+	}
+	for _, id := range base.FamilyIDs() {
+		for _, meta := range base.Family(id).AllFiles() {
+			placed[meta.FileNum] = true
+			if !slices.Contains(tables, meta.FileNum) {
+				report.Missing = append(report.Missing, meta.FileNum)
+				dropTable(id, meta)
+				continue
+			}
+			if _, _, err := scanTable(dir, meta.FileNum); err != nil {
+				if err := report.moveLost(dir, sstable.FileName(meta.FileNum)); err != nil {
+					return report, err
+				}
+				dropTable(id, meta)
+				continue
+			}
+			kept[id] = append(kept[id], meta)
+		}
+	}
+	// 未登记的表：旧 MANIFEST 不完整时可能是丢失记录的输出，否则是未提交或已过期的文件
+	// usedFamilies 记录恢复的表与 WAL 中出现的列族，旧 MANIFEST 未登记的需要补登记
+	usedFamilies := make(map[uint32]bool)
+	recovered := make(map[uint32][]tableMeta)
+	for _, fileNum := range tables {
+		if placed[fileNum] {
+			continue
+		}
+		if damaged && fileNum >= base.NextFileNum {
+			if meta, props, err := scanTable(dir, fileNum); err == nil && props.FamilyKnown {
+				recovered[props.ColumnFamily] = append(recovered[props.ColumnFamily], meta)
+				usedFamilies[props.ColumnFamily] = true
+				report.Recovered = append(report.Recovered, fileNum)
+				continue
+			}
+		}
+		if err := report.moveLost(dir, sstable.FileName(fileNum)); err != nil {
+			return report, err
+		}
+	}
+	// L0 按登记顺序从新到旧查找，恢复的表按最大序列号排列，避免旧的合并输出遮住更新的刷写结果
+	for id, metas := range recovered {
+		slices.SortFunc(metas, func(a, b tableMeta) int { return cmp.Compare(a.MaxSeq, b.MaxSeq) })
+		kept[id] = append(kept[id], metas...)
+	}
+
+	// Blob 文件同理：保留旧 MANIFEST 中存在的文件，旧 MANIFEST 不完整时恢复新编号的文件
+	var keptBlobs []blobMeta
+	for _, meta := range base.Blobs {
+		if !slices.Contains(blobs, meta.FileNum) {
+			report.Missing = append(report.Missing, meta.FileNum)
+			continue
+		}
+		keptBlobs = append(keptBlobs, meta)
+	}
+	for _, fileNum := range blobs {
+		if slices.ContainsFunc(base.Blobs, func(meta blobMeta) bool { return meta.FileNum == fileNum }) {
+			continue
+		}
+		if damaged && fileNum >= base.NextFileNum {
+			if meta, err := scanBlob(dir, fileNum); err == nil {
+				keptBlobs = append(keptBlobs, meta)
+				continue
+			}
+		}
+		if err := report.moveLost(dir, vlog.FileName(fileNum)); err != nil {
+			return report, err
+		}
+	}
+
+	// 截断 WAL 中无法解码的部分，记录其中出现的列族与最大序列号
+	var walSeq uint64
+	report.WAL, err = wal.Salvage(dir, func(replayed record.Batch) error {
+		for _, item := range replayed.Entries {
+			usedFamilies[item.Family] = true
+			walSeq = max(walSeq, item.Seq)
+		}
+		return nil
+	})
+	if err != nil {
+		return report, fmt.Errorf("salvage wal: %w", err)
+	}
+
+	// 组装新的版本状态
+	families := slices.Clone(base.Families)
+	for id := range usedFamilies {
+		if id != 0 && !slices.ContainsFunc(families, func(f familyState) bool { return f.ID == id }) {
+			families = append(families, familyState{FamilyMeta: familyMeta{ID: id, Name: "recovered-" + strconv.FormatUint(uint64(id), 10)}})
+			report.Families = append(report.Families, id)
+		}
+	}
+	state := (&versionState{NextFileNum: nextFileNum}).Clone()
+	added := versionEdit{AddedBlobs: keptBlobs}
+	for _, fam := range families {
+		added.AddedFamilies = append(added.AddedFamilies, fam.FamilyMeta)
+	}
+	state = state.Apply(added)
+	flushed := make(map[uint32]uint64)
+	for _, id := range state.FamilyIDs() {
+		state = state.Apply(versionEdit{Family: id, Added: kept[id]})
+		for _, meta := range kept[id] {
+			report.Tables = append(report.Tables, meta.FileNum)
+		}
+		flushed[id] = base.FlushedSeq(id)
+		if seq, ok := droppedSeq[id]; ok && seq > 0 && seq-1 < flushed[id] {
+			flushed[id] = seq - 1
+		}
+	}
+	state.FlushedSeqs = flushed
+	state.LastSeq = max(state.LastSeq, base.LastSeq, walSeq)
+	for _, meta := range keptBlobs {
+		report.Blobs = append(report.Blobs, meta.FileNum)
+	}
+	slices.Sort(report.Tables)
+	slices.Sort(report.Families)
+
+	report.Manifest, err = manifest.Rewrite(dir, state)
+	if err != nil {
+		return report, fmt.Errorf("rewrite manifest: %w", err)
+	}
+	return report, nil
+}
+
+// moveLost 把无法使用的文件移入 lost 目录，保留现场供人工检查
+func (r *RepairReport) moveLost(dir, name string) error {
+	lostDir := filepath.Join(dir, lostDirName)
+	if err := os.MkdirAll(lostDir, 0o755); err != nil {
+		return fmt.Errorf("create lost dir: %w", err)
+	}
+	if err := os.Rename(filepath.Join(dir, name), filepath.Join(lostDir, name)); err != nil {
+		return fmt.Errorf("move %s to lost dir: %w", name, err)
+	}
+	r.Lost = append(r.Lost, name)
+	return nil
+}
+
+// listDataFiles 列出目录中的 SSTable 与 Blob 文件编号，均按升序
+func listDataFiles(dir string) ([]uint64, []uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list lsm dir: %w", err)
+	}
+	var tables, blobs []uint64
+	for _, item := range entries {
+		if item.IsDir() {
+			continue
+		}
+		name, target := item.Name(), (*[]uint64)(nil)
+		switch {
+		case strings.HasSuffix(name, ".sst"):
+			target = &tables
+		case strings.HasSuffix(name, ".blob"):
+			target = &blobs
+		default:
+			continue
+		}
+		fileNum, err := strconv.ParseUint(name[:strings.IndexByte(name, '.')], 10, 64)
+		if err != nil {
+			continue
+		}
+		*target = append(*target, fileNum)
+	}
+	slices.Sort(tables)
+	slices.Sort(blobs)
+	return tables, blobs, nil
+}
+
+// scanTable 校验 SSTable 的全部校验和，并从记录中重建表元数据（Level 为 0），同时返回页脚属性
+func scanTable(dir string, fileNum uint64) (tableMeta, sstable.Properties, error) {
+	path := filepath.Join(dir, sstable.FileName(fileNum))
+	info, err := os.Stat(path)
+	if err != nil {
+		return tableMeta{}, sstable.Properties{}, err
+	}
+	reader, err := sstable.Open(path, tableMeta{FileNum: fileNum})
+	if err != nil {
+		return tableMeta{}, sstable.Properties{}, err
+	}
+	defer func() { _ = reader.Close() }()
+	if err := reader.VerifyChecksums(); err != nil {
+		return tableMeta{}, sstable.Properties{}, err
+	}
+	entries, err := reader.Entries()
+	if err != nil {
+		return tableMeta{}, sstable.Properties{}, err
+	}
+	if len(entries) == 0 {
+		return tableMeta{}, sstable.Properties{}, fmt.Errorf("%w: empty table %d", ErrSSTableCorrupt, fileNum)
+	}
+	meta := tableMeta{
+		FileNum:  fileNum,
+		Smallest: record.CloneBytes(entries[0].Key),
+		Largest:  record.CloneBytes(entries[len(entries)-1].Key),
+		MinSeq:   entries[0].Seq,
+		Size:     info.Size(),
+	}
+	for _, item := range entries {
+		meta.MinSeq = min(meta.MinSeq, item.Seq)
+		meta.MaxSeq = max(meta.MaxSeq, item.Seq)
+	}
+	return meta, reader.Properties(), nil
+}
+
+// scanBlob 遍历 Blob 文件校验每条记录，返回不含失效统计的元数据
+func scanBlob(dir string, fileNum uint64) (blobMeta, error) {
+	reader, err := vlog.Open(dir, fileNum)
+	if err != nil {
+		return blobMeta{}, err
+	}
+	defer func() { _ = reader.Close() }()
+	meta := blobMeta{FileNum: fileNum}
+	if err := reader.Iterate(func(vlog.Pointer, []byte, []byte) error {
+		meta.Count++
+		return nil
+	}); err != nil {
+		return blobMeta{}, err
+	}
+	info, err := os.Stat(filepath.Join(dir, vlog.FileName(fileNum)))
+	if err != nil {
+		return blobMeta{}, err
+	}
+	meta.Size = info.Size()
+	return meta, nil
+}
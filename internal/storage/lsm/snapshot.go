@@ -8,38 +8,49 @@ import (
 )
 
 type Snapshot struct {
-    entries []entry
+    entries map[uint32][]entry // 按列族编号保存的可见条目
     closed  bool
 }
 
-func newSnapshot(entries []entry) *Snapshot {
+func newSnapshot(entries map[uint32][]entry) *Snapshot {
+    cloned := make(map[uint32][]entry, len(entries))
+    for id, items := range entries {
+		cloned[id] = cloneEntries(items)
+	}
     return &Snapshot{
-		entries: cloneEntries(entries),
+		entries: cloned,
 	}
 }
 
-// 使用迭代器查询
+// 使用迭代器查询默认列族
 func (s *Snapshot) Get(key []byte) ([]byte, bool, error) {
+    return s.GetCF(nil, key)
+}
+
+// 查询指定列族，快照创建后打开的列族视为空
+func (s *Snapshot) GetCF(cf *ColumnFamily, key []byte) ([]byte, bool, error) {
     if s.closed {
         return nil, false, ErrClosed
     }
-    pos := sort.Search(len(s.entries), func(i int) bool {
-		return bytes.Compare(s.entries[i].Key, key) >= 0
+    entries := s.entries[cf.ID()]
+    pos := sort.Search(len(entries), func(i int) bool {
+		return bytes.Compare(entries[i].Key, key) >= 0
 	})
-	if pos >= len(s.entries) || !bytes.Equal(s.entries[pos].Key, key) {
+	if pos >= len(entries) || !bytes.Equal(entries[pos].Key, key) {
 		return nil, false, nil
 	}
-    return record.CloneBytes(s.entries[pos].Value), true, nil
+    return record.CloneBytes(entries[pos].Value), true, nil
 }
 
-// 范围扫描
+// 范围扫描 options 指定的列族
 func (s *Snapshot) NewIterator(options IterOptions) *Iterator {
     if s.closed {
         return newErrorIterator(ErrClosed)
     }
 	bounds := makeKeyBounds(options)
-    entries := make([]entry, 0, len(s.entries))
-    for _, item := range s.entries {
+    family := s.entries[options.ColumnFamily.ID()]
+    entries := make([]entry, 0, len(family))
+    for _, item := range family {
 		if bounds.Contains(item.Key) {
 			entries = append(entries, item.Clone())
 		}
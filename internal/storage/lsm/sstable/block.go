@@ -0,0 +1,272 @@
+package sstable
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"mini-kv/internal/storage/lsm/record"
+)
+
+// restartInterval 是相邻重启点之间的条目数，重启点处的键不做前缀压缩
+const restartInterval = 16
+
+// blockBuilder 构建前缀压缩的数据块
+//
+// 块格式：若干条目 | 重启点偏移数组(u32 * n) | 重启点数量(u32)
+// 条目格式：shared | unshared | valueLen（均为 uvarint）| kind(u8) | seq(uvarint) | 键后缀 | 值
+type blockBuilder struct {
+	buf      []byte
+	restarts []uint32
+	lastKey  []byte
+	counter  int // 距上一个重启点的条目数
+	count    int
+}
+
+// add 追加一条记录，调用方需保证记录按内部键顺序到达
+func (b *blockBuilder) add(entry record.Entry) {
+	shared := 0
+	if b.counter < restartInterval && b.count > 0 {
+		shared = sharedPrefixLen(b.lastKey, entry.Key)
+	} else {
+		b.restarts = append(b.restarts, uint32(len(b.buf)))
+		b.counter = 0
+	}
+	b.buf = binary.AppendUvarint(b.buf, uint64(shared))
+	b.buf = binary.AppendUvarint(b.buf, uint64(len(entry.Key)-shared))
+	b.buf = binary.AppendUvarint(b.buf, uint64(len(entry.Value)))
+	b.buf = append(b.buf, byte(entry.Kind))
+	b.buf = binary.AppendUvarint(b.buf, entry.Seq)
+	b.buf = append(b.buf, entry.Key[shared:]...)
+	b.buf = append(b.buf, entry.Value...)
+	b.lastKey = append(b.lastKey[:0], entry.Key...)
+	b.counter++
+	b.count++
+}
+
+// estimatedSize 返回完成后块的近似字节数
+func (b *blockBuilder) estimatedSize() int {
+	return len(b.buf) + 4*len(b.restarts) + 4
+}
+
+// empty 报告当前块是否没有条目
+func (b *blockBuilder) empty() bool {
+	return b.count == 0
+}
+
+// finish 写入重启点数组并返回块字节，返回值在下一次 reset 前有效
+func (b *blockBuilder) finish() []byte {
+	for _, restart := range b.restarts {
+		b.buf = binary.LittleEndian.AppendUint32(b.buf, restart)
+	}
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(b.restarts)))
+	return b.buf
+}
+
+// reset 清空构建器以复用缓冲区
+func (b *blockBuilder) reset() {
+	b.buf = b.buf[:0]
+	b.restarts = b.restarts[:0]
+	b.lastKey = b.lastKey[:0]
+	b.counter = 0
+	b.count = 0
+}
+
+// blockIter 在数据块上定位与遍历，前缀压缩格式可按重启点二分查找而无需解码整个块
+type blockIter struct {
+	data        []byte // 条目区域
+	restarts    []byte // 重启点偏移数组
+	numRestarts int
+	next        int // 下一条目的起始偏移
+	key         []byte
+	current     record.Entry
+	valid       bool
+	err         error
+
+	legacy      []record.Entry // 旧格式块一次性解码后的条目
+	legacyIndex int
+}
+
+// newBlockIter 根据格式版本创建块迭代器
+func newBlockIter(data []byte, version uint32) (*blockIter, error) {
+	if version < prefixBlockVersion {
+		entries, err := decodeBlock(data)
+		if err != nil {
+			return nil, err
+		}
+		return &blockIter{legacy: entries, legacyIndex: -1}, nil
+	}
+	if len(data) < 4 {
+		return nil, fmt.Errorf("%w: missing restart count", ErrInvalidIndex)
+	}
+	numRestarts := int(binary.LittleEndian.Uint32(data[len(data)-4:]))
+	restartsStart := len(data) - 4 - 4*numRestarts
+	if numRestarts == 0 || restartsStart < 0 {
+		return nil, fmt.Errorf("%w: bad restart count %d", ErrInvalidIndex, numRestarts)
+	}
+	return &blockIter{
+		data:        data[:restartsStart],
+		restarts:    data[restartsStart : len(data)-4],
+		numRestarts: numRestarts,
+	}, nil
+}
+
+// first 定位到块内第一条记录
+func (it *blockIter) first() bool {
+	if it.legacy != nil {
+		it.legacyIndex = 0
+		return it.legacyIndex < len(it.legacy)
+	}
+	it.seekToRestart(0)
+	return it.advance()
+}
+
+// nextEntry 前进到下一条记录
+func (it *blockIter) nextEntry() bool {
+	if it.legacy != nil {
+		if it.legacyIndex < len(it.legacy) {
+			it.legacyIndex++
+		}
+		return it.legacyIndex < len(it.legacy)
+	}
+	if !it.valid {
+		return false
+	}
+	return it.advance()
+}
+
+// seek 定位到第一条键不小于 key 的记录
+func (it *blockIter) seek(key []byte) bool {
+	if it.legacy != nil {
+		it.legacyIndex = sort.Search(len(it.legacy), func(i int) bool {
+			return bytes.Compare(it.legacy[i].Key, key) >= 0
+		})
+		return it.legacyIndex < len(it.legacy)
+	}
+	// 二分查找最后一个键严格小于 key 的重启点，从该点开始线性扫描
+	restart := sort.Search(it.numRestarts, func(i int) bool {
+		restartKey, ok := it.restartKey(i)
+		return !ok || bytes.Compare(restartKey, key) >= 0
+	})
+	if it.err != nil {
+		return false
+	}
+	if restart > 0 {
+		restart--
+	}
+	it.seekToRestart(restart)
+	for it.advance() {
+		if bytes.Compare(it.key, key) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// entry 返回当前记录，键值引用块内数据，调用方如需保留应自行克隆
+func (it *blockIter) entry() record.Entry {
+	if it.legacy != nil {
+		return it.legacy[it.legacyIndex]
+	}
+	return it.current
+}
+
+// entries 解码块内全部记录
+func (it *blockIter) entries() ([]record.Entry, error) {
+	if it.legacy != nil {
+		return it.legacy, nil
+	}
+	entries := make([]record.Entry, 0)
+	for ok := it.first(); ok; ok = it.nextEntry() {
+		entries = append(entries, it.current.Clone())
+	}
+	return entries, it.err
+}
+
+// restartKey 返回第 i 个重启点处的完整键
+func (it *blockIter) restartKey(i int) ([]byte, bool) {
+	offset, ok := it.restartOffset(i)
+	if !ok {
+		return nil, false
+	}
+	reader := blockReader{data: it.data, off: offset}
+	shared, ok1 := reader.uvarint()
+	unshared, ok2 := reader.uvarint()
+	_, ok3 := reader.uvarint()
+	_, ok4 := reader.u8()
+	_, ok5 := reader.uvarint()
+	if !ok1 || !ok2 || !ok3 || !ok4 || !ok5 || shared != 0 || unshared > uint64(reader.remaining()) {
+		it.err = fmt.Errorf("%w: bad restart point %d", ErrInvalidIndex, i)
+		return nil, false
+	}
+	return it.data[reader.off : reader.off+int(unshared)], true
+}
+
+// restartOffset 返回第 i 个重启点的偏移，偏移越出条目区域时记录错误
+func (it *blockIter) restartOffset(i int) (int, bool) {
+	offset := binary.LittleEndian.Uint32(it.restarts[4*i:])
+	if uint64(offset) >= uint64(len(it.data)) {
+		it.err = fmt.Errorf("%w: restart point %d offset %d out of range", ErrInvalidIndex, i, offset)
+		return 0, false
+	}
+	return int(offset), true
+}
+
+// seekToRestart 将下一条目移到第 i 个重启点，偏移非法时迭代器直接结束
+func (it *blockIter) seekToRestart(i int) {
+	it.key = it.key[:0]
+	it.valid = false
+	offset, ok := it.restartOffset(i)
+	if !ok {
+		offset = len(it.data)
+	}
+	it.next = offset
+}
+
+// advance 解码 next 处的记录
+func (it *blockIter) advance() bool {
+	it.valid = false
+	if it.next >= len(it.data) {
+		return false
+	}
+	reader := blockReader{data: it.data, off: it.next}
+	shared, ok1 := reader.uvarint()
+	unshared, ok2 := reader.uvarint()
+	valueLen, ok3 := reader.uvarint()
+	kind, ok4 := reader.u8()
+	seq, ok5 := reader.uvarint()
+	if !ok1 || !ok2 || !ok3 || !ok4 || !ok5 {
+		it.err = fmt.Errorf("%w: truncated block entry at %d", ErrInvalidIndex, it.next)
+		return false
+	}
+	// 长度先按 uint64 与剩余字节比较，避免转换为 int 后溢出成负数
+	remaining := uint64(reader.remaining())
+	if shared > uint64(len(it.key)) || unshared > remaining || valueLen > remaining-unshared {
+		it.err = fmt.Errorf("%w: bad block entry at %d", ErrInvalidIndex, it.next)
+		return false
+	}
+	it.key = append(it.key[:shared], it.data[reader.off:reader.off+int(unshared)]...)
+	reader.off += int(unshared)
+	value := it.data[reader.off : reader.off+int(valueLen)]
+	reader.off += int(valueLen)
+	it.next = reader.off
+
+	it.current = record.Entry{Kind: record.Kind(kind), Seq: seq, Key: it.key, Value: value}
+	if kind == byte(record.KindDelete) {
+		it.current.Value = nil
+	}
+	it.valid = true
+	return true
+}
+
+// sharedPrefixLen 返回两个键的公共前缀长度
+func sharedPrefixLen(a, b []byte) int {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
@@ -0,0 +1,144 @@
+package sstable
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WriteReason 标识 SSTable 写入的来源，用于按来源统计写入字节数
+type WriteReason int
+
+const (
+	WriteReasonFlush      WriteReason = iota // 内存表刷写
+	WriteReasonCompaction                    // 合并输出
+	numWriteReasons
+)
+
+func (r WriteReason) String() string {
+	switch r {
+	case WriteReasonFlush:
+		return "flush"
+	case WriteReasonCompaction:
+		return "compaction"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(r))
+	}
+}
+
+type writeReasonKey struct{}
+
+// ContextWithWriteReason 在上下文中标记写入来源，Manager.Build 据此统计和限速
+func ContextWithWriteReason(ctx context.Context, reason WriteReason) context.Context {
+	return context.WithValue(ctx, writeReasonKey{}, reason)
+}
+
+// writeReasonFromContext 读取上下文中的写入来源，未标记时视为合并
+func writeReasonFromContext(ctx context.Context) WriteReason {
+	if reason, ok := ctx.Value(writeReasonKey{}).(WriteReason); ok {
+		return reason
+	}
+	return WriteReasonCompaction
+}
+
+// RateLimiter 是刷写与合并共享的令牌桶写入限速器，速率可在运行时调整
+//
+// 令牌桶容量为一秒的速率；单次请求超过剩余令牌时预支后续令牌并等待，
+// 因此大块写入不会被拆分，平均速率仍受限
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   int64     // 每秒允许写入的字节数，<=0 表示不限速
+	tokens float64   // 当前可用令牌，可为负表示已预支
+	last   time.Time // 上次补充令牌的时间
+
+	written [numWriteReasons]atomic.Int64 // 按来源统计的写入字节数
+	waited  atomic.Int64                  // 因限速累计等待的时间
+}
+
+// NewRateLimiter 创建限速器，bytesPerSec <= 0 表示不限速，只统计写入量
+func NewRateLimiter(bytesPerSec int64) *RateLimiter {
+	l := &RateLimiter{}
+	l.SetRate(bytesPerSec)
+	l.tokens = float64(l.rate)
+	return l
+}
+
+// SetRate 调整限速速率，已预支的令牌保持不变
+func (l *RateLimiter) SetRate(bytesPerSec int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refillLocked(time.Now())
+	if bytesPerSec < 0 {
+		bytesPerSec = 0
+	}
+	l.rate = bytesPerSec
+	if l.tokens > float64(bytesPerSec) {
+		l.tokens = float64(bytesPerSec)
+	}
+}
+
+// Rate 返回当前限速速率（字节/秒），0 表示不限速
+func (l *RateLimiter) Rate() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// Wait 记录 n 字节的写入并在超出速率时阻塞，直到令牌足够或上下文取消
+func (l *RateLimiter) Wait(ctx context.Context, reason WriteReason, n int) error {
+	if reason >= 0 && reason < numWriteReasons {
+		l.written[reason].Add(int64(n))
+	}
+	l.mu.Lock()
+	if l.rate <= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	now := time.Now()
+	l.refillLocked(now)
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+	}
+	l.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+
+	l.waited.Add(int64(delay))
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// BytesWritten 返回指定来源累计写入的字节数
+func (l *RateLimiter) BytesWritten(reason WriteReason) int64 {
+	if reason < 0 || reason >= numWriteReasons {
+		return 0
+	}
+	return l.written[reason].Load()
+}
+
+// WaitTime 返回写入因限速累计等待的时间
+func (l *RateLimiter) WaitTime() time.Duration {
+	return time.Duration(l.waited.Load())
+}
+
+// refillLocked 按经过的时间补充令牌，最多补满一秒的速率
+func (l *RateLimiter) refillLocked(now time.Time) {
+	if !l.last.IsZero() && l.rate > 0 {
+		l.tokens += now.Sub(l.last).Seconds() * float64(l.rate)
+		if l.tokens > float64(l.rate) {
+			l.tokens = float64(l.rate)
+		}
+	}
+	l.last = now
+}
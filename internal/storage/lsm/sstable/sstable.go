@@ -26,8 +26,10 @@ type Manager struct {
 }
 
 type Options struct {
-    BlockSize  int  // Data Block 目标大小，默认 32KB
-    BitsPerKey int  // 布隆过滤器每个 Key 的位数，默认 10
+    BlockSize     int  // Data Block 目标大小，默认 32KB
+    BitsPerKey    int  // 布隆过滤器每个 Key 的位数，默认 10
+    SkipChecksums bool // 读取时跳过块校验，供热点路径使用
+    RateLimiter   *RateLimiter // 写入限速器，为空时不限速
 }
 
 // NewManager 创建一个新的 SSTable 管理器，指定存储目录和配置选项
@@ -64,6 +66,10 @@ func (m *Manager) Build(ctx context.Context, fileNum uint64, level int, entries
 	if err != nil {
 		return TableMeta{}, err
 	}
+	writer.ctx, writer.reason = ctx, writeReasonFromContext(ctx)
+	if id, ok := ctx.Value(columnFamilyKey{}).(uint32); ok {
+		writer.family = id + 1
+	}
 	for _, entry := range entries {
 		if err := ctx.Err(); err != nil {
 			_ = writer.Close()
@@ -79,7 +85,7 @@ func (m *Manager) Build(ctx context.Context, fileNum uint64, level int, entries
 
 // Open 根据元数据打开现有的 SSTable 文件，返回一个读取器
 func (m *Manager) Open(meta TableMeta) (*Reader, error) {
-	return Open(filepath.Join(m.dir, FileName(meta.FileNum)), meta)
+	return openReader(filepath.Join(m.dir, FileName(meta.FileNum)), meta, !m.opts.SkipChecksums)
 }
 
 // Remove 删除指定文件编号的 SSTable 文件若文件不存在则视为成功
@@ -91,6 +97,14 @@ func (m *Manager) Remove(fileNum uint64) error {
 	return err
 }
 
+type columnFamilyKey struct{}
+
+// ContextWithColumnFamily 在上下文中标记表所属的列族，Manager.Build 将其写入页脚，
+// 使 MANIFEST 损坏时仍能把表恢复到原来的列族
+func ContextWithColumnFamily(ctx context.Context, id uint32) context.Context {
+	return context.WithValue(ctx, columnFamilyKey{}, id)
+}
+
 // FileName 根据文件编号返回标准的 SSTable 文件名
 func FileName(fileNum uint64) string {
 	return fmt.Sprintf(filePattern, fileNum)
@@ -103,17 +117,22 @@ type Writer struct {
 	fileNum  uint64
 	level    int
 	opts     Options
-	block    []record.Entry   // 当前正在构建的数据块
-	blockLen int              // 当前数据块的估算字节数
+	block    blockBuilder     // 当前正在构建的数据块
+	firstKey []byte           // 当前数据块的首个键
+	lastKey  []byte           // 当前数据块的末尾键
 	index    []IndexEntry     // 已写入块的索引
 	bloom    *BloomBuilder // 布隆过滤器构建器
 	smallest []byte
 	largest  []byte
 	minSeq   uint64
 	maxSeq   uint64
+	lastSeq  uint64            // 最近一次追加记录的序列号，用于顺序检查
 	count    int
 	offset   uint64            // 已写入文件的总字节数
 	closed   bool
+	ctx      context.Context   // 限速等待使用的上下文
+	reason   WriteReason       // 写入来源，用于限速统计
+	family   uint32            // 所属列族编号加一，0 表示未标记
 }
 
 // Create 创建一个新的 SSTable 文件并返回写入器
@@ -135,6 +154,8 @@ func Create(path string, fileNum uint64, level int, opts Options) (*Writer, erro
 		level:   level,
 		opts:    opts,
 		bloom:   NewBloomBuilder(1024, opts.BitsPerKey),
+		ctx:     context.TODO(),
+		reason:  WriteReasonCompaction,
 	}, nil
 }
 
@@ -143,9 +164,8 @@ func (w *Writer) Add(entry record.Entry) error {
 	if w.closed {
 		return os.ErrClosed
 	}
-	entry = entry.Clone()
 	// 检查顺序
-	if len(w.block) > 0 && record.Compare(w.block[len(w.block)-1], entry) > 0 {
+	if w.count > 0 && record.Compare(record.Entry{Key: w.largest, Seq: w.lastSeq}, entry) > 0 {
 		return fmt.Errorf("%w: entries out of order", ErrInvalidIndex)
 	}
 	// 更新表的全局边界
@@ -160,11 +180,15 @@ func (w *Writer) Add(entry record.Entry) error {
 	if entry.Seq > w.maxSeq {
 		w.maxSeq = entry.Seq
 	}
+	w.lastSeq = entry.Seq
 	w.bloom.Add(entry.Key)
-	w.block = append(w.block, entry)
-	w.blockLen += encodedEntryLen(entry)
+	if w.block.empty() {
+		w.firstKey = record.CloneBytes(entry.Key)
+	}
+	w.lastKey = append(w.lastKey[:0], entry.Key...)
+	w.block.add(entry)
 	w.count++
-	if w.blockLen >= w.opts.BlockSize {
+	if w.block.estimatedSize() >= w.opts.BlockSize {
 		return w.flushBlock()
 	}
 	return nil
@@ -186,6 +210,7 @@ func (w *Writer) Finish() (TableMeta, error) {
 		_ = w.Close()
 		return TableMeta{}, err
 	}
+	indexBytes = appendChecksum(indexBytes)
 	indexOffset := w.offset
 	if err := w.write(indexBytes); err != nil {
 		_ = w.Close()
@@ -198,6 +223,7 @@ func (w *Writer) Finish() (TableMeta, error) {
 		_ = w.Close()
 		return TableMeta{}, err
 	}
+	bloomBytes = appendChecksum(bloomBytes)
 	bloomOffset := w.offset
 	if err := w.write(bloomBytes); err != nil {
 		_ = w.Close()
@@ -211,6 +237,9 @@ func (w *Writer) Finish() (TableMeta, error) {
 	binary.LittleEndian.PutUint64(footer[20:28], bloomOffset)
 	binary.LittleEndian.PutUint32(footer[28:32], uint32(len(bloomBytes)))
 	binary.LittleEndian.PutUint32(footer[32:36], uint32(w.count))
+	binary.LittleEndian.PutUint32(footer[36:40], currentFormatVersion)
+	binary.LittleEndian.PutUint32(footer[40:44], w.family)
+	sealFooter(footer)
 	if err := w.write(footer); err != nil {
 		_ = w.Close()
 		return TableMeta{}, err
@@ -246,18 +275,13 @@ func (w *Writer) Close() error {
 
 // flushBlock 将当前积累的数据块编码并写入文件
 func (w *Writer) flushBlock() error {
-	if len(w.block) == 0 {
+	if w.block.empty() {
 		return nil
 	}
-	data, err := encodeBlock(w.block)
-	if err != nil {
-		return err
-	}
-	first := w.block[0].Key
-	last := w.block[len(w.block)-1].Key
+	data := appendChecksum(w.block.finish())
 	entry := IndexEntry{
-		FirstKey: record.CloneBytes(first),
-		LastKey:  record.CloneBytes(last),
+		FirstKey: w.firstKey,
+		LastKey:  record.CloneBytes(w.lastKey),
 		Handle: BlockHandle{
 			Offset: w.offset,
 			Length: uint32(len(data)),
@@ -267,13 +291,17 @@ func (w *Writer) flushBlock() error {
 		return err
 	}
 	w.index = append(w.index, entry)
-	w.block = w.block[:0]
-	w.blockLen = 0
+	w.block.reset()
 	return nil
 }
 
-// write 是文件写入的包装，更新写入偏移量
+// write 是文件写入的包装，按限速器节流并更新写入偏移量
 func (w *Writer) write(data []byte) error {
+	if w.opts.RateLimiter != nil {
+		if err := w.opts.RateLimiter.Wait(w.ctx, w.reason, len(data)); err != nil {
+			return fmt.Errorf("write sstable: %w", err)
+		}
+	}
 	n, err := w.file.Write(data)
 	if err != nil {
 		return fmt.Errorf("write sstable: %w", err)
@@ -287,14 +315,25 @@ func (w *Writer) write(data []byte) error {
 
 // Reader 用于读取已存在的 SSTable
 type Reader struct {
-	path  string
-	meta  TableMeta
-	index *Index
-	bloom *Bloom
+	path    string
+	meta    TableMeta
+	index   *Index
+	bloom   *Bloom
+	count   int64       // 页脚记录的条目总数
+	version uint32      // 页脚中的格式版本
+	family  uint32      // 页脚中的列族编号加一，0 表示未知
+	verify  bool        // 读取块时是否校验
+	indexAt BlockHandle // 索引块位置
+	bloomAt BlockHandle // 布隆块位置
 }
 
 // Open 打开一个 SSTable 文件，解析元数据、索引和布隆过滤器，返回读取器
 func Open(path string, meta TableMeta) (*Reader, error) {
+	return openReader(path, meta, true)
+}
+
+// openReader 打开 SSTable，verify 控制是否校验索引、布隆和数据块
+func openReader(path string, meta TableMeta, verify bool) (*Reader, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, fmt.Errorf("open sstable: %w", err)
@@ -305,44 +344,61 @@ func Open(path string, meta TableMeta) (*Reader, error) {
 		return nil, fmt.Errorf("stat sstable: %w", err)
 	}
 	if info.Size() < footerSize {
-		return nil, fmt.Errorf("%w: short sstable", ErrInvalidIndex)
+		return nil, &CorruptionError{Path: path, Reason: fmt.Sprintf("short sstable of %d bytes", info.Size())}
 	}
-	// 读取页脚
+	// 读取并校验页脚
+	footerAt := uint64(info.Size() - footerSize)
 	footer := make([]byte, footerSize)
-	if _, err := file.ReadAt(footer, info.Size()-footerSize); err != nil {
+	if _, err := file.ReadAt(footer, int64(footerAt)); err != nil {
 		return nil, fmt.Errorf("read sstable footer: %w", err)
 	}
-	// 验证魔数
-	if binary.LittleEndian.Uint64(footer[0:8]) != tableMagic {
-		return nil, fmt.Errorf("%w: bad sstable magic", ErrInvalidIndex)
+	version, err := checkFooter(path, footerAt, footer)
+	if err != nil {
+		return nil, err
+	}
+	if version > currentFormatVersion {
+		return nil, fmt.Errorf("%w: unsupported sstable version %d", ErrInvalidIndex, version)
+	}
+	reader := &Reader{
+		path:    path,
+		meta:    meta.Clone(),
+		count:   int64(binary.LittleEndian.Uint32(footer[32:36])),
+		version: version,
+		verify:  verify,
+		indexAt: BlockHandle{Offset: binary.LittleEndian.Uint64(footer[8:16]), Length: binary.LittleEndian.Uint32(footer[16:20])},
+		bloomAt: BlockHandle{Offset: binary.LittleEndian.Uint64(footer[20:28]), Length: binary.LittleEndian.Uint32(footer[28:32])},
+	}
+	if version >= columnFamilyVersion {
+		reader.family = binary.LittleEndian.Uint32(footer[40:44])
+	}
+	for _, handle := range []BlockHandle{reader.indexAt, reader.bloomAt} {
+		if handle.Offset > footerAt || uint64(handle.Length) > footerAt-handle.Offset {
+			return nil, &CorruptionError{Path: path, Offset: footerAt, Reason: fmt.Sprintf("footer handle %d+%d past end of data", handle.Offset, handle.Length)}
+		}
 	}
-	indexOffset := int64(binary.LittleEndian.Uint64(footer[8:16]))
-	indexLength := int(binary.LittleEndian.Uint32(footer[16:20]))
-	bloomOffset := int64(binary.LittleEndian.Uint64(footer[20:28]))
-	bloomLength := int(binary.LittleEndian.Uint32(footer[28:32]))
 
 	// 读取索引
-	indexBytes := make([]byte, indexLength)
-	if _, err := file.ReadAt(indexBytes, indexOffset); err != nil {
+	indexBytes, err := reader.readSection(file, reader.indexAt, verify)
+	if err != nil {
 		return nil, fmt.Errorf("read sstable index: %w", err)
 	}
 	index, err := DecodeIndex(indexBytes)
 	if err != nil {
-		return nil, err
+		return nil, &CorruptionError{Path: path, Offset: reader.indexAt.Offset, Reason: err.Error()}
 	}
 	// 读取布隆过滤器（若存在）
-	var bloom *Bloom
-	if bloomLength > 0 {
-		bloomBytes := make([]byte, bloomLength)
-		if _, err := file.ReadAt(bloomBytes, bloomOffset); err != nil {
+	if reader.bloomAt.Length > 0 {
+		bloomBytes, err := reader.readSection(file, reader.bloomAt, verify)
+		if err != nil {
 			return nil, fmt.Errorf("read sstable bloom: %w", err)
 		}
-		bloom, err = DecodeBloom(bloomBytes)
+		reader.bloom, err = DecodeBloom(bloomBytes)
 		if err != nil {
-			return nil, err
+			return nil, &CorruptionError{Path: path, Offset: reader.bloomAt.Offset, Reason: err.Error()}
 		}
 	}
-	return &Reader{path: path, meta: meta.Clone(), index: index, bloom: bloom}, nil
+	reader.index = index
+	return reader, nil
 }
 
 // Get 在 SSTable 中查找指定键首先通过布隆过滤器快速排除，然后使用索引定位数据块
@@ -354,127 +410,294 @@ func (r *Reader) Get(key []byte, readSeq uint64) (record.Entry, bool, error) {
 	if !ok {
 		return record.Entry{}, false, nil
 	}
-	entries, err := r.readBlock(handle)
+	block, err := r.readBlock(handle)
 	if err != nil {
 		return record.Entry{}, false, err
 	}
-	for _, entry := range entries {
-		if bytes.Equal(entry.Key, key) && entry.Seq <= readSeq {
+	// 块内二分定位到 key 的最新版本，再按序列号向后查找可见版本
+	for ok := block.seek(key); ok; ok = block.nextEntry() {
+		entry := block.entry()
+		if !bytes.Equal(entry.Key, key) {
+			break
+		}
+		if entry.Seq <= readSeq {
 			return entry.Clone(), true, nil
 		}
 	}
-	return record.Entry{}, false, nil
+	return record.Entry{}, false, block.err
+}
+
+// MayContain 用布隆过滤器判断 key 是否可能存在，filtered 为 false 表示文件没有布隆过滤器
+func (r *Reader) MayContain(key []byte) (mayContain, filtered bool) {
+	if r.bloom == nil {
+		return true, false
+	}
+	return r.bloom.MayContain(key), true
 }
 
 // NewIterator 创建一个迭代器，仅返回序列号不超过 readSeq 且在键范围内的可见条目
 func (r *Reader) NewIterator(readSeq uint64, bounds record.KeyBounds) (*Iterator, error) {
-	entries, err := r.Entries()
-	if err != nil {
-		return nil, err
-	}
-	visible := make([]record.Entry, 0, len(entries))
-	for _, entry := range entries {
-		if entry.Seq <= readSeq && bounds.Contains(entry.Key) {
-			visible = append(visible, entry)
-		}
-	}
-	return &Iterator{entries: visible, index: -1}, nil
+	return &Iterator{
+		reader:  r,
+		readSeq: readSeq,
+		bounds:  bounds.Clone(),
+		blocks:  r.index.Entries(),
+	}, nil
 }
 
 // Entries 返回 SSTable 中所有记录（不进行序列号过滤）
 func (r *Reader) Entries() ([]record.Entry, error) {
-	indexEntries := r.index.Entries()
+	return r.EntriesInRange(record.KeyBounds{})
+}
+
+// EntriesInRange 返回键位于 bounds 内的所有记录（不进行序列号过滤），只读取与范围重叠的数据块
+func (r *Reader) EntriesInRange(bounds record.KeyBounds) ([]record.Entry, error) {
 	entries := make([]record.Entry, 0)
-	for _, indexEntry := range indexEntries {
-		blockEntries, err := r.readBlock(indexEntry.Handle)
+	for _, indexEntry := range r.index.Entries() {
+		if len(bounds.Upper) > 0 && bytes.Compare(indexEntry.FirstKey, bounds.Upper) >= 0 {
+			break
+		}
+		if len(bounds.Lower) > 0 && bytes.Compare(indexEntry.LastKey, bounds.Lower) < 0 {
+			continue
+		}
+		block, err := r.readBlock(indexEntry.Handle)
 		if err != nil {
 			return nil, err
 		}
-		entries = append(entries, blockEntries...)
+		blockEntries, err := block.entries()
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range blockEntries {
+			if bounds.Contains(entry.Key) {
+				entries = append(entries, entry)
+			}
+		}
 	}
 	return entries, nil
 }
 
+// IndexEntries 返回数据块索引条目，可用于按数据量切分键范围
+func (r *Reader) IndexEntries() []IndexEntry {
+	return r.index.Entries()
+}
+
+// ApproximateRange 根据索引估算 [lower, upper) 范围内的数据字节数与条目数，空边界表示不限
+// 字节数为与范围重叠的数据块长度之和，条目数按这些块占全部数据块的比例从页脚总数折算
+func (r *Reader) ApproximateRange(lower, upper []byte) (int64, int64) {
+	var total, size int64
+	for _, entry := range r.index.Entries() {
+		total += int64(entry.Handle.Length)
+		if len(upper) > 0 && bytes.Compare(entry.FirstKey, upper) >= 0 {
+			continue
+		}
+		if len(lower) > 0 && bytes.Compare(entry.LastKey, lower) < 0 {
+			continue
+		}
+		size += int64(entry.Handle.Length)
+	}
+	if total == 0 {
+		return 0, 0
+	}
+	return size, r.count * size / total
+}
+
+// Properties 描述 SSTable 页脚与布隆过滤器的信息，供调试工具使用
+type Properties struct {
+	FormatVersion uint32      // 页脚中的格式版本
+	Count         int64       // 页脚记录的条目总数
+	Index         BlockHandle // 索引块位置
+	Bloom         BlockHandle // 布隆块位置，长度为 0 表示没有布隆过滤器
+	BloomBits     uint64      // 布隆过滤器位数
+	BloomHashes   uint8       // 布隆过滤器哈希函数个数
+	ColumnFamily  uint32      // 表所属的列族，FamilyKnown 为 false 时无意义
+	FamilyKnown   bool        // 页脚是否记录了所属列族，旧格式或未标记列族构建的表为 false
+}
+
+// Properties 返回表的页脚与布隆过滤器信息
+func (r *Reader) Properties() Properties {
+	props := Properties{
+		FormatVersion: r.version,
+		Count:         r.count,
+		Index:         r.indexAt,
+		Bloom:         r.bloomAt,
+	}
+	if r.family > 0 {
+		props.ColumnFamily, props.FamilyKnown = r.family-1, true
+	}
+	if r.bloom != nil {
+		props.BloomBits, props.BloomHashes = r.bloom.bitCount, r.bloom.hashes
+	}
+	return props
+}
+
 // Close 释放 Reader 的资源（当前为无操作，文件已关闭）
 func (r *Reader) Close() error {
 	return nil
 }
 
-// readBlock 从文件中读取并解码一个数据块
-func (r *Reader) readBlock(handle BlockHandle) ([]record.Entry, error) {
+// VerifyChecksums 忽略 SkipChecksums 设置，校验索引、布隆过滤器和全部数据块
+func (r *Reader) VerifyChecksums() error {
+	file, err := os.Open(r.path)
+	if err != nil {
+		return fmt.Errorf("open sstable: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+	handles := []BlockHandle{r.indexAt}
+	if r.bloomAt.Length > 0 {
+		handles = append(handles, r.bloomAt)
+	}
+	for _, entry := range r.index.Entries() {
+		handles = append(handles, entry.Handle)
+	}
+	for _, handle := range handles {
+		if _, err := r.readSection(file, handle, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readBlock 从文件中读取一个数据块并返回块迭代器
+func (r *Reader) readBlock(handle BlockHandle) (*blockIter, error) {
 	file, err := os.Open(r.path)
 	if err != nil {
 		return nil, fmt.Errorf("open sstable block: %w", err)
 	}
 	defer func() { _ = file.Close() }()
+	data, err := r.readSection(file, handle, r.verify)
+	if err != nil {
+		return nil, fmt.Errorf("read sstable block: %w", err)
+	}
+	return newBlockIter(data, r.version)
+}
+
+// readSection 读取 handle 指向的区域，带校验和的格式会去掉块尾并按需校验
+func (r *Reader) readSection(file *os.File, handle BlockHandle, verify bool) ([]byte, error) {
 	data := make([]byte, handle.Length)
 	if _, err := file.ReadAt(data, int64(handle.Offset)); err != nil {
-		return nil, fmt.Errorf("read sstable block: %w", err)
+		return nil, err
+	}
+	if r.version == legacyFormatVersion {
+		return data, nil
 	}
-	return decodeBlock(data)
+	return stripChecksum(r.path, handle.Offset, data, verify)
 }
 
-// Iterator 提供对 SSTable 记录的顺序访问
+// Iterator 提供对 SSTable 记录的顺序访问，按需逐块读取，仅返回序列号不超过 readSeq 且在键范围内的条目
 type Iterator struct {
-	entries []record.Entry
-	index   int
+	reader   *Reader
+	readSeq  uint64
+	bounds   record.KeyBounds
+	blocks   []IndexEntry
+	blockIdx int
+	block    *blockIter
+	valid    bool
+	err      error
 }
 
 func (it *Iterator) First() bool {
-	if len(it.entries) == 0 {
-		it.index = -1
+	if len(it.bounds.Lower) > 0 {
+		return it.Seek(it.bounds.Lower)
+	}
+	if !it.loadBlock(0) {
 		return false
 	}
-	it.index = 0
-	return true
+	return it.settle(it.block.first())
 }
 
 func (it *Iterator) Seek(key []byte) bool {
-	pos := sort.Search(len(it.entries), func(i int) bool {
-		return bytes.Compare(it.entries[i].Key, key) >= 0
+	if len(it.bounds.Lower) > 0 && bytes.Compare(key, it.bounds.Lower) < 0 {
+		key = it.bounds.Lower
+	}
+	// 找到第一个末尾键不小于 key 的数据块，再在块内二分定位
+	pos := sort.Search(len(it.blocks), func(i int) bool {
+		return bytes.Compare(it.blocks[i].LastKey, key) >= 0
 	})
-	if pos >= len(it.entries) {
-		it.index = -1
+	if !it.loadBlock(pos) {
 		return false
 	}
-	it.index = pos
-	return true
+	return it.settle(it.block.seek(key))
 }
 
 func (it *Iterator) Next() bool {
-	if it.index < 0 {
+	if !it.valid {
+		if it.err != nil {
+			return false
+		}
 		return it.First()
 	}
-	it.index++
-	if it.index >= len(it.entries) {
-		it.index = -1
-		return false
-	}
-	return true
+	return it.settle(it.block.nextEntry())
 }
 
 func (it *Iterator) Valid() bool {
-	return it.index >= 0 && it.index < len(it.entries)
+	return it.valid
 }
 
 func (it *Iterator) Entry() record.Entry {
 	if !it.Valid() {
 		return record.Entry{}
 	}
-	return it.entries[it.index].Clone()
+	return it.block.entry().Clone()
 }
 
 func (it *Iterator) Err() error {
-	return nil
+	return it.err
 }
 
 func (it *Iterator) Close() error {
-	it.entries = nil
-	it.index = -1
+	it.blocks = nil
+	it.block = nil
+	it.valid = false
 	return nil
 }
 
-// encodeBlock 将记录切片编码为数据块的字节表示
+// loadBlock 读取第 idx 个数据块，越界或出错时使迭代器失效
+func (it *Iterator) loadBlock(idx int) bool {
+	it.valid = false
+	it.blockIdx = idx
+	it.block = nil
+	if idx >= len(it.blocks) {
+		return false
+	}
+	block, err := it.reader.readBlock(it.blocks[idx].Handle)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	it.block = block
+	return true
+}
+
+// settle 从当前位置起跳过不可见条目，必要时切换到后续数据块
+func (it *Iterator) settle(ok bool) bool {
+	for {
+		if !ok {
+			if it.block.err != nil {
+				it.err = it.block.err
+				it.valid = false
+				return false
+			}
+			if !it.loadBlock(it.blockIdx + 1) {
+				return false
+			}
+			ok = it.block.first()
+			continue
+		}
+		entry := it.block.entry()
+		if len(it.bounds.Upper) > 0 && bytes.Compare(entry.Key, it.bounds.Upper) >= 0 {
+			it.valid = false
+			return false
+		}
+		if entry.Seq <= it.readSeq && it.bounds.Contains(entry.Key) {
+			it.valid = true
+			return true
+		}
+		ok = it.block.nextEntry()
+	}
+}
+
+// encodeBlock 将记录切片编码为旧格式数据块的字节表示，仅用于兼容旧版本文件
 func encodeBlock(entries []record.Entry) ([]byte, error) {
 	size := 4 // 条目计数
 	for _, entry := range entries {
@@ -493,7 +716,7 @@ func encodeBlock(entries []record.Entry) ([]byte, error) {
 	return out, nil
 }
 
-// decodeBlock 从字节切片解码出一个数据块的记录集合
+// decodeBlock 从字节切片解码出一个旧格式数据块的记录集合
 func decodeBlock(data []byte) ([]record.Entry, error) {
 	reader := blockReader{data: data}
 	count, ok := reader.u32()
@@ -576,6 +799,18 @@ func (r *blockReader) u64() (uint64, bool) {
 	return value, true
 }
 
+func (r *blockReader) uvarint() (uint64, bool) {
+	if r.remaining() < 1 {
+		return 0, false
+	}
+	value, n := binary.Uvarint(r.data[r.off:])
+	if n <= 0 {
+		return 0, false
+	}
+	r.off += n
+	return value, true
+}
+
 func (r *blockReader) bytes(n int) ([]byte, bool) {
 	if n < 0 || r.remaining() < n {
 		return nil, false
@@ -2,8 +2,13 @@ package sstable
 
 import (
 	"context"
+	"encoding/binary"
 	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"mini-kv/internal/storage/lsm/record"
 )
@@ -45,6 +50,397 @@ func TestManagerBuildOpenGetAndIterator(t *testing.T) {
 	}
 }
 
+func TestReaderDetectsCorruptDataBlock(t *testing.T) {
+	dir := t.TempDir()
+	manager := NewManager(dir, Options{BlockSize: 32})
+	meta, err := manager.Build(context.Background(), 1, 0, []record.Entry{
+		record.NewPut([]byte("a"), []byte("1"), 1),
+		record.NewPut([]byte("b"), []byte("2"), 2),
+	})
+	if err != nil {
+		t.Fatalf("Build error = %v", err)
+	}
+	reader, err := manager.Open(meta)
+	if err != nil {
+		t.Fatalf("Open error = %v", err)
+	}
+	handle, ok := reader.index.Find([]byte("b"))
+	if !ok {
+		t.Fatal("index Find(b) = false, want true")
+	}
+	path := filepath.Join(dir, FileName(1))
+	flipByte(t, path, int64(handle.Offset)+2)
+
+	_, _, err = reader.Get([]byte("b"), 10)
+	var corruption *CorruptionError
+	if !errors.As(err, &corruption) || !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("Get error = %v, want CorruptionError", err)
+	}
+	if corruption.Path != path || corruption.Offset != handle.Offset {
+		t.Fatalf("corruption = %+v, want path %s offset %d", corruption, path, handle.Offset)
+	}
+	if err := reader.VerifyChecksums(); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("VerifyChecksums error = %v, want %v", err, ErrCorrupt)
+	}
+
+	// 跳过校验时不再返回校验和错误
+	skipping, err := NewManager(dir, Options{BlockSize: 32, SkipChecksums: true}).Open(meta)
+	if err != nil {
+		t.Fatalf("Open skipping checksums error = %v", err)
+	}
+	if _, _, err := skipping.Get([]byte("b"), 10); errors.Is(err, ErrCorrupt) {
+		t.Fatalf("Get skipping checksums error = %v, want no checksum error", err)
+	}
+}
+
+func TestOpenDetectsCorruptIndex(t *testing.T) {
+	dir := t.TempDir()
+	manager := NewManager(dir, Options{})
+	meta, err := manager.Build(context.Background(), 1, 0, []record.Entry{
+		record.NewPut([]byte("a"), []byte("1"), 1),
+	})
+	if err != nil {
+		t.Fatalf("Build error = %v", err)
+	}
+	reader, err := manager.Open(meta)
+	if err != nil {
+		t.Fatalf("Open error = %v", err)
+	}
+	flipByte(t, filepath.Join(dir, FileName(1)), int64(reader.indexAt.Offset))
+
+	if _, err := manager.Open(meta); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("Open corrupt index error = %v, want %v", err, ErrCorrupt)
+	}
+}
+
+func TestOpenDetectsCorruptFooter(t *testing.T) {
+	dir := t.TempDir()
+	manager := NewManager(dir, Options{})
+	meta, err := manager.Build(context.Background(), 1, 0, []record.Entry{
+		record.NewPut([]byte("a"), []byte("1"), 1),
+	})
+	if err != nil {
+		t.Fatalf("Build error = %v", err)
+	}
+	path := filepath.Join(dir, FileName(1))
+	original, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile error = %v", err)
+	}
+	footerAt := len(original) - footerSize
+
+	for name, corrupt := range map[string]func(data []byte){
+		// 版本字段被改成旧版本时不能退回无校验的读取路径
+		"version downgraded": func(data []byte) { binary.LittleEndian.PutUint32(data[footerAt+36:], legacyFormatVersion) },
+		"index offset":       func(data []byte) { data[footerAt+8] ^= 0x01 },
+		"entry count":        func(data []byte) { data[footerAt+32] ^= 0x01 },
+	} {
+		data := append([]byte(nil), original...)
+		corrupt(data)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatalf("WriteFile error = %v", err)
+		}
+		_, err := manager.Open(meta)
+		var corruption *CorruptionError
+		if !errors.As(err, &corruption) || !errors.Is(err, ErrCorrupt) {
+			t.Fatalf("%s: Open error = %v, want CorruptionError", name, err)
+		}
+		if corruption.Offset != uint64(footerAt) {
+			t.Fatalf("%s: corruption offset = %d, want footer offset %d", name, corruption.Offset, footerAt)
+		}
+	}
+}
+
+func TestReaderOpensLegacyFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName(1))
+	entries := []record.Entry{
+		record.NewPut([]byte("a"), []byte("1"), 1),
+		record.NewPut([]byte("b"), []byte("2"), 2),
+	}
+	writeLegacyTable(t, path, entries)
+
+	reader, err := Open(path, TableMeta{FileNum: 1})
+	if err != nil {
+		t.Fatalf("Open legacy error = %v", err)
+	}
+	got, ok, err := reader.Get([]byte("b"), 10)
+	if err != nil || !ok || string(got.Value) != "2" {
+		t.Fatalf("Get(b) = (%+v, %v, %v), want value 2", got, ok, err)
+	}
+	if err := reader.VerifyChecksums(); err != nil {
+		t.Fatalf("VerifyChecksums legacy error = %v", err)
+	}
+}
+
+func TestPrefixBlockSeekAcrossRestartPoints(t *testing.T) {
+	var builder blockBuilder
+	var entries []record.Entry
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("tenant-000042/user-%04d", i))
+		// 每个键写两个版本，较新的版本排在前面
+		entries = append(entries,
+			record.NewPut(key, []byte(fmt.Sprintf("v2-%d", i)), uint64(2*i+2)),
+			record.NewPut(key, []byte(fmt.Sprintf("v1-%d", i)), uint64(2*i+1)),
+		)
+	}
+	for _, entry := range entries {
+		builder.add(entry)
+	}
+	data := builder.finish()
+	legacy, err := encodeBlock(entries)
+	if err != nil {
+		t.Fatalf("encodeBlock error = %v", err)
+	}
+	if len(data) >= len(legacy)/2 {
+		t.Fatalf("prefix block size = %d, want less than half of legacy %d", len(data), len(legacy))
+	}
+
+	block, err := newBlockIter(data, prefixBlockVersion)
+	if err != nil {
+		t.Fatalf("newBlockIter error = %v", err)
+	}
+	for _, i := range []int{0, 7, 8, 9, 63, 99} {
+		key := fmt.Sprintf("tenant-000042/user-%04d", i)
+		if !block.seek([]byte(key)) {
+			t.Fatalf("seek(%s) = false, want true", key)
+		}
+		got := block.entry()
+		if string(got.Key) != key || got.Seq != uint64(2*i+2) {
+			t.Fatalf("seek(%s) = (%s, %d), want newest version", key, got.Key, got.Seq)
+		}
+		if !block.nextEntry() || block.entry().Seq != uint64(2*i+1) {
+			t.Fatalf("next after seek(%s) = %+v, want older version", key, block.entry())
+		}
+	}
+	if block.seek([]byte("tenant-000042/user-9999")) {
+		t.Fatalf("seek past end = true, want false")
+	}
+	decoded, err := block.entries()
+	if err != nil || len(decoded) != len(entries) {
+		t.Fatalf("entries = %d, %v; want %d", len(decoded), err, len(entries))
+	}
+	for i := range entries {
+		if record.Compare(decoded[i], entries[i]) != 0 || string(decoded[i].Value) != string(entries[i].Value) {
+			t.Fatalf("entry %d = %+v, want %+v", i, decoded[i], entries[i])
+		}
+	}
+}
+
+func TestPrefixBlockRejectsCorruptEntries(t *testing.T) {
+	// 构造单条目块：shared | unshared | valueLen | kind | seq | 键 | 值 | 重启点 | 重启点数量
+	corruptBlock := func(unshared, valueLen uint64, restart uint32) []byte {
+		var data []byte
+		data = binary.AppendUvarint(data, 0)
+		data = binary.AppendUvarint(data, unshared)
+		data = binary.AppendUvarint(data, valueLen)
+		data = append(data, byte(record.KindPut))
+		data = binary.AppendUvarint(data, 1)
+		data = append(data, "k1"...)
+		data = binary.LittleEndian.AppendUint32(data, restart)
+		return binary.LittleEndian.AppendUint32(data, 1)
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"restart offset past entries", corruptBlock(1, 1, 1<<20)},
+		{"key length past block", corruptBlock(1<<63, 0, 0)},
+		// 1 + (2^64-1) 转为 int 后相加为 0，旧检查会放过并在切片时 panic
+		{"value length overflows int", corruptBlock(1, ^uint64(0), 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block, err := newBlockIter(tt.data, prefixBlockVersion)
+			if err != nil {
+				t.Fatalf("newBlockIter error = %v", err)
+			}
+			if block.first() {
+				t.Fatalf("first() = true, want false")
+			}
+			if !errors.Is(block.err, ErrInvalidIndex) {
+				t.Fatalf("first() err = %v, want ErrInvalidIndex", block.err)
+			}
+			block.err = nil
+			if block.seek([]byte("k")) || !errors.Is(block.err, ErrInvalidIndex) {
+				t.Fatalf("seek() err = %v, want ErrInvalidIndex", block.err)
+			}
+		})
+	}
+}
+
+func TestIteratorSeekAcrossBlocksHonorsBoundsAndSeq(t *testing.T) {
+	manager := NewManager(t.TempDir(), Options{BlockSize: 64})
+	var entries []record.Entry
+	for i := 0; i < 50; i++ {
+		entries = append(entries, record.NewPut([]byte(fmt.Sprintf("k%03d", i)), []byte("v"), uint64(i+1)))
+	}
+	meta, err := manager.Build(context.Background(), 1, 0, entries)
+	if err != nil {
+		t.Fatalf("Build error = %v", err)
+	}
+	reader, err := manager.Open(meta)
+	if err != nil {
+		t.Fatalf("Open error = %v", err)
+	}
+	if len(reader.index.Entries()) < 2 {
+		t.Fatalf("blocks = %d, want several", len(reader.index.Entries()))
+	}
+
+	iter, err := reader.NewIterator(40, record.KeyBounds{Lower: []byte("k010"), Upper: []byte("k045")})
+	if err != nil {
+		t.Fatalf("NewIterator error = %v", err)
+	}
+	defer func() { _ = iter.Close() }()
+	if !iter.Seek([]byte("k020")) || string(iter.Entry().Key) != "k020" {
+		t.Fatalf("Seek(k020) = %+v, want k020", iter.Entry())
+	}
+	if !iter.Seek([]byte("a")) || string(iter.Entry().Key) != "k010" {
+		t.Fatalf("Seek(a) = %+v, want lower bound k010", iter.Entry())
+	}
+	count := 0
+	for ok := iter.First(); ok; ok = iter.Next() {
+		count++
+	}
+	// 序列号 40 对应 k039，上界之前可见的键为 k010..k039
+	if count != 30 || iter.Err() != nil {
+		t.Fatalf("visible entries = %d, err = %v; want 30", count, iter.Err())
+	}
+}
+
+func TestReaderApproximateRangeUsesIndex(t *testing.T) {
+	manager := NewManager(t.TempDir(), Options{BlockSize: 64})
+	var entries []record.Entry
+	for i := 0; i < 100; i++ {
+		entries = append(entries, record.NewPut([]byte(fmt.Sprintf("k%03d", i)), []byte("value"), uint64(i+1)))
+	}
+	meta, err := manager.Build(context.Background(), 1, 0, entries)
+	if err != nil {
+		t.Fatalf("Build error = %v", err)
+	}
+	reader, err := manager.Open(meta)
+	if err != nil {
+		t.Fatalf("Open error = %v", err)
+	}
+
+	totalSize, totalCount := reader.ApproximateRange(nil, nil)
+	if totalCount != 100 || totalSize <= 0 || totalSize >= meta.Size {
+		t.Fatalf("ApproximateRange(nil, nil) = (%d, %d), want data bytes below %d and 100 entries", totalSize, totalCount, meta.Size)
+	}
+	halfSize, halfCount := reader.ApproximateRange([]byte("k050"), nil)
+	if halfSize <= 0 || halfSize >= totalSize || halfCount < 40 || halfCount > 60 {
+		t.Fatalf("ApproximateRange(k050, nil) = (%d, %d), want about half of (%d, 100)", halfSize, halfCount, totalSize)
+	}
+	if size, count := reader.ApproximateRange([]byte("x"), nil); size != 0 || count != 0 {
+		t.Fatalf("ApproximateRange(x, nil) = (%d, %d), want 0 0", size, count)
+	}
+}
+
+func TestReaderEntriesInRangeReadsOverlappingBlocks(t *testing.T) {
+	manager := NewManager(t.TempDir(), Options{BlockSize: 64})
+	var entries []record.Entry
+	for i := 0; i < 50; i++ {
+		key := []byte(fmt.Sprintf("k%03d", i))
+		if i%2 == 0 {
+			entries = append(entries, record.NewDelete(key, uint64(i+1)))
+		} else {
+			entries = append(entries, record.NewPut(key, []byte("value"), uint64(i+1)))
+		}
+	}
+	meta, err := manager.Build(context.Background(), 1, 0, entries)
+	if err != nil {
+		t.Fatalf("Build error = %v", err)
+	}
+	reader, err := manager.Open(meta)
+	if err != nil {
+		t.Fatalf("Open error = %v", err)
+	}
+
+	got, err := reader.EntriesInRange(record.KeyBounds{Lower: []byte("k010"), Upper: []byte("k020")})
+	if err != nil {
+		t.Fatalf("EntriesInRange error = %v", err)
+	}
+	// 删除标记同样返回，且不越过范围边界
+	if len(got) != 10 || string(got[0].Key) != "k010" || string(got[len(got)-1].Key) != "k019" {
+		t.Fatalf("EntriesInRange = %d entries from %q to %q, want 10 from k010 to k019", len(got), got[0].Key, got[len(got)-1].Key)
+	}
+}
+
+func TestRateLimiterThrottlesAndCountsByReason(t *testing.T) {
+	limiter := NewRateLimiter(100 << 10)
+	ctx := context.Background()
+
+	started := time.Now()
+	if err := limiter.Wait(ctx, WriteReasonFlush, 100<<10); err != nil {
+		t.Fatalf("Wait within burst error = %v", err)
+	}
+	if err := limiter.Wait(ctx, WriteReasonCompaction, 20<<10); err != nil {
+		t.Fatalf("Wait over burst error = %v", err)
+	}
+	if elapsed := time.Since(started); elapsed < 150*time.Millisecond {
+		t.Fatalf("Wait over burst returned after %v, want about 200ms", elapsed)
+	}
+	if limiter.WaitTime() <= 0 {
+		t.Fatalf("WaitTime = %v, want > 0", limiter.WaitTime())
+	}
+	if got := limiter.BytesWritten(WriteReasonFlush); got != 100<<10 {
+		t.Fatalf("flush bytes = %d, want %d", got, 100<<10)
+	}
+	if got := limiter.BytesWritten(WriteReasonCompaction); got != 20<<10 {
+		t.Fatalf("compaction bytes = %d, want %d", got, 20<<10)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := limiter.Wait(canceled, WriteReasonCompaction, 1<<20); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Wait canceled error = %v, want %v", err, context.Canceled)
+	}
+
+	// 关闭限速后写入不再等待
+	limiter.SetRate(0)
+	started = time.Now()
+	if err := limiter.Wait(ctx, WriteReasonCompaction, 10<<20); err != nil || time.Since(started) > 50*time.Millisecond {
+		t.Fatalf("Wait unlimited = %v after %v, want immediate", err, time.Since(started))
+	}
+}
+
+func flipByte(t *testing.T, path string, offset int64) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile error = %v", err)
+	}
+	data[offset] ^= 0xff
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("WriteFile error = %v", err)
+	}
+}
+
+// writeLegacyTable 按无校验和的旧格式写出单块 SSTable
+func writeLegacyTable(t *testing.T, path string, entries []record.Entry) {
+	t.Helper()
+	block, err := encodeBlock(entries)
+	if err != nil {
+		t.Fatalf("encodeBlock error = %v", err)
+	}
+	index, err := EncodeIndex([]IndexEntry{{
+		FirstKey: entries[0].Key,
+		LastKey:  entries[len(entries)-1].Key,
+		Handle:   BlockHandle{Offset: 0, Length: uint32(len(block))},
+	}})
+	if err != nil {
+		t.Fatalf("EncodeIndex error = %v", err)
+	}
+	footer := make([]byte, footerSize)
+	binary.LittleEndian.PutUint64(footer[0:8], tableMagic)
+	binary.LittleEndian.PutUint64(footer[8:16], uint64(len(block)))
+	binary.LittleEndian.PutUint32(footer[16:20], uint32(len(index)))
+	binary.LittleEndian.PutUint32(footer[32:36], uint32(len(entries)))
+	data := append(append(block, index...), footer...)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("WriteFile error = %v", err)
+	}
+}
+
 // ----------------version-----------------
 
 func TestStateApplyFindAndDelete(t *testing.T) {
@@ -78,6 +474,39 @@ func TestStateCloneIsIndependent(t *testing.T) {
 	}
 }
 
+func TestStateFamiliesTrackLevelsAndFlushedSeq(t *testing.T) {
+	state := (&State{NextFileNum: 1}).Apply(Edit{
+		LastSeq: 5,
+		Added:   []TableMeta{{FileNum: 1, Smallest: []byte("a"), Largest: []byte("b"), MaxSeq: 5}},
+	})
+	// 旧 MANIFEST 没有刷写进度，默认列族以 LastSeq 为准
+	if got := state.FlushedSeq(0); got != 5 {
+		t.Fatalf("FlushedSeq(0) = %d, want 5", got)
+	}
+	state = state.Apply(Edit{AddedFamilies: []FamilyMeta{{ID: 1, Name: "meta"}}})
+	state = state.Apply(Edit{
+		LastSeq:    9,
+		Family:     1,
+		FlushedSeq: 9,
+		Added:      []TableMeta{{FileNum: 2, Smallest: []byte("a"), Largest: []byte("z"), MaxSeq: 9}},
+	})
+	if got := state.FlushedSeq(0); got != 5 {
+		t.Fatalf("FlushedSeq(0) after family flush = %d, want pinned 5", got)
+	}
+	if got := state.FlushedSeq(1); got != 9 {
+		t.Fatalf("FlushedSeq(1) = %d, want 9", got)
+	}
+	if ids := state.FamilyIDs(); len(ids) != 2 || ids[1] != 1 {
+		t.Fatalf("FamilyIDs = %v, want [0 1]", ids)
+	}
+	if files := state.FilesForKey([]byte("c")); len(files) != 0 {
+		t.Fatalf("default FilesForKey(c) = %+v, want empty", files)
+	}
+	if files := state.Family(1).FilesForKey([]byte("c")); len(files) != 1 || files[0].FileNum != 2 {
+		t.Fatalf("family FilesForKey(c) = %+v, want file 2", files)
+	}
+}
+
 // ----------------bloom--------------------
 
 func TestBloomHasNoFalseNegativesAfterRoundTrip(t *testing.T) {
@@ -16,19 +16,56 @@ type TableMeta struct {
 	Size     int64  // 文件大小
 }
 
+// BlobMeta 保存一个 Blob 文件的元数据及其中已失效记录的统计
+type BlobMeta struct {
+	FileNum      uint64 // 文件编号，与 SSTable 共用编号空间
+	Size         int64  // 文件大小
+	Count        int    // 记录数
+	GarbageBytes int64  // 已失效记录的字节数
+	GarbageCount int    // 已失效记录数
+}
+
+// BlobGarbage 记录一次合并或回收在某个 Blob 文件中新产生的失效记录
+type BlobGarbage struct {
+	FileNum uint64
+	Bytes   int64
+	Count   int
+}
+
+// FamilyMeta 标识一个列族，编号 0 为默认列族且不需要登记
+type FamilyMeta struct {
+	ID   uint32
+	Name string
+}
+
+// FamilyState 保存一个非默认列族的 SSTable 层级
+type FamilyState struct {
+	FamilyMeta
+	Levels [][]TableMeta
+}
+
 // Edit 记录一次版本状态变更
 type Edit struct {
-	NextFileNum uint64      // 下一个可分配的文件编号
-	LastSeq     uint64      // 最新序列号
-	Added       []TableMeta // 本次新增的表
-	Deleted     []uint64    // 要删除的文件编号
+	NextFileNum   uint64        // 下一个可分配的文件编号
+	LastSeq       uint64        // 最新序列号
+	Family        uint32        // Added 与 Deleted 所属的列族
+	FlushedSeq    uint64        // 非零时表示该列族序列号不超过此值的写入均已刷写到 SSTable
+	Added         []TableMeta   // 本次新增的表
+	Deleted       []uint64      // 要删除的文件编号
+	AddedFamilies []FamilyMeta  // 本次新建的列族
+	AddedBlobs    []BlobMeta    // 本次新增的 Blob 文件
+	DeletedBlobs  []uint64      // 要删除的 Blob 文件编号
+	BlobGarbage   []BlobGarbage // 新增的失效记录统计
 }
 
 // State 是一个不可变、写时复制的层级集合
 type State struct {
-	NextFileNum uint64        // 下一个可分配的文件编号
-	LastSeq     uint64        // 已消费的最新序列号
-	Levels      [][]TableMeta // 各层级有序（L0 按文件号，其他层按键）
+	NextFileNum uint64            // 下一个可分配的文件编号
+	LastSeq     uint64            // 已消费的最新序列号
+	Levels      [][]TableMeta     // 默认列族的各层级，有序（L0 按文件号，其他层按键）
+	Blobs       []BlobMeta        // 存活的 Blob 文件，按文件号升序
+	Families    []FamilyState     // 非默认列族，按编号升序
+	FlushedSeqs map[uint32]uint64 // 各列族已刷写到 SSTable 的最大序列号，缺少默认列族时以 LastSeq 为准
 }
 
 // 深拷贝元数据，复制键切片
@@ -53,32 +90,117 @@ func (e Edit) Clone() Edit {
 	return Edit{
 		NextFileNum: e.NextFileNum,
 		LastSeq:     e.LastSeq,
+		Family:      e.Family,
+		FlushedSeq:  e.FlushedSeq,
 		Added:       added,
 		Deleted:     append([]uint64(nil), e.Deleted...),
+
+		AddedFamilies: append([]FamilyMeta(nil), e.AddedFamilies...),
+		AddedBlobs:    append([]BlobMeta(nil), e.AddedBlobs...),
+		DeletedBlobs:  append([]uint64(nil), e.DeletedBlobs...),
+		BlobGarbage:   append([]BlobGarbage(nil), e.BlobGarbage...),
 	}
 }
 
+// GarbageRatio 返回失效字节占文件大小的比例
+func (m BlobMeta) GarbageRatio() float64 {
+	if m.Size <= 0 {
+		return 0
+	}
+	return float64(m.GarbageBytes) / float64(m.Size)
+}
+
 // 深拷贝，保证 NextFileNum 至少为 1
 func (s *State) Clone() *State {
 	if s == nil {
 		return &State{NextFileNum: 1}
 	}
-	levels := make([][]TableMeta, len(s.Levels))
-	for i := range s.Levels {
-		levels[i] = make([]TableMeta, len(s.Levels[i]))
-		for j := range s.Levels[i] {
-			levels[i][j] = s.Levels[i][j].Clone()
-		}
-	}
 	nextFileNum := s.NextFileNum
 	if nextFileNum == 0 {
 		nextFileNum = 1
 	}
+	families := make([]FamilyState, len(s.Families))
+	for i, family := range s.Families {
+		families[i] = FamilyState{FamilyMeta: family.FamilyMeta, Levels: cloneLevels(family.Levels)}
+	}
+	var flushed map[uint32]uint64
+	if s.FlushedSeqs != nil {
+		flushed = make(map[uint32]uint64, len(s.FlushedSeqs))
+		for id, seq := range s.FlushedSeqs {
+			flushed[id] = seq
+		}
+	}
 	return &State{
 		NextFileNum: nextFileNum,
 		LastSeq:     s.LastSeq,
-		Levels:      levels,
+		Levels:      cloneLevels(s.Levels),
+		Blobs:       append([]BlobMeta(nil), s.Blobs...),
+		Families:    families,
+		FlushedSeqs: flushed,
+	}
+}
+
+// 深拷贝层级
+func cloneLevels(in [][]TableMeta) [][]TableMeta {
+	levels := make([][]TableMeta, len(in))
+	for i := range in {
+		levels[i] = make([]TableMeta, len(in[i]))
+		for j := range in[i] {
+			levels[i][j] = in[i][j].Clone()
+		}
+	}
+	return levels
+}
+
+// Family 返回只包含指定列族层级的状态视图，未知列族返回空层级
+func (s *State) Family(id uint32) *State {
+	if s == nil {
+		return (&State{}).Clone()
+	}
+	view := &State{NextFileNum: s.NextFileNum, LastSeq: s.LastSeq}
+	if id == 0 {
+		view.Levels = s.Levels
+	} else if family := s.findFamily(id); family != nil {
+		view.Levels = family.Levels
+	}
+	return view.Clone()
+}
+
+// FamilyIDs 返回所有列族编号（含默认列族），按编号升序
+func (s *State) FamilyIDs() []uint32 {
+	ids := []uint32{0}
+	if s == nil {
+		return ids
+	}
+	for _, family := range s.Families {
+		ids = append(ids, family.ID)
+	}
+	return ids
+}
+
+// FlushedSeq 返回列族已刷写到 SSTable 的最大序列号，WAL 回放时跳过不超过该值的条目
+func (s *State) FlushedSeq(id uint32) uint64 {
+	if s == nil {
+		return 0
+	}
+	if seq, ok := s.FlushedSeqs[id]; ok {
+		return seq
 	}
+	if id == 0 {
+		// 引入列族前的 MANIFEST 只有默认列族，其刷写进度即 LastSeq
+		return s.LastSeq
+	}
+	return 0
+}
+
+// 按编号查找非默认列族
+func (s *State) findFamily(id uint32) *FamilyState {
+	for i := range s.Families {
+		if s.Families[i].ID == id {
+			return &s.Families[i]
+		}
+	}
+	return nil
 }
 
 // 将一次编辑应用到当前状态，返回新状态（不可变）
@@ -87,22 +209,49 @@ func (s *State) Apply(edit Edit) *State {
 	if edit.NextFileNum > next.NextFileNum {
 		next.NextFileNum = edit.NextFileNum
 	}
+	// 其他列族第一次变更前固定默认列族的刷写进度，之后 LastSeq 会被其他列族推进
+	if edit.Family != 0 || len(edit.AddedFamilies) > 0 {
+		if _, ok := next.FlushedSeqs[0]; !ok {
+			next.setFlushedSeq(0, s.FlushedSeq(0))
+		}
+	}
 	if edit.LastSeq > next.LastSeq {
 		next.LastSeq = edit.LastSeq
 	}
+	for _, meta := range edit.AddedFamilies {
+		if meta.ID != 0 && next.findFamily(meta.ID) == nil {
+			next.Families = append(next.Families, FamilyState{FamilyMeta: meta})
+		}
+	}
+	sort.Slice(next.Families, func(i, j int) bool {
+		return next.Families[i].ID < next.Families[j].ID
+	})
+	if edit.FlushedSeq > next.FlushedSeq(edit.Family) {
+		next.setFlushedSeq(edit.Family, edit.FlushedSeq)
+	}
+
+	levels := &next.Levels
+	if edit.Family != 0 {
+		family := next.findFamily(edit.Family)
+		if family == nil {
+			next.Families = append(next.Families, FamilyState{FamilyMeta: FamilyMeta{ID: edit.Family}})
+			family = &next.Families[len(next.Families)-1]
+		}
+		levels = &family.Levels
+	}
 	// 删除指定文件
 	for _, deleted := range edit.Deleted {
-		for level := range next.Levels {
-			next.Levels[level] = removeFile(next.Levels[level], deleted)
+		for level := range *levels {
+			(*levels)[level] = removeFile((*levels)[level], deleted)
 		}
 	}
 	// 添加新文件，并按层级排序
 	for _, meta := range edit.Added {
-		for len(next.Levels) <= meta.Level {
-			next.Levels = append(next.Levels, nil)
+		for len(*levels) <= meta.Level {
+			*levels = append(*levels, nil)
 		}
-		next.Levels[meta.Level] = append(next.Levels[meta.Level], meta.Clone())
-		sortLevel(next.Levels[meta.Level])
+		(*levels)[meta.Level] = append((*levels)[meta.Level], meta.Clone())
+		sortLevel((*levels)[meta.Level])
 		if meta.FileNum >= next.NextFileNum {
 			next.NextFileNum = meta.FileNum + 1
 		}
@@ -110,12 +259,51 @@ func (s *State) Apply(edit Edit) *State {
 			next.LastSeq = meta.MaxSeq
 		}
 	}
+	applyBlobs(next, edit)
 	if next.NextFileNum == 0 {
 		next.NextFileNum = 1
 	}
 	return next
 }
 
+// 记录列族的刷写进度
+func (s *State) setFlushedSeq(id uint32, seq uint64) {
+	if s.FlushedSeqs == nil {
+		s.FlushedSeqs = make(map[uint32]uint64)
+	}
+	s.FlushedSeqs[id] = seq
+}
+
+// 应用 Blob 文件的增删与失效统计，未知文件的统计直接忽略（文件可能已被回收）
+func applyBlobs(next *State, edit Edit) {
+	for _, deleted := range edit.DeletedBlobs {
+		out := next.Blobs[:0]
+		for _, meta := range next.Blobs {
+			if meta.FileNum != deleted {
+				out = append(out, meta)
+			}
+		}
+		next.Blobs = out
+	}
+	for _, meta := range edit.AddedBlobs {
+		next.Blobs = append(next.Blobs, meta)
+		if meta.FileNum >= next.NextFileNum {
+			next.NextFileNum = meta.FileNum + 1
+		}
+	}
+	sort.Slice(next.Blobs, func(i, j int) bool {
+		return next.Blobs[i].FileNum < next.Blobs[j].FileNum
+	})
+	for _, garbage := range edit.BlobGarbage {
+		for i := range next.Blobs {
+			if next.Blobs[i].FileNum == garbage.FileNum {
+				next.Blobs[i].GarbageBytes += garbage.Bytes
+				next.Blobs[i].GarbageCount += garbage.Count
+			}
+		}
+	}
+}
+
 // 返回所有可能包含指定键的文件（L0 按倒序，其他层顺序）
 func (s *State) FilesForKey(key []byte) []TableMeta {
 	if s == nil {
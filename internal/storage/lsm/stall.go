@@ -0,0 +1,186 @@
+package lsm
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	writeSlowdownDelay = time.Millisecond      // 减速状态下每次写入的延迟
+	stallPollInterval  = 10 * time.Millisecond // 停写等待时的兜底轮询间隔
+)
+
+// StallCondition 描述当前写入节流级别
+type StallCondition int
+
+const (
+	StallNone    StallCondition = iota // 正常写入
+	StallDelayed                       // 写入被减速
+	StallStopped                       // 写入被暂停，等待刷写或合并追上
+)
+
+func (c StallCondition) String() string {
+	switch c {
+	case StallNone:
+		return "none"
+	case StallDelayed:
+		return "delayed"
+	case StallStopped:
+		return "stopped"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(c))
+	}
+}
+
+// 节流原因
+const (
+	StallReasonImmutableMemTables     = "immutable_memtables"
+	StallReasonL0Files                = "l0_files"
+	StallReasonPendingCompactionBytes = "pending_compaction_bytes"
+)
+
+// StallState 是写入节流状态的快照
+type StallState struct {
+	Condition              StallCondition
+	Reason                 string // 触发节流的原因，正常时为空
+	ImmutableMemTables     int    // 等待刷写的不可变表数量
+	L0Files                int    // Level 0 文件数量
+	PendingCompactionBytes int64  // 估算的待合并字节数
+}
+
+// WriteStall 返回当前写入节流状态，多个列族时取最严重的列族
+func (e *Engine) WriteStall() StallState {
+	var worst StallState
+	for _, fam := range e.sortedFamilies() {
+		stall := e.familyStall(fam)
+		if fam == e.defaultFamily || stall.Condition > worst.Condition {
+			worst = stall
+		}
+	}
+	return worst
+}
+
+// familyStall 计算单个列族的写入节流状态
+func (e *Engine) familyStall(fam *family) StallState {
+	e.memMu.RLock()
+	immutable := len(fam.imm)
+	memFull := fam.mem != nil && fam.mem.ApproximateSize() >= fam.opts.MemTableSize
+	opts := *fam.opts
+	e.memMu.RUnlock()
+
+	state := e.familyVersion(fam.handle.id)
+	l0 := state.FilesInRange(0, nil, nil)
+	stall := StallState{
+		ImmutableMemTables:     immutable,
+		L0Files:                len(l0),
+		PendingCompactionBytes: pendingCompactionBytes(state, l0, opts.L0CompactionTrigger),
+	}
+
+	// 先判断停写条件，再判断减速条件
+	switch {
+	case immutable >= opts.MaxImmutableTables && memFull:
+		stall.Condition, stall.Reason = StallStopped, StallReasonImmutableMemTables
+	case stall.L0Files >= opts.L0StopTrigger:
+		stall.Condition, stall.Reason = StallStopped, StallReasonL0Files
+	case stall.PendingCompactionBytes >= opts.HardPendingCompactionBytes:
+		stall.Condition, stall.Reason = StallStopped, StallReasonPendingCompactionBytes
+	case immutable >= opts.MaxImmutableTables:
+		stall.Condition, stall.Reason = StallDelayed, StallReasonImmutableMemTables
+	case stall.L0Files >= opts.L0SlowdownTrigger:
+		stall.Condition, stall.Reason = StallDelayed, StallReasonL0Files
+	case stall.PendingCompactionBytes >= opts.SoftPendingCompactionBytes:
+		stall.Condition, stall.Reason = StallDelayed, StallReasonPendingCompactionBytes
+	}
+	return stall
+}
+
+// pendingCompactionBytes 估算下一次合并需要重写的字节数：达到触发阈值的 Level 0 文件及其重叠的 Level 1 文件
+func pendingCompactionBytes(state *versionState, l0 []tableMeta, trigger int) int64 {
+	if len(l0) < trigger {
+		return 0
+	}
+	var pending int64
+	for _, meta := range l0 {
+		pending += meta.Size
+	}
+	if lower, upper, ok := tableKeyRange(l0); ok {
+		for _, meta := range overlappingTables(state, 1, lower, upper) {
+			pending += meta.Size
+		}
+	}
+	return pending
+}
+
+// throttleWrite 按节流状态延迟或阻塞写入；NoSlowdown 时直接返回 ErrWriteStall
+func (e *Engine) throttleWrite(options WriteOptions) error {
+	delayed, stopped := false, false
+	var startedAt time.Time
+	defer func() {
+		if delayed || stopped {
+			e.metrics.stallTime.Add(int64(e.clock.Now().Sub(startedAt)))
+		}
+	}()
+
+	for {
+		wake := e.stallWakeCh()
+		state := e.WriteStall()
+		if state.Condition == StallNone || (state.Condition == StallDelayed && delayed) {
+			return nil
+		}
+		if options.NoSlowdown {
+			return fmt.Errorf("%w: %s %s", ErrWriteStall, state.Condition, state.Reason)
+		}
+		if !delayed && !stopped {
+			startedAt = e.clock.Now()
+		}
+
+		wait := stallPollInterval
+		if state.Condition == StallDelayed {
+			delayed = true
+			e.metrics.stallDelayedWrites.Add(1)
+			wait = writeSlowdownDelay
+		} else if !stopped {
+			stopped = true
+			e.metrics.stallStoppedWrites.Add(1)
+		}
+		// 确保后台任务正在追赶
+		if state.Reason == StallReasonImmutableMemTables {
+			e.requestFlush()
+		} else {
+			e.requestCompaction()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-e.doneCh:
+			timer.Stop()
+			return ErrClosed
+		case <-wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+		if err := e.backgroundError(); err != nil {
+			return err
+		}
+	}
+}
+
+// stallWakeCh 返回在后台任务推进后会被关闭的通知通道
+func (e *Engine) stallWakeCh() <-chan struct{} {
+	e.stallMu.Lock()
+	defer e.stallMu.Unlock()
+	if e.stallWake == nil {
+		e.stallWake = make(chan struct{})
+	}
+	return e.stallWake
+}
+
+// notifyStallWaiters 唤醒所有等待节流解除的写入
+func (e *Engine) notifyStallWaiters() {
+	e.stallMu.Lock()
+	defer e.stallMu.Unlock()
+	if e.stallWake != nil {
+		close(e.stallWake)
+		e.stallWake = nil
+	}
+}
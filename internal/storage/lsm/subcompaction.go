@@ -0,0 +1,103 @@
+package lsm
+
+import (
+	"bytes"
+	"context"
+	"sort"
+)
+
+// subcompactionRanges 按输入数据量把合并切分为互不重叠的键范围，范围数不超过 MaxSubcompactions。
+// 切分点取自输入文件的数据块首键，同一用户键的所有版本总是落在同一范围内。
+func (e *Engine) subcompactionRanges(inputs []tableMeta) ([]keyBounds, error) {
+	var total int64
+	for _, meta := range inputs {
+		total += meta.Size
+	}
+	n := min(int64(e.opts.MaxSubcompactions), total/e.opts.SubcompactionMinBytes)
+	if n <= 1 {
+		return []keyBounds{{}}, nil
+	}
+
+	// 收集所有输入数据块的首键及大小，按键排序后按累计大小均分
+	type blockSample struct {
+		key  []byte
+		size int64
+	}
+	samples := make([]blockSample, 0)
+	var sampled int64
+	for _, meta := range inputs {
+		if err := e.badTableError(meta.FileNum); err != nil {
+			return nil, err
+		}
+		reader, err := e.tables.Open(meta)
+		if err != nil {
+			return nil, e.tableError(meta, "open compaction input", err)
+		}
+		for _, block := range reader.IndexEntries() {
+			samples = append(samples, blockSample{key: block.FirstKey, size: int64(block.Handle.Length)})
+			sampled += int64(block.Handle.Length)
+		}
+		if err := reader.Close(); err != nil {
+			return nil, wrapSSTableCorrupt("close compaction input", err)
+		}
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return bytes.Compare(samples[i].key, samples[j].key) < 0
+	})
+
+	ranges := make([]keyBounds, 0, n)
+	var lower []byte
+	var acc int64
+	for _, sample := range samples {
+		target := sampled * int64(len(ranges)+1) / n
+		if acc >= target && len(ranges) < int(n)-1 && (lower == nil || bytes.Compare(sample.key, lower) > 0) {
+			ranges = append(ranges, keyBounds{Lower: lower, Upper: sample.key})
+			lower = sample.key
+		}
+		acc += sample.size
+	}
+	return append(ranges, keyBounds{Lower: lower}), nil
+}
+
+// runSubcompaction 读取所有输入在 bounds 内的条目，合并后构建一个输出文件；范围内没有存活条目时返回零值元数据。
+// 同时返回合并中被丢弃的值指针所对应的 Blob 失效统计。
+func (e *Engine) runSubcompaction(ctx context.Context, inputs []tableMeta, bounds keyBounds, outputLevel int) (tableMeta, []blobGarbage, error) {
+	entries := make([]entry, 0)
+	for _, meta := range inputs {
+		if (len(bounds.Upper) > 0 && bytes.Compare(meta.Smallest, bounds.Upper) >= 0) ||
+			(len(bounds.Lower) > 0 && bytes.Compare(meta.Largest, bounds.Lower) < 0) {
+			continue
+		}
+		if err := e.badTableError(meta.FileNum); err != nil {
+			return tableMeta{}, nil, err
+		}
+		reader, err := e.tables.Open(meta)
+		if err != nil {
+			return tableMeta{}, nil, e.tableError(meta, "open compaction input", err)
+		}
+		tableEntries, err := reader.EntriesInRange(bounds)
+		closeErr := reader.Close()
+		if err != nil {
+			return tableMeta{}, nil, e.tableError(meta, "read compaction input", err)
+		}
+		if closeErr != nil {
+			return tableMeta{}, nil, wrapSSTableCorrupt("close compaction input", closeErr)
+		}
+		entries = append(entries, tableEntries...)
+	}
+
+	// 合并条目，去重并保留最新可见版本
+	merged, err := mergeVisibleEntries(entries)
+	if err != nil {
+		return tableMeta{}, nil, err
+	}
+	garbage, err := droppedBlobValues(entries, merged)
+	if err != nil || len(merged) == 0 {
+		return tableMeta{}, garbage, err
+	}
+	meta, err := e.tables.Build(ctx, e.allocateFileNum(), outputLevel, merged)
+	if err != nil {
+		return tableMeta{}, nil, wrapSSTableCorrupt("build compaction output", err)
+	}
+	return meta, garbage, nil
+}
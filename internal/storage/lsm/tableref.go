@@ -0,0 +1,71 @@
+package lsm
+
+import "errors"
+
+// pinTables 在同一临界区内读取当前版本并为 pick 选中的文件增加引用计数，
+// 这样合并发布新版本后，读者仍在使用的旧文件会推迟到最后一次 unpinTables 时才删除
+func (e *Engine) pinTables(pick func() []tableMeta) []tableMeta {
+	e.tableRefMu.Lock()
+	defer e.tableRefMu.Unlock()
+	files := pick()
+	if len(files) == 0 {
+		return nil
+	}
+	if e.tableRefs == nil {
+		e.tableRefs = make(map[uint64]int)
+	}
+	for _, meta := range files {
+		e.tableRefs[meta.FileNum]++
+	}
+	return files
+}
+
+// unpinTables 释放 pinTables 的引用，删除已过期且不再被引用的文件
+// 删除发生在读路径上，失败时按合并删除失败处理，记为后台错误
+func (e *Engine) unpinTables(files []tableMeta) {
+	var ready []uint64
+	e.tableRefMu.Lock()
+	for _, meta := range files {
+		e.tableRefs[meta.FileNum]--
+		if e.tableRefs[meta.FileNum] > 0 {
+			continue
+		}
+		delete(e.tableRefs, meta.FileNum)
+		if _, ok := e.obsoleteTables[meta.FileNum]; ok {
+			delete(e.obsoleteTables, meta.FileNum)
+			ready = append(ready, meta.FileNum)
+		}
+	}
+	e.tableRefMu.Unlock()
+	e.setBackgroundError(e.deleteTables(ready))
+}
+
+// removeTables 删除已从版本中移除的 SSTable 文件，仍被读者引用的文件标记为过期，
+// 由最后一个读者释放时删除；立即删除的错误合并返回
+func (e *Engine) removeTables(fileNums []uint64) error {
+	var ready []uint64
+	e.tableRefMu.Lock()
+	for _, fileNum := range fileNums {
+		if e.tableRefs[fileNum] > 0 {
+			if e.obsoleteTables == nil {
+				e.obsoleteTables = make(map[uint64]struct{})
+			}
+			e.obsoleteTables[fileNum] = struct{}{}
+			continue
+		}
+		ready = append(ready, fileNum)
+	}
+	e.tableRefMu.Unlock()
+	return e.deleteTables(ready)
+}
+
+// deleteTables 在不持有任何锁的情况下删除文件，收集所有错误并合并返回
+func (e *Engine) deleteTables(fileNums []uint64) error {
+	var err error
+	for _, fileNum := range fileNums {
+		if removeErr := e.tables.Remove(fileNum); removeErr != nil {
+			err = errors.Join(err, wrapSSTableCorrupt("remove obsolete table", removeErr))
+		}
+	}
+	return err
+}
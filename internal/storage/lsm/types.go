@@ -2,13 +2,15 @@ package lsm
 
 // 写入后是否立即刷盘
 type WriteOptions struct {
-    Sync bool
+    Sync       bool
+    NoSlowdown bool // 遇到写入节流时立即返回 ErrWriteStall 而不是等待
 }
 
 // 迭代器范围
 type IterOptions struct {
-    LowerBound []byte
-    UpperBound []byte
+    LowerBound   []byte
+    UpperBound   []byte
+    ColumnFamily *ColumnFamily // 为 nil 时遍历默认列族
 }
 
 // 操作类型
@@ -21,9 +23,10 @@ const (
 
 // 单次操作
 type WriteOp struct {
-    Type  OpType
-    Key   []byte
-    Value []byte
+    Type   OpType
+    Key    []byte
+    Value  []byte
+    Family *ColumnFamily // 为 nil 时写入默认列族
 }
 
 // 批量操作容器
@@ -48,6 +51,25 @@ func (b *WriteBatch) Delete(key []byte) {
     })
 }
 
+// 将键值附加到批次末尾，写入指定列族
+func (b *WriteBatch) PutCF(cf *ColumnFamily, key, value []byte) {
+    b.Ops = append(b.Ops, WriteOp{
+        Type:   OpPut,
+        Key:    cloneBytes(key),
+        Value:  cloneBytes(value),
+        Family: cf,
+    })
+}
+
+// 删除指定列族中的键
+func (b *WriteBatch) DeleteCF(cf *ColumnFamily, key []byte) {
+    b.Ops = append(b.Ops, WriteOp{
+        Type:   OpDelete,
+        Key:    cloneBytes(key),
+        Family: cf,
+    })
+}
+
 // 返回当前操作数量
 func (b *WriteBatch) Len() int {
     if b == nil {
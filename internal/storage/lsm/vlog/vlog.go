@@ -0,0 +1,213 @@
+package vlog
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"mini-kv/internal/storage/lsm/record"
+)
+
+const (
+	blobMagic   = "MKVBLOB1"  // Blob 文件头部魔数
+	filePattern = "%06d.blob" // Blob 文件名模板
+)
+
+var (
+	ErrCorrupt    = errors.New("vlog: corrupt blob")      // Blob 文件或指针损坏
+	ErrBadPointer = errors.New("vlog: bad value pointer") // 值指针编码无效
+)
+
+// Pointer 指向 Blob 文件中的一条记录，LSM 中只保存其编码
+type Pointer struct {
+	FileNum uint64 // Blob 文件编号
+	Offset  uint64 // 记录帧在文件中的起始偏移
+	Size    uint32 // 记录帧的总字节数
+}
+
+// Encode 将指针编码为变长字节串
+func (p Pointer) Encode() []byte {
+	out := make([]byte, 0, 3*binary.MaxVarintLen64)
+	out = binary.AppendUvarint(out, p.FileNum)
+	out = binary.AppendUvarint(out, p.Offset)
+	out = binary.AppendUvarint(out, uint64(p.Size))
+	return out
+}
+
+// DecodePointer 解码 Pointer.Encode 生成的字节串
+func DecodePointer(data []byte) (Pointer, error) {
+	var p Pointer
+	var size uint64
+	for _, field := range []*uint64{&p.FileNum, &p.Offset, &size} {
+		value, n := binary.Uvarint(data)
+		if n <= 0 {
+			return Pointer{}, ErrBadPointer
+		}
+		*field = value
+		data = data[n:]
+	}
+	if len(data) != 0 || size > uint64(^uint32(0)) {
+		return Pointer{}, ErrBadPointer
+	}
+	p.Size = uint32(size)
+	return p, nil
+}
+
+// FileName 根据文件编号返回 Blob 文件名
+func FileName(fileNum uint64) string {
+	return fmt.Sprintf(filePattern, fileNum)
+}
+
+// Remove 删除指定编号的 Blob 文件，文件不存在视为成功
+func Remove(dir string, fileNum uint64) error {
+	err := os.Remove(filepath.Join(dir, FileName(fileNum)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Writer 顺序追加键值记录到新的 Blob 文件
+type Writer struct {
+	file    *os.File
+	path    string
+	fileNum uint64
+	offset  uint64 // 已写入的字节数
+	count   int    // 已写入的记录数
+}
+
+// Create 创建新的 Blob 文件并写入文件头
+func Create(dir string, fileNum uint64) (*Writer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create blob dir: %w", err)
+	}
+	path := filepath.Join(dir, FileName(fileNum))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("create blob file: %w", err)
+	}
+	if _, err := file.Write([]byte(blobMagic)); err != nil {
+		_ = file.Close()
+		_ = os.Remove(path)
+		return nil, fmt.Errorf("write blob header: %w", err)
+	}
+	return &Writer{file: file, path: path, fileNum: fileNum, offset: uint64(len(blobMagic))}, nil
+}
+
+// Add 追加一条记录并返回指向它的指针；记录中保存键，便于垃圾回收判断存活
+func (w *Writer) Add(key, value []byte) (Pointer, error) {
+	payload := binary.AppendUvarint(make([]byte, 0, binary.MaxVarintLen32+len(key)+len(value)), uint64(len(key)))
+	payload = append(payload, key...)
+	payload = append(payload, value...)
+	frame := record.EncodeFrame(payload)
+	if _, err := w.file.Write(frame); err != nil {
+		return Pointer{}, fmt.Errorf("write blob record: %w", err)
+	}
+	ptr := Pointer{FileNum: w.fileNum, Offset: w.offset, Size: uint32(len(frame))}
+	w.offset += uint64(len(frame))
+	w.count++
+	return ptr, nil
+}
+
+// Finish 同步并关闭文件，返回文件总字节数和记录数
+func (w *Writer) Finish() (int64, int, error) {
+	if err := w.file.Sync(); err != nil {
+		_ = w.file.Close()
+		return 0, 0, fmt.Errorf("sync blob file: %w", err)
+	}
+	if err := w.file.Close(); err != nil {
+		return 0, 0, fmt.Errorf("close blob file: %w", err)
+	}
+	return int64(w.offset), w.count, nil
+}
+
+// Abort 关闭并删除未完成的文件
+func (w *Writer) Abort() error {
+	return errors.Join(w.file.Close(), os.Remove(w.path))
+}
+
+// Reader 按指针随机读取或顺序遍历一个 Blob 文件
+type Reader struct {
+	file    *os.File
+	fileNum uint64
+}
+
+// Open 打开指定编号的 Blob 文件
+func Open(dir string, fileNum uint64) (*Reader, error) {
+	file, err := os.Open(filepath.Join(dir, FileName(fileNum)))
+	if err != nil {
+		return nil, fmt.Errorf("open blob file: %w", err)
+	}
+	header := make([]byte, len(blobMagic))
+	if _, err := io.ReadFull(file, header); err != nil || string(header) != blobMagic {
+		_ = file.Close()
+		return nil, fmt.Errorf("%w: bad header in %s", ErrCorrupt, FileName(fileNum))
+	}
+	return &Reader{file: file, fileNum: fileNum}, nil
+}
+
+// Read 读取指针指向的记录，校验校验和与键
+func (r *Reader) Read(ptr Pointer, key []byte) ([]byte, error) {
+	if ptr.FileNum != r.fileNum {
+		return nil, fmt.Errorf("%w: pointer to file %d read from %d", ErrBadPointer, ptr.FileNum, r.fileNum)
+	}
+	frame := make([]byte, ptr.Size)
+	if _, err := r.file.ReadAt(frame, int64(ptr.Offset)); err != nil {
+		return nil, fmt.Errorf("%w: read record at %d: %w", ErrCorrupt, ptr.Offset, err)
+	}
+	recordKey, value, _, err := decodeRecord(frame)
+	if err != nil {
+		return nil, fmt.Errorf("record at %d: %w", ptr.Offset, err)
+	}
+	if string(recordKey) != string(key) {
+		return nil, fmt.Errorf("%w: key mismatch at %d", ErrCorrupt, ptr.Offset)
+	}
+	return value, nil
+}
+
+// Iterate 按写入顺序遍历全部记录
+func (r *Reader) Iterate(fn func(ptr Pointer, key, value []byte) error) error {
+	info, err := r.file.Stat()
+	if err != nil {
+		return fmt.Errorf("stat blob file: %w", err)
+	}
+	data := make([]byte, info.Size())
+	if _, err := r.file.ReadAt(data, 0); err != nil {
+		return fmt.Errorf("read blob file: %w", err)
+	}
+	offset := len(blobMagic)
+	for offset < len(data) {
+		key, value, consumed, err := decodeRecord(data[offset:])
+		if err != nil {
+			return fmt.Errorf("record at %d: %w", offset, err)
+		}
+		ptr := Pointer{FileNum: r.fileNum, Offset: uint64(offset), Size: uint32(consumed)}
+		if err := fn(ptr, key, value); err != nil {
+			return err
+		}
+		offset += consumed
+	}
+	return nil
+}
+
+// Close 关闭文件句柄
+func (r *Reader) Close() error {
+	return r.file.Close()
+}
+
+// decodeRecord 解码一条记录帧，返回键、值和帧长度
+func decodeRecord(data []byte) ([]byte, []byte, int, error) {
+	payload, consumed, err := record.DecodeFrame(data)
+	if err != nil {
+		return nil, nil, 0, errors.Join(ErrCorrupt, err)
+	}
+	keyLen, n := binary.Uvarint(payload)
+	if n <= 0 || uint64(len(payload)-n) < keyLen {
+		return nil, nil, 0, fmt.Errorf("%w: bad key length", ErrCorrupt)
+	}
+	key := payload[n : n+int(keyLen)]
+	return key, payload[n+int(keyLen):], consumed, nil
+}
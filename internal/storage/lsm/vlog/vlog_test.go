@@ -0,0 +1,98 @@
+package vlog
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriterReaderRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	writer, err := Create(dir, 7)
+	if err != nil {
+		t.Fatalf("Create error = %v", err)
+	}
+	first, err := writer.Add([]byte("a"), []byte("value-a"))
+	if err != nil {
+		t.Fatalf("Add(a) error = %v", err)
+	}
+	second, err := writer.Add([]byte("b"), []byte("value-b"))
+	if err != nil {
+		t.Fatalf("Add(b) error = %v", err)
+	}
+	size, count, err := writer.Finish()
+	if err != nil {
+		t.Fatalf("Finish error = %v", err)
+	}
+	if count != 2 || size != int64(second.Offset)+int64(second.Size) {
+		t.Fatalf("Finish = (%d, %d), want size %d count 2", size, count, int64(second.Offset)+int64(second.Size))
+	}
+
+	decoded, err := DecodePointer(second.Encode())
+	if err != nil || decoded != second {
+		t.Fatalf("DecodePointer = (%+v, %v), want %+v", decoded, err, second)
+	}
+	if _, err := DecodePointer(append(second.Encode(), 0)); !errors.Is(err, ErrBadPointer) {
+		t.Fatalf("DecodePointer trailing byte error = %v, want ErrBadPointer", err)
+	}
+
+	reader, err := Open(dir, 7)
+	if err != nil {
+		t.Fatalf("Open error = %v", err)
+	}
+	defer func() { _ = reader.Close() }()
+	value, err := reader.Read(first, []byte("a"))
+	if err != nil || string(value) != "value-a" {
+		t.Fatalf("Read(a) = (%q, %v), want value-a", value, err)
+	}
+	if _, err := reader.Read(first, []byte("b")); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("Read with wrong key error = %v, want ErrCorrupt", err)
+	}
+
+	var keys []string
+	err = reader.Iterate(func(ptr Pointer, key, value []byte) error {
+		keys = append(keys, string(key))
+		if ptr != first && ptr != second {
+			t.Fatalf("Iterate pointer = %+v, want one of the written pointers", ptr)
+		}
+		return nil
+	})
+	if err != nil || len(keys) != 2 || keys[0] != "a" || keys[1] != "b" {
+		t.Fatalf("Iterate = (%v, %v), want [a b]", keys, err)
+	}
+}
+
+func TestReaderDetectsCorruptRecord(t *testing.T) {
+	dir := t.TempDir()
+	writer, err := Create(dir, 1)
+	if err != nil {
+		t.Fatalf("Create error = %v", err)
+	}
+	ptr, err := writer.Add([]byte("k"), []byte("payload"))
+	if err != nil {
+		t.Fatalf("Add error = %v", err)
+	}
+	if _, _, err := writer.Finish(); err != nil {
+		t.Fatalf("Finish error = %v", err)
+	}
+
+	path := filepath.Join(dir, FileName(1))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile error = %v", err)
+	}
+	data[len(data)-1] ^= 0xff
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("WriteFile error = %v", err)
+	}
+
+	reader, err := Open(dir, 1)
+	if err != nil {
+		t.Fatalf("Open error = %v", err)
+	}
+	defer func() { _ = reader.Close() }()
+	if _, err := reader.Read(ptr, []byte("k")); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("Read corrupt record error = %v, want ErrCorrupt", err)
+	}
+}
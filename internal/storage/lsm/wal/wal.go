@@ -112,6 +112,20 @@ func (s *Store) Append(batch record.Batch, syncWrite bool) error {
 	return nil
 }
 
+// Sync 将当前段文件已写入的数据强制落盘
+func (s *Store) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return os.ErrClosed
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("sync wal segment: %w", err)
+	}
+	return nil
+}
+
 // Replay 回放所有 WAL 段文件，对每个批次调用 fn 进行恢复（通常写入 MemTable）
 func (s *Store) Replay(fn func(record.Batch) error) error {
 	s.mu.Lock()
@@ -230,6 +244,68 @@ func replaySegment(path string, isTail bool, fn func(record.Batch) error) error
 	return nil
 }
 
+// SalvageResult 描述一个段文件的修复结果
+type SalvageResult struct {
+	Path    string // 段文件路径
+	Batches int    // 保留的完整批次数
+	Kept    int64  // 保留的字节数
+	Dropped int64  // 截断丢弃的字节数
+	Err     error  // 导致截断的解码错误，未截断时为 nil
+}
+
+// Segments 返回目录下所有 WAL 段文件路径，按编号升序
+func Segments(dir string) ([]string, error) {
+	segments, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		paths = append(paths, segment.path)
+	}
+	return paths, nil
+}
+
+// Salvage 离线修复目录下的全部段文件：每个段保留第一个无法解码的帧之前的批次并截断其余部分，
+// 之后的段仍然保留；fn 非空时对每个保留的批次调用
+func Salvage(dir string, fn func(record.Batch) error) ([]SalvageResult, error) {
+	segments, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]SalvageResult, 0, len(segments))
+	for _, segment := range segments {
+		data, err := os.ReadFile(segment.path)
+		if err != nil {
+			return results, fmt.Errorf("read wal segment: %w", err)
+		}
+		result := SalvageResult{Path: segment.path}
+		offset := 0
+		for offset < len(data) {
+			batch, consumed, err := record.DecodeBatchFrame(data[offset:])
+			if err != nil {
+				result.Err = err
+				break
+			}
+			if fn != nil {
+				if err := fn(batch); err != nil {
+					return results, err
+				}
+			}
+			result.Batches++
+			offset += consumed
+		}
+		result.Kept, result.Dropped = int64(offset), int64(len(data)-offset)
+		if result.Dropped > 0 {
+			if err := os.Truncate(segment.path, int64(offset)); err != nil {
+				return results, fmt.Errorf("truncate wal segment: %w", err)
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
 // maxSegmentSeq 返回指定段文件中所有条目的最大序列号
 func maxSegmentSeq(path string) (uint64, error) {
 	data, err := os.ReadFile(path)
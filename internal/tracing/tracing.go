@@ -0,0 +1,117 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"mini-kv/internal/config"
+)
+
+const serviceName = "mini-kv"
+
+// Provider owns the tracer provider installed by Setup.
+type Provider struct {
+	provider *sdktrace.TracerProvider
+	memory   *tracetest.InMemoryExporter
+}
+
+// Setup installs a global tracer provider and W3C trace context propagation
+// for the configured exporter. With exporter "none" the global no-op provider
+// stays in place and instrumented code pays almost nothing.
+func Setup(ctx context.Context, cfg config.TracingConfig, nodeID string) (*Provider, error) {
+	var exporter sdktrace.SpanExporter
+	var memory *tracetest.InMemoryExporter
+	switch cfg.Exporter {
+	case "", "none":
+		return &Provider{}, nil
+	case "stdout":
+		var err error
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, fmt.Errorf("create stdout trace exporter: %w", err)
+		}
+	case "otlp":
+		opts := []otlptracegrpc.Option{}
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		var err error
+		exporter, err = otlptracegrpc.New(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("create otlp trace exporter: %w", err)
+		}
+	case "memory":
+		memory = tracetest.NewInMemoryExporter()
+		exporter = memory
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", cfg.Exporter)
+	}
+
+	spanProcessor := sdktrace.WithBatcher(exporter)
+	if memory != nil {
+		spanProcessor = sdktrace.WithSyncer(exporter)
+	}
+	ratio := cfg.SampleRatio
+	if ratio <= 0 {
+		ratio = 1
+	}
+	provider := sdktrace.NewTracerProvider(
+		spanProcessor,
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewSchemaless(
+			semconv.ServiceName(serviceName),
+			attribute.String("mini_kv.node", nodeID),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return &Provider{provider: provider, memory: memory}, nil
+}
+
+// Shutdown flushes pending spans and stops the exporter.
+func (p *Provider) Shutdown(ctx context.Context) error {
+	if p == nil || p.provider == nil {
+		return nil
+	}
+	return p.provider.Shutdown(ctx)
+}
+
+// Spans returns the spans recorded by the "memory" exporter.
+func (p *Provider) Spans() tracetest.SpanStubs {
+	if p == nil || p.memory == nil {
+		return nil
+	}
+	return p.memory.GetSpans()
+}
+
+// Reset drops the spans recorded by the "memory" exporter.
+func (p *Provider) Reset() {
+	if p != nil && p.memory != nil {
+		p.memory.Reset()
+	}
+}
+
+// EndSpan records err on span, if any, and ends it.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
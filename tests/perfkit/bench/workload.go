@@ -68,7 +68,7 @@ func NewWorkload(cfg Config) (Workload, error) {
 		return nil, fmt.Errorf("operation percentages must sum to 100, got %d", total)
 	}
 
-	base := workloadBase{
+	base := &workloadBase{
 		cfg:    cfg,
 		random: rand.New(rand.NewSource(cfg.Seed)),
 		value:  makeValue(cfg.ValueSize),
@@ -119,7 +119,7 @@ func (w *workloadBase) operation() Operation {
 }
 
 type uniformWorkload struct {
-	base workloadBase
+	base *workloadBase
 }
 
 func (w *uniformWorkload) Next() Request {
@@ -130,7 +130,7 @@ func (w *uniformWorkload) Next() Request {
 }
 
 type zipfianWorkload struct {
-	base workloadBase
+	base *workloadBase
 	zipf *rand.Zipf
 }
 
@@ -142,7 +142,7 @@ func (w *zipfianWorkload) Next() Request {
 }
 
 type sequentialWorkload struct {
-	base workloadBase
+	base *workloadBase
 	next int
 }
 